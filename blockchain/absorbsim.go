@@ -0,0 +1,149 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math/big"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/wire"
+)
+
+// AbsorptionSimBlock is a block replayed by an AbsorptionSimulator.
+type AbsorptionSimBlock struct {
+	// Header is the header of the block, which provides its price, version
+	// and timestamp.  It does not need to connect to the previous block.
+	Header wire.BlockHeader
+
+	// MinerKey identifies the miner of the block for the median price
+	// rules which aggregate the prices per miner.  The key is recovered
+	// from the header signature when it is nil.
+	MinerKey []byte
+
+	// SupplyChange is the STB supply change of the block besides its
+	// absorption, which is nil for none.
+	SupplyChange *big.Int
+}
+
+// AbsorptionSimResult describes how a block replayed by an AbsorptionSimulator
+// absorbed the STB supply.
+type AbsorptionSimResult struct {
+	Height int32 // The height of the block.
+	Price  Price // The price carried by the block header.
+
+	// MedianPrice is the median price of the epoch ending at the block, or
+	// NoPrice when the blocks do not provide enough prices.
+	MedianPrice Price
+
+	// Rate is the absorption rate triggered by the block, or NoPrice when
+	// the block does not trigger an absorption.
+	Rate Price
+
+	// Absorption is the amount of STB the block must absorb, which is
+	// negative when the STB supply contracts, or nil when the block does
+	// not absorb.
+	Absorption *big.Int
+
+	// TotalSupply is the total supply of STB after the block, assuming it
+	// fully absorbed its absorption.
+	TotalSupply *big.Int
+}
+
+// AbsorptionSimulator replays the absorption rules of the consensus over a
+// series of blocks, such as historical blocks replayed with different chain
+// parameters, or synthetic ones.  The rules are the ones the chain applies to
+// the blocks it connects, so the simulated absorptions are the ones a chain
+// with the same parameters and blocks would require.
+//
+// The simulator is NOT safe for concurrent access.
+type AbsorptionSimulator struct {
+	chain       *BlockChain
+	totalSupply *big.Int
+}
+
+// NewAbsorptionSimulator returns a simulator of the absorption rules of the
+// passed chain parameters, starting after their genesis block with the passed
+// total supply of STB.
+func NewAbsorptionSimulator(params *chaincfg.Params, genesisSupply *big.Int) *AbsorptionSimulator {
+	// The chain only holds the block nodes the absorption rules look up,
+	// so it has neither a database nor a block index.
+	node := newBlockNode(&params.GenesisBlock.Header, nil)
+	node.absorption = calcAbsorptionState(node, NoPrice, params)
+	chain := &BlockChain{
+		chainParams:      params,
+		bestChain:        newChainView(node),
+		warningCaches:    newThresholdCaches(vbNumBits),
+		deploymentCaches: newThresholdCaches(chaincfg.DefinedDeployments),
+	}
+	return &AbsorptionSimulator{
+		chain:       chain,
+		totalSupply: new(big.Int).Set(genesisSupply),
+	}
+}
+
+// Height returns the height of the last replayed block, which is zero for the
+// genesis block.
+func (s *AbsorptionSimulator) Height() int32 {
+	return s.chain.bestChain.Height()
+}
+
+// NextAbsorption returns the amount of STB the next replayed block must
+// absorb, or nil when it does not absorb.
+func (s *AbsorptionSimulator) NextAbsorption() (*big.Int, error) {
+	return s.chain.calcAbsorptionAfter(s.chain.bestChain.Tip(), s.totalSupply)
+}
+
+// ConnectBlock replays the passed block after the last replayed one, assuming
+// it fully absorbs the STB it must absorb, and returns how it absorbed the
+// STB supply.
+func (s *AbsorptionSimulator) ConnectBlock(block *AbsorptionSimBlock) (*AbsorptionSimResult, error) {
+	b := s.chain
+	tip := b.bestChain.Tip()
+	absorption, err := b.calcAbsorptionAfter(tip, s.totalSupply)
+	if err != nil {
+		return nil, err
+	}
+
+	node := newBlockNode(&block.Header, tip)
+	if block.MinerKey != nil {
+		node.minerKeyOnce.Do(func() {
+			node.minerKey = block.MinerKey
+		})
+	}
+	supplyChange := new(big.Int)
+	if absorption != nil {
+		supplyChange.Add(supplyChange, absorption)
+	}
+	if block.SupplyChange != nil {
+		supplyChange.Add(supplyChange, block.SupplyChange)
+	}
+	node.supplyChange = supplyChange
+
+	// Connect the node the way connectBlock does, without the block index
+	// since none of the absorption rules look it up.
+	rate, err := b.checkNewAbsorptionRate(node)
+	if err != nil {
+		return nil, err
+	}
+	if rate != NoPrice {
+		node.status |= statusAbsorption
+	}
+	node.absorption = calcAbsorptionState(node, rate, b.chainParams)
+	b.bestChain.SetTip(node)
+	s.totalSupply = new(big.Int).Add(s.totalSupply, supplyChange)
+
+	medianPrice, err := b.calcBlockMedianPrice(node)
+	if err != nil {
+		return nil, err
+	}
+	return &AbsorptionSimResult{
+		Height:      node.height,
+		Price:       headerPrice(node.priceDerivation, node.height, b.chainParams),
+		MedianPrice: medianPrice,
+		Rate:        rate,
+		Absorption:  absorption,
+		TotalSupply: new(big.Int).Set(s.totalSupply),
+	}, nil
+}
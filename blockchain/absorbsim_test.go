@@ -0,0 +1,101 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/wire"
+)
+
+// TestAbsorptionSimulator ensures the simulator triggers the absorptions and
+// absorbs the supply the way the chain does.
+func TestAbsorptionSimulator(t *testing.T) {
+	t.Parallel()
+
+	params := chaincfg.RegressionNetParams
+	params.BlockPerTimespan = 4
+
+	// Every block carries a price of 0.5 while the genesis block carries a
+	// price of zero, so the third block triggers a passive absorption at
+	// 0.375 of the supply of 1000, absorbed over the next 4 blocks, then
+	// the seventh block triggers another one at 0.5 of the supply.
+	tests := []struct {
+		rate       Price
+		absorption int64 // -1 for none
+		supply     int64
+	}{
+		{NoPrice, -1, 1000},
+		{NoPrice, -1, 1000},
+		{375000000, -1, 1000},
+		{NoPrice, 93, 1093},
+		{NoPrice, 94, 1187},
+		{NoPrice, 94, 1281},
+		{500000000, 94, 1375},
+		{NoPrice, 171, 1546},
+	}
+
+	sim := NewAbsorptionSimulator(&params, big.NewInt(1000))
+	timestamp := params.GenesisBlock.Header.Timestamp
+	for i, test := range tests {
+		timestamp = timestamp.Add(time.Second)
+		result, err := sim.ConnectBlock(&AbsorptionSimBlock{
+			Header: wire.BlockHeader{
+				Version:         1,
+				Timestamp:       timestamp,
+				PriceDerivation: int64(PriceUnit / 2),
+			},
+		})
+		if err != nil {
+			t.Fatalf("block %d: unexpected error: %v", i+1, err)
+		}
+
+		wantAbsorption := "<nil>"
+		if test.absorption >= 0 {
+			wantAbsorption = big.NewInt(test.absorption).String()
+		}
+		if result.Height != int32(i+1) || result.Rate != test.rate ||
+			result.Absorption.String() != wantAbsorption ||
+			result.TotalSupply.Int64() != test.supply {
+
+			t.Fatalf("block %d: got height %d, rate %d, absorption %v, "+
+				"supply %v, want rate %d, absorption %s, supply %d",
+				i+1, result.Height, result.Rate, result.Absorption,
+				result.TotalSupply, test.rate, wantAbsorption,
+				test.supply)
+		}
+	}
+
+	// The rest of the second absorption is spread over its 3 remaining
+	// blocks.
+	next, err := sim.NextAbsorption()
+	if err != nil || next == nil || next.Int64() != 172 {
+		t.Fatalf("NextAbsorption: got %v, %v, want 172", next, err)
+	}
+
+	// The supply changes besides the absorption are absorbed too.
+	result, err := sim.ConnectBlock(&AbsorptionSimBlock{
+		Header: wire.BlockHeader{
+			Version:         1,
+			Timestamp:       timestamp.Add(time.Second),
+			PriceDerivation: int64(NoPrice),
+		},
+		SupplyChange: big.NewInt(-46),
+	})
+	if err != nil {
+		t.Fatalf("ConnectBlock: unexpected error: %v", err)
+	}
+	if result.Price != NoPrice || result.TotalSupply.Int64() != 1672 {
+		t.Fatalf("ConnectBlock: got price %d, supply %v, want no price, "+
+			"supply 1672", result.Price, result.TotalSupply)
+	}
+	next, err = sim.NextAbsorption()
+	if err != nil || next == nil || next.Int64() != 195 {
+		t.Fatalf("NextAbsorption: got %v, %v, want 195", next, err)
+	}
+}
@@ -7,8 +7,14 @@ package blockchain
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"math/big"
+	"sort"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/database"
 )
 
 var (
@@ -16,8 +22,336 @@ var (
 	BigZero = big.Int{}
 )
 
+// absorptionState is the absorption state of the chain ending at a block node.
+// It is accumulated from the state of the parent when the node is connected to
+// the main chain, so the absorption lookups need not walk the chain.
+type absorptionState struct {
+	// lastAbsorption is the most recent block of the chain, up to and
+	// including the node, which triggered an absorption.  It is nil when
+	// no absorption ever occurred.
+	lastAbsorption *blockNode
+
+	// rate is the absorption rate triggered by lastAbsorption, which is
+	// the median price of its epoch.  It is NoPrice when lastAbsorption
+	// is nil.
+	rate Price
+
+	// supplySinceAbsorption is the STB supply change of the blocks after
+	// lastAbsorption, up to and including the node.
+	supplySinceAbsorption *big.Int
+
+	// priceSum and priceCount are the sum and the number of the prices of
+	// the blocks of the chain, up to and including the node.
+	priceSum   *big.Int
+	priceCount int32
+}
+
+// calcAbsorptionState returns the absorption state of the chain ending at the
+// passed node, given the state of its parent and the price, status and supply
+// change of the node itself.  The passed rate is the absorption rate triggered
+// by the node, which is only used when the node has the absorption status.
+func calcAbsorptionState(node *blockNode, rate Price, params *chaincfg.Params) absorptionState {
+	priceSum, priceCount := priceTotals(node.parent)
+	priceSum = new(big.Int).Set(priceSum)
+	price := headerPrice(node.priceDerivation, node.height, params)
+	if price != NoPrice {
+		priceSum.Add(priceSum, big.NewInt(int64(price)))
+		priceCount++
+	}
+
+	state := absorptionState{
+		rate:       NoPrice,
+		priceSum:   priceSum,
+		priceCount: priceCount,
+	}
+	if node.status.Absorption() {
+		state.lastAbsorption = node
+		state.rate = rate
+		state.supplySinceAbsorption = &BigZero
+		return state
+	}
+
+	supply := &BigZero
+	if node.parent != nil {
+		state.lastAbsorption = node.parent.absorption.lastAbsorption
+		state.rate = node.parent.absorption.rate
+		supply = node.parent.absorption.supplySinceAbsorption
+	}
+	state.supplySinceAbsorption = new(big.Int).Add(supply, node.supplyChange)
+	return state
+}
+
+// priceTotals returns the sum and the number of the prices of the chain up to
+// and including the passed node, which are zero for a nil node.
+func priceTotals(node *blockNode) (*big.Int, int32) {
+	if node == nil {
+		return &BigZero, 0
+	}
+	return node.absorption.priceSum, node.absorption.priceCount
+}
+
 // calculate the median price for the nextPrice chained after the block node.
-func calcMedianPrice(node *blockNode, epoch int32) float64 {
+// NoPrice is returned when the blocks do not provide enough prices.
+//
+// This is the mean of every price in the epoch, used until the median price
+// deployment is active.  See calcMinerMedianPrice.  It is computed from the
+// price totals of the parent of the node and of the passed epoch start, which
+// is the ancestor of the node right before the epoch, so the node itself does
+// not need to have its absorption state yet.
+func calcMedianPrice(node, epochStart *blockNode, epoch int32, params *chaincfg.Params) Price {
+	if node == nil || node.height+1 < epoch {
+		// 1 epoch must pass before the first absorption
+		return NoPrice
+	}
+
+	sum, count := priceTotals(node.parent)
+	sum = new(big.Int).Set(sum)
+	price := headerPrice(node.priceDerivation, node.height, params)
+	if price != NoPrice {
+		sum.Add(sum, big.NewInt(int64(price)))
+		count++
+	}
+	startSum, startCount := priceTotals(epochStart)
+	sum.Sub(sum, startSum)
+	count -= startCount
+
+	if count <= 0 || int64(count)*3 < int64(epoch)*2 {
+		// less than super majority, or no price at all for a network
+		// without an epoch length
+		return NoPrice
+	}
+
+	// The mean is truncated toward zero, and always fits in a Price since
+	// all of the summed prices do.
+	return Price(sum.Quo(sum, big.NewInt(int64(count))).Int64())
+}
+
+// calcMinerMedianPrice is calcMedianPrice with the prices of the epoch
+// aggregated per miner by aggregateMinerPrices, so that neither an extreme
+// price nor the number of blocks mined by a single key can move the result.
+// Blocks whose miner key cannot be recovered are ignored.
+func calcMinerMedianPrice(node *blockNode, epoch int32, params *chaincfg.Params) Price {
+	if node == nil || node.height+1 < epoch {
+		// 1 epoch must pass before the first absorption
+		return NoPrice
+	}
+	return newMinerPriceWindow(node, epoch, params).medianPrice(epoch)
+}
+
+// minerPriceWindow holds the prices of the blocks of the epoch ending at a
+// block node, grouped by the key of their miner and kept sorted.  The window of
+// the epoch ending at the next block is advanced from it with the prices of the
+// block entering the epoch and of the one leaving it, without walking the epoch.
+type minerPriceWindow struct {
+	node   *blockNode
+	count  int64
+	prices map[string][]Price
+}
+
+// newMinerPriceWindow returns the window of the epoch ending at the passed
+// node, walking every block of the epoch.
+func newMinerPriceWindow(node *blockNode, epoch int32, params *chaincfg.Params) *minerPriceWindow {
+	w := &minerPriceWindow{
+		node:   node,
+		prices: make(map[string][]Price),
+	}
+	for n := node; n != nil && node.height-n.height < epoch; n = n.parent {
+		w.add(n, params)
+	}
+	return w
+}
+
+// add adds the price of the passed block to the window, unless it has no price
+// or no miner key.
+func (w *minerPriceWindow) add(n *blockNode, params *chaincfg.Params) {
+	price := headerPrice(n.priceDerivation, n.height, params)
+	minerKey := n.MinerKey()
+	if price == NoPrice || minerKey == nil {
+		return
+	}
+
+	prices := w.prices[string(minerKey)]
+	i := sort.Search(len(prices), func(i int) bool {
+		return prices[i] >= price
+	})
+	prices = append(prices, 0)
+	copy(prices[i+1:], prices[i:])
+	prices[i] = price
+	w.prices[string(minerKey)] = prices
+	w.count++
+}
+
+// remove removes the price of the passed block, which must have been added,
+// from the window.
+func (w *minerPriceWindow) remove(n *blockNode, params *chaincfg.Params) {
+	price := headerPrice(n.priceDerivation, n.height, params)
+	minerKey := n.MinerKey()
+	if price == NoPrice || minerKey == nil {
+		return
+	}
+
+	prices := w.prices[string(minerKey)]
+	i := sort.Search(len(prices), func(i int) bool {
+		return prices[i] >= price
+	})
+	if i == len(prices) || prices[i] != price {
+		return
+	}
+	if len(prices) == 1 {
+		delete(w.prices, string(minerKey))
+	} else {
+		w.prices[string(minerKey)] = append(prices[:i], prices[i+1:]...)
+	}
+	w.count--
+}
+
+// medianPrice returns the prices of the window aggregated per miner the same
+// way as aggregateMinerPrices.  NoPrice is returned when less than two thirds
+// of the blocks of the epoch provide a price.
+func (w *minerPriceWindow) medianPrice(epoch int32) Price {
+	if w.count*3 < int64(epoch)*2 {
+		// less than super majority
+		return NoPrice
+	}
+
+	medians := make([]Price, 0, len(w.prices))
+	for _, prices := range w.prices {
+		medians = append(medians, sortedMedianPrice(prices))
+	}
+	return trimmedMeanPrice(medians)
+}
+
+// aggregateMinerPrices reduces the prices fed by each miner to the median of
+// its own prices, so every miner contributes a single value, then discards the
+// top and bottom thirds of those values and returns the mean of the rest,
+// truncated toward zero.  NoPrice is returned when there are no prices.
+func aggregateMinerPrices(minerPrices [][]Price) Price {
+	medians := make([]Price, 0, len(minerPrices))
+	for _, prices := range minerPrices {
+		if len(prices) == 0 {
+			continue
+		}
+		medians = append(medians, medianPrice(prices))
+	}
+	return trimmedMeanPrice(medians)
+}
+
+// trimmedMeanPrice discards the top and bottom thirds of the passed prices and
+// returns the mean of the rest, truncated toward zero.  NoPrice is returned
+// when there are no prices.  The passed slice is sorted in place.
+func trimmedMeanPrice(prices []Price) Price {
+	if len(prices) == 0 {
+		return NoPrice
+	}
+
+	sortPrices(prices)
+	trim := len(prices) / 3
+	return meanPrice(prices[trim : len(prices)-trim])
+}
+
+// medianPrice returns the median of the passed prices, which is the mean of
+// the two middle prices when there is an even number of them.  The passed
+// slice is not modified.
+func medianPrice(prices []Price) Price {
+	sorted := make([]Price, len(prices))
+	copy(sorted, prices)
+	sortPrices(sorted)
+	return sortedMedianPrice(sorted)
+}
+
+// sortedMedianPrice is medianPrice for prices which are already sorted in
+// increasing order.
+func sortedMedianPrice(sorted []Price) Price {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return meanPrice(sorted[mid-1 : mid+1])
+}
+
+// meanPrice returns the mean of the passed prices, truncated toward zero.
+func meanPrice(prices []Price) Price {
+	sum := new(big.Int)
+	for _, price := range prices {
+		sum.Add(sum, big.NewInt(int64(price)))
+	}
+	return Price(sum.Quo(sum, big.NewInt(int64(len(prices)))).Int64())
+}
+
+// sortPrices sorts the passed prices in increasing order.
+func sortPrices(prices []Price) {
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i] < prices[j]
+	})
+}
+
+// calcEpochPrice returns the median price of the epoch ending at the passed
+// block node, aggregated by the rules in effect for that block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) calcEpochPrice(node *blockNode, epoch int32) (Price, error) {
+	if node == nil || epoch <= 0 {
+		// no price for a network without an epoch length
+		return NoPrice, nil
+	}
+
+	state, err := b.deploymentState(node.parent, chaincfg.DeploymentMedianPrice)
+	if err != nil {
+		return NoPrice, err
+	}
+	if state == ThresholdActive {
+		if node.height+1 < epoch {
+			// 1 epoch must pass before the first absorption
+			return NoPrice, nil
+		}
+		return b.minerPriceWindow(node, epoch).medianPrice(epoch), nil
+	}
+	epochStart := b.ancestor(node, node.height-epoch)
+	return calcMedianPrice(node, epochStart, epoch, b.chainParams), nil
+}
+
+// minerPriceWindow returns the window of the miner prices of the epoch ending
+// at the passed node.  The cached window is advanced by one block when the node
+// extends it, which is the case of every block connected to the main chain, and
+// is rebuilt from the whole epoch otherwise.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) minerPriceWindow(node *blockNode, epoch int32) *minerPriceWindow {
+	w := b.minerPrices
+	switch {
+	case w != nil && w.node == node:
+
+	case w != nil && node.parent != nil && w.node == node.parent:
+		w.add(node, b.chainParams)
+		if leaving := b.ancestor(node, node.height-epoch); leaving != nil {
+			w.remove(leaving, b.chainParams)
+		}
+		w.node = node
+
+	default:
+		w = newMinerPriceWindow(node, epoch, b.chainParams)
+		b.minerPrices = w
+	}
+	return w
+}
+
+// ancestor returns the ancestor of the node at the passed height.  The part of
+// the chain shared with the best chain is looked up in the best chain view, so
+// only the blocks of a side chain after the fork point are walked.
+func (b *BlockChain) ancestor(node *blockNode, height int32) *blockNode {
+	if height < 0 || height > node.height {
+		return nil
+	}
+	if fork := b.bestChain.FindFork(node); fork != nil && height <= fork.height {
+		return b.bestChain.NodeByHeight(height)
+	}
+	return node.Ancestor(height)
+}
+
+// calcLegacyMedianPrice is calcMedianPrice for the blocks below the
+// FixedPointPriceHeight, whose absorption is computed with floating point
+// arithmetic.  NaN is returned when the blocks do not provide enough prices.
+func calcLegacyMedianPrice(node *blockNode, epoch int32) float64 {
 	if node == nil || node.height+1 < epoch {
 		// 1 epoch must pass before the first absorption
 		return math.NaN()
@@ -26,7 +360,7 @@ func calcMedianPrice(node *blockNode, epoch int32) float64 {
 	var count int
 	var sum float64
 	for n := node; n != nil && node.height-n.height < epoch; n = n.parent {
-		priceDrv := float64(n.priceDerivation)
+		priceDrv := legacyPrice(n.priceDerivation)
 		if math.IsNaN(priceDrv) {
 			continue
 		}
@@ -39,28 +373,98 @@ func calcMedianPrice(node *blockNode, epoch int32) float64 {
 		return math.NaN()
 	}
 
-	// TODO: remove bad price here, e.g. take only 2/3 of valid prices
-
 	return sum / float64(count)
 }
 
-func findLastAbsorption(node *blockNode, epoch int32) (*blockNode, *big.Int) {
-	totalSupplyChange := new(big.Int)
-	for n := node; n != nil; n = n.parent {
-		if n.status.Absorption() {
-			return n, totalSupplyChange
-		}
-		totalSupplyChange.Add(totalSupplyChange, n.supplyChange)
+// isActiveAbsorption returns whether the median price moved far enough from
+// the median price of the last absorption to trigger an active absorption,
+// which is when their ratio is at least the ActiveAbsorptionHighRatio or at
+// most the ActiveAbsorptionLowRatio of the passed chain parameters.  The
+// ratio is compared by cross multiplication so no precision is lost.
+func isActiveAbsorption(medianPrice, lastMedianPrice Price, params *chaincfg.Params) bool {
+	high, low := params.ActiveAbsorptionHighRatio, params.ActiveAbsorptionLowRatio
+	median := big.NewInt(int64(medianPrice))
+	last := big.NewInt(int64(lastMedianPrice))
+
+	// The median price scaled by the denominator of each ratio, compared
+	// with the last median price scaled by its numerator.
+	medianHigh := new(big.Int).Mul(median, high.Denom())
+	lastHigh := new(big.Int).Mul(last, high.Num())
+	medianLow := new(big.Int).Mul(median, low.Denom())
+	lastLow := new(big.Int).Mul(last, low.Num())
+
+	switch last.Sign() {
+	case 1:
+		return medianHigh.Cmp(lastHigh) >= 0 || medianLow.Cmp(lastLow) <= 0
+	case -1:
+		return medianHigh.Cmp(lastHigh) <= 0 || medianLow.Cmp(lastLow) >= 0
 	}
-	return nil, nil
+
+	// Any move away from a zero price is an infinite ratio.
+	return median.Sign() != 0
+}
+
+// isLegacyActiveAbsorption is isActiveAbsorption for the blocks below the
+// FixedPointPriceHeight, which compares the ratio of the floating point median
+// prices with the ratios of the passed chain parameters regardless of the sign
+// of the last median price.
+func isLegacyActiveAbsorption(medianPrice, lastMedianPrice float64, params *chaincfg.Params) bool {
+	high, _ := params.ActiveAbsorptionHighRatio.Float64()
+	low, _ := params.ActiveAbsorptionLowRatio.Float64()
+	priceRate := medianPrice / lastMedianPrice
+	return priceRate >= high || priceRate <= low
+}
+
+// calcAbsorption returns the amount of STB absorbed from the passed supply at
+// the passed rate, truncated toward zero.
+func calcAbsorption(supply *big.Int, rate Price) *big.Int {
+	absorption := new(big.Int).Mul(supply, big.NewInt(int64(rate)))
+	return absorption.Quo(absorption, big.NewInt(int64(PriceUnit)))
+}
+
+// calcLegacyAbsorption is calcAbsorption for the blocks below the
+// FixedPointPriceHeight, computed with floating point arithmetic.
+func calcLegacyAbsorption(supply *big.Int, rate float64) *big.Int {
+	absorption := new(big.Float).SetInt(supply)
+	absorption.Mul(absorption, big.NewFloat(rate))
+	result, _ := absorption.Int(nil)
+	return result
+}
+
+// findLastAbsorption returns the most recent absorption block of the chain
+// ending at the passed node, along with the STB supply change of the blocks
+// after it.  The node must have its absorption state, which is the case for
+// the blocks of the main chain.  Nil is returned when no absorption occurred.
+func findLastAbsorption(node *blockNode) (*blockNode, *big.Int) {
+	if node == nil || node.absorption.lastAbsorption == nil {
+		return nil, nil
+	}
+	return node.absorption.lastAbsorption, node.absorption.supplySinceAbsorption
+}
+
+// calcBlockMedianPrice returns the median price of the epoch ending at the
+// passed node of the main chain, with the arithmetic used at its height.
+// NoPrice is returned when the blocks do not provide enough prices.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) calcBlockMedianPrice(node *blockNode) (Price, error) {
+	epoch := b.chainParams.BlockPerTimespan
+	if usesFixedPointPrice(node.height, b.chainParams) {
+		return b.calcEpochPrice(node, epoch)
+	}
+	median := calcLegacyMedianPrice(node, epoch)
+	if math.IsNaN(median) {
+		return NoPrice, nil
+	}
+	return PriceFromFloat(median), nil
 }
 
 // CheckNewAbsorptionRate check if the new block will trigger a new absorptioin.
 //
 // This function is safe for concurrent access.
-func (b *BlockChain) CheckNewAbsorptionRate(node *blockNode) (float64, error) {
-	b.chainLock.RLock()
-	defer b.chainLock.RUnlock()
+func (b *BlockChain) CheckNewAbsorptionRate(node *blockNode) (Price, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
 	b.stateLock.RLock()
 	defer b.stateLock.RUnlock()
 	return b.checkNewAbsorptionRate(node)
@@ -68,51 +472,100 @@ func (b *BlockChain) CheckNewAbsorptionRate(node *blockNode) (float64, error) {
 
 // calcNextAbsorptionRate calculates the absorption for the block
 // after the end of the current best chain based on the price history.
-func (b *BlockChain) checkNewAbsorptionRate(node *blockNode) (float64, error) {
+// NoPrice is returned when the block does not trigger an absorption.
+func (b *BlockChain) checkNewAbsorptionRate(node *blockNode) (Price, error) {
 	epoch := b.chainParams.BlockPerTimespan
 	if node.height < epoch-1 {
 		// no absorption in the first epoch
-		return math.NaN(), nil
+		return NoPrice, nil
 	}
 
 	if node.parent != b.bestChain.Tip() {
-		return math.NaN(), errors.New("node does not connect to the best chain")
+		return NoPrice, errors.New("node does not connect to the best chain")
 	}
 
-	medianPrice := calcMedianPrice(node, epoch)
-	if math.IsNaN(medianPrice) {
-		return math.NaN(), nil
+	if !usesFixedPointPrice(node.height, b.chainParams) {
+		return b.checkLegacyAbsorptionRate(node)
+	}
+
+	medianPrice, err := b.calcEpochPrice(node, epoch)
+	if err != nil {
+		return NoPrice, err
+	}
+	if medianPrice == NoPrice {
+		return NoPrice, nil
 	}
 
-	absnNode, _ := findLastAbsorption(node, epoch)
+	// The node does not have its absorption state until it is connected,
+	// so the last absorption is looked up from its parent.
+	absnNode, _ := findLastAbsorption(node.parent)
 	if absnNode == nil || node.height-absnNode.height >= epoch {
 		// passive condition: 1 epoch without any active absorption
 		// or absorption never occurs
 		return medianPrice, nil
 	}
 
-	// check for active condition
-	lastAbsnNode := b.bestChain.NodeByHeight(absnNode.height)
-	lastAbsnMedianPrice := calcMedianPrice(lastAbsnNode, epoch)
-	if math.IsNaN(lastAbsnMedianPrice) {
+	// check for active condition against the rate of the last absorption,
+	// which is the median price of its epoch
+	lastAbsnMedianPrice := absnNode.absorption.rate
+	if lastAbsnMedianPrice == NoPrice {
 		// TBD: when does this happen?
 		return medianPrice, nil
 	}
 
-	priceRate := medianPrice / lastAbsnMedianPrice
-	if priceRate >= 2 || priceRate <= -0.5 {
+	if isActiveAbsorption(medianPrice, lastAbsnMedianPrice, b.chainParams) {
 		// active absorption
 		return medianPrice, nil
 	}
 
-	return math.NaN(), nil
+	return NoPrice, nil
+}
+
+// checkLegacyAbsorptionRate is checkNewAbsorptionRate for the blocks below the
+// FixedPointPriceHeight, computed with floating point arithmetic.  The rate is
+// only rounded to a Price when it is returned.
+func (b *BlockChain) checkLegacyAbsorptionRate(node *blockNode) (Price, error) {
+	epoch := b.chainParams.BlockPerTimespan
+	medianPrice := calcLegacyMedianPrice(node, epoch)
+	if math.IsNaN(medianPrice) {
+		return NoPrice, nil
+	}
+
+	absnNode, _ := findLastAbsorption(node.parent)
+	if absnNode == nil || node.height-absnNode.height >= epoch {
+		return PriceFromFloat(medianPrice), nil
+	}
+
+	lastAbsnNode := b.bestChain.NodeByHeight(absnNode.height)
+	lastAbsnMedianPrice := calcLegacyMedianPrice(lastAbsnNode, epoch)
+	if math.IsNaN(lastAbsnMedianPrice) {
+		return PriceFromFloat(medianPrice), nil
+	}
+
+	if isLegacyActiveAbsorption(medianPrice, lastAbsnMedianPrice, b.chainParams) {
+		return PriceFromFloat(medianPrice), nil
+	}
+
+	return NoPrice, nil
+}
+
+// EpochPrice returns the median price of the epoch ending at the tip of the
+// main chain, aggregated by the rules in effect for the tip, or NoPrice when
+// there is none.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) EpochPrice() (Price, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	return b.calcEpochPrice(b.bestChain.Tip(), b.chainParams.BlockPerTimespan)
 }
 
 // CalcNextAbsorption calculates the next absorption amount of STB
 // after the current best chain tip.
 func (b *BlockChain) CalcNextAbsorption() *big.Int {
-	b.chainLock.RLock()
-	defer b.chainLock.RUnlock()
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
 	b.stateLock.RLock()
 	defer b.stateLock.RUnlock()
 	return b.calcNextAbsorption()
@@ -125,32 +578,298 @@ func (b *BlockChain) calcNextAbsorption() *big.Int {
 		return nil
 	}
 
+	b.stateLock.RLock()
+	totalSupply := new(big.Int).Set(&b.stateSnapshot.TotalSupply)
+	b.stateLock.RUnlock()
+
+	absorption, err := b.calcAbsorptionAfter(tip, totalSupply)
+	if err != nil {
+		log.Errorf("Unable to calculate the absorption after block "+
+			"%v: %v", tip.hash, err)
+		return nil
+	}
+	return absorption
+}
+
+// calcAbsorptionAfter returns the amount of STB to absorb by the block after
+// the passed node of the main chain, whose total STB supply is passed.  Nil is
+// returned when the block does not absorb.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) calcAbsorptionAfter(node *blockNode, totalSupply *big.Int) (*big.Int, error) {
 	epoch := b.chainParams.BlockPerTimespan
-	absnNode, alreadyAbsorbed := findLastAbsorption(tip, epoch)
+	absnNode, alreadyAbsorbed := findLastAbsorption(node)
 	if absnNode == nil {
 		// absorption never occurs
-		return nil
+		return nil, nil
 	}
 
-	b.stateLock.RLock()
-	lastAbsnSupply := b.stateSnapshot.TotalSupply
-	b.stateLock.RUnlock()
-
-	remainBlockToAbsorb := epoch - (tip.height - absnNode.height)
+	remainBlockToAbsorb := epoch - (node.height - absnNode.height)
 	if remainBlockToAbsorb <= 0 {
 		// absorption only occurs for 1 week
-		return nil
+		return nil, nil
 	}
 
-	lastAbsnSupply.Sub(&lastAbsnSupply, alreadyAbsorbed)
-	lastAbsnRate := calcMedianPrice(absnNode, epoch)
-
-	lastAbsnFloat := new(big.Float).SetInt(&lastAbsnSupply)
-	lastAbsnFloat.Mul(lastAbsnFloat, big.NewFloat(lastAbsnRate))
-	lastAbsn, _ := lastAbsnFloat.Int(nil)
+	lastAbsn, err := b.calcLastAbsorption(node, totalSupply)
+	if err != nil {
+		return nil, err
+	}
 
 	remainAbsn := new(big.Int).Sub(lastAbsn, alreadyAbsorbed)
 	remainAbsn.Div(remainAbsn, big.NewInt(int64(remainBlockToAbsorb)))
 
-	return remainAbsn
+	return remainAbsn, nil
+}
+
+// calcLastAbsorption returns the total amount of STB to absorb by the last
+// absorption of the chain ending at the passed node of the main chain, whose
+// total STB supply is passed.  The node must have an absorption.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) calcLastAbsorption(node *blockNode, totalSupply *big.Int) (*big.Int, error) {
+	epoch := b.chainParams.BlockPerTimespan
+	absnNode, alreadyAbsorbed := findLastAbsorption(node)
+	lastAbsnSupply := new(big.Int).Sub(totalSupply, alreadyAbsorbed)
+
+	if !usesFixedPointPrice(node.height+1, b.chainParams) {
+		lastAbsnRate := calcLegacyMedianPrice(absnNode, epoch)
+		return calcLegacyAbsorption(lastAbsnSupply, lastAbsnRate), nil
+	}
+
+	return calcAbsorption(lastAbsnSupply, absnNode.absorption.rate), nil
+}
+
+// activeAbsorptionPrices returns the median prices at or beyond which an active
+// absorption is triggered, given the median price of the last absorption.  The
+// absorption is active when the median price is at most low or at least high,
+// as decided by isActiveAbsorption.  The prices are clamped to the range of the
+// valid prices.
+func activeAbsorptionPrices(lastMedianPrice Price, params *chaincfg.Params) (low, high Price) {
+	last := big.NewInt(int64(lastMedianPrice))
+	highRatio, lowRatio := params.ActiveAbsorptionHighRatio, params.ActiveAbsorptionLowRatio
+
+	switch last.Sign() {
+	case 1:
+		// median >= last*highRatio or median <= last*lowRatio
+		return clampPrice(floorRatio(last, lowRatio)),
+			clampPrice(ceilRatio(last, highRatio))
+	case -1:
+		// median <= last*highRatio or median >= last*lowRatio
+		return clampPrice(floorRatio(last, highRatio)),
+			clampPrice(ceilRatio(last, lowRatio))
+	}
+
+	// any move away from zero
+	return -1, 1
+}
+
+// floorRatio returns the passed integer multiplied by the passed ratio, rounded
+// toward negative infinity.
+func floorRatio(n *big.Int, ratio *big.Rat) *big.Int {
+	// The denominator of a big.Rat is always positive, so the Euclidean
+	// division rounds toward negative infinity.
+	result := new(big.Int).Mul(n, ratio.Num())
+	return result.Div(result, ratio.Denom())
+}
+
+// ceilRatio returns the passed integer multiplied by the passed ratio, rounded
+// toward positive infinity.
+func ceilRatio(n *big.Int, ratio *big.Rat) *big.Int {
+	result := floorRatio(new(big.Int).Neg(n), ratio)
+	return result.Neg(result)
+}
+
+// clampPrice returns the passed integer as a Price, clamped to the range of the
+// valid prices, which excludes NoPrice.
+func clampPrice(n *big.Int) Price {
+	switch {
+	case n.IsInt64() && n.Int64() != int64(NoPrice):
+		return Price(n.Int64())
+	case n.Sign() > 0:
+		return math.MaxInt64
+	}
+	return NoPrice + 1
+}
+
+// AbsorptionInfo describes the absorption state of the chain ending at a block
+// of the main chain.
+type AbsorptionInfo struct {
+	Hash   chainhash.Hash // The hash of the block.
+	Height int32          // The height of the block.
+
+	// MedianPrice is the median price of the epoch ending at the block, or
+	// NoPrice when the blocks do not provide enough prices.
+	MedianPrice Price
+
+	// TotalSupply is the total supply of STB after the block.
+	TotalSupply *big.Int
+
+	// LastAbsorption is the most recent absorption block, up to and
+	// including the block, or nil when no absorption occurred.  The rest of
+	// the absorption fields are only set when there is one.
+	LastAbsorption *chainhash.Hash
+
+	// LastAbsorptionHeight is the height of LastAbsorption.
+	LastAbsorptionHeight int32
+
+	// AbsorptionRate is the median price of the last absorption.
+	AbsorptionRate Price
+
+	// Absorption is the total amount of STB to absorb by the last
+	// absorption, of which Absorbed has already been absorbed.  It is
+	// negative when the STB supply contracts.
+	Absorption *big.Int
+	Absorbed   *big.Int
+
+	// RemainingBlocks is the number of blocks left to absorb the rest of
+	// the last absorption, and NextAbsorption is the amount of STB the
+	// block after must absorb, nil when there is none.
+	RemainingBlocks int32
+	NextAbsorption  *big.Int
+
+	// NextPassiveHeight is the first height of a block which can trigger a
+	// passive absorption, given enough prices.
+	NextPassiveHeight int32
+
+	// ActiveLowPrice and ActiveHighPrice are the median prices at or
+	// beyond which the block after triggers an active absorption.  They
+	// are NoPrice when the block after cannot trigger one.
+	ActiveLowPrice  Price
+	ActiveHighPrice Price
+}
+
+// AbsorptionInfo returns the absorption state of the chain ending at the block
+// of the main chain with the passed hash, or at the tip of the main chain for
+// a nil hash.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AbsorptionInfo(hash *chainhash.Hash) (*AbsorptionInfo, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.bestChain.Tip()
+	if hash != nil {
+		node = b.index.LookupNode(hash)
+		if node == nil || !b.bestChain.Contains(node) {
+			str := fmt.Sprintf("block %s is not in the main chain", hash)
+			return nil, errNotInMainChain(str)
+		}
+	}
+
+	// The supply of the block is the one of the tip before the supply
+	// changes of the blocks after it.
+	b.stateLock.RLock()
+	totalSupply := new(big.Int).Set(&b.stateSnapshot.TotalSupply)
+	b.stateLock.RUnlock()
+	for n := b.bestChain.Tip(); n != node; n = n.parent {
+		totalSupply.Sub(totalSupply, n.supplyChange)
+	}
+
+	epoch := b.chainParams.BlockPerTimespan
+	info := &AbsorptionInfo{
+		Hash:            node.hash,
+		Height:          node.height,
+		TotalSupply:     totalSupply,
+		AbsorptionRate:  NoPrice,
+		ActiveLowPrice:  NoPrice,
+		ActiveHighPrice: NoPrice,
+	}
+
+	var err error
+	info.MedianPrice, err = b.calcBlockMedianPrice(node)
+	if err != nil {
+		return nil, err
+	}
+
+	absnNode, alreadyAbsorbed := findLastAbsorption(node)
+	if absnNode == nil {
+		// The passive condition holds as soon as the first epoch passed.
+		info.NextPassiveHeight = epoch - 1
+		if info.NextPassiveHeight <= node.height {
+			info.NextPassiveHeight = node.height + 1
+		}
+		return info, nil
+	}
+
+	info.LastAbsorption = &absnNode.hash
+	info.LastAbsorptionHeight = absnNode.height
+	info.Absorbed = alreadyAbsorbed
+	info.NextPassiveHeight = absnNode.height + epoch
+	if info.NextPassiveHeight <= node.height {
+		info.NextPassiveHeight = node.height + 1
+	}
+
+	info.AbsorptionRate = node.absorption.rate
+	info.Absorption, err = b.calcLastAbsorption(node, totalSupply)
+	if err != nil {
+		return nil, err
+	}
+	info.NextAbsorption, err = b.calcAbsorptionAfter(node, totalSupply)
+	if err != nil {
+		return nil, err
+	}
+	info.RemainingBlocks = epoch - (node.height - absnNode.height)
+	if info.RemainingBlocks < 0 {
+		info.RemainingBlocks = 0
+	}
+
+	// The block after can only trigger an active absorption within the
+	// epoch of the last absorption.
+	if node.height+1-absnNode.height < epoch && info.AbsorptionRate != NoPrice {
+		info.ActiveLowPrice, info.ActiveHighPrice =
+			activeAbsorptionPrices(info.AbsorptionRate, b.chainParams)
+	}
+
+	return info, nil
+}
+
+// BlockAbsorptionRate returns the absorption rate triggered by the block with
+// the passed hash, which is the median price of its epoch, or NoPrice when the
+// block does not trigger an absorption.  The block must be connected to the
+// main chain.
+//
+// This function is safe for concurrent access.  The indexes, which are called
+// while the chain lock is held, must use DBFetchBlockAbsorptionRate instead.
+func (b *BlockChain) BlockAbsorptionRate(hash *chainhash.Hash) (Price, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil || !b.bestChain.Contains(node) {
+		str := fmt.Sprintf("block %s is not in the main chain", hash)
+		return NoPrice, errNotInMainChain(str)
+	}
+
+	if !b.index.NodeStatus(node).Absorption() {
+		return NoPrice, nil
+	}
+	return b.index.NodeAbsorptionState(node).rate, nil
+}
+
+// DBFetchBlockAbsorptionRate uses an existing database transaction to retrieve
+// the absorption rate triggered by the block with the passed hash and height
+// from the block index, or NoPrice when the block does not trigger an
+// absorption.  The block index entry of a block is written before the indexes
+// are notified of its connection, so they can look the rate up with the
+// transaction they are passed.
+func DBFetchBlockAbsorptionRate(dbTx database.Tx, hash *chainhash.Hash, height int32) (Price, error) {
+	blockIndexBucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+	blockRow := blockIndexBucket.Get(blockIndexKey(hash, uint32(height)))
+	if blockRow == nil {
+		str := fmt.Sprintf("block %s is not in the block index", hash)
+		return NoPrice, errNotInMainChain(str)
+	}
+
+	_, status, _, absorption, err := deserializeBlockRow(blockRow)
+	if err != nil {
+		return NoPrice, err
+	}
+	if !status.Absorption() {
+		return NoPrice, nil
+	}
+	if absorption == nil {
+		return NoPrice, AssertError(fmt.Sprintf("block %s has no "+
+			"absorption state", hash))
+	}
+	return absorption.rate, nil
 }
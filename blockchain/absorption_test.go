@@ -0,0 +1,956 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainec"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/database"
+	"github.com/endurio/ndrd/txscript"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// absorptionTestChain is a chain instance the tests extend with blocks whose
+// coinbases create both NDR and STB, so there is a supply for the absorptions
+// to scale.  The blocks are connected without being validated.
+type absorptionTestChain struct {
+	t         *testing.T
+	bc        *BlockChain
+	timestamp time.Time
+}
+
+// newAbsorptionTestChain returns an absorption test chain with a short epoch,
+// so only a few blocks are needed to trigger an absorption, along with a
+// teardown function the caller must invoke when done.
+func newAbsorptionTestChain(t *testing.T, dbName string, params chaincfg.Params) (*absorptionTestChain, func()) {
+	params.BlockPerTimespan = 4
+	bc, teardown, err := chainSetup(dbName, &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	bc.TstSetCoinbaseMaturity(1)
+	return &absorptionTestChain{
+		t:         t,
+		bc:        bc,
+		timestamp: params.GenesisBlock.Header.Timestamp,
+	}, teardown
+}
+
+// newBlock creates and stores a block extending the passed node with the
+// passed price derivation, whose coinbase creates 100 NDR and 1000 STB, and
+// which contains the passed transactions.
+func (c *absorptionTestChain) newBlock(parent *blockNode, price Price, txs ...*wire.MsgTx) (*blockNode, *chainutil.Block) {
+	c.timestamp = c.timestamp.Add(time.Second)
+	header := wire.BlockHeader{
+		Version:         1,
+		PrevBlock:       parent.hash,
+		Bits:            0x207fffff,
+		Timestamp:       c.timestamp,
+		PriceDerivation: int64(price),
+	}
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&zeroHash,
+		math.MaxUint32), []byte{byte(parent.height + 1)}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(types.Value{Amount: 100},
+		[]byte{txscript.OP_TRUE}))
+	coinbase.AddTxOut(wire.NewTxOut(types.Value{
+		Amount: 1000,
+		Token:  types.Token1,
+	}, []byte{txscript.OP_TRUE}))
+	block := chainutil.NewBlock(&wire.MsgBlock{
+		Header:       header,
+		Transactions: append([]*wire.MsgTx{coinbase}, txs...),
+	})
+	node := newBlockNode(&header, parent)
+	block.SetHeight(node.height)
+	c.bc.index.AddNode(node)
+	err := c.bc.db.Update(func(dbTx database.Tx) error {
+		return dbStoreBlock(dbTx, block)
+	})
+	if err != nil {
+		c.t.Fatalf("dbStoreBlock: unexpected error: %v", err)
+	}
+	return node, block
+}
+
+// connect connects the passed block to the main chain the same way
+// connectBestChain does once the block is validated.
+func (c *absorptionTestChain) connect(node *blockNode, block *chainutil.Block) {
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&node.parent.hash)
+	err := view.fetchInputUtxos(c.bc.db, block)
+	if err != nil {
+		c.t.Fatalf("fetchInputUtxos: unexpected error: %v", err)
+	}
+	stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
+	supplyChange, err := view.connectTransactions(block, &stxos)
+	if err != nil {
+		c.t.Fatalf("connectTransactions: unexpected error: %v", err)
+	}
+	c.bc.index.SetSupplyChange(node, supplyChange)
+	c.bc.chainLock.Lock()
+	err = c.bc.connectBlock(node, block, view, stxos)
+	c.bc.chainLock.Unlock()
+	if err != nil {
+		c.t.Fatalf("connectBlock: unexpected error: %v", err)
+	}
+}
+
+// TestAbsorptionReorg ensures an absorption block which is removed from the
+// main chain by a reorganization no longer affects the absorption of the new
+// best chain, and that the orders it filled are spendable orders again.
+func TestAbsorptionReorg(t *testing.T) {
+	c, teardown := newAbsorptionTestChain(t, "absorptionreorg",
+		chaincfg.RegressionNetParams)
+	defer teardown()
+	bc := c.bc
+
+	var disconnected []*chainutil.Block
+	var reverted []Notification
+	bc.Subscribe(func(n *Notification) {
+		switch n.Type {
+		case NTBlockDisconnected:
+			disconnected = append(disconnected, n.Data.(*chainutil.Block))
+		case NTAbsorptionStartReverted, NTAbsorptionEndReverted,
+			NTOrderFillReverted:
+			reverted = append(reverted, *n)
+		}
+	})
+
+	// Create the common part of both chains, whose last block triggers
+	// the first absorption, followed by the main chain whose first block
+	// moves the price enough to trigger an active absorption, and whose
+	// second block fills an order selling the NDR of the first coinbase.
+	//
+	//   genesis -> 1 -> 2 -> 3 (absorption) -> 4a (absorption) -> 5a
+	//                                      \-> 4b -> 5b -> 6b
+	var forkPoint *blockNode
+	var firstCoinbase *chainutil.Tx
+	for i := 0; i < 3; i++ {
+		node, block := c.newBlock(bc.bestChain.Tip(), PriceUnit)
+		c.connect(node, block)
+		if i == 0 {
+			firstCoinbase = block.Transactions()[0]
+		}
+		forkPoint = node
+	}
+	order := wire.NewMsgTx(wire.TxVersion)
+	order.AddTxIn(wire.NewTxIn(wire.NewOutPoint(firstCoinbase.Hash(), 0),
+		nil, nil))
+	order.AddTxOut(wire.NewTxOut(types.Value{
+		Amount: 30,
+		Token:  types.Token1,
+	}, nil))
+	absnNode, absnBlock := c.newBlock(forkPoint, 6*PriceUnit)
+	c.connect(absnNode, absnBlock)
+	orderNode, orderBlock := c.newBlock(absnNode, PriceUnit, order)
+	c.connect(orderNode, orderBlock)
+
+	for _, n := range []*blockNode{forkPoint, absnNode} {
+		if !bc.index.NodeStatus(n).Absorption() {
+			t.Fatalf("connectBlock: block %d does not trigger an "+
+				"absorption", n.height)
+		}
+	}
+	if node, _ := findLastAbsorption(bc.bestChain.Tip()); node != absnNode {
+		t.Fatalf("findLastAbsorption: unexpected absorption block "+
+			"-- got %v, want %v", node, absnNode)
+	}
+	absnRate, err := bc.BlockAbsorptionRate(&absnNode.hash)
+	if err != nil {
+		t.Fatalf("BlockAbsorptionRate: unexpected error: %v", err)
+	}
+	err = bc.db.View(func(dbTx database.Tx) error {
+		for _, n := range []*blockNode{absnNode, orderNode} {
+			rate, err := DBFetchBlockAbsorptionRate(dbTx, &n.hash,
+				n.height)
+			if err != nil {
+				return err
+			}
+			want := NoPrice
+			if n == absnNode {
+				want = absnRate
+			}
+			if rate != want {
+				t.Errorf("DBFetchBlockAbsorptionRate: got rate %d "+
+					"for block %d, want %d", rate, n.height, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DBFetchBlockAbsorptionRate: unexpected error: %v", err)
+	}
+	info, err := bc.AbsorptionInfo(nil)
+	if err != nil {
+		t.Fatalf("AbsorptionInfo: unexpected error: %v", err)
+	}
+	if info.LastAbsorptionHeight != absnNode.height ||
+		info.AbsorptionRate != absnRate || absnRate == NoPrice ||
+		info.RemainingBlocks != 3 ||
+		info.NextPassiveHeight != absnNode.height+4 {
+		t.Fatalf("AbsorptionInfo: unexpected info %+v", info)
+	}
+
+	// Reorganize to the longer side chain, whose blocks are already known
+	// to be valid.
+	sideTip := forkPoint
+	for i := 0; i < 3; i++ {
+		sideTip, _ = c.newBlock(sideTip, PriceUnit)
+		bc.index.SetStatusFlags(sideTip, statusValid)
+	}
+	detachNodes, attachNodes := bc.getReorganizeNodes(sideTip)
+	bc.chainLock.Lock()
+	err = bc.reorganizeChain(detachNodes, attachNodes)
+	bc.chainLock.Unlock()
+	if err != nil {
+		t.Fatalf("reorganizeChain: unexpected error: %v", err)
+	}
+	if bc.bestChain.Tip() != sideTip {
+		t.Fatalf("reorganizeChain: tip is block %d, want the side chain",
+			bc.bestChain.Tip().height)
+	}
+
+	// The absorption of the common part applies again, as if the removed
+	// absorption block never existed.
+	if bc.index.NodeStatus(absnNode).Absorption() {
+		t.Fatal("disconnectBlock: the disconnected block still triggers " +
+			"an absorption")
+	}
+	if node, _ := findLastAbsorption(bc.bestChain.Tip()); node != forkPoint {
+		t.Fatalf("findLastAbsorption: unexpected absorption block "+
+			"-- got %v, want %v", node, forkPoint)
+	}
+	info, err = bc.AbsorptionInfo(nil)
+	if err != nil {
+		t.Fatalf("AbsorptionInfo: unexpected error: %v", err)
+	}
+	if info.LastAbsorptionHeight != forkPoint.height ||
+		info.RemainingBlocks != 1 {
+		t.Fatalf("AbsorptionInfo: unexpected info %+v after the "+
+			"reorganization", info)
+	}
+
+	// The disconnected blocks are notified from the tip down, and the
+	// order they filled spends unspent outputs again, so it classifies
+	// as an order the order book accepts back.
+	if len(disconnected) != 2 ||
+		!disconnected[0].Hash().IsEqual(orderBlock.Hash()) ||
+		!disconnected[1].Hash().IsEqual(absnBlock.Hash()) {
+		t.Fatalf("got %d disconnected blocks, want blocks %d and %d",
+			len(disconnected), orderNode.height, absnNode.height)
+	}
+
+	// The order fill and the absorption of the disconnected blocks are
+	// reverted in the same order.
+	if len(reverted) != 2 || reverted[0].Type != NTOrderFillReverted ||
+		reverted[1].Type != NTAbsorptionStartReverted {
+		t.Fatalf("got reverted notifications %v, want the order fill "+
+			"then the absorption", reverted)
+	}
+	fill := reverted[0].Data.(*OrderFilledNtfnsData)
+	if fill.Order.MsgTx().TxHash() != order.TxHash() ||
+		fill.Block != disconnected[0] {
+		t.Fatalf("reverted fill of order %v, want %v", fill.Order.Hash(),
+			order.TxHash())
+	}
+	absn := reverted[1].Data.(*AbsorptionNtfnsData)
+	if absn.AbsorptionHash != absnNode.hash || absn.Rate != absnRate {
+		t.Fatalf("reverted absorption %v at rate %d, want %v at rate "+
+			"%d", absn.AbsorptionHash, absn.Rate, absnNode.hash,
+			absnRate)
+	}
+
+	orderTx := disconnected[0].Transactions()[1]
+	view, err := bc.FetchUtxoView(orderTx)
+	if err != nil {
+		t.Fatalf("FetchUtxoView: unexpected error: %v", err)
+	}
+	balance, err := CheckTransactionInputs(orderTx, sideTip.height+1, view,
+		bc.chainParams)
+	if err != nil {
+		t.Fatalf("CheckTransactionInputs: order of the disconnected "+
+			"block is not spendable: %v", err)
+	}
+	if !IsOrderBalance(balance) {
+		t.Fatalf("IsOrderBalance: order of the disconnected block has "+
+			"balance %v", balance)
+	}
+
+	// The next block of the new main chain meets the passive absorption
+	// condition, one epoch after the remaining absorption.
+	next := newFakeNode(sideTip, 1, 0x207fffff, c.timestamp.Add(time.Second))
+	next.priceDerivation = int64(PriceUnit)
+	rate, err := bc.checkNewAbsorptionRate(next)
+	if err != nil {
+		t.Fatalf("checkNewAbsorptionRate: unexpected error: %v", err)
+	}
+	if rate == NoPrice {
+		t.Fatal("checkNewAbsorptionRate: absorption is not triggered " +
+			"after the reorganization")
+	}
+}
+
+// TestAbsorptionNotifications ensures the blocks connected to the main chain
+// notify the absorptions they start and end, and the orders they fill.
+func TestAbsorptionNotifications(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.BlockPerTimespan = 4
+
+	bc := newFakeChain(&params)
+	bc.stateSnapshot = &BestState{}
+
+	// Create 8 blocks which each create 100 STB, and whose 4th block
+	// triggers an absorption.
+	//
+	//   genesis -> 1 -> 2 -> 3 -> 4 (absorption) -> 5 -> 6 -> 7 -> 8
+	timestamp := time.Unix(1261130161, 0)
+	nodes := make([]*blockNode, 0, 8)
+	node := bc.bestChain.Tip()
+	for i := 0; i < 8; i++ {
+		timestamp = timestamp.Add(time.Second)
+		node = newFakeNode(node, 1, 0x207fffff, timestamp)
+		node.priceDerivation = int64(PriceUnit)
+		node.supplyChange = big.NewInt(100)
+		if node.height == 4 {
+			node.status |= statusAbsorption
+		}
+		node.absorption = calcAbsorptionState(node, PriceUnit, &params)
+		bc.index.AddNode(node)
+		bc.bestChain.SetTip(node)
+		nodes = append(nodes, node)
+	}
+
+	// Every block fills an order which buys 30 STB for 4 NDR.
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&zeroHash,
+		math.MaxUint32), nil, nil))
+	coinbase.AddTxOut(wire.NewTxOut(types.Value{Amount: 50}, nil))
+	order := wire.NewMsgTx(wire.TxVersion)
+	order.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0),
+		nil, nil))
+	order.AddTxOut(wire.NewTxOut(types.Value{
+		Amount: 30,
+		Token:  types.Token1,
+	}, nil))
+	block := chainutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase, order},
+	})
+	stxos := []SpentTxOut{{Amount: 4}}
+
+	tests := []struct {
+		node        *blockNode
+		totalSupply int64
+		typ         NotificationType
+		absorption  int64
+		absorbed    int64
+		orderRate   Price
+	}{
+		{nodes[2], 9900, NTOrderFilled, 0, 0, NoPrice},
+		{nodes[3], 10000, NTAbsorptionStarted, 10000, 0, NoPrice},
+		{nodes[6], 10300, NTOrderFilled, 0, 0, PriceUnit},
+		{nodes[7], 10400, NTAbsorptionEnded, 10000, 400, PriceUnit},
+	}
+	for _, test := range tests {
+		ntfns, err := bc.absorptionNotifications(test.node, block, stxos,
+			big.NewInt(test.totalSupply))
+		if err != nil {
+			t.Fatalf("absorptionNotifications: unexpected error for "+
+				"block %d: %v", test.node.height, err)
+		}
+
+		wantLen := 2
+		if test.typ == NTOrderFilled {
+			wantLen = 1
+		}
+		if len(ntfns) != wantLen {
+			t.Fatalf("absorptionNotifications: unexpected number of "+
+				"notifications for block %d -- got %d, want %d",
+				test.node.height, len(ntfns), wantLen)
+		}
+
+		if test.typ != NTOrderFilled {
+			data, ok := ntfns[0].Data.(*AbsorptionNtfnsData)
+			if ntfns[0].Type != test.typ || !ok ||
+				data.AbsorptionHash != nodes[3].hash ||
+				data.AbsorptionHeight != 4 ||
+				data.Rate != PriceUnit ||
+				data.Absorption.Int64() != test.absorption ||
+				data.Absorbed.Int64() != test.absorbed {
+				t.Fatalf("absorptionNotifications: unexpected "+
+					"notification for block %d -- got %v %+v",
+					test.node.height, ntfns[0].Type, ntfns[0].Data)
+			}
+		}
+
+		last := ntfns[len(ntfns)-1]
+		data, ok := last.Data.(*OrderFilledNtfnsData)
+		if last.Type != NTOrderFilled || !ok ||
+			data.Order != block.Transactions()[1] ||
+			data.Rate != test.orderRate ||
+			data.Balance.Amount(types.Token0) != -4 ||
+			data.Balance.Amount(types.Token1) != 30 {
+			t.Fatalf("absorptionNotifications: unexpected order "+
+				"notification for block %d -- got %v %+v",
+				test.node.height, last.Type, last.Data)
+		}
+	}
+}
+
+// TestCalcMedianPrice ensures the median price of an epoch is computed with
+// integer arithmetic only, and pins its exact value.
+func TestCalcMedianPrice(t *testing.T) {
+	t.Parallel()
+
+	params := chaincfg.RegressionNetParams
+	const epoch = 3
+
+	tests := []struct {
+		name   string
+		prices []int64 // price derivations of the epoch, oldest first
+		want   Price
+	}{
+		{
+			name:   "truncated mean",
+			prices: []int64{1e9, 2e9, 4e9},
+			want:   2333333333,
+		},
+		{
+			name:   "negative mean truncated toward zero",
+			prices: []int64{-1, -2, -2},
+			want:   -1,
+		},
+		{
+			name:   "super majority of prices",
+			prices: []int64{wire.NoPriceDerivation, 3, 4},
+			want:   3,
+		},
+		{
+			name:   "no super majority of prices",
+			prices: []int64{wire.NoPriceDerivation, wire.NoPriceDerivation, 4},
+			want:   NoPrice,
+		},
+		{
+			name:   "no overflow",
+			prices: []int64{math.MaxInt64, math.MaxInt64, math.MaxInt64},
+			want:   math.MaxInt64,
+		},
+	}
+
+	for _, test := range tests {
+		node := newBlockNode(&params.GenesisBlock.Header, nil)
+		node.absorption = calcAbsorptionState(node, NoPrice, &params)
+		for _, price := range test.prices {
+			node = newFakeNode(node, 1, 0x207fffff, time.Unix(0, 0))
+			node.priceDerivation = price
+			node.absorption = calcAbsorptionState(node, NoPrice, &params)
+		}
+		epochStart := node.Ancestor(node.height - epoch)
+		got := calcMedianPrice(node, epochStart, epoch, &params)
+		if got != test.want {
+			t.Errorf("%s: got median price %d, want %d", test.name,
+				got, test.want)
+		}
+	}
+
+	// An empty epoch, as on a network without an epoch length, has no
+	// price rather than dividing by zero.
+	node := newBlockNode(&params.GenesisBlock.Header, nil)
+	node.absorption = calcAbsorptionState(node, NoPrice, &params)
+	node = newFakeNode(node, 1, 0x207fffff, time.Unix(0, 0))
+	node.priceDerivation = 5
+	node.absorption = calcAbsorptionState(node, NoPrice, &params)
+	if got := calcMedianPrice(node, node, 0, &params); got != NoPrice {
+		t.Errorf("empty epoch: got median price %d, want no price", got)
+	}
+}
+
+// TestAggregateMinerPrices ensures the per miner trimmed median is not moved
+// by adversarial price series, whether they come from extreme prices or from
+// a single key mining most of the blocks.
+func TestAggregateMinerPrices(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		prices [][]Price // prices fed by each miner
+		want   Price
+	}{
+		{
+			name:   "no prices",
+			prices: nil,
+			want:   NoPrice,
+		},
+		{
+			name:   "miners without prices are ignored",
+			prices: [][]Price{{}, {100}, {}},
+			want:   100,
+		},
+		{
+			name:   "single miner median",
+			prices: [][]Price{{102, 100, 101}},
+			want:   101,
+		},
+		{
+			name:   "single miner even median",
+			prices: [][]Price{{100, 200}},
+			want:   150,
+		},
+		{
+			name:   "one extreme miner",
+			prices: [][]Price{{100}, {101}, {102}, {1e18}},
+			want:   101,
+		},
+		{
+			name:   "extreme miners on both sides",
+			prices: [][]Price{{-1e18}, {100}, {1e18}, {101}, {102}},
+			want:   101,
+		},
+		{
+			name: "one key mining most blocks",
+			prices: [][]Price{
+				{1e15, 1e15, 1e15, 1e15, 1e15, 1e15, 1e15, 1e15},
+				{100}, {101}, {102},
+			},
+			want: 101,
+		},
+		{
+			name: "spikes within a miner series",
+			prices: [][]Price{
+				{100, 1e18, 100, -1e18, 100},
+				{101, 101, 1e18},
+				{102},
+			},
+			want: 101,
+		},
+		{
+			name:   "negative mean truncated toward zero",
+			prices: [][]Price{{-1}, {-2}},
+			want:   -1,
+		},
+		{
+			name:   "no overflow",
+			prices: [][]Price{{math.MaxInt64, math.MaxInt64}, {math.MaxInt64}},
+			want:   math.MaxInt64,
+		},
+	}
+
+	for _, test := range tests {
+		if got := aggregateMinerPrices(test.prices); got != test.want {
+			t.Errorf("%s: got price %d, want %d", test.name, got,
+				test.want)
+		}
+	}
+}
+
+// TestCalcMinerMedianPrice ensures the prices of an epoch are grouped by the
+// key that signed each block.
+func TestCalcMinerMedianPrice(t *testing.T) {
+	t.Parallel()
+
+	params := chaincfg.RegressionNetParams
+	const epoch = 5
+
+	keys := make([]*chainec.PrivateKey, 3)
+	for i := range keys {
+		keys[i], _ = chainec.PrivKeyFromBytes(chainec.S256(),
+			[]byte{byte(i + 1)})
+	}
+
+	type block struct {
+		miner int // index of the signing key, -1 for an unsigned block
+		price int64
+	}
+	tests := []struct {
+		name   string
+		blocks []block // blocks of the epoch, oldest first
+		want   Price
+	}{
+		{
+			name: "one key mining most blocks",
+			blocks: []block{
+				{0, 1e18}, {0, 1e18}, {0, 1e18}, {1, 100}, {2, 102},
+			},
+			want: 102,
+		},
+		{
+			name: "unsigned blocks are ignored",
+			blocks: []block{
+				{0, 100}, {-1, 1e18}, {1, 102}, {2, 104}, {0, 100},
+			},
+			want: 102,
+		},
+		{
+			name: "no super majority of signed prices",
+			blocks: []block{
+				{0, 100}, {-1, 1e18}, {1, 102}, {-1, 1e18}, {-1, 1e18},
+			},
+			want: NoPrice,
+		},
+	}
+
+	for _, test := range tests {
+		node := newBlockNode(&params.GenesisBlock.Header, nil)
+		for _, b := range test.blocks {
+			header := &wire.BlockHeader{
+				Version:         1,
+				PrevBlock:       node.hash,
+				Bits:            0x207fffff,
+				Timestamp:       time.Unix(0, 0),
+				PriceDerivation: b.price,
+			}
+			if b.miner >= 0 {
+				if _, err := header.Sign(keys[b.miner]); err != nil {
+					t.Fatalf("%s: unable to sign header: %v",
+						test.name, err)
+				}
+			}
+			node = newBlockNode(header, node)
+		}
+		got := calcMinerMedianPrice(node, epoch, &params)
+		if got != test.want {
+			t.Errorf("%s: got median price %d, want %d", test.name,
+				got, test.want)
+		}
+	}
+}
+
+// TestMinerPriceWindow ensures the cached miner price window advanced block by
+// block aggregates the same median price as the whole epoch, for the main chain
+// and for a side chain, and that ancestors of side chain blocks are found.
+func TestMinerPriceWindow(t *testing.T) {
+	t.Parallel()
+
+	params := chaincfg.RegressionNetParams
+	const epoch = 6
+
+	keys := make([]*chainec.PrivateKey, 3)
+	for i := range keys {
+		keys[i], _ = chainec.PrivKeyFromBytes(chainec.S256(),
+			[]byte{byte(i + 1)})
+	}
+	newNode := func(parent *blockNode, i int) *blockNode {
+		header := &wire.BlockHeader{
+			Version:         1,
+			PrevBlock:       parent.hash,
+			Bits:            0x207fffff,
+			Timestamp:       time.Unix(int64(parent.height+1), 0),
+			PriceDerivation: int64(100 + i*i%17),
+		}
+		// Every fifth block is unsigned, so it has no miner key.
+		if i%5 != 4 {
+			if _, err := header.Sign(keys[i%len(keys)]); err != nil {
+				t.Fatalf("unable to sign header: %v", err)
+			}
+		}
+		return newBlockNode(header, parent)
+	}
+
+	// The main chain has 20 blocks, and the side chain forks from its
+	// block at height 12 with 4 blocks.
+	nodes := []*blockNode{newBlockNode(&params.GenesisBlock.Header, nil)}
+	for i := 1; i <= 20; i++ {
+		nodes = append(nodes, newNode(nodes[i-1], i))
+	}
+	sideNodes := []*blockNode{nodes[12]}
+	for i := 1; i <= 4; i++ {
+		sideNodes = append(sideNodes, newNode(sideNodes[i-1], i+7))
+	}
+	b := &BlockChain{
+		chainParams: &params,
+		bestChain:   newChainView(nodes[20]),
+	}
+
+	check := func(node *blockNode) {
+		got := b.minerPriceWindow(node, epoch).medianPrice(epoch)
+		want := calcMinerMedianPrice(node, epoch, &params)
+		if got != want {
+			t.Fatalf("median price at height %d: got %d, want %d",
+				node.height, got, want)
+		}
+	}
+	check(nodes[epoch-1])
+	window := b.minerPrices
+	for _, node := range nodes[epoch:] {
+		check(node)
+	}
+	if b.minerPrices != window {
+		t.Fatal("window was rebuilt for the main chain")
+	}
+	for _, node := range sideNodes[1:] {
+		check(node)
+	}
+	if b.minerPrices == window {
+		t.Fatal("window was not rebuilt for the side chain")
+	}
+
+	tip := sideNodes[len(sideNodes)-1]
+	for height := int32(-1); height <= tip.height+1; height++ {
+		if got, want := b.ancestor(tip, height), tip.Ancestor(height); got != want {
+			t.Errorf("ancestor at height %d: got %v, want %v", height,
+				got, want)
+		}
+	}
+}
+
+// TestIsActiveAbsorption ensures the active absorption condition matches the
+// price ratio bounds exactly, for prices of either sign.
+func TestIsActiveAbsorption(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.MainNetParams
+
+	tests := []struct {
+		median Price
+		last   Price
+		want   bool
+	}{
+		{2e9, 1e9, true},
+		{1999999999, 1e9, false},
+		{-5e8, 1e9, true},
+		{-499999999, 1e9, false},
+		{-2e9, -1e9, true},
+		{-1999999999, -1e9, false},
+		{5e8, -1e9, true},
+		{499999999, -1e9, false},
+		{1, 0, true},
+		{-1, 0, true},
+		{0, 0, false},
+		{math.MaxInt64, math.MaxInt64/2 + 1, false},
+		{math.MaxInt64, math.MaxInt64 / 2, true},
+		{math.MinInt64 + 1, math.MinInt64 + 1, false},
+	}
+
+	for i, test := range tests {
+		got := isActiveAbsorption(test.median, test.last, params)
+		if got != test.want {
+			t.Errorf("#%d: isActiveAbsorption(%d, %d) = %v, want %v",
+				i, test.median, test.last, got, test.want)
+		}
+	}
+}
+
+// TestIsLegacyActiveAbsorption ensures the active absorption condition of the
+// blocks below the FixedPointPriceHeight follows the ratios of the chain
+// parameters.
+func TestIsLegacyActiveAbsorption(t *testing.T) {
+	t.Parallel()
+
+	alternate := chaincfg.MainNetParams
+	alternate.ActiveAbsorptionHighRatio = big.NewRat(3, 2)
+	alternate.ActiveAbsorptionLowRatio = big.NewRat(2, 3)
+
+	tests := []struct {
+		params       *chaincfg.Params
+		median, last float64
+		want         bool
+	}{
+		{&chaincfg.MainNetParams, 2, 1, true},
+		{&chaincfg.MainNetParams, 1.99, 1, false},
+		{&chaincfg.MainNetParams, -0.5, 1, true},
+		{&chaincfg.MainNetParams, -0.49, 1, false},
+		{&alternate, 1.5, 1, true},
+		{&alternate, 1.49, 1, false},
+		{&alternate, 0.66, 1, true},
+		{&alternate, 0.67, 1, false},
+	}
+
+	for i, test := range tests {
+		got := isLegacyActiveAbsorption(test.median, test.last, test.params)
+		if got != test.want {
+			t.Errorf("#%d: isLegacyActiveAbsorption(%v, %v) = %v, "+
+				"want %v", i, test.median, test.last, got, test.want)
+		}
+	}
+}
+
+// TestActiveAbsorptionPrices ensures the projected active absorption prices
+// are exactly the bounds at which isActiveAbsorption starts to hold.
+func TestActiveAbsorptionPrices(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		last      Price
+		low, high Price
+	}{
+		{last: PriceUnit, low: -PriceUnit / 2, high: 2 * PriceUnit},
+		{last: 3, low: -2, high: 6},
+		{last: -3, low: -6, high: 2},
+		{last: -PriceUnit, low: -2 * PriceUnit, high: PriceUnit / 2},
+		{last: 0, low: -1, high: 1},
+		{last: math.MaxInt64, low: -(math.MaxInt64 / 2) - 1, high: math.MaxInt64},
+		{last: NoPrice + 1, low: NoPrice + 1, high: 1 << 62},
+	}
+
+	// The thresholds of the alternate parameters are a rise of half and a
+	// drop of a third.
+	alternate := chaincfg.MainNetParams
+	alternate.ActiveAbsorptionHighRatio = big.NewRat(3, 2)
+	alternate.ActiveAbsorptionLowRatio = big.NewRat(2, 3)
+	alternateTests := []struct {
+		last      Price
+		low, high Price
+	}{
+		{last: PriceUnit, low: PriceUnit * 2 / 3, high: PriceUnit * 3 / 2},
+		{last: 7, low: 4, high: 11},
+		{last: -7, low: -11, high: -4},
+	}
+
+	check := func(params *chaincfg.Params, last, wantLow, wantHigh Price) {
+		low, high := activeAbsorptionPrices(last, params)
+		if low != wantLow || high != wantHigh {
+			t.Errorf("activeAbsorptionPrices(%d): got (%d, %d), "+
+				"want (%d, %d)", last, low, high, wantLow,
+				wantHigh)
+			return
+		}
+		// The bounds which are clamped cannot be reached.
+		if (low != NoPrice+1 && !isActiveAbsorption(low, last, params)) ||
+			(high != math.MaxInt64 && !isActiveAbsorption(high, last, params)) {
+			t.Errorf("activeAbsorptionPrices(%d): bounds do not "+
+				"trigger an active absorption", last)
+		}
+		if low+1 < high-1 && (isActiveAbsorption(low+1, last, params) ||
+			isActiveAbsorption(high-1, last, params)) {
+			t.Errorf("activeAbsorptionPrices(%d): prices within "+
+				"the bounds trigger an active absorption", last)
+		}
+	}
+	for _, test := range tests {
+		check(&chaincfg.MainNetParams, test.last, test.low, test.high)
+	}
+	for _, test := range alternateTests {
+		check(&alternate, test.last, test.low, test.high)
+	}
+}
+
+// TestCalcAbsorption pins the exact absorption amounts computed from a supply
+// and a fixed-point rate.
+func TestCalcAbsorption(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		supply int64
+		rate   Price
+		want   string
+	}{
+		{3000, PriceUnit, "3000"},
+		{1e17, 123456789, "12345678900000000"},
+		{7, 333333333, "2"},
+		{1000, -1, "0"},
+		{10, -150000000, "-1"},
+		{math.MaxInt64, math.MaxInt64, "85070591730234615847396907784"},
+	}
+
+	for i, test := range tests {
+		want, _ := new(big.Int).SetString(test.want, 10)
+		got := calcAbsorption(big.NewInt(test.supply), test.rate)
+		if got.Cmp(want) != 0 {
+			t.Errorf("#%d: calcAbsorption(%d, %d) = %v, want %v", i,
+				test.supply, test.rate, got, want)
+		}
+	}
+}
+
+// TestFixedPointPriceActivation ensures the blocks below the
+// FixedPointPriceHeight have their floating point prices decoded, both for an
+// epoch entirely below the height and for one which straddles it.
+func TestFixedPointPriceActivation(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.FixedPointPriceHeight = 6
+	c, teardown := newAbsorptionTestChain(t, "fixedpointpriceactivation",
+		params)
+	defer teardown()
+	bc := c.bc
+
+	// The price is 0.5 in every block, encoded the way each block carries
+	// it at its height.
+	const price = PriceUnit / 2
+	for height := int32(1); height <= 7; height++ {
+		raw := HeaderPriceDerivation(price, height, bc.chainParams)
+		node, block := c.newBlock(bc.bestChain.Tip(), Price(raw))
+		c.connect(node, block)
+	}
+
+	// The epoch price of the tip is the one of its epoch.
+	if got, err := bc.EpochPrice(); err != nil || got != price {
+		t.Errorf("EpochPrice: got %d, %v, want %d", got, err, price)
+	}
+
+	bc.chainLock.Lock()
+	defer bc.chainLock.Unlock()
+	for _, height := range []int32{4, 7} {
+		node := bc.bestChain.NodeByHeight(height)
+		got, err := bc.calcBlockMedianPrice(node)
+		if err != nil {
+			t.Fatalf("calcBlockMedianPrice: unexpected error: %v", err)
+		}
+		if got != price {
+			t.Errorf("calcBlockMedianPrice at height %d: got %d, "+
+				"want %d", height, got, price)
+		}
+	}
+}
+
+// TestHeaderPrice ensures the price derivation of block headers is carried in
+// fixed point from the FixedPointPriceHeight, and as the bits of a float64
+// below it.
+func TestHeaderPrice(t *testing.T) {
+	t.Parallel()
+
+	params := chaincfg.RegressionNetParams
+	params.FixedPointPriceHeight = 100
+
+	tests := []struct {
+		name   string
+		height int32
+		price  Price
+		raw    int64
+	}{
+		{"fixed point", 100, 123456789, 123456789},
+		{"fixed point without price", 100, NoPrice, wire.NoPriceDerivation},
+		{"legacy", 99, 1e8, int64(math.Float64bits(0.1))},
+		{"legacy without price", 99, NoPrice, int64(math.Float64bits(math.NaN()))},
+	}
+
+	for _, test := range tests {
+		raw := HeaderPriceDerivation(test.price, test.height, &params)
+		if raw != test.raw {
+			t.Errorf("%s: got header price derivation %x, want %x",
+				test.name, raw, test.raw)
+		}
+		price := headerPrice(raw, test.height, &params)
+		if price != test.price {
+			t.Errorf("%s: got price %d, want %d", test.name, price,
+				test.price)
+		}
+	}
+
+	// Floating point prices entering the node are rounded to the nearest
+	// unit, and those out of range are no prices.
+	floats := []struct {
+		f    float64
+		want Price
+	}{
+		{0.1, 1e8},
+		{-0.25, -25e7},
+		{math.NaN(), NoPrice},
+		{1e10, NoPrice},
+	}
+	for _, test := range floats {
+		if got := PriceFromFloat(test.f); got != test.want {
+			t.Errorf("PriceFromFloat(%v) = %d, want %d", test.f, got,
+				test.want)
+		}
+	}
+}
@@ -7,7 +7,6 @@ package blockchain
 
 import (
 	"fmt"
-	"math"
 
 	"github.com/endurio/ndrd/database"
 	"github.com/endurio/ndrd/chainutil"
@@ -70,9 +69,9 @@ func (b *BlockChain) maybeAcceptBlock(block *chainutil.Block, flags BehaviorFlag
 	newNode.status = statusDataStored
 
 	rate, err := b.checkNewAbsorptionRate(newNode)
-	if !math.IsNaN(rate) {
+	if rate != NoPrice {
 		log.Infof("A new absorption with rate %v is triggered by block height %v (%v)",
-			rate, block.Height(), block.Hash())
+			rate.Float(), block.Height(), block.Hash())
 		b.index.SetStatusFlags(newNode, statusAbsorption)
 	}
 
@@ -14,6 +14,7 @@ import (
 	"github.com/endurio/ndrd/chaincfg"
 	"github.com/endurio/ndrd/chaincfg/chainhash"
 	"github.com/endurio/ndrd/chainec"
+	"github.com/endurio/ndrd/chainutil"
 	"github.com/endurio/ndrd/database"
 	"github.com/endurio/ndrd/wire"
 )
@@ -103,10 +104,20 @@ type blockNode struct {
 	timestamp  int64
 	merkleRoot chainhash.Hash
 
-	priceDerivation Price
+	priceDerivation int64
 	supplyChange    *big.Int // STB supply change in this block.
 	signature       chainec.CompactSignature
 
+	// absorption is the absorption state of the chain ending at this node.
+	// It is set when the node is connected to the main chain.
+	absorption absorptionState
+
+	// minerKey is the hash160 of the public key recovered from the block
+	// signature.  It is only recovered on first use by MinerKey since the
+	// recovery is expensive, and is nil when no key can be recovered.
+	minerKeyOnce sync.Once
+	minerKey     []byte
+
 	// status is a bitfield representing the validation state of the block. The
 	// status field, unlike the other fields, may be written to and so should
 	// only be accessed using the concurrent-safe NodeStatus method on
@@ -127,7 +138,7 @@ func initBlockNode(node *blockNode, blockHeader *wire.BlockHeader, parent *block
 		nonce:           blockHeader.Nonce,
 		timestamp:       blockHeader.Timestamp.Unix(),
 		merkleRoot:      blockHeader.MerkleRoot,
-		priceDerivation: Price(blockHeader.PriceDerivation),
+		priceDerivation: blockHeader.PriceDerivation,
 		supplyChange:    &BigZero,
 		signature:       blockHeader.Signature,
 	}
@@ -163,11 +174,28 @@ func (node *blockNode) Header() wire.BlockHeader {
 		Timestamp:       time.Unix(node.timestamp, 0),
 		Bits:            node.bits,
 		Nonce:           node.nonce,
-		PriceDerivation: float64(node.priceDerivation),
+		PriceDerivation: node.priceDerivation,
 		Signature:       node.signature,
 	}
 }
 
+// MinerKey returns the hash160 of the public key of the miner that signed the
+// block, or nil when no key can be recovered from the block signature.
+//
+// This function is safe for concurrent access.
+func (node *blockNode) MinerKey() []byte {
+	node.minerKeyOnce.Do(func() {
+		header := node.Header()
+		pubkey, _, err := chainec.RecoverCompact(chainec.S256(),
+			header.Signature[:], header.BlockHashWithoutSignature())
+		if err != nil {
+			return
+		}
+		node.minerKey = chainutil.Hash160(pubkey.SerializeCompressed())
+	})
+	return node.minerKey
+}
+
 // Ancestor returns the ancestor block node at the provided height by following
 // the chain backwards from this node.  The returned block will be nil when a
 // height is requested that is after the height of the passed node or is less
@@ -355,6 +383,27 @@ func (bi *blockIndex) SetSupplyChange(node *blockNode, supplyChange *big.Int) {
 	bi.Unlock()
 }
 
+// NodeAbsorptionState provides concurrent-safe access to the absorption state
+// of a node.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) NodeAbsorptionState(node *blockNode) absorptionState {
+	bi.RLock()
+	state := node.absorption
+	bi.RUnlock()
+	return state
+}
+
+// SetAbsorptionState sets the absorption state of the block node.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) SetAbsorptionState(node *blockNode, state absorptionState) {
+	bi.Lock()
+	node.absorption = state
+	bi.dirty[node] = struct{}{}
+	bi.Unlock()
+}
+
 // flushToDB writes all dirty block nodes to the database. If all writes
 // succeed, this clears the dirty set.
 func (bi *blockIndex) flushToDB() error {
@@ -9,7 +9,6 @@ package blockchain
 import (
 	"container/list"
 	"fmt"
-	"math"
 	"math/big"
 	"sync"
 	"time"
@@ -175,6 +174,12 @@ type BlockChain struct {
 	warningCaches    []thresholdStateCache
 	deploymentCaches []thresholdStateCache
 
+	// minerPrices caches the prices of the epoch ending at the most recent
+	// block whose median price was aggregated per miner, so the epoch of
+	// the block after only needs to be advanced by one block.  It is
+	// protected by the chain lock.
+	minerPrices *minerPriceWindow
+
 	// The following fields are used to determine if certain warnings have
 	// already been shown.
 	//
@@ -596,8 +601,19 @@ func (b *BlockChain) connectBlock(node *blockNode, block *chainutil.Block,
 		}
 	}
 
+	// check if a new absorption should occur in this block
+	rate, err := b.checkNewAbsorptionRate(node)
+	if err != nil {
+		return err
+	}
+	if rate != NoPrice {
+		// triggered, update the last absorption data
+		b.index.SetStatusFlags(node, statusAbsorption)
+	}
+	b.index.SetAbsorptionState(node, calcAbsorptionState(node, rate, b.chainParams))
+
 	// Write any block status changes to DB before updating best state.
-	err := b.index.flushToDB()
+	err = b.index.flushToDB()
 	if err != nil {
 		return err
 	}
@@ -613,16 +629,6 @@ func (b *BlockChain) connectBlock(node *blockNode, block *chainutil.Block,
 	blockWeight := uint64(GetBlockWeight(block))
 	totalSupply.Add(&totalSupply, node.supplyChange)
 
-	// check if a new absorption should occur in this block
-	rate, err := b.checkNewAbsorptionRate(node)
-	if err != nil {
-		return err
-	}
-	if !math.IsNaN(rate) {
-		// triggered, update the last absorption data
-		b.index.SetStatusFlags(node, statusAbsorption)
-	}
-
 	state := newBestState(node, blockSize, blockWeight, numTxns,
 		curTotalTxns+numTxns, node.CalcPastMedianTime(),
 		&totalSupply)
@@ -689,11 +695,24 @@ func (b *BlockChain) connectBlock(node *blockNode, block *chainutil.Block,
 	b.stateSnapshot = state
 	b.stateLock.Unlock()
 
+	// Gather the absorption and order fill notifications of the block
+	// while the chain lock is still held.  The block is connected at this
+	// point, so a failure only loses the notifications.
+	ntfns, err := b.absorptionNotifications(node, block, stxos,
+		&state.TotalSupply)
+	if err != nil {
+		log.Errorf("Unable to generate the absorption notifications "+
+			"of block %v: %v", node.hash, err)
+	}
+
 	// Notify the caller that the block was connected to the main chain.
 	// The caller would typically want to react with actions such as
 	// updating wallets.
 	b.chainLock.Unlock()
 	b.sendNotification(NTBlockConnected, block)
+	for i := range ntfns {
+		b.sendNotification(ntfns[i].Type, ntfns[i].Data)
+	}
 	b.chainLock.Lock()
 
 	return nil
@@ -710,18 +729,40 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *chainutil.Block, vi
 			"block at the end of the main chain")
 	}
 
-	// Load the previous block since some details for it are needed below.
+	// Load the previous block since some details for it are needed below,
+	// along with the outputs spent by the block.
 	prevNode := node.parent
 	var prevBlock *chainutil.Block
+	var stxos []SpentTxOut
 	err := b.db.View(func(dbTx database.Tx) error {
 		var err error
 		prevBlock, err = dbFetchBlockByNode(dbTx, prevNode)
+		if err != nil {
+			return err
+		}
+		stxos, err = dbFetchSpendJournalEntry(dbTx, block)
 		return err
 	})
 	if err != nil {
 		return err
 	}
 
+	// Gather the notifications reverting the absorption and order fill
+	// notifications of the block while it still has its absorption status.
+	// A failure only loses the notifications.
+	b.stateLock.RLock()
+	tipSupply := new(big.Int).Set(&b.stateSnapshot.TotalSupply)
+	b.stateLock.RUnlock()
+	ntfns, err := b.revertedNotifications(node, block, stxos, tipSupply)
+	if err != nil {
+		log.Errorf("Unable to generate the reverted absorption "+
+			"notifications of block %v: %v", node.hash, err)
+	}
+
+	// The block no longer triggers an absorption once it leaves the main
+	// chain.  The flag is evaluated again should it be reconnected later.
+	b.index.UnsetStatusFlags(node, statusAbsorption)
+
 	// Write any block status changes to DB before updating best state.
 	err = b.index.flushToDB()
 	if err != nil {
@@ -739,7 +780,6 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *chainutil.Block, vi
 	blockWeight := uint64(GetBlockWeight(prevBlock))
 	newTotalTxns := curTotalTxns - uint64(len(block.MsgBlock().Transactions))
 	totalSupply.Sub(&totalSupply, node.supplyChange)
-	// TODO: calculate whether absorption occurs in this block
 	state := newBestState(prevNode, blockSize, blockWeight, numTxns,
 		newTotalTxns, prevNode.CalcPastMedianTime(),
 		&totalSupply)
@@ -817,6 +857,9 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *chainutil.Block, vi
 	// updating wallets.
 	b.chainLock.Unlock()
 	b.sendNotification(NTBlockDisconnected, block)
+	for i := range ntfns {
+		b.sendNotification(ntfns[i].Type, ntfns[i].Data)
+	}
 	b.chainLock.Lock()
 
 	return nil
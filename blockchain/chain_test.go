@@ -12,8 +12,9 @@ import (
 
 	"github.com/endurio/ndrd/chaincfg"
 	"github.com/endurio/ndrd/chaincfg/chainhash"
-	"github.com/endurio/ndrd/wire"
 	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
 )
 
 // TestHaveBlock tests the HaveBlock API to ensure proper functionality.
@@ -143,7 +144,7 @@ func TestCalcSequenceLock(t *testing.T) {
 	targetTx := chainutil.NewTx(&wire.MsgTx{
 		TxOut: []*wire.TxOut{{
 			PkScript: nil,
-			Value:    10,
+			Value:    types.Value{Amount: 10},
 		}},
 	})
 	utxoView := NewUtxoViewpoint()
@@ -178,7 +179,7 @@ func TestCalcSequenceLock(t *testing.T) {
 	unConfTx := &wire.MsgTx{
 		TxOut: []*wire.TxOut{{
 			PkScript: nil,
-			Value:    5,
+			Value:    types.Value{Amount: 5},
 		}},
 	}
 	unConfUtxo := wire.OutPoint{
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math/big"
 	"sync"
 	"time"
@@ -30,6 +31,10 @@ const (
 	// journal bucket that is used to track all spent transactions for use
 	// in reorgs.
 	latestSpendJournalBucketVersion = 1
+
+	// latestAbsorptionStateVersion is the current version of the absorption
+	// state stored in the block index entries.
+	latestAbsorptionStateVersion = 1
 )
 
 var (
@@ -179,7 +184,9 @@ func dbFetchOrCreateVersion(dbTx database.Tx, key []byte, defaultVersion uint32)
 // The reserved field below used to keep track of the version of the containing
 // transaction when the height in the header code was non-zero, however the
 // height is always non-zero now, but keeping the extra reserved field allows
-// backwards compatibility.
+// backwards compatibility.  It now holds the token code of the spent txout when
+// the header code flags a token other than Token0, and zero otherwise.  See the
+// token code format in compress.go.
 //
 // The serialized format is:
 //
@@ -194,7 +201,8 @@ func dbFetchOrCreateVersion(dbTx database.Tx, key []byte, defaultVersion uint32)
 //
 // The serialized header code format is:
 //   bit 0 - containing transaction is a coinbase
-//   bits 1-x - height of the block that contains the spent txout
+//   bit 1 - the spent txout carries a token other than Token0
+//   bits 2-x - height of the block that contains the spent txout
 //
 // Example 1:
 // From block 170 in main blockchain.
@@ -257,8 +265,8 @@ type SpentTxOut struct {
 	// Denotes if the creating tx is a coinbase.
 	IsCoinBase bool
 
-	// Denotes if the output is not Token0 type.
-	IsToken bool
+	// Token is the token carried by the output.
+	Token types.Token
 }
 
 // FetchSpendJournal attempts to retrieve the spend journal, or the set of
@@ -292,7 +300,7 @@ func spentTxOutHeaderCode(stxo *SpentTxOut) uint64 {
 	// encodes the height shifted over one bit and the coinbase flag in the
 	// lowest bit.
 	headerCode := uint64(stxo.Height) << 2
-	if stxo.IsToken {
+	if stxo.Token != types.Token0 {
 		headerCode |= 0x02
 	}
 	if stxo.IsCoinBase {
@@ -302,6 +310,15 @@ func spentTxOutHeaderCode(stxo *SpentTxOut) uint64 {
 	return headerCode
 }
 
+// spentTxOutReserved returns the reserved field to be used when serializing the
+// provided stxo entry, which is the token code of its token other than Token0.
+func spentTxOutReserved(stxo *SpentTxOut) uint64 {
+	if stxo.Token == types.Token0 {
+		return 0
+	}
+	return tokenCode(stxo.Token)
+}
+
 // spentTxOutSerializeSize returns the number of bytes it would take to
 // serialize the passed stxo according to the format described above.
 func spentTxOutSerializeSize(stxo *SpentTxOut) int {
@@ -310,7 +327,7 @@ func spentTxOutSerializeSize(stxo *SpentTxOut) int {
 		// The legacy v1 spend journal format conditionally tracked the
 		// containing transaction version when the height was non-zero,
 		// so this is required for backwards compat.
-		size += serializeSizeVLQ(0)
+		size += serializeSizeVLQ(spentTxOutReserved(stxo))
 	}
 	return size + compressedTxOutSize(uint64(stxo.Amount), stxo.PkScript)
 }
@@ -326,7 +343,7 @@ func putSpentTxOut(target []byte, stxo *SpentTxOut) int {
 		// The legacy v1 spend journal format conditionally tracked the
 		// containing transaction version when the height was non-zero,
 		// so this is required for backwards compat.
-		offset += putVLQ(target[offset:], 0)
+		offset += putVLQ(target[offset:], spentTxOutReserved(stxo))
 	}
 	return offset + putCompressedTxOut(target[offset:], uint64(stxo.Amount),
 		stxo.PkScript)
@@ -354,19 +371,28 @@ func decodeSpentTxOut(serialized []byte, stxo *SpentTxOut) (int, error) {
 	// Bit 1 indicates the token is not Token0.
 	// Bits 2-x encode height of containing transaction.
 	stxo.IsCoinBase = code&0x01 != 0
-	stxo.IsToken = code&0x02 != 0
 	stxo.Height = int32(code >> 2)
+	stxo.Token = types.Token0
+	var reserved uint64
 	if stxo.Height > 0 {
 		// The legacy v1 spend journal format conditionally tracked the
 		// containing transaction version when the height was non-zero,
 		// so this is required for backwards compat.
-		_, bytesRead := deserializeVLQ(serialized[offset:])
+		var bytesRead int
+		reserved, bytesRead = deserializeVLQ(serialized[offset:])
 		offset += bytesRead
 		if offset >= len(serialized) {
 			return offset, errDeserialize("unexpected end of data " +
 				"after reserved")
 		}
 	}
+	if code&0x02 != 0 {
+		token, err := decodeTokenCode(reserved)
+		if err != nil {
+			return offset, err
+		}
+		stxo.Token = token
+	}
 
 	// Decode the compressed txout.
 	amount, pkScript, bytesRead, err := decodeCompressedTxOut(
@@ -527,17 +553,24 @@ func dbRemoveSpendJournalEntry(dbTx database.Tx, blockHash *chainhash.Hash) erro
 //
 // The serialized value format is:
 //
-//   <header code><compressed txout>
+//   <header code><compressed txout>[<token code>]
 //
 //   Field                Type     Size
 //   header code          VLQ      variable
 //   compressed txout
 //     compressed amount  VLQ      variable
 //     compressed script  []byte   variable
+//   token code           VLQ      variable
 //
 // The serialized header code format is:
 //   bit 0 - containing transaction is a coinbase
-//   bits 1-x - height of the block that contains the unspent txout
+//   bit 1 - the unspent txout carries a token other than Token0
+//   bits 2-x - height of the block that contains the unspent txout
+//
+// The token code is only present for the unspent txouts which carry a token
+// other than Token0 and Token1, so the token of an entry without one is Token1
+// when the header code flags a token other than Token0.  See the token code
+// format in compress.go.
 //
 // Example 1:
 // From tx in main blockchain:
@@ -660,13 +693,21 @@ func serializeUtxoEntry(entry *UtxoEntry) ([]byte, error) {
 	// Calculate the size needed to serialize the entry.
 	size := serializeSizeVLQ(headerCode) +
 		compressedTxOutSize(uint64(entry.Amount()), entry.PkScript())
+	hasTokenCode := entry.Token() != types.Token0 &&
+		entry.Token() != types.Token1
+	if hasTokenCode {
+		size += serializeSizeVLQ(tokenCode(entry.Token()))
+	}
 
 	// Serialize the header code followed by the compressed unspent
-	// transaction output.
+	// transaction output and the token code if needed.
 	serialized := make([]byte, size)
 	offset := putVLQ(serialized, headerCode)
 	offset += putCompressedTxOut(serialized[offset:], uint64(entry.Amount()),
 		entry.PkScript())
+	if hasTokenCode {
+		putVLQ(serialized[offset:], tokenCode(entry.Token()))
+	}
 
 	return serialized, nil
 }
@@ -691,24 +732,37 @@ func deserializeUtxoEntry(serialized []byte) (*UtxoEntry, error) {
 	blockHeight := int32(code >> 2)
 
 	// Decode the compressed unspent transaction output.
-	amount, pkScript, _, err := decodeCompressedTxOut(serialized[offset:])
+	amount, pkScript, bytesRead, err := decodeCompressedTxOut(
+		serialized[offset:])
 	if err != nil {
 		return nil, errDeserialize(fmt.Sprintf("unable to decode "+
 			"utxo: %v", err))
 	}
+	offset += bytesRead
+
+	// Decode the token, which is Token1 unless a token code follows.
+	token := types.Token0
+	if isToken {
+		token = types.Token1
+		if offset < len(serialized) {
+			code, _ := deserializeVLQ(serialized[offset:])
+			token, err = decodeTokenCode(code)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	entry := &UtxoEntry{
 		amount:      types.Amount(amount),
 		pkScript:    pkScript,
 		blockHeight: blockHeight,
 		packedFlags: 0,
+		token:       token,
 	}
 	if isCoinBase {
 		entry.packedFlags |= tfCoinBase
 	}
-	if isToken {
-		entry.packedFlags |= tfToken
-	}
 
 	return entry, nil
 }
@@ -1068,6 +1122,7 @@ func (b *BlockChain) createChainState() error {
 	node := newBlockNode(header, nil)
 	node.status = statusDataStored | statusValid
 	node.supplyChange = &BigZero
+	node.absorption = calcAbsorptionState(node, NoPrice, b.chainParams)
 	b.bestChain.SetTip(node)
 
 	// Add the new node to the index which is used for faster lookups.
@@ -1233,9 +1288,10 @@ func (b *BlockChain) initChainState() error {
 
 		var i int32
 		var lastNode *blockNode
+		var rebuildAbsorption []*blockNode
 		cursor = blockIndexBucket.Cursor()
 		for ok := cursor.First(); ok; ok = cursor.Next() {
-			header, status, supplyChange, err := deserializeBlockRow(cursor.Value())
+			header, status, supplyChange, absorption, err := deserializeBlockRow(cursor.Value())
 			if err != nil {
 				return err
 			}
@@ -1272,6 +1328,19 @@ func (b *BlockChain) initChainState() error {
 			node.status = status
 			b.index.addNode(node)
 
+			// Entries stored without the absorption state, such as
+			// the ones of an older database, have it rebuilt once
+			// the best chain is set, since the absorption rates
+			// depend on it.
+			if absorption == nil {
+				rebuildAbsorption = append(rebuildAbsorption, node)
+			} else {
+				err := absorption.resolve(node, b.index)
+				if err != nil {
+					return err
+				}
+			}
+
 			lastNode = node
 			i++
 		}
@@ -1284,6 +1353,24 @@ func (b *BlockChain) initChainState() error {
 		}
 		b.bestChain.SetTip(tip)
 
+		// Rebuild the missing absorption states from their parent, in
+		// order of height, and write them back with the index.
+		if len(rebuildAbsorption) > 0 {
+			log.Infof("Rebuilding the absorption state of the " +
+				"block index...")
+		}
+		for _, node := range rebuildAbsorption {
+			rate := NoPrice
+			if node.status.Absorption() {
+				rate, err = b.calcBlockMedianPrice(node)
+				if err != nil {
+					return err
+				}
+			}
+			b.index.SetAbsorptionState(node,
+				calcAbsorptionState(node, rate, b.chainParams))
+		}
+
 		// Load the raw block bytes for the best block.
 		blockBytes, err := dbTx.FetchBlock(&state.hash)
 		if err != nil {
@@ -1334,27 +1421,145 @@ func (b *BlockChain) initChainState() error {
 	return b.index.flushToDB()
 }
 
+// dbAbsorptionState is the absorption state of a block node as stored in the
+// block index, which refers to the last absorption block by its hash.
+type dbAbsorptionState struct {
+	priceSum              *big.Int
+	priceCount            int32
+	lastAbsorption        chainhash.Hash
+	rate                  Price
+	supplySinceAbsorption *big.Int
+}
+
+// resolve sets the absorption state of the passed node, looking up the last
+// absorption block in the passed block index.
+func (s *dbAbsorptionState) resolve(node *blockNode, index *blockIndex) error {
+	node.absorption = absorptionState{
+		rate:                  s.rate,
+		supplySinceAbsorption: s.supplySinceAbsorption,
+		priceSum:              s.priceSum,
+		priceCount:            s.priceCount,
+	}
+	if s.lastAbsorption == zeroHash {
+		return nil
+	}
+
+	node.absorption.lastAbsorption = index.LookupNode(&s.lastAbsorption)
+	if node.absorption.lastAbsorption == nil {
+		return AssertError(fmt.Sprintf("initChainState: Could not "+
+			"find last absorption %s of block %s", s.lastAbsorption,
+			node.hash))
+	}
+	return nil
+}
+
+// serializeSignedBigInt returns the serialization of a big integer, which is a
+// byte that is 1 for negative integers followed by its big endian magnitude.
+func serializeSignedBigInt(n *big.Int) []byte {
+	magnitude := n.Bytes()
+	serialized := make([]byte, 1+len(magnitude))
+	if n.Sign() < 0 {
+		serialized[0] = 1
+	}
+	copy(serialized[1:], magnitude)
+	return serialized
+}
+
+// deserializeSignedBigInt parses a big integer serialized by
+// serializeSignedBigInt.
+func deserializeSignedBigInt(serialized []byte) (*big.Int, error) {
+	if len(serialized) == 0 {
+		return nil, errDeserialize("missing sign of big integer")
+	}
+	n := new(big.Int).SetBytes(serialized[1:])
+	if serialized[0] != 0 {
+		n.Neg(n)
+	}
+	return n, nil
+}
+
 // deserializeBlockRow parses a value in the block index bucket into a block
-// header and block status bitfield.
-func deserializeBlockRow(blockRow []byte) (*wire.BlockHeader, blockStatus, *big.Int, error) {
+// header, block status bitfield, supply change and absorption state.  The
+// absorption state is nil for the entries stored without it.
+//
+// The supply change is signed in the versioned entries.  The entries of an
+// older database have no version and store its magnitude only.
+func deserializeBlockRow(blockRow []byte) (*wire.BlockHeader, blockStatus, *big.Int, *dbAbsorptionState, error) {
 	buffer := bytes.NewReader(blockRow)
 
 	var header wire.BlockHeader
 	err := header.Deserialize(buffer)
 	if err != nil {
-		return nil, statusNone, nil, err
+		return nil, statusNone, nil, nil, err
 	}
 
 	statusByte, err := buffer.ReadByte()
 	if err != nil {
-		return nil, statusNone, nil, err
+		return nil, statusNone, nil, nil, err
 	}
 
 	supplyChangeBytes, err := wire.ReadVarBytes(buffer, 0, 64, "supplyChange")
 	if err != nil {
-		return nil, statusNone, nil, err
+		return nil, statusNone, nil, nil, err
+	}
+	if buffer.Len() == 0 {
+		supplyChange := new(big.Int).SetBytes(supplyChangeBytes)
+		return &header, blockStatus(statusByte), supplyChange, nil, nil
+	}
+
+	version, err := wire.ReadVarInt(buffer, 0)
+	if err != nil {
+		return nil, statusNone, nil, nil, err
+	}
+	if version != latestAbsorptionStateVersion {
+		str := fmt.Sprintf("unsupported absorption state version %d",
+			version)
+		return nil, statusNone, nil, nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: str,
+		}
+	}
+	supplyChange, err := deserializeSignedBigInt(supplyChangeBytes)
+	if err != nil {
+		return nil, statusNone, nil, nil, err
+	}
+	if buffer.Len() == 0 {
+		return &header, blockStatus(statusByte), supplyChange, nil, nil
+	}
+
+	var absorption dbAbsorptionState
+	priceSumBytes, err := wire.ReadVarBytes(buffer, 0, 64, "priceSum")
+	if err != nil {
+		return nil, statusNone, nil, nil, err
+	}
+	absorption.priceSum, err = deserializeSignedBigInt(priceSumBytes)
+	if err != nil {
+		return nil, statusNone, nil, nil, err
 	}
-	return &header, blockStatus(statusByte), new(big.Int).SetBytes(supplyChangeBytes), nil
+	priceCount, err := wire.ReadVarInt(buffer, 0)
+	if err != nil {
+		return nil, statusNone, nil, nil, err
+	}
+	absorption.priceCount = int32(priceCount)
+	_, err = io.ReadFull(buffer, absorption.lastAbsorption[:])
+	if err != nil {
+		return nil, statusNone, nil, nil, err
+	}
+	rate, err := wire.ReadVarInt(buffer, 0)
+	if err != nil {
+		return nil, statusNone, nil, nil, err
+	}
+	absorption.rate = Price(rate)
+	supplyBytes, err := wire.ReadVarBytes(buffer, 0, 64, "supplySinceAbsorption")
+	if err != nil {
+		return nil, statusNone, nil, nil, err
+	}
+	absorption.supplySinceAbsorption, err = deserializeSignedBigInt(supplyBytes)
+	if err != nil {
+		return nil, statusNone, nil, nil, err
+	}
+
+	return &header, blockStatus(statusByte), supplyChange, &absorption, nil
 }
 
 // dbFetchHeaderByHash uses an existing database transaction to retrieve the
@@ -1405,13 +1610,40 @@ func dbFetchBlockByNode(dbTx database.Tx, node *blockNode) (*chainutil.Block, er
 	return block, nil
 }
 
-// dbStoreBlockNode stores the block header and validation status to the block
-// index bucket. This overwrites the current entry if there exists one.
-func dbStoreBlockNode(dbTx database.Tx, node *blockNode) error {
+// serializeAbsorptionState writes the absorption state of a block node to the
+// passed writer in the format read by deserializeBlockRow.
+func serializeAbsorptionState(w io.Writer, state *absorptionState) error {
+	err := wire.WriteVarBytes(w, 0, serializeSignedBigInt(state.priceSum))
+	if err != nil {
+		return err
+	}
+	err = wire.WriteVarInt(w, 0, uint64(state.priceCount))
+	if err != nil {
+		return err
+	}
+	lastAbsorption := &zeroHash
+	if state.lastAbsorption != nil {
+		lastAbsorption = &state.lastAbsorption.hash
+	}
+	_, err = w.Write(lastAbsorption[:])
+	if err != nil {
+		return err
+	}
+	err = wire.WriteVarInt(w, 0, uint64(state.rate))
+	if err != nil {
+		return err
+	}
+	return wire.WriteVarBytes(w, 0,
+		serializeSignedBigInt(state.supplySinceAbsorption))
+}
+
+// serializeBlockRow returns the value of the passed block node in the block
+// index bucket in the format read by deserializeBlockRow.
+func serializeBlockRow(node *blockNode) ([]byte, error) {
 	// Serialize block data to be stored.
 	dataLen := blockHdrSize + 1
 
-	supplyChangeBytes := node.supplyChange.Bytes()
+	supplyChangeBytes := serializeSignedBigInt(node.supplyChange)
 	len := len(supplyChangeBytes)
 	dataLen += wire.VarIntSerializeSize(uint64(len)) + len
 
@@ -1419,19 +1651,41 @@ func dbStoreBlockNode(dbTx database.Tx, node *blockNode) error {
 	header := node.Header()
 	err := header.Serialize(w)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = w.WriteByte(byte(node.status))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = wire.WriteVarBytes(w, 0, supplyChangeBytes)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	err = wire.WriteVarInt(w, 0, latestAbsorptionStateVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// The absorption state is only stored once the node has it, which is
+	// when it is connected to the main chain.
+	if node.absorption.priceSum != nil {
+		err = serializeAbsorptionState(w, &node.absorption)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return w.Bytes(), nil
+}
 
-	value := w.Bytes()
+// dbStoreBlockNode stores the block header and validation status to the block
+// index bucket. This overwrites the current entry if there exists one.
+func dbStoreBlockNode(dbTx database.Tx, node *blockNode) error {
+	value, err := serializeBlockRow(node)
+	if err != nil {
+		return err
+	}
 
 	// Write block header data to block index bucket.
 	blockIndexBucket := dbTx.Metadata().Bucket(blockIndexBucketName)
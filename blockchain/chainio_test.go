@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/endurio/ndrd/database"
+	"github.com/endurio/ndrd/types"
 	"github.com/endurio/ndrd/wire"
 )
 
@@ -57,7 +58,7 @@ func TestStxoSerialization(t *testing.T) {
 				IsCoinBase: true,
 				Height:     9,
 			},
-			serialized: hexToBytes("1300320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
+			serialized: hexToBytes("2500320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
 		},
 		// Adapted from block 100025 in main blockchain.
 		{
@@ -68,7 +69,7 @@ func TestStxoSerialization(t *testing.T) {
 				IsCoinBase: false,
 				Height:     100024,
 			},
-			serialized: hexToBytes("8b99700086c64700b2fb57eadf61e106a100a7445a8c3f67898841ec"),
+			serialized: hexToBytes("97b4600086c64700b2fb57eadf61e106a100a7445a8c3f67898841ec"),
 		},
 		// Adapted from block 100025 in main blockchain.
 		{
@@ -79,6 +80,26 @@ func TestStxoSerialization(t *testing.T) {
 			},
 			serialized: hexToBytes("0091f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
 		},
+		{
+			name: "Spends Token1 output",
+			stxo: SpentTxOut{
+				Amount:   100000000,
+				PkScript: hexToBytes("76a914ee8bd501094a7d5ca318da2506de35e1cb025ddc88ac"),
+				Height:   1,
+				Token:    types.Token1,
+			},
+			serialized: hexToBytes("06000900ee8bd501094a7d5ca318da2506de35e1cb025ddc"),
+		},
+		{
+			name: "Spends output of another token",
+			stxo: SpentTxOut{
+				Amount:   100000000,
+				PkScript: hexToBytes("76a914ee8bd501094a7d5ca318da2506de35e1cb025ddc88ac"),
+				Height:   1,
+				Token:    types.Token(2),
+			},
+			serialized: hexToBytes("06010900ee8bd501094a7d5ca318da2506de35e1cb025ddc"),
+		},
 	}
 
 	for _, test := range tests {
@@ -240,15 +261,15 @@ func TestSpendJournalSerialization(t *testing.T) {
 					Sequence:        0xffffffff,
 				}},
 				TxOut: []*wire.TxOut{{
-					Value:    1000000000,
+					Value:    types.Value{Amount: 1000000000},
 					PkScript: hexToBytes("4104ae1a62fe09c5f51b13905f07f06b99a2f7159b2225f374cd378d71302fa28414e7aab37397f554a7df5f142c21c1b7303b8a0626f1baded5c72a704f7e6cd84cac"),
 				}, {
-					Value:    4000000000,
+					Value:    types.Value{Amount: 4000000000},
 					PkScript: hexToBytes("410411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3ac"),
 				}},
 				LockTime: 0,
 			}},
-			serialized: hexToBytes("1300320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
+			serialized: hexToBytes("2500320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
 		},
 		// Adapted from block 100025 in main blockchain.
 		{
@@ -275,10 +296,10 @@ func TestSpendJournalSerialization(t *testing.T) {
 					Sequence:        0xffffffff,
 				}},
 				TxOut: []*wire.TxOut{{
-					Value:    5000000,
+					Value:    types.Value{Amount: 5000000},
 					PkScript: hexToBytes("76a914f419b8db4ba65f3b6fcc233acb762ca6f51c23d488ac"),
 				}, {
-					Value:    34400000000,
+					Value:    types.Value{Amount: 34400000000},
 					PkScript: hexToBytes("76a914cadf4fc336ab3c6a4610b75f31ba0676b7f663d288ac"),
 				}},
 				LockTime: 0,
@@ -293,15 +314,15 @@ func TestSpendJournalSerialization(t *testing.T) {
 					Sequence:        0xffffffff,
 				}},
 				TxOut: []*wire.TxOut{{
-					Value:    5000000,
+					Value:    types.Value{Amount: 5000000},
 					PkScript: hexToBytes("76a914a983ad7c92c38fc0e2025212e9f972204c6e687088ac"),
 				}, {
-					Value:    13756000000,
+					Value:    types.Value{Amount: 13756000000},
 					PkScript: hexToBytes("76a914a6ebd69952ab486a7a300bfffdcb395dc7d47c2388ac"),
 				}},
 				LockTime: 0,
 			}},
-			serialized: hexToBytes("8b99700086c64700b2fb57eadf61e106a100a7445a8c3f67898841ec8b99700091f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
+			serialized: hexToBytes("97b4600086c64700b2fb57eadf61e106a100a7445a8c3f67898841ec97b4600091f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
 		},
 	}
 
@@ -423,7 +444,7 @@ func TestUtxoSerialization(t *testing.T) {
 				blockHeight: 1,
 				packedFlags: tfCoinBase,
 			},
-			serialized: hexToBytes("03320496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52"),
+			serialized: hexToBytes("05320496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52"),
 		},
 		// From tx in main blockchain:
 		// 0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098:0
@@ -447,7 +468,7 @@ func TestUtxoSerialization(t *testing.T) {
 				blockHeight: 100001,
 				packedFlags: 0,
 			},
-			serialized: hexToBytes("8b99420700ee8bd501094a7d5ca318da2506de35e1cb025ddc"),
+			serialized: hexToBytes("97b4040700ee8bd501094a7d5ca318da2506de35e1cb025ddc"),
 		},
 		// From tx in main blockchain:
 		// 8131ffb0a2c945ecaf9b9063e59558784f9c3a74741ce6ae2a18d0571dac15bb:1
@@ -461,6 +482,26 @@ func TestUtxoSerialization(t *testing.T) {
 			},
 			serialized: nil,
 		},
+		{
+			name: "height 1, Token1",
+			entry: &UtxoEntry{
+				amount:      100000000,
+				pkScript:    hexToBytes("76a914ee8bd501094a7d5ca318da2506de35e1cb025ddc88ac"),
+				blockHeight: 1,
+				token:       types.Token1,
+			},
+			serialized: hexToBytes("060900ee8bd501094a7d5ca318da2506de35e1cb025ddc"),
+		},
+		{
+			name: "height 1, another token",
+			entry: &UtxoEntry{
+				amount:      100000000,
+				pkScript:    hexToBytes("76a914ee8bd501094a7d5ca318da2506de35e1cb025ddc88ac"),
+				blockHeight: 1,
+				token:       types.Token(2),
+			},
+			serialized: hexToBytes("060900ee8bd501094a7d5ca318da2506de35e1cb025ddc01"),
+		},
 	}
 
 	for i, test := range tests {
@@ -527,6 +568,12 @@ func TestUtxoSerialization(t *testing.T) {
 				utxoEntry.IsCoinBase(), test.entry.IsCoinBase())
 			continue
 		}
+		if utxoEntry.Token() != test.entry.Token() {
+			t.Errorf("deserializeUtxoEntry #%d (%s) mismatched "+
+				"token: got %v, want %v", i, test.name,
+				utxoEntry.Token(), test.entry.Token())
+			continue
+		}
 	}
 }
 
@@ -626,8 +673,9 @@ func TestBestChainStateSerialization(t *testing.T) {
 					workSum.Add(workSum, CalcWork(486604799))
 					return new(big.Int).Set(workSum)
 				}(), // 0x0100010001
+				totalSupply: big.NewInt(5000000000), // 0x012a05f200
 			},
-			serialized: hexToBytes("6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000000000000100000000000000050000000100010001"),
+			serialized: hexToBytes("6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d619000000000000000000010000000000000005000000010001000105000000012a05f200"),
 		},
 		{
 			name: "block 1",
@@ -639,8 +687,9 @@ func TestBestChainStateSerialization(t *testing.T) {
 					workSum.Add(workSum, CalcWork(486604799))
 					return new(big.Int).Set(workSum)
 				}(), // 0x0200020002
+				totalSupply: big.NewInt(10000000000), // 0x02540be400
 			},
-			serialized: hexToBytes("4860eb18bf1b1620e37e9490fc8a427514416fd75159ab86688e9a8300000000010000000200000000000000050000000200020002"),
+			serialized: hexToBytes("4860eb18bf1b1620e37e9490fc8a427514416fd75159ab86688e9a83000000000100000002000000000000000500000002000200020500000002540be400"),
 		},
 	}
 
@@ -720,3 +769,131 @@ func TestBestChainStateDeserializeErrors(t *testing.T) {
 		}
 	}
 }
+
+// TestBlockRowAbsorptionSerialization ensures the supply change and the
+// absorption state stored in the block index rows round trip, that the rows of
+// an older database storing the magnitude of the supply change only are still
+// read and that rows storing an unknown version are rejected.
+func TestBlockRowAbsorptionSerialization(t *testing.T) {
+	t.Parallel()
+
+	header := wire.BlockHeader{Version: 1, Bits: 0x207fffff}
+	absnNode := newBlockNode(&header, nil)
+
+	// rawRow returns a block index row holding the test header and status
+	// followed by the passed serialized supply change and data.
+	rawRow := func(supplyChange []byte, data ...byte) []byte {
+		var w bytes.Buffer
+		if err := header.Serialize(&w); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		w.WriteByte(byte(statusValid))
+		wire.WriteVarBytes(&w, 0, supplyChange)
+		w.Write(data)
+		return w.Bytes()
+	}
+
+	tests := []struct {
+		name         string
+		supplyChange *big.Int
+		state        *absorptionState
+		raw          []byte
+		wantSupply   *big.Int
+		want         *dbAbsorptionState
+		wantErr      bool
+	}{
+		{
+			name:         "without absorption state",
+			supplyChange: big.NewInt(-500),
+			wantSupply:   big.NewInt(-500),
+		},
+		{
+			name:       "older database",
+			raw:        rawRow(big.NewInt(500).Bytes()),
+			wantSupply: big.NewInt(500),
+		},
+		{
+			name: "unsupported version",
+			raw: rawRow(serializeSignedBigInt(big.NewInt(500)),
+				latestAbsorptionStateVersion+1),
+			wantErr: true,
+		},
+		{
+			name:         "no absorption",
+			supplyChange: big.NewInt(-1000),
+			state: &absorptionState{
+				rate:                  NoPrice,
+				supplySinceAbsorption: big.NewInt(-1000),
+				priceSum:              big.NewInt(-3000000000),
+				priceCount:            3,
+			},
+			wantSupply: big.NewInt(-1000),
+			want: &dbAbsorptionState{
+				rate:                  NoPrice,
+				supplySinceAbsorption: big.NewInt(-1000),
+				priceSum:              big.NewInt(-3000000000),
+				priceCount:            3,
+			},
+		},
+		{
+			name:         "last absorption",
+			supplyChange: big.NewInt(500),
+			state: &absorptionState{
+				lastAbsorption:        absnNode,
+				rate:                  -2 * PriceUnit,
+				supplySinceAbsorption: new(big.Int),
+				priceSum:              new(big.Int).Lsh(big.NewInt(1), 70),
+				priceCount:            1 << 20,
+			},
+			wantSupply: big.NewInt(500),
+			want: &dbAbsorptionState{
+				lastAbsorption:        absnNode.hash,
+				rate:                  -2 * PriceUnit,
+				supplySinceAbsorption: new(big.Int),
+				priceSum:              new(big.Int).Lsh(big.NewInt(1), 70),
+				priceCount:            1 << 20,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		row := test.raw
+		if row == nil {
+			node := newBlockNode(&header, nil)
+			node.status = statusValid
+			node.supplyChange = test.supplyChange
+			if test.state != nil {
+				node.absorption = *test.state
+			}
+			var err error
+			row, err = serializeBlockRow(node)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+		}
+
+		_, status, supplyChange, state, err := deserializeBlockRow(row)
+		if test.wantErr {
+			if dbErr, ok := err.(database.Error); !ok ||
+				dbErr.ErrorCode != database.ErrCorruption {
+				t.Errorf("%s: expected a corruption error, got %v",
+					test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if status != statusValid || supplyChange.Cmp(test.wantSupply) != 0 {
+			t.Errorf("%s: mismatched status %v or supply change %v, "+
+				"want %v", test.name, status, supplyChange,
+				test.wantSupply)
+			continue
+		}
+		if !reflect.DeepEqual(state, test.want) {
+			t.Errorf("%s: mismatched state - got %v, want %v",
+				test.name, state, test.want)
+		}
+	}
+}
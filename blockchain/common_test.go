@@ -352,6 +352,7 @@ func newFakeChain(params *chaincfg.Params) *BlockChain {
 	// Create a genesis block node and block index index populated with it
 	// for use when creating the fake chain below.
 	node := newBlockNode(&params.GenesisBlock.Header, nil)
+	node.absorption = calcAbsorptionState(node, NoPrice, params)
 	index := newBlockIndex(nil, params)
 	index.AddNode(node)
 
@@ -6,8 +6,11 @@
 package blockchain
 
 import (
+	"fmt"
+
 	"github.com/endurio/ndrd/chainec"
 	"github.com/endurio/ndrd/txscript"
+	"github.com/endurio/ndrd/types"
 )
 
 // -----------------------------------------------------------------------------
@@ -585,3 +588,31 @@ func decodeCompressedTxOut(serialized []byte) (uint64, []byte, int, error) {
 	script := decompressScript(serialized[bytesRead : bytesRead+scriptSize])
 	return amount, script, bytesRead + scriptSize, nil
 }
+
+// -----------------------------------------------------------------------------
+// The token carried by a transaction output is Token0 unless the header code of
+// its serialization flags it otherwise, in which case the token is encoded as a
+// token code, which is the token minus one.  This way the token code of Token1,
+// the only other token the outputs carried before more tokens were registered,
+// is zero.
+//
+// Example encodings:
+//   Token1 -> 0
+//   Token2 -> 1
+// -----------------------------------------------------------------------------
+
+// tokenCode returns the token code of the passed token, which must not be
+// Token0, according to the format described above.
+func tokenCode(token types.Token) uint64 {
+	return uint64(token) - 1
+}
+
+// decodeTokenCode returns the token the passed token code encodes according to
+// the format described above.
+func decodeTokenCode(code uint64) (types.Token, error) {
+	if code >= uint64(types.TokenInvalid)-1 {
+		return types.TokenInvalid, errDeserialize(fmt.Sprintf("invalid "+
+			"token code %d", code))
+	}
+	return types.Token(code + 1), nil
+}
@@ -233,6 +233,15 @@ const (
 
 	// ErrBadAbsorption indicates an invalid absorption orders in a block.
 	ErrBadAbsorption
+
+	// ErrBadPartialFill indicates the partially filled order of a block
+	// does not match the original order and the unfilled amount committed
+	// to by the coinbase transaction.
+	ErrBadPartialFill
+
+	// ErrUnknownToken indicates a transaction output carries a token which
+	// is not one of the tokens of the network.
+	ErrUnknownToken
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -280,6 +289,9 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrPreviousBlockUnknown:      "ErrPreviousBlockUnknown",
 	ErrInvalidAncestorBlock:      "ErrInvalidAncestorBlock",
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
+	ErrBadAbsorption:             "ErrBadAbsorption",
+	ErrBadPartialFill:            "ErrBadPartialFill",
+	ErrUnknownToken:              "ErrUnknownToken",
 }
 
 // String returns the ErrorCode as a human-readable name.
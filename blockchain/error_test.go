@@ -59,6 +59,9 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrPreviousBlockUnknown, "ErrPreviousBlockUnknown"},
 		{ErrInvalidAncestorBlock, "ErrInvalidAncestorBlock"},
 		{ErrPrevBlockNotBest, "ErrPrevBlockNotBest"},
+		{ErrBadAbsorption, "ErrBadAbsorption"},
+		{ErrBadPartialFill, "ErrBadPartialFill"},
+		{ErrUnknownToken, "ErrUnknownToken"},
 		{0xffff, "Unknown ErrorCode (65535)"},
 	}
 
@@ -70,7 +70,7 @@ func ExampleBlockChain_ProcessBlock() {
 	fmt.Printf("Block accepted. Is it an orphan?: %v", isOrphan)
 
 	// Output:
-	// Failed to process block: already have block 000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f
+	// Failed to process block: already have block 7e8bc48c26507cd0ed0b8f5ebbd3d8ccc856fa4671c9a0e3cd2dd2573e57cacb
 }
 
 // This example demonstrates how to convert the compact "bits" in a block header
@@ -138,9 +138,13 @@ func TestFullBlocks(t *testing.T) {
 		t.Fatalf("failed to generate tests: %v", err)
 	}
 
-	// Create a new database and chain instance to run tests against.
-	chain, teardownFunc, err := chainSetup("fullblocktest",
-		&chaincfg.RegressionNetParams)
+	// Create a new database and chain instance to run tests against.  The
+	// miner of the generated blocks is authorized, and partial fills are
+	// active from the genesis block.
+	params := chaincfg.RegressionNetParams
+	params.AuthorizedPKHs = [][20]byte{fullblocktests.MinerPubKeyHash}
+	params.Deployments[chaincfg.DeploymentPartialFill].StartTime = 0
+	chain, teardownFunc, err := chainSetup("fullblocktest", &params)
 	if err != nil {
 		t.Errorf("Failed to setup chain instance: %v", err)
 		return
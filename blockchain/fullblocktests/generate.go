@@ -167,7 +167,7 @@ func makeSpendableOutForTx(tx *wire.MsgTx, txOutIndex uint32) spendableOut {
 			Hash:  tx.TxHash(),
 			Index: txOutIndex,
 		},
-		amount: types.Amount(tx.TxOut[txOutIndex].Value),
+		amount: tx.TxOut[txOutIndex].Value.Amount,
 	}
 }
 
@@ -294,7 +294,7 @@ func (g *testGenerator) createCoinbaseTx(blockHeight int32) *wire.MsgTx {
 		SignatureScript: coinbaseScript,
 	})
 	tx.AddTxOut(&wire.TxOut{
-		Value:    blockchain.CalcBlockSubsidy(blockHeight, g.params),
+		Value:    blockchain.CalcBlockSubsidy(blockHeight, g.params).Value(types.Token0),
 		PkScript: opTrueScript,
 	})
 	return tx
@@ -344,6 +344,9 @@ func solveBlock(header *wire.BlockHeader) bool {
 				return
 			default:
 				hdr.Nonce = i
+				if _, err := hdr.Sign(minerPrivKey); err != nil {
+					panic(err)
+				}
 				hash := hdr.BlockHash()
 				if blockchain.HashToBig(&hash).Cmp(
 					targetDifficulty) <= 0 {
@@ -373,6 +376,9 @@ func solveBlock(header *wire.BlockHeader) bool {
 		if result.found {
 			close(quit)
 			header.Nonce = result.nonce
+			if _, err := header.Sign(minerPrivKey); err != nil {
+				panic(err)
+			}
 			return true
 		}
 	}
@@ -386,7 +392,7 @@ func additionalCoinbase(amount types.Amount) func(*wire.MsgBlock) {
 	return func(b *wire.MsgBlock) {
 		// Increase the first proof-of-work coinbase subsidy by the
 		// provided amount.
-		b.Transactions[0].TxOut[0].Value += int64(amount)
+		b.Transactions[0].TxOut[0].Value.Amount += amount
 	}
 }
 
@@ -399,12 +405,12 @@ func additionalSpendFee(fee types.Amount) func(*wire.MsgBlock) {
 	return func(b *wire.MsgBlock) {
 		// Increase the fee of the spending transaction by reducing the
 		// amount paid.
-		if int64(fee) > b.Transactions[1].TxOut[0].Value {
+		if fee > b.Transactions[1].TxOut[0].Value.Amount {
 			panic(fmt.Sprintf("additionalSpendFee: fee of %d "+
 				"exceeds available spend transaction value",
 				fee))
 		}
-		b.Transactions[1].TxOut[0].Value -= int64(fee)
+		b.Transactions[1].TxOut[0].Value.Amount -= fee
 	}
 }
 
@@ -444,9 +450,9 @@ func createSpendTx(spend *spendableOut, fee types.Amount) *wire.MsgTx {
 		Sequence:         wire.MaxTxInSequenceNum,
 		SignatureScript:  nil,
 	})
-	spendTx.AddTxOut(wire.NewTxOut(int64(spend.amount-fee),
+	spendTx.AddTxOut(wire.NewTxOut(types.Value{Amount: spend.amount - fee},
 		opTrueScript))
-	spendTx.AddTxOut(wire.NewTxOut(0, uniqueOpReturnScript()))
+	spendTx.AddTxOut(wire.NewTxOut(types.Value{}, uniqueOpReturnScript()))
 
 	return spendTx
 }
@@ -490,7 +496,7 @@ func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers
 		// Create the transaction with a fee of 1 atom for the
 		// miner and increase the coinbase subsidy accordingly.
 		fee := types.Amount(1)
-		coinbaseTx.TxOut[0].Value += int64(fee)
+		coinbaseTx.TxOut[0].Value.Amount += fee
 
 		// Create a transaction that spends from the provided spendable
 		// output and includes an additional unique OP_RETURN output to
@@ -534,11 +540,16 @@ func (g *testGenerator) nextBlock(blockName string, spend *spendableOut, mungers
 	}
 
 	// Only solve the block if the nonce wasn't manually changed by a munge
-	// function.
+	// function.  The block is still signed by the miner otherwise.
 	if block.Header.Nonce == curNonce && !solveBlock(&block.Header) {
 		panic(fmt.Sprintf("Unable to solve block at height %d",
 			nextHeight))
 	}
+	if block.Header.Nonce != curNonce {
+		if _, err := block.Header.Sign(minerPrivKey); err != nil {
+			panic(err)
+		}
+	}
 
 	// Update generator state and return the block.
 	blockHash := block.BlockHash()
@@ -1316,8 +1327,8 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 		prevTx := b.Transactions[1]
 		for i := 0; i < txnsNeeded; i++ {
 			prevTx = createSpendTxForTx(prevTx, lowFee)
-			prevTx.TxOut[0].Value -= 2
-			prevTx.AddTxOut(wire.NewTxOut(2, p2shScript))
+			prevTx.TxOut[0].Value.Amount -= 2
+			prevTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 2}, p2shScript))
 			b.AddTransaction(prevTx)
 		}
 	})
@@ -1431,30 +1442,26 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	})
 	rejected(blockchain.ErrNoTransactions)
 
-	// Create block with invalid proof of work.
+	// Create block signed by a miner which is not authorized.  Blocks are
+	// authorized by the signature of their miner instead of their proof of
+	// work, which is not required.
 	//
 	//   ... -> b43(13)
 	//                 \-> b46(14)
 	g.setTip("b43")
 	b46 := g.nextBlock("b46", outs[14])
 	// This can't be done inside a munge function passed to nextBlock
-	// because the block is solved after the function returns and this test
-	// requires an unsolved block.
+	// because the block is signed after the function returns.
 	{
 		origHash := b46.BlockHash()
-		for {
-			// Keep incrementing the nonce until the hash treated as
-			// a uint256 is higher than the limit.
-			b46.Header.Nonce++
-			blockHash := b46.BlockHash()
-			hashNum := blockchain.HashToBig(&blockHash)
-			if hashNum.Cmp(g.params.PowLimit) >= 0 {
-				break
-			}
+		unauthorizedKey, _ := chainec.PrivKeyFromBytes(chainec.S256(),
+			[]byte{0x01})
+		if _, err := b46.Header.Sign(unauthorizedKey); err != nil {
+			panic(err)
 		}
 		g.updateBlockState("b46", origHash, "b46", b46)
 	}
-	rejected(blockchain.ErrHighHash)
+	rejected(blockchain.ErrUnauthorizedMiner)
 
 	// Create block with a timestamp too far in the future.
 	//
@@ -1500,6 +1507,9 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	{
 		origHash := b49a.BlockHash()
 		b49a.Header.Bits = 0x01810000 // -1 in compact form.
+		if _, err := b49a.Header.Sign(minerPrivKey); err != nil {
+			panic(err)
+		}
 		g.updateBlockState("b49a", origHash, "b49a", b49a)
 	}
 	rejected(blockchain.ErrUnexpectedDifficulty)
@@ -1692,15 +1702,17 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	})
 	rejected(blockchain.ErrMissingTxOut)
 
-	// Create block with transaction that pays more than its inputs.
+	// Create block with transaction that pays more than its inputs.  Such
+	// a transaction buys the token it pays out, so it is an order, which
+	// cannot be mined without an absorption.
 	//
 	//   ... -> b57(16)
 	//                 \-> b59(17)
 	g.setTip("b57")
 	g.nextBlock("b59", outs[17], func(b *wire.MsgBlock) {
-		b.Transactions[1].TxOut[0].Value = int64(outs[17].amount) + 1
+		b.Transactions[1].TxOut[0].Value.Amount = outs[17].amount + 1
 	})
-	rejected(blockchain.ErrSpendTooHigh)
+	rejected(blockchain.ErrBadAbsorption)
 
 	// ---------------------------------------------------------------------
 	// BIP0030 tests.
@@ -1970,7 +1982,7 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 		// Add 4 outputs to the spending transaction that are spent
 		// below.
 		const numAdditionalOutputs = 4
-		const zeroCoin = int64(0)
+		zeroCoin := types.Value{}
 		spendTx := b.Transactions[1]
 		for i := 0; i < numAdditionalOutputs; i++ {
 			spendTx.AddTxOut(wire.NewTxOut(zeroCoin, opTrueScript))
@@ -2035,7 +2047,7 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	g.setTip("b79")
 	g.nextBlock("b81", outs[27], func(b *wire.MsgBlock) {
 		const numAdditionalOutputs = 4
-		const zeroCoin = int64(0)
+		zeroCoin := types.Value{}
 		spendTx := b.Transactions[1]
 		for i := 0; i < numAdditionalOutputs; i++ {
 			opRetScript := uniqueOpReturnScript()
@@ -2047,6 +2059,79 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	}
 	accepted()
 
+	// ---------------------------------------------------------------------
+	// Partial fill tests.
+	// ---------------------------------------------------------------------
+
+	// The coinbases of the generated chain create no STB, so there is no
+	// supply for an absorption to fill orders with.  Only the partial fills
+	// which are rejected regardless of the absorption are tested here.
+	//
+	// Create a block whose coinbase commits to a partial fill while its
+	// last transaction is not a partially filled order.
+	//
+	//   ... -> b81(27)
+	//                 \-> b82(28)
+	//
+	g.nextBlock("b82", outs[28], func(b *wire.MsgBlock) {
+		b.Transactions[0].AddTxOut(wire.NewTxOut(types.Value{},
+			blockchain.PartialFillScript(1)))
+	})
+	rejected(blockchain.ErrBadPartialFill)
+
+	// partialFill returns a munge function which adds the partial fill of
+	// an order selling the NDR of the provided spendable output for 10
+	// STB, leaving 5 STB of it unfilled.  The passed function, if any, is
+	// applied to the partially filled order before it is added.
+	partialFill := func(spend *spendableOut, mungeFill func(*wire.MsgTx)) func(*wire.MsgBlock) {
+		return func(b *wire.MsgBlock) {
+			const unfilled = types.Amount(5)
+			order := wire.NewMsgTx(1)
+			order.AddTxIn(&wire.TxIn{
+				PreviousOutPoint: spend.prevOut,
+				Sequence:         wire.MaxTxInSequenceNum,
+			})
+			order.AddTxOut(wire.NewTxOut(types.Value{
+				Amount: 10,
+				Token:  types.Token1,
+			}, opTrueScript))
+			balance := types.NewBalance(-spend.amount, 10)
+			fill, err := blockchain.NewPartialFill(order, balance,
+				opTrueScript, unfilled)
+			if err != nil {
+				panic(err)
+			}
+			if mungeFill != nil {
+				mungeFill(fill)
+			}
+			b.Transactions[0].AddTxOut(wire.NewTxOut(types.Value{},
+				blockchain.PartialFillScript(unfilled)))
+			b.AddTransaction(fill)
+		}
+	}
+
+	// Create a block with a valid partial fill of an order while there is
+	// no absorption for the order to be mined with.
+	//
+	//   ... -> b81(27)
+	//                 \-> b83(28)
+	//
+	g.setTip("b81")
+	g.nextBlock("b83", nil, partialFill(outs[28], nil))
+	rejected(blockchain.ErrBadAbsorption)
+
+	// Create a block with a partial fill of an order which returns more
+	// change to the owner than the unfilled share of the order.
+	//
+	//   ... -> b81(27)
+	//                 \-> b84(28)
+	//
+	g.setTip("b81")
+	g.nextBlock("b84", nil, partialFill(outs[28], func(fill *wire.MsgTx) {
+		fill.TxOut[len(fill.TxOut)-1].Value.Amount++
+	}))
+	rejected(blockchain.ErrBadPartialFill)
+
 	// ---------------------------------------------------------------------
 	// Large block re-org test.
 	// ---------------------------------------------------------------------
@@ -12,6 +12,9 @@ import (
 
 	"github.com/endurio/ndrd/chaincfg"
 	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainec"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/types"
 	"github.com/endurio/ndrd/wire"
 )
 
@@ -39,6 +42,14 @@ func fromHex(s string) []byte {
 	return r
 }
 
+// pubKeyHash returns the hash of the passed public key in its compressed form,
+// which is how the miners are authorized.
+func pubKeyHash(pubKey *chainec.PublicKey) [20]byte {
+	var pkh [20]byte
+	copy(pkh[:], chainutil.Hash160(pubKey.SerializeCompressed()))
+	return pkh
+}
+
 var (
 	// bigOne is 1 represented as a big.Int.  It is defined here to avoid
 	// the overhead of creating it multiple times.
@@ -48,6 +59,15 @@ var (
 	// can have for the regression test network.  It is the value 2^255 - 1.
 	regressionPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 255), bigOne)
 
+	// minerPrivKey is the private key the generated blocks are signed with.
+	minerPrivKey, _ = chainec.PrivKeyFromBytes(chainec.S256(),
+		fromHex("eaf02ca348c524e6392655ba4d29603cd1a7347d9d65cfe93ce1ebffdca22694"))
+
+	// MinerPubKeyHash is the public key hash of the miner which signs the
+	// generated blocks.  The chain the tests are run against must
+	// authorize it.
+	MinerPubKeyHash = pubKeyHash(minerPrivKey.PubKey())
+
 	// regTestGenesisBlock defines the genesis block of the block chain which serves
 	// as the public transaction ledger for the regression test network.
 	regTestGenesisBlock = wire.MsgBlock{
@@ -74,7 +94,7 @@ var (
 				Sequence: 0xffffffff,
 			}},
 			TxOut: []*wire.TxOut{{
-				Value: 0,
+				Value: types.Value{},
 				PkScript: fromHex("4104678afdb0fe5548271967f1" +
 					"a67130b7105cd6a828e03909a67962e0ea1f" +
 					"61deb649f6bc3f4cef38c4f35504e51ec138" +
@@ -133,4 +153,8 @@ var regressionNetParams = &chaincfg.Params{
 	// BIP44 coin type used in the hierarchical deterministic path for
 	// address generation.
 	HDCoinType: 1,
+
+	// The key the generated blocks are signed with is the only one
+	// authorized to mine.
+	AuthorizedPKHs: [][20]byte{MinerPubKeyHash},
 }
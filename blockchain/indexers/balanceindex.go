@@ -0,0 +1,615 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/database"
+	"github.com/endurio/ndrd/txscript"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+const (
+	// balanceIndexName is the human-readable name for the index.
+	balanceIndexName = "balance index"
+
+	// tokenBalanceSize is the size of the balance of a token in a
+	// serialized balance entry.
+	tokenBalanceSize = 1 + 4 + 8
+
+	// addrUtxoKeySize is the size of the key of an unspent output in the
+	// balance index.
+	addrUtxoKeySize = addrKeySize + chainhash.HashSize + 4
+
+	// addrUtxoEntrySize is the size of a serialized unspent output entry.
+	addrUtxoEntrySize = 1 + 8 + 4 + 1
+)
+
+var (
+	// balanceIndexKey is the key of the balance index and the parent db
+	// bucket used to house it.
+	balanceIndexKey = []byte("balancebyaddridx")
+
+	// balanceIndexBalancesKey is the name of the db bucket used to house
+	// the balance of each address.
+	balanceIndexBalancesKey = []byte("balances")
+
+	// balanceIndexUtxosKey is the name of the db bucket used to house the
+	// unspent outputs of each address.
+	balanceIndexUtxosKey = []byte("utxos")
+)
+
+// -----------------------------------------------------------------------------
+// The balance index consists of two buckets.  The first one maps each address
+// with unspent outputs to the number and the total amount of the unspent
+// outputs of each token paying it, and the second one houses an entry for each
+// of those outputs.  Only the outputs paying a single standard address are
+// indexed.
+//
+// The serialized format for keys and values in the balances bucket is:
+//   <addr key> = <token balance>...
+//
+//   Field           Type              Size
+//   addr key        [addrKeySize]byte 21 bytes
+//   token balance   (see below)       13 bytes each, by increasing token
+//
+// The serialized format of a token balance is:
+//   <token><outputs><amount>
+//
+//   Field           Type              Size
+//   token           uint8             1 byte
+//   outputs         uint32            4 bytes
+//   amount          int64             8 bytes
+//
+// The serialized format for keys and values in the utxos bucket is:
+//   <addr key><hash><index> = <token><amount><height><flags>
+//
+//   Field           Type              Size
+//   addr key        [addrKeySize]byte 21 bytes
+//   hash            chainhash.Hash    32 bytes
+//   index           uint32            4 bytes
+//   token           uint8             1 byte
+//   amount          int64             8 bytes
+//   height          uint32            4 bytes
+//   flags           uint8             1 byte, 0x01 for a coinbase output
+// -----------------------------------------------------------------------------
+
+// AddressTokenBalance houses the unspent outputs of a token paying an address.
+type AddressTokenBalance struct {
+	Token   types.Token
+	Outputs uint32
+	Amount  types.Amount
+}
+
+// AddressBalance houses the balance of each token of an address as of the
+// block the balance index was last updated with.
+type AddressBalance struct {
+	Hash   chainhash.Hash
+	Height int32
+
+	// Tokens are the balances of the tokens with unspent outputs paying
+	// the address, by increasing token.
+	Tokens []AddressTokenBalance
+}
+
+// TokenBalance returns the balance of the passed token, which is empty when
+// the address has no unspent output of the token.
+func (b *AddressBalance) TokenBalance(token types.Token) *AddressTokenBalance {
+	for i := range b.Tokens {
+		if b.Tokens[i].Token == token {
+			return &b.Tokens[i]
+		}
+	}
+	return &AddressTokenBalance{Token: token}
+}
+
+// AddressUtxo houses an unspent output paying an address, as recorded by the
+// balance index.
+type AddressUtxo struct {
+	OutPoint   wire.OutPoint
+	Value      types.Value
+	Height     int32
+	IsCoinBase bool
+}
+
+// serializeAddrBalance returns the passed token balances serialized in the
+// format described above.
+func serializeAddrBalance(tokens []AddressTokenBalance) []byte {
+	serialized := make([]byte, len(tokens)*tokenBalanceSize)
+	offset := 0
+	for i := range tokens {
+		serialized[offset] = byte(tokens[i].Token)
+		byteOrder.PutUint32(serialized[offset+1:], tokens[i].Outputs)
+		byteOrder.PutUint64(serialized[offset+5:], uint64(tokens[i].Amount))
+		offset += tokenBalanceSize
+	}
+	return serialized
+}
+
+// deserializeAddrBalance decodes the passed serialized token balances.
+func deserializeAddrBalance(serialized []byte) ([]AddressTokenBalance, error) {
+	if len(serialized)%tokenBalanceSize != 0 {
+		return nil, errDeserialize("unexpected end of data for address " +
+			"balance")
+	}
+
+	tokens := make([]AddressTokenBalance, 0, len(serialized)/tokenBalanceSize)
+	for offset := 0; offset < len(serialized); offset += tokenBalanceSize {
+		tokens = append(tokens, AddressTokenBalance{
+			Token:   types.Token(serialized[offset]),
+			Outputs: byteOrder.Uint32(serialized[offset+1:]),
+			Amount:  types.Amount(byteOrder.Uint64(serialized[offset+5:])),
+		})
+	}
+	return tokens, nil
+}
+
+// addrUtxoKey returns the key of the passed unspent output paying the address
+// of the passed address key.
+func addrUtxoKey(addrKey [addrKeySize]byte, outpoint *wire.OutPoint) []byte {
+	key := make([]byte, addrUtxoKeySize)
+	offset := copy(key, addrKey[:])
+	offset += copy(key[offset:], outpoint.Hash[:])
+	byteOrder.PutUint32(key[offset:], outpoint.Index)
+	return key
+}
+
+// serializeAddrUtxo returns the passed unspent output serialized in the format
+// described above.  The outpoint is part of the key.
+func serializeAddrUtxo(utxo *AddressUtxo) []byte {
+	serialized := make([]byte, addrUtxoEntrySize)
+	serialized[0] = byte(utxo.Value.Token)
+	byteOrder.PutUint64(serialized[1:], uint64(utxo.Value.Amount))
+	byteOrder.PutUint32(serialized[9:], uint32(utxo.Height))
+	if utxo.IsCoinBase {
+		serialized[13] = 0x01
+	}
+	return serialized
+}
+
+// deserializeAddrUtxo decodes the passed key and serialized entry of an
+// unspent output.
+func deserializeAddrUtxo(key, serialized []byte) (*AddressUtxo, error) {
+	if len(key) != addrUtxoKeySize || len(serialized) != addrUtxoEntrySize {
+		return nil, errDeserialize("unexpected end of data for address " +
+			"unspent output")
+	}
+
+	var utxo AddressUtxo
+	offset := copy(utxo.OutPoint.Hash[:], key[addrKeySize:])
+	utxo.OutPoint.Index = byteOrder.Uint32(key[addrKeySize+offset:])
+	utxo.Value.Token = types.Token(serialized[0])
+	utxo.Value.Amount = types.Amount(byteOrder.Uint64(serialized[1:]))
+	utxo.Height = int32(byteOrder.Uint32(serialized[9:]))
+	utxo.IsCoinBase = serialized[13]&0x01 != 0
+	return &utxo, nil
+}
+
+// dbFetchAddrBalance returns the token balances of the address of the passed
+// address key from the passed balances bucket.
+func dbFetchAddrBalance(bucket internalBucket, addrKey [addrKeySize]byte) ([]AddressTokenBalance, error) {
+	serialized := bucket.Get(addrKey[:])
+	if serialized == nil {
+		return nil, nil
+	}
+	return deserializeAddrBalance(serialized)
+}
+
+// dbUpdateAddrBalance adds the passed number of outputs and amount of the
+// passed token to the balance of the address of the passed address key, which
+// are negative to remove outputs.  The tokens without outputs are removed from
+// the balance, and the balance from the bucket when it has no tokens left.
+func dbUpdateAddrBalance(bucket internalBucket, addrKey [addrKeySize]byte,
+	token types.Token, outputs int32, amount types.Amount) error {
+
+	tokens, err := dbFetchAddrBalance(bucket, addrKey)
+	if err != nil {
+		return err
+	}
+
+	i := sort.Search(len(tokens), func(i int) bool {
+		return tokens[i].Token >= token
+	})
+	if i == len(tokens) || tokens[i].Token != token {
+		tokens = append(tokens, AddressTokenBalance{})
+		copy(tokens[i+1:], tokens[i:])
+		tokens[i] = AddressTokenBalance{Token: token}
+	}
+	balance := &tokens[i]
+	if outputs < 0 && balance.Outputs < uint32(-outputs) {
+		return AssertError(fmt.Sprintf("dbUpdateAddrBalance: removing "+
+			"%d outputs of %v from an address with %d", -outputs,
+			token, balance.Outputs))
+	}
+	balance.Outputs = uint32(int64(balance.Outputs) + int64(outputs))
+	balance.Amount += amount
+	if balance.Outputs == 0 {
+		tokens = append(tokens[:i], tokens[i+1:]...)
+	}
+
+	if len(tokens) == 0 {
+		return bucket.Delete(addrKey[:])
+	}
+	return bucket.Put(addrKey[:], serializeAddrBalance(tokens))
+}
+
+// balanceIndexBuckets houses the buckets of the balance index.  It uses the
+// internalBucket interface so the tests can provide mock buckets.
+type balanceIndexBuckets struct {
+	balances internalBucket
+	utxos    internalBucket
+}
+
+// addUtxo records the passed unspent output paying the address of the passed
+// address key.
+func (b *balanceIndexBuckets) addUtxo(addrKey [addrKeySize]byte, utxo *AddressUtxo) error {
+	err := b.utxos.Put(addrUtxoKey(addrKey, &utxo.OutPoint),
+		serializeAddrUtxo(utxo))
+	if err != nil {
+		return err
+	}
+	return dbUpdateAddrBalance(b.balances, addrKey, utxo.Value.Token, 1,
+		utxo.Value.Amount)
+}
+
+// removeUtxo removes the passed unspent output paying the address of the passed
+// address key.
+func (b *balanceIndexBuckets) removeUtxo(addrKey [addrKeySize]byte, outpoint *wire.OutPoint,
+	value types.Value) error {
+
+	err := b.utxos.Delete(addrUtxoKey(addrKey, outpoint))
+	if err != nil {
+		return err
+	}
+	return dbUpdateAddrBalance(b.balances, addrKey, value.Token, -1,
+		-value.Amount)
+}
+
+// BalanceIndex implements an index of the unspent outputs and the balance of
+// each token of the addresses, keyed by the same address script hashes as the
+// address index.  That is to say, it supports querying what each address
+// currently holds without reading its transactions.
+type BalanceIndex struct {
+	db          database.DB
+	chainParams *chaincfg.Params
+}
+
+// Ensure the BalanceIndex type implements the Indexer interface.
+var _ Indexer = (*BalanceIndex)(nil)
+
+// Ensure the BalanceIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*BalanceIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *BalanceIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *BalanceIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *BalanceIndex) Key() []byte {
+	return balanceIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *BalanceIndex) Name() string {
+	return balanceIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to be
+// created for the first time.  It creates the buckets for the balance index.
+//
+// This is part of the Indexer interface.
+func (idx *BalanceIndex) Create(dbTx database.Tx) error {
+	bucket, err := dbTx.Metadata().CreateBucket(balanceIndexKey)
+	if err != nil {
+		return err
+	}
+	if _, err := bucket.CreateBucket(balanceIndexBalancesKey); err != nil {
+		return err
+	}
+	_, err = bucket.CreateBucket(balanceIndexUtxosKey)
+	return err
+}
+
+// buckets returns the buckets of the balance index of the passed database
+// transaction.
+func (idx *BalanceIndex) buckets(dbTx database.Tx) *balanceIndexBuckets {
+	bucket := dbTx.Metadata().Bucket(balanceIndexKey)
+	return &balanceIndexBuckets{
+		balances: bucket.Bucket(balanceIndexBalancesKey),
+		utxos:    bucket.Bucket(balanceIndexUtxosKey),
+	}
+}
+
+// pkScriptKey returns the address key of the single standard address the
+// passed public key script pays, and whether or not it pays one.  The outputs
+// paying several addresses, such as multisig ones, are not attributed to any of
+// them.
+func (idx *BalanceIndex) pkScriptKey(pkScript []byte) ([addrKeySize]byte, bool) {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript,
+		idx.chainParams)
+	if err != nil || len(addrs) != 1 {
+		return [addrKeySize]byte{}, false
+	}
+	addrKey, err := addrToKey(addrs[0])
+	return addrKey, err == nil
+}
+
+// checkSpentOutputs returns an error unless the passed spent outputs are as
+// many as the inputs of the passed block.
+func checkSpentOutputs(block *chainutil.Block, stxos []blockchain.SpentTxOut) error {
+	numSpent := 0
+	for _, tx := range block.Transactions()[1:] {
+		numSpent += len(tx.MsgTx().TxIn)
+	}
+	if len(stxos) != numSpent {
+		return AssertError(fmt.Sprintf("got %d spent outputs for the %d "+
+			"inputs of block %s", len(stxos), numSpent, block.Hash()))
+	}
+	return nil
+}
+
+// connectBlock updates the passed buckets of the balance index with the
+// outputs the passed block spends and creates.  The spent outputs must be in
+// the order the transactions of the block spend them.
+func (idx *BalanceIndex) connectBlock(buckets *balanceIndexBuckets, block *chainutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	if err := checkSpentOutputs(block, stxos); err != nil {
+		return err
+	}
+
+	stxoIdx := 0
+	for txIdx, tx := range block.Transactions() {
+		// Coinbases do not reference any inputs.  The outputs created
+		// and spent in the same block are removed by the transaction
+		// spending them since the transactions are connected in order.
+		if txIdx != 0 {
+			for _, txIn := range tx.MsgTx().TxIn {
+				stxo := &stxos[stxoIdx]
+				stxoIdx++
+
+				addrKey, ok := idx.pkScriptKey(stxo.PkScript)
+				if !ok {
+					continue
+				}
+				err := buckets.removeUtxo(addrKey,
+					&txIn.PreviousOutPoint, types.Value{
+						Amount: stxo.Amount,
+						Token:  stxo.Token,
+					})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for i, txOut := range tx.MsgTx().TxOut {
+			addrKey, ok := idx.pkScriptKey(txOut.PkScript)
+			if !ok {
+				continue
+			}
+			err := buckets.addUtxo(addrKey, &AddressUtxo{
+				OutPoint:   wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)},
+				Value:      txOut.Value,
+				Height:     block.Height(),
+				IsCoinBase: txIdx == 0,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// disconnectBlock reverts the updates connectBlock made to the passed buckets
+// of the balance index with the passed block, by removing the outputs it
+// creates and restoring the outputs it spends, in the reverse order.
+func (idx *BalanceIndex) disconnectBlock(buckets *balanceIndexBuckets, block *chainutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	if err := checkSpentOutputs(block, stxos); err != nil {
+		return err
+	}
+
+	transactions := block.Transactions()
+	stxoIdx := len(stxos)
+	for txIdx := len(transactions) - 1; txIdx >= 0; txIdx-- {
+		tx := transactions[txIdx]
+		for i, txOut := range tx.MsgTx().TxOut {
+			addrKey, ok := idx.pkScriptKey(txOut.PkScript)
+			if !ok {
+				continue
+			}
+			outpoint := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)}
+			err := buckets.removeUtxo(addrKey, &outpoint, txOut.Value)
+			if err != nil {
+				return err
+			}
+		}
+		if txIdx == 0 {
+			break
+		}
+
+		txIns := tx.MsgTx().TxIn
+		stxoIdx -= len(txIns)
+		for i, txIn := range txIns {
+			stxo := &stxos[stxoIdx+i]
+			addrKey, ok := idx.pkScriptKey(stxo.PkScript)
+			if !ok {
+				continue
+			}
+			err := buckets.addUtxo(addrKey, &AddressUtxo{
+				OutPoint: txIn.PreviousOutPoint,
+				Value: types.Value{
+					Amount: stxo.Amount,
+					Token:  stxo.Token,
+				},
+				Height:     stxo.Height,
+				IsCoinBase: stxo.IsCoinBase,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer removes the outputs spent by the
+// block from the balances of the addresses they paid, and adds the outputs it
+// creates to the balances of the addresses they pay.
+//
+// This is part of the Indexer interface.
+func (idx *BalanceIndex) ConnectBlock(dbTx database.Tx, block *chainutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	return idx.connectBlock(idx.buckets(dbTx), block, stxos)
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the outputs created
+// by the block from the balances of the addresses they pay, and restores the
+// outputs it spent to the balances of the addresses they paid.
+//
+// This is part of the Indexer interface.
+func (idx *BalanceIndex) DisconnectBlock(dbTx database.Tx, block *chainutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	return idx.disconnectBlock(idx.buckets(dbTx), block, stxos)
+}
+
+// AddressBalance returns the balance of each token of the passed address, along
+// with the block the index was last updated with.  An error is returned for the
+// address types the index does not support.
+//
+// This function is safe for concurrent access.
+func (idx *BalanceIndex) AddressBalance(addr chainutil.Address) (*AddressBalance, error) {
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var balance AddressBalance
+	err = idx.db.View(func(dbTx database.Tx) error {
+		hash, height, err := dbFetchIndexerTip(dbTx, balanceIndexKey)
+		if err != nil {
+			return err
+		}
+		balance.Hash = *hash
+		balance.Height = height
+
+		balance.Tokens, err = dbFetchAddrBalance(idx.buckets(dbTx).balances,
+			addrKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// dbFetchAddrUtxos returns the unspent outputs of the passed address key found
+// with the passed cursor over the unspent outputs bucket, ordered by outpoint.
+// Only the outputs of the passed token are returned, unless it is TokenInvalid.
+// The first numToSkip outputs are skipped, and at most numRequested outputs
+// are returned, along with the number of outputs actually skipped.
+func dbFetchAddrUtxos(cursor database.Cursor, addrKey [addrKeySize]byte,
+	token types.Token, numToSkip, numRequested uint32) ([]AddressUtxo, uint32, error) {
+
+	var utxos []AddressUtxo
+	var skipped uint32
+	for ok := cursor.Seek(addrKey[:]); ok && uint32(len(utxos)) < numRequested &&
+		bytes.HasPrefix(cursor.Key(), addrKey[:]); ok = cursor.Next() {
+
+		utxo, err := deserializeAddrUtxo(cursor.Key(), cursor.Value())
+		if err != nil {
+			return nil, 0, err
+		}
+		if token != types.TokenInvalid && utxo.Value.Token != token {
+			continue
+		}
+		if skipped < numToSkip {
+			skipped++
+			continue
+		}
+		utxos = append(utxos, *utxo)
+	}
+	return utxos, skipped, nil
+}
+
+// AddressUtxos returns the unspent outputs paying the passed address, ordered
+// by outpoint, along with the number of outputs skipped.  Only the outputs of
+// the passed token are returned, unless it is TokenInvalid.  The first
+// numToSkip outputs are skipped, and at most numRequested outputs are
+// returned.  An error is returned for the address types the index does not
+// support.
+//
+// This function is safe for concurrent access.
+func (idx *BalanceIndex) AddressUtxos(addr chainutil.Address, token types.Token,
+	numToSkip, numRequested uint32) ([]AddressUtxo, uint32, error) {
+
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var utxos []AddressUtxo
+	var skipped uint32
+	err = idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(balanceIndexKey).
+			Bucket(balanceIndexUtxosKey)
+		var err error
+		utxos, skipped, err = dbFetchAddrUtxos(bucket.Cursor(), addrKey,
+			token, numToSkip, numRequested)
+		return err
+	})
+	return utxos, skipped, err
+}
+
+// NewBalanceIndex returns a new instance of an indexer that is used to create a
+// mapping of the addresses to their unspent outputs and to the balance of each
+// token they hold.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewBalanceIndex(db database.DB, chainParams *chaincfg.Params) *BalanceIndex {
+	return &BalanceIndex{db: db, chainParams: chainParams}
+}
+
+// DropBalanceIndex drops the balance index from the provided database if it
+// exists.
+func DropBalanceIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, balanceIndexKey, balanceIndexName, interrupt)
+}
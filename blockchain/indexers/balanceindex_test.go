@@ -0,0 +1,325 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/database"
+	"github.com/endurio/ndrd/txscript"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// balanceIndexBucket provides a mock balance index database bucket by
+// implementing the internalBucket interface.
+type balanceIndexBucket struct {
+	entries map[string][]byte
+}
+
+// Get returns the value associated with the key from the mock bucket.
+//
+// This is part of the internalBucket interface.
+func (b *balanceIndexBucket) Get(key []byte) []byte {
+	return b.entries[string(key)]
+}
+
+// Put stores the provided key/value pair to the mock bucket.
+//
+// This is part of the internalBucket interface.
+func (b *balanceIndexBucket) Put(key []byte, value []byte) error {
+	b.entries[string(key)] = value
+	return nil
+}
+
+// Delete removes the provided key from the mock bucket.
+//
+// This is part of the internalBucket interface.
+func (b *balanceIndexBucket) Delete(key []byte) error {
+	delete(b.entries, string(key))
+	return nil
+}
+
+// balanceIndexCursor provides a mock cursor over the entries of a mock balance
+// index bucket, in key order, by implementing the database.Cursor interface.
+// Only the methods used by the balance index are implemented.
+type balanceIndexCursor struct {
+	database.Cursor
+	bucket *balanceIndexBucket
+	keys   []string
+	pos    int
+}
+
+// newBalanceIndexCursor returns a new mock cursor over the entries of the
+// passed mock bucket.
+func newBalanceIndexCursor(bucket *balanceIndexBucket) *balanceIndexCursor {
+	keys := make([]string, 0, len(bucket.entries))
+	for key := range bucket.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return &balanceIndexCursor{bucket: bucket, keys: keys}
+}
+
+// Seek positions the cursor at the first key greater than or equal to the
+// passed one.
+//
+// This is part of the database.Cursor interface.
+func (c *balanceIndexCursor) Seek(seek []byte) bool {
+	c.pos = sort.SearchStrings(c.keys, string(seek))
+	return c.pos < len(c.keys)
+}
+
+// Next moves the cursor to the next key.
+//
+// This is part of the database.Cursor interface.
+func (c *balanceIndexCursor) Next() bool {
+	c.pos++
+	return c.pos < len(c.keys)
+}
+
+// Key returns the key the cursor is positioned at.
+//
+// This is part of the database.Cursor interface.
+func (c *balanceIndexCursor) Key() []byte {
+	return []byte(c.keys[c.pos])
+}
+
+// Value returns the value the cursor is positioned at.
+//
+// This is part of the database.Cursor interface.
+func (c *balanceIndexCursor) Value() []byte {
+	return c.bucket.entries[c.keys[c.pos]]
+}
+
+// TestBalanceIndexBlock ensures the balance index accounts for the outputs a
+// block spends and creates for each token, including the outputs spent in the
+// same block, and that disconnecting the block restores the previous state.
+func TestBalanceIndexBlock(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.MainNetParams
+	idx := NewBalanceIndex(nil, params)
+	newAddr := func(b byte) ([addrKeySize]byte, []byte) {
+		addr, err := chainutil.NewAddressPubKeyHash(
+			[]byte{b, 19: 0}, params)
+		if err != nil {
+			t.Fatalf("NewAddressPubKeyHash: unexpected error: %v", err)
+		}
+		addrKey, err := addrToKey(addr)
+		if err != nil {
+			t.Fatalf("addrToKey: unexpected error: %v", err)
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+		}
+		return addrKey, pkScript
+	}
+	keyA, scriptA := newAddr(0x0a)
+	keyB, scriptB := newAddr(0x0b)
+	keyC, scriptC := newAddr(0x0c)
+	nullData, err := txscript.NullDataScript([]byte{0x01})
+	if err != nil {
+		t.Fatalf("NullDataScript: unexpected error: %v", err)
+	}
+
+	ndr := func(amount types.Amount) types.Value {
+		return types.Value{Amount: amount, Token: types.Token0}
+	}
+	stb := func(amount types.Amount) types.Value {
+		return types.Value{Amount: amount, Token: types.Token1}
+	}
+
+	// Address B starts with an output of a previous block.
+	buckets := &balanceIndexBuckets{
+		balances: &balanceIndexBucket{entries: make(map[string][]byte)},
+		utxos:    &balanceIndexBucket{entries: make(map[string][]byte)},
+	}
+	prevOut := wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}
+	err = buckets.addUtxo(keyB, &AddressUtxo{OutPoint: prevOut,
+		Value: ndr(10), Height: 50})
+	if err != nil {
+		t.Fatalf("addUtxo: unexpected error: %v", err)
+	}
+	snapshot := func() [2]map[string]string {
+		var entries [2]map[string]string
+		for i, bucket := range []internalBucket{buckets.balances,
+			buckets.utxos} {
+
+			entries[i] = make(map[string]string)
+			for k, v := range bucket.(*balanceIndexBucket).entries {
+				entries[i][k] = string(v)
+			}
+		}
+		return entries
+	}
+	before := snapshot()
+
+	// The coinbase pays NDR and STB to address A.  The first transaction
+	// spends the output of address B, paying address A and B again along
+	// with a null data output, and the second one spends the new output of
+	// address B to pay address C.
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		math.MaxUint32), nil, nil))
+	coinbase.AddTxOut(wire.NewTxOut(ndr(50), scriptA))
+	coinbase.AddTxOut(wire.NewTxOut(stb(20), scriptA))
+	tx1 := wire.NewMsgTx(wire.TxVersion)
+	tx1.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+	tx1.AddTxOut(wire.NewTxOut(ndr(5), scriptA))
+	tx1.AddTxOut(wire.NewTxOut(ndr(4), scriptB))
+	tx1.AddTxOut(wire.NewTxOut(ndr(0), nullData))
+	tx2 := wire.NewMsgTx(wire.TxVersion)
+	tx1Hash := tx1.TxHash()
+	tx2.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&tx1Hash, 1), nil, nil))
+	tx2.AddTxOut(wire.NewTxOut(ndr(3), scriptC))
+	msgBlock := wire.MsgBlock{Transactions: []*wire.MsgTx{coinbase, tx1,
+		tx2}}
+	block := chainutil.NewBlock(&msgBlock)
+	block.SetHeight(100)
+	stxos := []blockchain.SpentTxOut{
+		{Amount: 10, PkScript: scriptB, Height: 50},
+		{Amount: 4, PkScript: scriptB, Height: 100},
+	}
+
+	if err := idx.connectBlock(buckets, block, stxos); err != nil {
+		t.Fatalf("connectBlock: unexpected error: %v", err)
+	}
+	tests := []struct {
+		addrKey [addrKeySize]byte
+		tokens  []AddressTokenBalance
+		utxos   int
+	}{
+		{keyA, []AddressTokenBalance{
+			{Token: types.Token0, Outputs: 2, Amount: 55},
+			{Token: types.Token1, Outputs: 1, Amount: 20},
+		}, 3},
+		{keyB, nil, 0},
+		{keyC, []AddressTokenBalance{
+			{Token: types.Token0, Outputs: 1, Amount: 3},
+		}, 1},
+	}
+	for i, test := range tests {
+		tokens, err := dbFetchAddrBalance(buckets.balances, test.addrKey)
+		if err != nil {
+			t.Fatalf("dbFetchAddrBalance #%d: unexpected error: %v", i,
+				err)
+		}
+		if !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("dbFetchAddrBalance #%d: got %+v, want %+v", i,
+				tokens, test.tokens)
+		}
+		utxos := 0
+		for k := range buckets.utxos.(*balanceIndexBucket).entries {
+			if k[:addrKeySize] == string(test.addrKey[:]) {
+				utxos++
+			}
+		}
+		if utxos != test.utxos {
+			t.Errorf("#%d: got %d unspent outputs, want %d", i, utxos,
+				test.utxos)
+		}
+	}
+
+	// The coinbase outputs are flagged as such.
+	coinbaseOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+	key := addrUtxoKey(keyA, &coinbaseOut)
+	utxo, err := deserializeAddrUtxo(key, buckets.utxos.Get(key))
+	if err != nil {
+		t.Fatalf("deserializeAddrUtxo: unexpected error: %v", err)
+	}
+	want := &AddressUtxo{OutPoint: coinbaseOut, Value: stb(20),
+		Height: 100, IsCoinBase: true}
+	if !reflect.DeepEqual(utxo, want) {
+		t.Fatalf("deserializeAddrUtxo: got %+v, want %+v", utxo, want)
+	}
+
+	if err := idx.disconnectBlock(buckets, block, stxos); err != nil {
+		t.Fatalf("disconnectBlock: unexpected error: %v", err)
+	}
+	if after := snapshot(); !reflect.DeepEqual(after, before) {
+		t.Fatalf("disconnectBlock: got entries %v, want %v", after,
+			before)
+	}
+
+	// The spent outputs of all the inputs are required.
+	err = idx.connectBlock(buckets, block, stxos[:1])
+	if _, ok := err.(AssertError); !ok {
+		t.Fatalf("connectBlock: unexpected error with missing spent "+
+			"outputs: %v", err)
+	}
+}
+
+// TestAddressUtxos ensures the unspent outputs of an address are fetched in
+// outpoint order, filtered by token, and paged by the number of outputs to skip
+// and requested.
+func TestAddressUtxos(t *testing.T) {
+	t.Parallel()
+
+	keyA := [addrKeySize]byte{0x0a}
+	keyB := [addrKeySize]byte{0x0b}
+	buckets := &balanceIndexBuckets{
+		balances: &balanceIndexBucket{entries: make(map[string][]byte)},
+		utxos:    &balanceIndexBucket{entries: make(map[string][]byte)},
+	}
+
+	// Address A has 5 outputs alternating between NDR and STB, and
+	// address B has one output.
+	var utxos []AddressUtxo
+	for i := 0; i < 5; i++ {
+		utxo := AddressUtxo{
+			OutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i)}},
+			Value: types.Value{Amount: types.Amount(i + 1),
+				Token: types.Token(i % 2)},
+			Height: int32(i),
+		}
+		if err := buckets.addUtxo(keyA, &utxo); err != nil {
+			t.Fatalf("addUtxo: unexpected error: %v", err)
+		}
+		utxos = append(utxos, utxo)
+	}
+	err := buckets.addUtxo(keyB, &AddressUtxo{Value: types.Value{Amount: 99}})
+	if err != nil {
+		t.Fatalf("addUtxo: unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		token       types.Token
+		skip, count uint32
+		want        []AddressUtxo
+		wantSkipped uint32
+	}{
+		{types.TokenInvalid, 0, 100, utxos, 0},
+		{types.TokenInvalid, 1, 2, utxos[1:3], 1},
+		{types.TokenInvalid, 4, 100, utxos[4:], 4},
+		{types.TokenInvalid, 10, 100, nil, 5},
+		{types.TokenInvalid, 0, 0, nil, 0},
+		{types.Token0, 0, 100, []AddressUtxo{utxos[0], utxos[2], utxos[4]}, 0},
+		{types.Token0, 1, 1, []AddressUtxo{utxos[2]}, 1},
+		{types.Token1, 1, 100, []AddressUtxo{utxos[3]}, 1},
+	}
+	for i, test := range tests {
+		cursor := newBalanceIndexCursor(buckets.utxos.(*balanceIndexBucket))
+		got, skipped, err := dbFetchAddrUtxos(cursor, keyA, test.token,
+			test.skip, test.count)
+		if err != nil {
+			t.Fatalf("dbFetchAddrUtxos #%d: unexpected error: %v", i,
+				err)
+		}
+		if !reflect.DeepEqual(got, test.want) || skipped != test.wantSkipped {
+			t.Errorf("dbFetchAddrUtxos #%d: got %+v, %d skipped, "+
+				"want %+v, %d skipped", i, got, skipped, test.want,
+				test.wantSkipped)
+		}
+	}
+}
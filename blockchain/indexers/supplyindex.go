@@ -0,0 +1,286 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/database"
+	"github.com/endurio/ndrd/types"
+)
+
+const (
+	// supplyIndexName is the human-readable name for the index.
+	supplyIndexName = "supply index"
+
+	// supplyEntrySize is the size of a serialized supply index entry.
+	supplyEntrySize = chainhash.HashSize + 8 + 8 + 4 + 8 + 8
+)
+
+var (
+	// supplyIndexKey is the key of the supply index and the db bucket used
+	// to house it.
+	supplyIndexKey = []byte("supplybyheightidx")
+)
+
+// -----------------------------------------------------------------------------
+// The supply index consists of an entry for every block in the main chain,
+// which records how the block changed the STB supply, whether it triggered an
+// absorption, and the totals of the orders it filled.
+//
+// The serialized format for keys and values in the height to supply bucket is:
+//   <height> = <hash><supply change><absorption rate><orders><STB><NDR>
+//
+//   Field           Type              Size
+//   height          uint32            4 bytes
+//   hash            chainhash.Hash    32 bytes
+//   supply change   int64             8 bytes
+//   absorption rate int64             8 bytes
+//   orders          uint32            4 bytes
+//   STB             int64             8 bytes
+//   NDR             int64             8 bytes
+//   -----
+//   Total: 72 bytes
+// -----------------------------------------------------------------------------
+
+// SupplyEntry houses the supply details of a block of the main chain, as
+// recorded by the supply index.
+type SupplyEntry struct {
+	Hash   chainhash.Hash
+	Height int32
+
+	// SupplyChange is the amount of STB created by the block, which is
+	// negative when the block destroys STB.
+	SupplyChange types.Amount
+
+	// AbsorptionRate is the absorption rate triggered by the block, or
+	// blockchain.NoPrice when the block does not trigger an absorption.
+	AbsorptionRate blockchain.Price
+
+	// FilledOrders is the number of orders filled by the block, and
+	// OrderSTB and OrderNDR are the net amounts of each token they
+	// received, which are negative for the token they paid.  OrderNDR
+	// includes the fees paid by the orders.
+	FilledOrders uint32
+	OrderSTB     types.Amount
+	OrderNDR     types.Amount
+}
+
+// Absorption returns whether or not the block triggered an absorption.
+func (e *SupplyEntry) Absorption() bool {
+	return e.AbsorptionRate != blockchain.NoPrice
+}
+
+// serializeSupplyEntry returns the passed supply entry serialized in the
+// format described above.
+func serializeSupplyEntry(entry *SupplyEntry) []byte {
+	serialized := make([]byte, supplyEntrySize)
+	offset := copy(serialized, entry.Hash[:])
+	byteOrder.PutUint64(serialized[offset:], uint64(entry.SupplyChange))
+	offset += 8
+	byteOrder.PutUint64(serialized[offset:], uint64(entry.AbsorptionRate))
+	offset += 8
+	byteOrder.PutUint32(serialized[offset:], entry.FilledOrders)
+	offset += 4
+	byteOrder.PutUint64(serialized[offset:], uint64(entry.OrderSTB))
+	offset += 8
+	byteOrder.PutUint64(serialized[offset:], uint64(entry.OrderNDR))
+	return serialized
+}
+
+// deserializeSupplyEntry decodes the passed serialized supply entry of the
+// block at the passed height.
+func deserializeSupplyEntry(serialized []byte, height int32) (*SupplyEntry, error) {
+	if len(serialized) != supplyEntrySize {
+		return nil, errDeserialize(fmt.Sprintf("unexpected end of "+
+			"data for supply entry of height %d", height))
+	}
+
+	entry := SupplyEntry{Height: height}
+	offset := copy(entry.Hash[:], serialized)
+	entry.SupplyChange = types.Amount(byteOrder.Uint64(serialized[offset:]))
+	offset += 8
+	entry.AbsorptionRate = blockchain.Price(byteOrder.Uint64(serialized[offset:]))
+	offset += 8
+	entry.FilledOrders = byteOrder.Uint32(serialized[offset:])
+	offset += 4
+	entry.OrderSTB = types.Amount(byteOrder.Uint64(serialized[offset:]))
+	offset += 8
+	entry.OrderNDR = types.Amount(byteOrder.Uint64(serialized[offset:]))
+	return &entry, nil
+}
+
+// supplyIndexHeightKey returns the key of the entry of the passed height.
+func supplyIndexHeightKey(height int32) []byte {
+	var key [4]byte
+	byteOrder.PutUint32(key[:], uint32(height))
+	return key[:]
+}
+
+// calcSupplyEntry returns the supply entry of the passed block given the
+// outputs it spends, without its absorption rate.  The spent outputs must be
+// in the order the transactions of the block spend them.
+func calcSupplyEntry(block *chainutil.Block, stxos []blockchain.SpentTxOut) (*SupplyEntry, error) {
+	entry := SupplyEntry{
+		Hash:           *block.Hash(),
+		Height:         block.Height(),
+		AbsorptionRate: blockchain.NoPrice,
+	}
+
+	balances, err := blockchain.TxBalances(block, stxos)
+	if err != nil {
+		return nil, err
+	}
+	for i, tx := range block.Transactions() {
+		// Ignore overflow since the block already passed all the
+		// validations.
+		balance := &balances[i]
+		entry.SupplyChange += balance.Amount(types.Token1)
+		if !blockchain.IsCoinBase(tx) && blockchain.IsOrderBalance(balance) {
+			entry.FilledOrders++
+			entry.OrderSTB += balance.Amount(types.Token1)
+			entry.OrderNDR += balance.Amount(types.Token0)
+		}
+	}
+
+	return &entry, nil
+}
+
+// SupplyIndex implements a supply by block height index.
+type SupplyIndex struct {
+	db          database.DB
+	chainParams *chaincfg.Params
+}
+
+// Ensure the SupplyIndex type implements the Indexer interface.
+var _ Indexer = (*SupplyIndex)(nil)
+
+// Ensure the SupplyIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*SupplyIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *SupplyIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *SupplyIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *SupplyIndex) Key() []byte {
+	return supplyIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SupplyIndex) Name() string {
+	return supplyIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to be
+// created for the first time.  It creates the bucket for the supply index.
+//
+// This is part of the Indexer interface.
+func (idx *SupplyIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(supplyIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds the supply entry of the
+// block.
+//
+// This is part of the Indexer interface.
+func (idx *SupplyIndex) ConnectBlock(dbTx database.Tx, block *chainutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	entry, err := calcSupplyEntry(block, stxos)
+	if err != nil {
+		return err
+	}
+	entry.AbsorptionRate, err = blockchain.DBFetchBlockAbsorptionRate(dbTx,
+		block.Hash(), block.Height())
+	if err != nil {
+		return err
+	}
+
+	bucket := dbTx.Metadata().Bucket(supplyIndexKey)
+	return bucket.Put(supplyIndexHeightKey(block.Height()),
+		serializeSupplyEntry(entry))
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the supply entry of
+// the block.
+//
+// This is part of the Indexer interface.
+func (idx *SupplyIndex) DisconnectBlock(dbTx database.Tx, block *chainutil.Block,
+	_ []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(supplyIndexKey)
+	return bucket.Delete(supplyIndexHeightKey(block.Height()))
+}
+
+// EntriesByHeight returns the supply entries of at most count blocks of the
+// main chain, starting at the passed height.  It stops at the first block the
+// index does not have an entry for, such as past the tip of the main chain, and
+// returns no entries when the database has no supply index.
+//
+// This function is safe for concurrent access.
+func (idx *SupplyIndex) EntriesByHeight(start int32, count int) ([]SupplyEntry, error) {
+	var entries []SupplyEntry
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(supplyIndexKey)
+		if bucket == nil {
+			return nil
+		}
+		for height := start; len(entries) < count; height++ {
+			serialized := bucket.Get(supplyIndexHeightKey(height))
+			if serialized == nil {
+				return nil
+			}
+			entry, err := deserializeSupplyEntry(serialized, height)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, *entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// NewSupplyIndex returns a new instance of an indexer that is used to create a
+// mapping of the heights of all blocks in the main chain to how they changed
+// the STB supply.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewSupplyIndex(db database.DB, chainParams *chaincfg.Params) *SupplyIndex {
+	return &SupplyIndex{db: db, chainParams: chainParams}
+}
+
+// DropSupplyIndex drops the supply index from the provided database if it
+// exists.
+func DropSupplyIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, supplyIndexKey, supplyIndexName, interrupt)
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// TestCalcSupplyEntry ensures the supply entry of a block accounts for the STB
+// created and destroyed by all of its transactions, and for the orders it
+// fills only.
+func TestCalcSupplyEntry(t *testing.T) {
+	t.Parallel()
+
+	ndr := func(amount types.Amount) types.Value {
+		return types.Value{Amount: amount, Token: types.Token0}
+	}
+	stb := func(amount types.Amount) types.Value {
+		return types.Value{Amount: amount, Token: types.Token1}
+	}
+	newTx := func(inputs int, outputs ...types.Value) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		for i := 0; i < inputs; i++ {
+			prevOut := wire.NewOutPoint(&chainhash.Hash{1}, uint32(i))
+			tx.AddTxIn(wire.NewTxIn(prevOut, nil, nil))
+		}
+		for _, value := range outputs {
+			tx.AddTxOut(wire.NewTxOut(value, nil))
+		}
+		return tx
+	}
+
+	// The coinbase creates 50 STB, the regular transaction pays a fee of
+	// 1 NDR and destroys no STB, and the two orders buy 30 STB for 3 NDR
+	// and 20 STB for 2 NDR, paying a fee of 1 NDR each.
+	coinbase := newTx(0, ndr(102), stb(50))
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		math.MaxUint32), nil, nil))
+	msgBlock := wire.MsgBlock{Transactions: []*wire.MsgTx{
+		coinbase,
+		newTx(2, ndr(9), stb(10)),
+		newTx(1, stb(30)),
+		newTx(1, stb(20)),
+	}}
+	stxos := []blockchain.SpentTxOut{
+		{Amount: 10},
+		{Amount: 10, Token: types.Token1},
+		{Amount: 4},
+		{Amount: 3},
+	}
+	block := chainutil.NewBlock(&msgBlock)
+	block.SetHeight(100)
+
+	entry, err := calcSupplyEntry(block, stxos)
+	if err != nil {
+		t.Fatalf("calcSupplyEntry: unexpected error: %v", err)
+	}
+	want := &SupplyEntry{
+		Hash:           *block.Hash(),
+		Height:         100,
+		SupplyChange:   100,
+		AbsorptionRate: blockchain.NoPrice,
+		FilledOrders:   2,
+		OrderSTB:       50,
+		OrderNDR:       -7,
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Fatalf("calcSupplyEntry: mismatched entry - got %+v, want %+v",
+			entry, want)
+	}
+
+	// The entry round trips with its absorption rate.
+	entry.AbsorptionRate = -blockchain.PriceUnit
+	serialized := serializeSupplyEntry(entry)
+	got, err := deserializeSupplyEntry(serialized, entry.Height)
+	if err != nil {
+		t.Fatalf("deserializeSupplyEntry: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, entry) || !got.Absorption() {
+		t.Fatalf("deserializeSupplyEntry: mismatched entry - got %+v, "+
+			"want %+v", got, entry)
+	}
+
+	// The spent outputs of all the inputs are required.
+	_, err = calcSupplyEntry(block, stxos[:3])
+	if _, ok := err.(blockchain.AssertError); !ok {
+		t.Fatalf("calcSupplyEntry: unexpected error with missing spent "+
+			"outputs: %v", err)
+	}
+}
@@ -7,6 +7,11 @@ package blockchain
 
 import (
 	"fmt"
+	"math/big"
+
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/types"
 )
 
 // NotificationType represents the type of a notification message.
@@ -30,6 +35,30 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTAbsorptionStarted indicates the associated block connected to the
+	// main chain triggered an absorption.
+	NTAbsorptionStarted
+
+	// NTAbsorptionEnded indicates the associated block connected to the
+	// main chain is the last block of an absorption.
+	NTAbsorptionEnded
+
+	// NTOrderFilled indicates an order was filled by a block connected to
+	// the main chain.
+	NTOrderFilled
+
+	// NTAbsorptionStartReverted indicates the associated block which
+	// triggered an absorption was disconnected from the main chain.
+	NTAbsorptionStartReverted
+
+	// NTAbsorptionEndReverted indicates the associated block which was the
+	// last block of an absorption was disconnected from the main chain.
+	NTAbsorptionEndReverted
+
+	// NTOrderFillReverted indicates an order filled by a block was
+	// returned by disconnecting the block from the main chain.
+	NTOrderFillReverted
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
@@ -38,6 +67,21 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTAbsorptionStarted: "NTAbsorptionStarted",
+	NTAbsorptionEnded:   "NTAbsorptionEnded",
+	NTOrderFilled:       "NTOrderFilled",
+
+	NTAbsorptionStartReverted: "NTAbsorptionStartReverted",
+	NTAbsorptionEndReverted:   "NTAbsorptionEndReverted",
+	NTOrderFillReverted:       "NTOrderFillReverted",
+}
+
+// revertedNotificationTypes maps the types of the absorption and order fill
+// notifications to the types of the notifications which revert them.
+var revertedNotificationTypes = map[NotificationType]NotificationType{
+	NTAbsorptionStarted: NTAbsorptionStartReverted,
+	NTAbsorptionEnded:   NTAbsorptionEndReverted,
+	NTOrderFilled:       NTOrderFillReverted,
 }
 
 // String returns the NotificationType in human-readable form.
@@ -54,11 +98,62 @@ func (n NotificationType) String() string {
 // 	- NTBlockAccepted:     *chainutil.Block
 // 	- NTBlockConnected:    *chainutil.Block
 // 	- NTBlockDisconnected: *chainutil.Block
+// 	- NTAbsorptionStarted: *AbsorptionNtfnsData
+// 	- NTAbsorptionEnded:   *AbsorptionNtfnsData
+// 	- NTOrderFilled:       *OrderFilledNtfnsData
+// 	- NTAbsorptionStartReverted: *AbsorptionNtfnsData
+// 	- NTAbsorptionEndReverted:   *AbsorptionNtfnsData
+// 	- NTOrderFillReverted:       *OrderFilledNtfnsData
+//
+// The absorption and order notifications of a block are sent after its
+// NTBlockConnected notification.  When the block is disconnected, they are
+// reverted in reverse order after its NTBlockDisconnected notification, by the
+// matching reverted notifications carrying the same data.
 type Notification struct {
 	Type NotificationType
 	Data interface{}
 }
 
+// AbsorptionNtfnsData describes an absorption for the NTAbsorptionStarted and
+// NTAbsorptionEnded notifications.
+type AbsorptionNtfnsData struct {
+	// Block is the connected or disconnected block, which triggered the
+	// absorption when it started, or which is its last block when it
+	// ended.
+	Block *chainutil.Block
+
+	// AbsorptionHash and AbsorptionHeight identify the block which
+	// triggered the absorption.
+	AbsorptionHash   chainhash.Hash
+	AbsorptionHeight int32
+
+	// Rate is the absorption rate, which is the median price of the epoch
+	// ending at the block which triggered the absorption.
+	Rate Price
+
+	// Absorption is the total amount of STB to absorb, which is negative
+	// when the supply contracts, and Absorbed is the amount absorbed up to
+	// and including the connected block.
+	Absorption *big.Int
+	Absorbed   *big.Int
+}
+
+// OrderFilledNtfnsData describes an order filled by a block for the
+// NTOrderFilled notification.
+type OrderFilledNtfnsData struct {
+	// Block is the connected or disconnected block and Order is the
+	// filled order.
+	Block *chainutil.Block
+	Order *chainutil.Tx
+
+	// Rate is the rate of the absorption the order was filled for.
+	Rate Price
+
+	// Balance is the net amount of each token received by the order,
+	// which is negative for the token it paid, fees included.
+	Balance types.Balance
+}
+
 // Subscribe to block chain notifications. Registers a callback to be executed
 // when various events take place. See the documentation on Notification and
 // NotificationType for details on the types and contents of notifications.
@@ -80,3 +175,94 @@ func (b *BlockChain) sendNotification(typ NotificationType, data interface{}) {
 	}
 	b.notificationsLock.RUnlock()
 }
+
+// absorptionNotifications returns the notifications for the absorption ended
+// or started by the passed node, which was just connected to the main chain
+// with the passed block, spent outputs and resulting total supply of STB,
+// followed by the ones for the orders the block filled.  An absorption which is
+// superseded by another one before its last block does not end.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) absorptionNotifications(node *blockNode, block *chainutil.Block,
+	stxos []SpentTxOut, totalSupply *big.Int) ([]Notification, error) {
+
+	var ntfns []Notification
+	epoch := b.chainParams.BlockPerTimespan
+	parentAbsn, parentAbsorbed := findLastAbsorption(node.parent)
+	if parentAbsn != nil && node.height-parentAbsn.height == epoch {
+		// The node is the last block of the absorption of its parent,
+		// so the absorption is computed from the supply before it.
+		parentSupply := new(big.Int).Sub(totalSupply, node.supplyChange)
+		absorption, err := b.calcLastAbsorption(node.parent, parentSupply)
+		if err != nil {
+			return nil, err
+		}
+		ntfns = append(ntfns, Notification{Type: NTAbsorptionEnded, Data: &AbsorptionNtfnsData{
+			Block:            block,
+			AbsorptionHash:   parentAbsn.hash,
+			AbsorptionHeight: parentAbsn.height,
+			Rate:             node.parent.absorption.rate,
+			Absorption:       absorption,
+			Absorbed:         new(big.Int).Add(parentAbsorbed, node.supplyChange),
+		}})
+	}
+
+	if node.status.Absorption() {
+		absorption, err := b.calcLastAbsorption(node, totalSupply)
+		if err != nil {
+			return nil, err
+		}
+		ntfns = append(ntfns, Notification{Type: NTAbsorptionStarted, Data: &AbsorptionNtfnsData{
+			Block:            block,
+			AbsorptionHash:   node.hash,
+			AbsorptionHeight: node.height,
+			Rate:             node.absorption.rate,
+			Absorption:       absorption,
+			Absorbed:         new(big.Int),
+		}})
+	}
+
+	// The orders of the block are filled for the absorption of its parent.
+	balances, err := TxBalances(block, stxos)
+	if err != nil {
+		return nil, err
+	}
+	for i, tx := range block.Transactions() {
+		if IsCoinBase(tx) || !IsOrderBalance(&balances[i]) {
+			continue
+		}
+		ntfns = append(ntfns, Notification{Type: NTOrderFilled, Data: &OrderFilledNtfnsData{
+			Block:   block,
+			Order:   tx,
+			Rate:    node.parent.absorption.rate,
+			Balance: balances[i],
+		}})
+	}
+
+	return ntfns, nil
+}
+
+// revertedNotifications returns the notifications reverting the absorption and
+// order fill notifications of the passed node, which is about to be
+// disconnected from the main chain with the passed block, spent outputs and
+// total supply of STB up to and including it.  They are in reverse order of the
+// notifications sent when the node was connected.
+//
+// This function MUST be called with the chain state lock held (for writes), and
+// before the absorption status of the node is unset.
+func (b *BlockChain) revertedNotifications(node *blockNode, block *chainutil.Block,
+	stxos []SpentTxOut, totalSupply *big.Int) ([]Notification, error) {
+
+	ntfns, err := b.absorptionNotifications(node, block, stxos, totalSupply)
+	if err != nil {
+		return nil, err
+	}
+	reverted := make([]Notification, 0, len(ntfns))
+	for i := len(ntfns) - 1; i >= 0; i-- {
+		reverted = append(reverted, Notification{
+			Type: revertedNotificationTypes[ntfns[i].Type],
+			Data: ntfns[i].Data,
+		})
+	}
+	return reverted, nil
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/txscript"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// A block may fill the last order it absorbs only partially, so the absorption
+// can be used up completely even when the order at the boundary is bigger than
+// what is left of it.  A partial fill is encoded as follows:
+//
+//   - The coinbase transaction commits to the amount of the token bought by
+//     the order which is left unfilled, in an output whose public key script is
+//     OP_RETURN OP_DATA_12 {0x70666c6c || unfilled amount as uint64 LE}.
+//   - The partially filled order is the last transaction of the block.  It is
+//     the original order signed by its owner, with the unfilled amount taken
+//     from its first output of the bought token, and with one more output
+//     appended which returns the unfilled share of the sold token to the
+//     owner as change.
+//   - The change is the sold amount of the original order multiplied by the
+//     unfilled amount and divided by the bought amount, rounded down.  It is
+//     paid to the public key script of the output spent by the first input.
+//
+// As the partially filled order is not the transaction signed by the owner,
+// the scripts of its inputs are validated against the original order, which
+// is restored from the partial fill and the committed unfilled amount.
+
+const (
+	// PartialFillPkScriptLength is the length of the public key script
+	// containing an OP_RETURN, the PartialFillMagicBytes, and the unfilled
+	// amount of the partially filled order.
+	PartialFillPkScriptLength = 14
+)
+
+var (
+	// PartialFillMagicBytes is the prefix marker within the public key
+	// script of a coinbase output to indicate that this output commits to
+	// the partial fill of the last order of the block.
+	PartialFillMagicBytes = []byte{
+		txscript.OP_RETURN,
+		txscript.OP_DATA_12,
+		0x70,
+		0x66,
+		0x6c,
+		0x6c,
+	}
+)
+
+// PartialFillScript returns the public key script of the coinbase output which
+// commits to leaving the passed amount of the last order of the block
+// unfilled.
+func PartialFillScript(unfilled types.Amount) []byte {
+	script := make([]byte, PartialFillPkScriptLength)
+	copy(script, PartialFillMagicBytes)
+	binary.LittleEndian.PutUint64(script[len(PartialFillMagicBytes):],
+		uint64(unfilled))
+	return script
+}
+
+// ExtractPartialFill attempts to locate, and return the unfilled amount of
+// the partially filled order committed to by the passed coinbase transaction.
+// The function additionally returns a boolean indicating if the commitment was
+// located within any of the outputs of the transaction.
+func ExtractPartialFill(tx *chainutil.Tx) (types.Amount, bool) {
+	// The commitment *must* be located within one of the coinbase
+	// transaction's outputs.
+	if !IsCoinBase(tx) {
+		return 0, false
+	}
+
+	msgTx := tx.MsgTx()
+	for i := len(msgTx.TxOut) - 1; i >= 0; i-- {
+		pkScript := msgTx.TxOut[i].PkScript
+		if len(pkScript) == PartialFillPkScriptLength &&
+			bytes.HasPrefix(pkScript, PartialFillMagicBytes) {
+
+			unfilled := binary.LittleEndian.Uint64(
+				pkScript[len(PartialFillMagicBytes):])
+			return types.Amount(unfilled), true
+		}
+	}
+
+	return 0, false
+}
+
+// orderTokens returns the token bought and the token sold by an order with the
+// passed balance.
+func orderTokens(balance *types.Balance) (bought, sold types.Token, err error) {
+	switch {
+	case balance.Amount(types.Token0) > 0 && balance.Amount(types.Token1) < 0:
+		return types.Token0, types.Token1, nil
+	case balance.Amount(types.Token1) > 0 && balance.Amount(types.Token0) < 0:
+		return types.Token1, types.Token0, nil
+	}
+	str := fmt.Sprintf("balance %v does not exchange one token for "+
+		"the other", balance)
+	return 0, 0, ruleError(ErrBadPartialFill, str)
+}
+
+// NewPartialFill returns the transaction which fills the passed order only
+// partially, leaving the passed amount of the token it buys unfilled.  The
+// balance must be the one of the order as returned by CheckTransactionInputs,
+// and changeScript the public key script of the output spent by its first
+// input.
+func NewPartialFill(order *wire.MsgTx, balance *types.Balance,
+	changeScript []byte, unfilled types.Amount) (*wire.MsgTx, error) {
+
+	bought, sold, err := orderTokens(balance)
+	if err != nil {
+		return nil, err
+	}
+
+	boughtAmount := balance.Amount(bought)
+	if unfilled <= 0 || unfilled >= boughtAmount {
+		str := fmt.Sprintf("unfilled amount %v is out of range for "+
+			"an order buying %v", unfilled, boughtAmount)
+		return nil, ruleError(ErrBadPartialFill, str)
+	}
+
+	// Take the unfilled amount from the first output of the bought token.
+	fill := order.Copy()
+	var filledOut *wire.TxOut
+	for _, txOut := range fill.TxOut {
+		if txOut.Value.Token == bought {
+			filledOut = txOut
+			break
+		}
+	}
+	if filledOut == nil || filledOut.Value.Amount < unfilled {
+		str := fmt.Sprintf("order has no output of %v to leave %v "+
+			"unfilled", bought, unfilled)
+		return nil, ruleError(ErrBadPartialFill, str)
+	}
+	filledOut.Value.Amount -= unfilled
+
+	// Return the unfilled share of the sold token as change.  The product
+	// can exceed 64 bits, so it's calculated with big integers.
+	change := new(big.Int).Mul((-balance.Amount(sold)).BigInt(),
+		unfilled.BigInt())
+	change.Div(change, boughtAmount.BigInt())
+	fill.AddTxOut(wire.NewTxOut(types.Value{
+		Amount: types.Amount(change.Int64()),
+		Token:  sold,
+	}, changeScript))
+
+	return fill, nil
+}
+
+// RestorePartialFill returns the original order the passed partially filled
+// order was derived from by leaving the passed amount unfilled.  It is the
+// counterpart of NewPartialFill.
+func RestorePartialFill(fill *wire.MsgTx, unfilled types.Amount) (*wire.MsgTx, error) {
+	if len(fill.TxOut) < 2 {
+		str := "partially filled order has no change output"
+		return nil, ruleError(ErrBadPartialFill, str)
+	}
+
+	order := fill.Copy()
+	change := order.TxOut[len(order.TxOut)-1]
+	order.TxOut = order.TxOut[:len(order.TxOut)-1]
+	for _, txOut := range order.TxOut {
+		if txOut.Value.Token != change.Value.Token {
+			txOut.Value.Amount += unfilled
+			return order, nil
+		}
+	}
+
+	str := "partially filled order has no output of the bought token"
+	return nil, ruleError(ErrBadPartialFill, str)
+}
+
+// RestorePartialFills returns the transactions of the passed block, with the
+// partially filled order, if any, replaced by the original order it was
+// derived from.  The original order is what the owner broadcast to the
+// network, so this is the view of the block the memory pool is interested in.
+func RestorePartialFills(block *chainutil.Block) []*chainutil.Tx {
+	txns := block.Transactions()
+	if len(txns) < 2 {
+		return txns
+	}
+	unfilled, ok := ExtractPartialFill(txns[0])
+	if !ok {
+		return txns
+	}
+
+	last := len(txns) - 1
+	order, err := RestorePartialFill(txns[last].MsgTx(), unfilled)
+	if err != nil {
+		return txns
+	}
+
+	restored := make([]*chainutil.Tx, len(txns))
+	copy(restored, txns)
+	restored[last] = chainutil.NewTx(order)
+	return restored
+}
+
+// checkPartialFill ensures the passed transaction is the partial fill of an
+// order leaving the passed amount unfilled, exactly as NewPartialFill derives
+// it.  The original order is returned so its scripts can be validated in place
+// of the partial fill.
+//
+// The passed view must contain the outputs spent by the transaction.
+func checkPartialFill(tx *chainutil.Tx, unfilled types.Amount, txHeight int32,
+	view *UtxoViewpoint, chainParams *chaincfg.Params) (*chainutil.Tx, error) {
+
+	if IsCoinBase(tx) {
+		str := "the partially filled order must not be a coinbase"
+		return nil, ruleError(ErrBadPartialFill, str)
+	}
+
+	orderTx, err := RestorePartialFill(tx.MsgTx(), unfilled)
+	if err != nil {
+		return nil, err
+	}
+	order := chainutil.NewTx(orderTx)
+	if err := CheckTransactionSanity(order); err != nil {
+		return nil, err
+	}
+
+	balance, err := CheckTransactionInputs(order, txHeight, view,
+		chainParams)
+	if err != nil {
+		return nil, err
+	}
+	if !IsOrderBalance(balance) {
+		str := fmt.Sprintf("partially filled transaction %v is not "+
+			"an order", order.Hash())
+		return nil, ruleError(ErrBadPartialFill, str)
+	}
+
+	utxo := view.LookupEntry(orderTx.TxIn[0].PreviousOutPoint)
+	fill, err := NewPartialFill(orderTx, balance, utxo.PkScript(), unfilled)
+	if err != nil {
+		return nil, err
+	}
+	if fill.TxHash() != *tx.Hash() {
+		str := fmt.Sprintf("transaction %v is not the partial fill of "+
+			"order %v leaving %v unfilled", tx.Hash(), order.Hash(),
+			unfilled)
+		return nil, ruleError(ErrBadPartialFill, str)
+	}
+
+	return order, nil
+}
+
+// CheckOrderAbsorption ensures an order with the passed balance can be mined
+// with the passed absorption, and adds the STB it absorbs to accAbsorption.
+// The orders mined in a block must follow the direction of the absorption and
+// must not absorb more than it in total.
+func CheckOrderAbsorption(balance *types.Balance, absorption,
+	accAbsorption *big.Int) error {
+
+	if absorption == nil || absorption.Sign() == 0 {
+		return ruleError(ErrBadAbsorption,
+			"Order cannot be mined when there is no absorption.")
+	}
+	absnSign := absorption.Sign()
+	balanceSTB := balance.Amount(types.Token1)
+	if (absnSign > 0) != (balanceSTB > 0) {
+		return ruleError(ErrBadAbsorption, "Wrong order direction to mine.")
+	}
+	if (balanceSTB > 0) == (balance.Amount(types.Token0) > 0) {
+		return ruleError(ErrBadAbsorption,
+			"Invalid order: one token must be exchanged for the other.")
+	}
+	accAbsorption.Add(accAbsorption, balanceSTB.BigInt())
+	if accAbsorption.Cmp(absorption) == absnSign {
+		return ruleError(ErrBadAbsorption, "Over absorbed.")
+	}
+
+	return nil
+}
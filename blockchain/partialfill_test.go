@@ -0,0 +1,359 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/txscript"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// isRuleErrorCode returns whether or not the passed error is a RuleError with
+// the passed error code.
+func isRuleErrorCode(err error, code ErrorCode) bool {
+	rerr, ok := err.(RuleError)
+	return ok && rerr.ErrorCode == code
+}
+
+// TestPartialFillCommitment ensures the unfilled amount committed to by a
+// coinbase output can be extracted back, and only from a coinbase.
+func TestPartialFillCommitment(t *testing.T) {
+	t.Parallel()
+
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&zeroHash,
+		wire.MaxPrevOutIndex), []byte{0x51, 0x51}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(types.Value{Amount: 50}, []byte{0x51}))
+
+	if _, ok := ExtractPartialFill(chainutil.NewTx(coinbase)); ok {
+		t.Fatal("ExtractPartialFill: found commitment in a coinbase " +
+			"without one")
+	}
+
+	const unfilled = types.Amount(123456789)
+	coinbase.AddTxOut(wire.NewTxOut(types.Value{},
+		PartialFillScript(unfilled)))
+	got, ok := ExtractPartialFill(chainutil.NewTx(coinbase))
+	if !ok || got != unfilled {
+		t.Fatalf("ExtractPartialFill: got %v (found %v), want %v", got,
+			ok, unfilled)
+	}
+
+	// The commitment must be ignored outside of a coinbase.
+	regular := coinbase.Copy()
+	regular.TxIn[0].PreviousOutPoint.Index = 0
+	if _, ok := ExtractPartialFill(chainutil.NewTx(regular)); ok {
+		t.Fatal("ExtractPartialFill: found commitment in a regular " +
+			"transaction")
+	}
+}
+
+// TestPartialFill ensures partial fills are derived from and restored to
+// their original orders, and that only the canonical partial fill of an order
+// is accepted.
+func TestPartialFill(t *testing.T) {
+	t.Parallel()
+
+	changeScript := []byte{0x51}
+
+	// The order sells the 1000 NDR of the previous output for 500 STB.
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 7}, nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(types.Value{
+		Amount: 1000,
+		Token:  types.Token0,
+	}, changeScript))
+	order := wire.NewMsgTx(wire.TxVersion)
+	prevHash := prevTx.TxHash()
+	order.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil, nil))
+	order.AddTxOut(wire.NewTxOut(types.Value{
+		Amount: 500,
+		Token:  types.Token1,
+	}, []byte{0x52}))
+	balance := types.NewBalance(-1000, 500)
+
+	view := NewUtxoViewpoint()
+	view.AddTxOuts(chainutil.NewTx(prevTx), 1)
+	params := &chaincfg.RegressionNetParams
+
+	tests := []struct {
+		name     string
+		unfilled types.Amount
+		change   types.Amount // NDR returned, or -1 when rejected
+	}{
+		{name: "two fifths unfilled", unfilled: 200, change: 400},
+		{name: "change rounded down", unfilled: 3, change: 6},
+		{name: "one atom unfilled", unfilled: 1, change: 2},
+		{name: "nothing unfilled", unfilled: 0, change: -1},
+		{name: "everything unfilled", unfilled: 500, change: -1},
+	}
+
+	for _, test := range tests {
+		fill, err := NewPartialFill(order, balance, changeScript,
+			test.unfilled)
+		if test.change < 0 {
+			if !isRuleErrorCode(err, ErrBadPartialFill) {
+				t.Errorf("%s: NewPartialFill: unexpected error %v",
+					test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: NewPartialFill: unexpected error %v",
+				test.name, err)
+			continue
+		}
+
+		change := fill.TxOut[len(fill.TxOut)-1]
+		if change.Value.Token != types.Token0 ||
+			change.Value.Amount != test.change {
+
+			t.Errorf("%s: got change %v, want %v NDR", test.name,
+				change.Value, test.change)
+		}
+		if got := fill.TxOut[0].Value.Amount; got != 500-test.unfilled {
+			t.Errorf("%s: got filled amount %v, want %v", test.name,
+				got, 500-test.unfilled)
+		}
+
+		restored, err := RestorePartialFill(fill, test.unfilled)
+		if err != nil || restored.TxHash() != order.TxHash() {
+			t.Errorf("%s: RestorePartialFill: did not restore the "+
+				"order (err %v)", test.name, err)
+		}
+
+		fillTx := chainutil.NewTx(fill)
+		got, err := checkPartialFill(fillTx, test.unfilled, 2, view,
+			params)
+		if err != nil {
+			t.Errorf("%s: checkPartialFill: unexpected error %v",
+				test.name, err)
+		} else if *got.Hash() != order.TxHash() {
+			t.Errorf("%s: checkPartialFill: got order %v, want %v",
+				test.name, got.Hash(), order.TxHash())
+		}
+
+		// Committing to a different unfilled amount or tampering with
+		// the change must be rejected.
+		_, err = checkPartialFill(fillTx, test.unfilled+1, 2, view,
+			params)
+		if err == nil {
+			t.Errorf("%s: checkPartialFill: accepted a wrong "+
+				"unfilled amount", test.name)
+		}
+		change.Value.Amount++
+		_, err = checkPartialFill(chainutil.NewTx(fill), test.unfilled,
+			2, view, params)
+		if !isRuleErrorCode(err, ErrBadPartialFill) {
+			t.Errorf("%s: checkPartialFill: unexpected error for a "+
+				"tampered change %v", test.name, err)
+		}
+	}
+}
+
+// TestCheckOrderAbsorption ensures the orders of a block must follow the
+// direction of the absorption and must not exceed it in total.
+func TestCheckOrderAbsorption(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		absorption *big.Int
+		balances   []*types.Balance
+		err        bool // whether the last balance is rejected
+	}{
+		{
+			name:     "no absorption",
+			balances: []*types.Balance{types.NewBalance(-10, 10)},
+			err:      true,
+		},
+		{
+			name:       "zero absorption",
+			absorption: big.NewInt(0),
+			balances:   []*types.Balance{types.NewBalance(-10, 10)},
+			err:        true,
+		},
+		{
+			name:       "asks within absorption",
+			absorption: big.NewInt(20),
+			balances: []*types.Balance{
+				types.NewBalance(-10, 10),
+				types.NewBalance(-10, 10),
+			},
+		},
+		{
+			name:       "asks over absorbed",
+			absorption: big.NewInt(20),
+			balances: []*types.Balance{
+				types.NewBalance(-10, 10),
+				types.NewBalance(-10, 11),
+			},
+			err: true,
+		},
+		{
+			name:       "bid against inflation",
+			absorption: big.NewInt(20),
+			balances:   []*types.Balance{types.NewBalance(10, -10)},
+			err:        true,
+		},
+		{
+			name:       "bids within absorption",
+			absorption: big.NewInt(-20),
+			balances:   []*types.Balance{types.NewBalance(10, -20)},
+		},
+		{
+			name:       "buying both tokens",
+			absorption: big.NewInt(20),
+			balances:   []*types.Balance{types.NewBalance(10, 10)},
+			err:        true,
+		},
+	}
+
+	for _, test := range tests {
+		accAbsorption := new(big.Int)
+		var err error
+		for i, balance := range test.balances {
+			err = CheckOrderAbsorption(balance, test.absorption,
+				accAbsorption)
+			if err != nil && i != len(test.balances)-1 {
+				t.Errorf("%s: balance %d: unexpected error %v",
+					test.name, i, err)
+			}
+		}
+		if test.err != isRuleErrorCode(err, ErrBadAbsorption) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+}
+
+// TestPartialFillDeployment ensures the coinbase commitment to a partial fill
+// is only enforced once the partial fill deployment is active, and that a
+// block with a valid partial fill is accepted then.
+func TestPartialFillDeployment(t *testing.T) {
+	opTrueScript := []byte{txscript.OP_TRUE}
+
+	// The order sells the 100 NDR of the first coinbase for 30 STB, and its
+	// partial fill leaves 10 STB of it unfilled.
+	const unfilled = types.Amount(10)
+	newOrder := func(prevOut *wire.OutPoint) (*wire.MsgTx, *wire.MsgTx) {
+		order := wire.NewMsgTx(wire.TxVersion)
+		order.AddTxIn(wire.NewTxIn(prevOut, nil, nil))
+		order.AddTxOut(wire.NewTxOut(types.Value{
+			Amount: 30,
+			Token:  types.Token1,
+		}, opTrueScript))
+		fill, err := NewPartialFill(order, types.NewBalance(-100, 30),
+			opTrueScript, unfilled)
+		if err != nil {
+			t.Fatalf("NewPartialFill: unexpected error: %v", err)
+		}
+		return order, fill
+	}
+
+	tests := []struct {
+		name   string
+		active bool
+		last   func(order, fill *wire.MsgTx) *wire.MsgTx
+		err    bool // whether the block is rejected with ErrBadPartialFill
+	}{
+		{
+			name: "commitment ignored before activation",
+			last: func(order, fill *wire.MsgTx) *wire.MsgTx { return order },
+		},
+		{
+			name:   "commitment without a partial fill",
+			active: true,
+			last:   func(order, fill *wire.MsgTx) *wire.MsgTx { return order },
+			err:    true,
+		},
+		{
+			name:   "partial fill",
+			active: true,
+			last:   func(order, fill *wire.MsgTx) *wire.MsgTx { return fill },
+		},
+		{
+			name:   "partial fill with excess change",
+			active: true,
+			last: func(order, fill *wire.MsgTx) *wire.MsgTx {
+				fill.TxOut[len(fill.TxOut)-1].Value.Amount++
+				return fill
+			},
+			err: true,
+		},
+	}
+
+	for i, test := range tests {
+		// A deployment which starts at zero is active from the genesis
+		// block, while the regression test network one is only voted
+		// in after several confirmation windows.
+		params := chaincfg.RegressionNetParams
+		if test.active {
+			params.Deployments[chaincfg.DeploymentPartialFill].StartTime = 0
+		}
+		c, teardown := newAbsorptionTestChain(t,
+			fmt.Sprintf("partialfilldeployment%d", i), params)
+
+		// Pay-to-script-hash, which the script validation requires
+		// alongside segwit, is only enforced for the blocks after its
+		// activation time.  The third block triggers an absorption the
+		// next block fills the order with.
+		c.timestamp = txscript.Bip16Activation
+		var firstCoinbase *chainutil.Tx
+		for i := 0; i < 3; i++ {
+			node, block := c.newBlock(c.bc.bestChain.Tip(), PriceUnit)
+			c.connect(node, block)
+			if i == 0 {
+				firstCoinbase = block.Transactions()[0]
+			}
+		}
+		order, fill := newOrder(wire.NewOutPoint(firstCoinbase.Hash(), 0))
+
+		tip := c.bc.bestChain.Tip()
+		header := wire.BlockHeader{
+			Version:         1,
+			PrevBlock:       tip.hash,
+			Bits:            0x207fffff,
+			Timestamp:       c.timestamp.Add(time.Second),
+			PriceDerivation: int64(PriceUnit),
+		}
+		coinbase := wire.NewMsgTx(wire.TxVersion)
+		coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&zeroHash,
+			wire.MaxPrevOutIndex), []byte{byte(tip.height + 1)}, nil))
+		coinbase.AddTxOut(wire.NewTxOut(types.Value{Amount: 50},
+			opTrueScript))
+		coinbase.AddTxOut(wire.NewTxOut(types.Value{},
+			PartialFillScript(unfilled)))
+		block := chainutil.NewBlock(&wire.MsgBlock{
+			Header: header,
+			Transactions: []*wire.MsgTx{coinbase,
+				test.last(order, fill)},
+		})
+		node := newBlockNode(&header, tip)
+		block.SetHeight(node.height)
+
+		view := NewUtxoViewpoint()
+		view.SetBestHash(&tip.hash)
+		var stxos []SpentTxOut
+		c.bc.chainLock.Lock()
+		err := c.bc.checkConnectBlock(node, block, view, &stxos)
+		c.bc.chainLock.Unlock()
+		teardown()
+
+		if test.err {
+			if !isRuleErrorCode(err, ErrBadPartialFill) {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+}
@@ -9,6 +9,17 @@ import (
 	"math"
 	"sync"
 	"time"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/wire"
+)
+
+const (
+	// PriceUnit is the fixed-point unit of a Price, one part per billion.
+	PriceUnit Price = wire.PriceDerivationUnit
+
+	// NoPrice is the Price of a block which does not provide one.
+	NoPrice Price = wire.NoPriceDerivation
 )
 
 var (
@@ -18,59 +29,147 @@ var (
 	maxPriceEntries = 1024
 )
 
-// Price ...
-type Price float64
+// Price is a price derivation of STB/USD from 1.0 in fixed point, in units of
+// PriceUnit.  Consensus code only computes with prices as integers, so all
+// nodes agree on the results regardless of their floating point behaviour.
+type Price int64
+
+// PriceFromFloat returns the passed floating point price, or price derivation,
+// rounded to the nearest unit of a Price.  NaN and values out of range convert to NoPrice.  It is
+// meant for prices entering the node, such as the fed ones, and must never be
+// used to compute consensus values.
+func PriceFromFloat(f float64) Price {
+	if math.IsNaN(f) {
+		return NoPrice
+	}
+	v := math.Round(f * float64(PriceUnit))
+	if v <= math.MinInt64 || v >= math.MaxInt64 {
+		return NoPrice
+	}
+	return Price(v)
+}
+
+// Float returns the price derivation as a floating point number for display,
+// or NaN for NoPrice.
+func (p Price) Float() float64 {
+	if p == NoPrice {
+		return math.NaN()
+	}
+	return float64(p) / float64(PriceUnit)
+}
+
+// usesFixedPointPrice returns whether the block at the passed height carries
+// its price derivation in fixed point and has its absorption computed with
+// integer arithmetic.
+func usesFixedPointPrice(height int32, params *chaincfg.Params) bool {
+	return height >= params.FixedPointPriceHeight
+}
+
+// legacyPrice returns the floating point price derivation carried by the
+// header of a block below the FixedPointPriceHeight.
+func legacyPrice(priceDerivation int64) float64 {
+	return math.Float64frombits(uint64(priceDerivation))
+}
 
-// PriceDesc ...
+// headerPrice returns the price derivation carried by the header of the block
+// at the passed height.  The floating point price derivation of a block below
+// the FixedPointPriceHeight is rounded to the nearest unit.
+func headerPrice(priceDerivation int64, height int32, params *chaincfg.Params) Price {
+	if usesFixedPointPrice(height, params) {
+		return Price(priceDerivation)
+	}
+	return PriceFromFloat(legacyPrice(priceDerivation))
+}
+
+// HeaderPriceDerivation returns the encoding of the passed price for the
+// header of the block at the passed height.
+func HeaderPriceDerivation(price Price, height int32, params *chaincfg.Params) int64 {
+	if usesFixedPointPrice(height, params) {
+		return int64(price)
+	}
+	return int64(math.Float64bits(price.Float()))
+}
+
+// PriceDesc describes a price along with the time it was observed.
 type PriceDesc struct {
 	Price
 	Timestamp time.Time
 }
 
-// FeedPriceSource provides a mechanism to add several time samples which are
-// used to determine a median time which is then used as an offset to the local
-// clock.
+// FeedPriceSource provides the price derivation of STB/USD to mine, from the
+// market prices fed from outside of the network.  The market price is 1.0 at
+// the peg, and the price derivation to mine is the market price minus 1.0.
 type FeedPriceSource interface {
-	// LastPrice ...
+	// LastPrice returns the price derivation of the last fed price, or
+	// nil when none has been fed.
 	LastPrice() *PriceDesc
+
+	// PriceToMine returns the price derivation to mine, or NoPrice when
+	// the fed prices are not recent enough.
 	PriceToMine() Price
+
+	// FeedPrice feeds the passed market price, which is not a price
+	// derivation.
 	FeedPrice(price Price)
 }
 
-// feedPrice ...
+// feedPrice is a FeedPriceSource which keeps the last fed market price only.
 type feedPrice struct {
-	mtx           sync.Mutex
-	blockTime     time.Duration
-	lastPriceDesc *PriceDesc
+	mtx       sync.Mutex
+	blockTime time.Duration
+	lastPrice *PriceDesc
 }
 
 // Ensure the feedPrice type implements the FeedPriceSource interface.
 var _ FeedPriceSource = (*feedPrice)(nil)
 
-// LastPrice ...
+// LastPrice returns the price derivation of the last fed price, or nil when
+// none has been fed.
+//
+// This is part of the FeedPriceSource interface implementation.
 func (fp *feedPrice) LastPrice() *PriceDesc {
-	return fp.lastPriceDesc
+	fp.mtx.Lock()
+	defer fp.mtx.Unlock()
+
+	if fp.lastPrice == nil {
+		return nil
+	}
+	return &PriceDesc{
+		Price:     fp.lastPrice.Price - PriceUnit,
+		Timestamp: fp.lastPrice.Timestamp,
+	}
 }
 
+// PriceToMine returns the price derivation of the last fed price, or NoPrice
+// when it is older than one block time.
+//
+// This is part of the FeedPriceSource interface implementation.
 func (fp *feedPrice) PriceToMine() Price {
-	if fp.lastPriceDesc == nil {
-		return Price(math.NaN())
+	last := fp.LastPrice()
+	if last == nil {
+		return NoPrice
 	}
-	duration := time.Since(fp.lastPriceDesc.Timestamp)
+	duration := time.Since(last.Timestamp)
 	if duration < 0 || fp.blockTime < duration {
-		return Price(math.NaN())
+		return NoPrice
 	}
-	return fp.lastPriceDesc.Price
+	return last.Price
 }
 
+// FeedPrice feeds the passed market price.
+//
+// This is part of the FeedPriceSource interface implementation.
 func (fp *feedPrice) FeedPrice(price Price) {
-	fp.lastPriceDesc = &PriceDesc{
-		Price:     price - 1.0,
+	fp.mtx.Lock()
+	fp.lastPrice = &PriceDesc{
+		Price:     price,
 		Timestamp: time.Now(),
 	}
+	fp.mtx.Unlock()
 }
 
-// NewFeedPrice ...
+// NewFeedPrice returns a new FeedPriceSource which keeps the last fed market
+// price only, and provides it to mine for one block time.
 func NewFeedPrice(blockTime time.Duration) FeedPriceSource {
 	return &feedPrice{
 		blockTime: blockTime,
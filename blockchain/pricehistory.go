@@ -0,0 +1,293 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PriceStats houses the statistics of the prices carried by the headers of a
+// set of blocks.  The price fields are NoPrice when none of the blocks carries
+// a price.
+type PriceStats struct {
+	Blocks   int // The number of blocks.
+	NoPrices int // The number of blocks which do not carry a price.
+
+	// Mean is truncated toward zero, and Median is the mean of the two
+	// middle prices when there is an even number of them.
+	Mean   Price
+	Median Price
+	Min    Price
+	Max    Price
+}
+
+// MinerPriceStats houses the price statistics of the blocks signed by a miner.
+type MinerPriceStats struct {
+	// MinerKey is the hash160 of the public key recovered from the block
+	// signatures, or nil for the blocks whose key cannot be recovered.
+	MinerKey []byte
+
+	PriceStats
+}
+
+// PriceBucket houses the price statistics of the blocks of the main chain
+// within a range of heights, or of timestamps.
+type PriceBucket struct {
+	// Start and End are the bounds of the bucket, inclusive, either as
+	// heights or as unix timestamps.
+	Start int64
+	End   int64
+
+	PriceStats
+
+	// Miners breaks the statistics of the bucket down per miner, by
+	// decreasing number of blocks.
+	Miners []MinerPriceStats
+}
+
+// priceSet accumulates the prices carried by a set of blocks.
+type priceSet struct {
+	prices   []Price
+	noPrices int
+}
+
+// add adds the passed price to the set.
+func (s *priceSet) add(price Price) {
+	if price == NoPrice {
+		s.noPrices++
+		return
+	}
+	s.prices = append(s.prices, price)
+}
+
+// stats returns the statistics of the prices of the set.
+func (s *priceSet) stats() PriceStats {
+	stats := PriceStats{
+		Blocks:   len(s.prices) + s.noPrices,
+		NoPrices: s.noPrices,
+		Mean:     NoPrice,
+		Median:   NoPrice,
+		Min:      NoPrice,
+		Max:      NoPrice,
+	}
+	if len(s.prices) == 0 {
+		return stats
+	}
+
+	sortPrices(s.prices)
+	stats.Mean = meanPrice(s.prices)
+	stats.Median = medianPrice(s.prices)
+	stats.Min = s.prices[0]
+	stats.Max = s.prices[len(s.prices)-1]
+	return stats
+}
+
+// priceBucketSet accumulates the prices of the blocks of a bucket, along with
+// the prices of each of their miners.
+type priceBucketSet struct {
+	all    priceSet
+	miners map[string]*priceSet
+}
+
+// add adds the price of the passed block node to the bucket.
+func (s *priceBucketSet) add(node *blockNode, price Price) {
+	s.all.add(price)
+
+	minerKey := string(node.MinerKey())
+	miner, ok := s.miners[minerKey]
+	if !ok {
+		miner = new(priceSet)
+		s.miners[minerKey] = miner
+	}
+	miner.add(price)
+}
+
+// bucket returns the statistics of the bucket with the passed bounds.
+func (s *priceBucketSet) bucket(start, end int64) PriceBucket {
+	bucket := PriceBucket{
+		Start:      start,
+		End:        end,
+		PriceStats: s.all.stats(),
+		Miners:     make([]MinerPriceStats, 0, len(s.miners)),
+	}
+	for minerKey, miner := range s.miners {
+		stats := MinerPriceStats{PriceStats: miner.stats()}
+		if minerKey != "" {
+			stats.MinerKey = []byte(minerKey)
+		}
+		bucket.Miners = append(bucket.Miners, stats)
+	}
+	sort.Slice(bucket.Miners, func(i, j int) bool {
+		mi, mj := &bucket.Miners[i], &bucket.Miners[j]
+		if mi.Blocks != mj.Blocks {
+			return mi.Blocks > mj.Blocks
+		}
+		return bytes.Compare(mi.MinerKey, mj.MinerKey) < 0
+	})
+	return bucket
+}
+
+// priceHistoryBlock is a block of the main chain collected for a price history,
+// along with its position and the price carried by its header.
+type priceHistoryBlock struct {
+	node  *blockNode
+	pos   int64
+	price Price
+}
+
+// collectPriceHistory returns the blocks of the main chain between the passed
+// heights, inclusive, whose position is within the passed range.  The position
+// of a block is either its height or its timestamp.  An error is returned when
+// more than maxBlocks blocks are within the range.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) collectPriceHistory(startHeight, endHeight int32,
+	position func(*blockNode) int64, start, end int64,
+	maxBlocks int) ([]priceHistoryBlock, error) {
+
+	var blocks []priceHistoryBlock
+	for height := startHeight; height <= endHeight; height++ {
+		node := b.bestChain.NodeByHeight(height)
+		if node == nil {
+			break
+		}
+		pos := position(node)
+		if pos < start || pos > end {
+			continue
+		}
+		if len(blocks) >= maxBlocks {
+			return nil, fmt.Errorf("the range holds more than %d "+
+				"blocks", maxBlocks)
+		}
+
+		blocks = append(blocks, priceHistoryBlock{
+			node:  node,
+			pos:   pos,
+			price: headerPrice(node.priceDerivation, node.height, b.chainParams),
+		})
+	}
+	return blocks, nil
+}
+
+// priceHistory returns the price buckets of the passed blocks, whose position
+// is within the passed range.  Each bucket spans bucketSize positions, or the
+// whole range when bucketSize is not positive.  Empty buckets are omitted.
+//
+// The miner keys of the blocks are recovered from their signatures, so this
+// function is meant to be called without the chain state lock held.
+func priceHistory(blocks []priceHistoryBlock, start, end, bucketSize int64) []PriceBucket {
+	if bucketSize <= 0 || bucketSize > end-start {
+		bucketSize = end - start + 1
+	}
+
+	sets := make(map[int64]*priceBucketSet)
+	for i := range blocks {
+		block := &blocks[i]
+		index := (block.pos - start) / bucketSize
+		set, ok := sets[index]
+		if !ok {
+			set = &priceBucketSet{miners: make(map[string]*priceSet)}
+			sets[index] = set
+		}
+		set.add(block.node, block.price)
+	}
+
+	indexes := make([]int64, 0, len(sets))
+	for index := range sets {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i] < indexes[j]
+	})
+
+	buckets := make([]PriceBucket, 0, len(indexes))
+	for _, index := range indexes {
+		bucketStart := start + index*bucketSize
+		bucketEnd := bucketStart + bucketSize - 1
+		if bucketEnd > end {
+			bucketEnd = end
+		}
+		buckets = append(buckets, sets[index].bucket(bucketStart, bucketEnd))
+	}
+	return buckets
+}
+
+// PriceHistoryByHeight returns the statistics of the prices carried by the
+// headers of the blocks of the main chain between the passed heights,
+// inclusive, in buckets of bucketSize blocks.  A single bucket spans the whole
+// range when bucketSize is not positive.  The range stops at the tip of the
+// main chain, and an error is returned when it holds more than maxBlocks
+// blocks.
+//
+// The statistics are computed from the block index only, so no block is loaded
+// from the database, and the chain state lock is released before the miner
+// keys are recovered from the block signatures.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PriceHistoryByHeight(start, end, bucketSize int32, maxBlocks int) ([]PriceBucket, error) {
+	b.chainLock.RLock()
+	if tip := b.bestChain.Height(); end > tip {
+		end = tip
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > end {
+		b.chainLock.RUnlock()
+		return nil, nil
+	}
+	if int64(end)-int64(start) >= int64(maxBlocks) {
+		b.chainLock.RUnlock()
+		return nil, fmt.Errorf("the range holds more than %d blocks",
+			maxBlocks)
+	}
+
+	height := func(node *blockNode) int64 {
+		return int64(node.height)
+	}
+	blocks, err := b.collectPriceHistory(start, end, height, int64(start),
+		int64(end), maxBlocks)
+	b.chainLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return priceHistory(blocks, int64(start), int64(end), int64(bucketSize)), nil
+}
+
+// PriceHistoryByTime returns the statistics of the prices carried by the
+// headers of the blocks of the main chain whose timestamps are between the
+// passed times, inclusive, in buckets of bucketSize.  A single bucket spans the
+// whole range when bucketSize is less than a second.  An error is returned
+// when the range holds more than maxBlocks blocks.
+//
+// Since the timestamps of the blocks are not ordered, the whole main chain is
+// scanned.  The statistics are computed from the block index only, so no block
+// is loaded from the database, and the chain state lock is released before the
+// miner keys are recovered from the block signatures.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PriceHistoryByTime(start, end time.Time, bucketSize time.Duration, maxBlocks int) ([]PriceBucket, error) {
+	if start.After(end) {
+		return nil, nil
+	}
+
+	timestamp := func(node *blockNode) int64 {
+		return node.timestamp
+	}
+	b.chainLock.RLock()
+	blocks, err := b.collectPriceHistory(0, b.bestChain.Height(), timestamp,
+		start.Unix(), end.Unix(), maxBlocks)
+	b.chainLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return priceHistory(blocks, start.Unix(), end.Unix(),
+		int64(bucketSize/time.Second)), nil
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chainec"
+	"github.com/endurio/ndrd/wire"
+)
+
+// TestPriceHistory ensures the price history of the main chain is bucketed by
+// height and by time, with the prices of each bucket broken down per miner.
+func TestPriceHistory(t *testing.T) {
+	t.Parallel()
+
+	params := chaincfg.RegressionNetParams
+	bc := newFakeChain(&params)
+
+	keys := make([]*chainec.PrivateKey, 2)
+	for i := range keys {
+		keys[i], _ = chainec.PrivKeyFromBytes(chainec.S256(),
+			[]byte{byte(i + 1)})
+	}
+
+	// Create 6 blocks, 10 seconds apart, whose 3rd block carries no price
+	// and whose 4th block is unsigned.
+	blocks := []struct {
+		miner int // index of the signing key, -1 for an unsigned block
+		price Price
+	}{
+		{0, 100}, {1, 300}, {0, NoPrice}, {-1, 200}, {1, 400}, {0, 600},
+	}
+	base := time.Unix(1261130160, 0)
+	node := bc.bestChain.Tip()
+	for i, b := range blocks {
+		header := &wire.BlockHeader{
+			Version:         1,
+			PrevBlock:       node.hash,
+			Bits:            0x207fffff,
+			Timestamp:       base.Add(time.Duration(i+1) * 10 * time.Second),
+			PriceDerivation: int64(b.price),
+		}
+		if b.miner >= 0 {
+			if _, err := header.Sign(keys[b.miner]); err != nil {
+				t.Fatalf("unable to sign header: %v", err)
+			}
+		}
+		node = newBlockNode(header, node)
+		bc.index.AddNode(node)
+		bc.bestChain.SetTip(node)
+	}
+
+	// Two buckets of 3 blocks.
+	buckets, err := bc.PriceHistoryByHeight(1, 6, 3, 6)
+	if err != nil {
+		t.Fatalf("PriceHistoryByHeight: unexpected error: %v", err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("PriceHistoryByHeight: got %d buckets, want 2",
+			len(buckets))
+	}
+	wantStats := []PriceStats{
+		{Blocks: 3, NoPrices: 1, Mean: 200, Median: 200, Min: 100, Max: 300},
+		{Blocks: 3, NoPrices: 0, Mean: 400, Median: 400, Min: 200, Max: 600},
+	}
+	for i, bucket := range buckets {
+		if bucket.Start != int64(1+3*i) || bucket.End != int64(3+3*i) {
+			t.Errorf("PriceHistoryByHeight: bucket %d spans %d-%d",
+				i, bucket.Start, bucket.End)
+		}
+		if bucket.PriceStats != wantStats[i] {
+			t.Errorf("PriceHistoryByHeight: bucket %d got stats %+v, "+
+				"want %+v", i, bucket.PriceStats, wantStats[i])
+		}
+		if len(bucket.Miners) != 2+i {
+			t.Errorf("PriceHistoryByHeight: bucket %d got %d miners, "+
+				"want %d", i, len(bucket.Miners), 2+i)
+		}
+	}
+
+	// The first miner mined the most blocks of the first bucket, one of
+	// which carries no price.
+	miner := buckets[0].Miners[0]
+	wantMiner := PriceStats{Blocks: 2, NoPrices: 1, Mean: 100, Median: 100,
+		Min: 100, Max: 100}
+	if miner.PriceStats != wantMiner {
+		t.Errorf("PriceHistoryByHeight: got miner stats %+v, want %+v",
+			miner.PriceStats, wantMiner)
+	}
+	wantKey := bc.bestChain.NodeByHeight(1).MinerKey()
+	if len(wantKey) == 0 || !bytes.Equal(miner.MinerKey, wantKey) {
+		t.Errorf("PriceHistoryByHeight: got miner key %x, want %x",
+			miner.MinerKey, wantKey)
+	}
+
+	// A single bucket up to the tip.
+	buckets, err = bc.PriceHistoryByHeight(1, 100, 0, 6)
+	if err != nil {
+		t.Fatalf("PriceHistoryByHeight: unexpected error: %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].Start != 1 || buckets[0].End != 6 ||
+		buckets[0].Blocks != 6 {
+
+		t.Errorf("PriceHistoryByHeight: got whole range buckets %+v",
+			buckets)
+	}
+
+	// Buckets of 20 seconds, from 15 seconds after the base time, which
+	// hold the 2nd and 3rd blocks, then the 4th.
+	buckets, err = bc.PriceHistoryByTime(base.Add(15*time.Second),
+		base.Add(45*time.Second), 20*time.Second, 3)
+	if err != nil {
+		t.Fatalf("PriceHistoryByTime: unexpected error: %v", err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("PriceHistoryByTime: got %d buckets, want 2",
+			len(buckets))
+	}
+	start := base.Unix() + 15
+	if buckets[0].Start != start || buckets[0].End != start+19 ||
+		buckets[0].Blocks != 2 || buckets[0].Median != 300 {
+
+		t.Errorf("PriceHistoryByTime: got first bucket %+v", buckets[0])
+	}
+	if buckets[1].Start != start+20 || buckets[1].End != start+30 ||
+		buckets[1].Blocks != 1 || buckets[1].Median != 200 {
+
+		t.Errorf("PriceHistoryByTime: got second bucket %+v", buckets[1])
+	}
+
+	// Ranges which hold more blocks than the limit are rejected.
+	if _, err := bc.PriceHistoryByHeight(1, 6, 3, 5); err == nil {
+		t.Error("PriceHistoryByHeight: unexpected success past the " +
+			"block limit")
+	}
+	if _, err := bc.PriceHistoryByTime(base.Add(15*time.Second),
+		base.Add(45*time.Second), 20*time.Second, 2); err == nil {
+
+		t.Error("PriceHistoryByTime: unexpected success past the " +
+			"block limit")
+	}
+}
@@ -240,8 +240,11 @@ func ValidateTransactionScripts(tx *chainutil.Tx, utxoView *UtxoViewpoint,
 }
 
 // checkBlockScripts executes and validates the scripts for all transactions in
-// the passed block using multiple goroutines.
-func checkBlockScripts(block *chainutil.Block, utxoView *UtxoViewpoint,
+// the passed block using multiple goroutines.  When the last transaction of the
+// block is a partially filled order, partialFillOrder must be the original
+// order it was derived from, whose scripts are validated in its place.
+func checkBlockScripts(block *chainutil.Block, partialFillOrder *chainutil.Tx,
+	utxoView *UtxoViewpoint,
 	scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache,
 	hashCache *txscript.HashCache) error {
 
@@ -256,7 +259,11 @@ func checkBlockScripts(block *chainutil.Block, utxoView *UtxoViewpoint,
 		numInputs += len(tx.MsgTx().TxIn)
 	}
 	txValItems := make([]*txValidateItem, 0, numInputs)
-	for _, tx := range block.Transactions() {
+	txns := block.Transactions()
+	if partialFillOrder != nil {
+		txns = append(txns[:len(txns)-1:len(txns)-1], partialFillOrder)
+	}
+	for _, tx := range txns {
 		hash := tx.Hash()
 
 		// If the HashCache is present, and it doesn't yet contain the
@@ -309,7 +316,7 @@ func checkBlockScripts(block *chainutil.Block, utxoView *UtxoViewpoint,
 	// longer need the cached hashes for these transactions, so we purge
 	// them from the cache.
 	if segwitActive && hashCache != nil {
-		for _, tx := range block.Transactions() {
+		for _, tx := range txns {
 			if tx.MsgTx().HasWitness() {
 				hashCache.PurgeSigHashes(tx.Hash())
 			}
@@ -292,6 +292,28 @@ func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
 	return state == ThresholdActive, nil
 }
 
+// IsDeploymentActiveAfter returns true if the target deploymentID is active
+// for the blocks extending the known block with the passed hash, and false
+// otherwise.  The rules of a deployment apply to a block when the deployment is
+// active after its parent.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsDeploymentActiveAfter(hash *chainhash.Hash, deploymentID uint32) (bool, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return false, fmt.Errorf("block %s is not known", hash)
+	}
+
+	b.chainLock.Lock()
+	state, err := b.deploymentState(node, deploymentID)
+	b.chainLock.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	return state == ThresholdActive, nil
+}
+
 // deploymentState returns the current rule change threshold for a given
 // deploymentID. The threshold is evaluated from the point of view of the block
 // node passed in as the first argument to this method.
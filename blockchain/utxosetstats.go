@@ -0,0 +1,172 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/database"
+	"github.com/endurio/ndrd/types"
+)
+
+// utxoStatsLogInterval is the minimum time between two progress messages
+// while the utxo set is walked.
+const utxoStatsLogInterval = 10 * time.Second
+
+// UtxoTokenStats houses the statistics of the unspent outputs of a token.
+type UtxoTokenStats struct {
+	Token   types.Token
+	Outputs uint64
+	Amount  big.Int
+}
+
+// UtxoSetStats houses the statistics of the utxo set as of a block of the main
+// chain.
+type UtxoSetStats struct {
+	// Hash and Height identify the best block the utxo set reflects, and
+	// TotalSupply is the total supply of STB in the chain as of that block.
+	Hash        chainhash.Hash
+	Height      int32
+	TotalSupply big.Int
+
+	// Transactions is the number of transactions with unspent outputs and
+	// Outputs the number of unspent outputs.
+	Transactions uint64
+	Outputs      uint64
+
+	// SerializedSize is the size of the utxo set as it is stored, and
+	// SetHash is the hash of the stored set, which only matches the one of
+	// another node with the same set stored in the same format.
+	SerializedSize uint64
+	SetHash        chainhash.Hash
+
+	// Tokens are the statistics of each token with unspent outputs, by
+	// increasing token.
+	Tokens []UtxoTokenStats
+}
+
+// TokenStats returns the statistics of the unspent outputs of the passed token,
+// which are empty when it has none.
+func (s *UtxoSetStats) TokenStats(token types.Token) *UtxoTokenStats {
+	for i := range s.Tokens {
+		if s.Tokens[i].Token == token {
+			return &s.Tokens[i]
+		}
+	}
+	return &UtxoTokenStats{Token: token}
+}
+
+// SupplyMismatch returns the amount of STB of the unspent outputs in excess of
+// the total supply of the chain, which is zero unless the utxo set and the
+// total supply disagree.
+func (s *UtxoSetStats) SupplyMismatch() *big.Int {
+	stb := s.TokenStats(types.Token1)
+	return new(big.Int).Sub(&stb.Amount, &s.TotalSupply)
+}
+
+// UtxoSetStats walks the whole utxo set of the database and returns its
+// statistics, along with the best block and total supply it reflects, all
+// from the same view of the database.  The walk logs its progress, and it
+// returns early with an error when the passed interrupt channel is closed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSetStats(interrupt <-chan struct{}) (*UtxoSetStats, error) {
+	var stats UtxoSetStats
+	tokens := make(map[types.Token]*UtxoTokenStats)
+	err := b.db.View(func(dbTx database.Tx) error {
+		state, err := deserializeBestChainState(
+			dbTx.Metadata().Get(chainStateKeyName))
+		if err != nil {
+			return err
+		}
+		stats.Hash = state.hash
+		stats.Height = int32(state.height)
+		if state.totalSupply != nil {
+			stats.TotalSupply.Set(state.totalSupply)
+		}
+
+		log.Infof("Walking the utxo set as of block %v (height %d)",
+			state.hash, state.height)
+
+		// The keys are the outpoints, which are sorted by transaction
+		// hash, so the outputs of a transaction are next to each
+		// other.  Each value is hashed after its size since the values
+		// are not self-delimiting.
+		hasher := sha256.New()
+		var size [4]byte
+		var lastHash []byte
+		lastLog := time.Now()
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		err = utxoBucket.ForEach(func(k, v []byte) error {
+			if interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+
+			entry, err := deserializeUtxoEntry(v)
+			if err != nil {
+				return err
+			}
+
+			if len(k) < chainhash.HashSize {
+				return errDeserialize("unexpected utxo key size")
+			}
+			if !bytes.Equal(lastHash, k[:chainhash.HashSize]) {
+				lastHash = append(lastHash[:0],
+					k[:chainhash.HashSize]...)
+				stats.Transactions++
+			}
+			stats.Outputs++
+			stats.SerializedSize += uint64(len(k) + len(v))
+			hasher.Write(k)
+			binary.LittleEndian.PutUint32(size[:], uint32(len(v)))
+			hasher.Write(size[:])
+			hasher.Write(v)
+
+			tokenStats, ok := tokens[entry.Token()]
+			if !ok {
+				tokenStats = &UtxoTokenStats{Token: entry.Token()}
+				tokens[entry.Token()] = tokenStats
+			}
+			tokenStats.Outputs++
+			tokenStats.Amount.Add(&tokenStats.Amount,
+				big.NewInt(int64(entry.Amount())))
+
+			if now := time.Now(); now.Sub(lastLog) >= utxoStatsLogInterval {
+				log.Infof("Walked %d unspent outputs of %d "+
+					"transactions", stats.Outputs,
+					stats.Transactions)
+				lastLog = now
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		copy(stats.SetHash[:], hasher.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Tokens = make([]UtxoTokenStats, 0, len(tokens))
+	for _, tokenStats := range tokens {
+		stats.Tokens = append(stats.Tokens, *tokenStats)
+	}
+	sort.Slice(stats.Tokens, func(i, j int) bool {
+		return stats.Tokens[i].Token < stats.Tokens[j].Token
+	})
+
+	log.Infof("Walked %d unspent outputs of %d transactions", stats.Outputs,
+		stats.Transactions)
+
+	return &stats, nil
+}
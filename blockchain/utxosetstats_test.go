@@ -0,0 +1,115 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/database"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// TestUtxoSetStats ensures the statistics of the utxo set account for the
+// unspent outputs of each token, and flag the STB outputs which do not match
+// the total supply.
+func TestUtxoSetStats(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("utxosetstats",
+		&chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	before, err := chain.UtxoSetStats(nil)
+	if err != nil {
+		t.Fatalf("UtxoSetStats: unexpected error: %v", err)
+	}
+	best := chain.BestSnapshot()
+	if before.Hash != best.Hash || before.Height != best.Height ||
+		before.TotalSupply.Cmp(&best.TotalSupply) != 0 {
+
+		t.Fatalf("UtxoSetStats: got block %v (%d) with supply %v, "+
+			"want %v (%d) with supply %v", before.Hash, before.Height,
+			&before.TotalSupply, best.Hash, best.Height,
+			&best.TotalSupply)
+	}
+
+	// Add two outputs of a transaction paying NDR and STB, and one of a
+	// transaction paying another token.
+	pkScript := []byte{0x51}
+	entries := []struct {
+		outpoint wire.OutPoint
+		entry    *UtxoEntry
+	}{
+		{wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 0},
+			&UtxoEntry{amount: 100, pkScript: pkScript, token: types.Token0}},
+		{wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 1},
+			&UtxoEntry{amount: 200, pkScript: pkScript, token: types.Token1}},
+		{wire.OutPoint{Hash: chainhash.Hash{0x02}, Index: 0},
+			&UtxoEntry{amount: 300, pkScript: pkScript, token: types.Token(2)}},
+	}
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		for _, e := range entries {
+			serialized, err := serializeUtxoEntry(e.entry)
+			if err != nil {
+				return err
+			}
+			key := outpointKey(e.outpoint)
+			if err := utxoBucket.Put(*key, serialized); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to add the utxos: %v", err)
+	}
+
+	after, err := chain.UtxoSetStats(nil)
+	if err != nil {
+		t.Fatalf("UtxoSetStats: unexpected error: %v", err)
+	}
+	if after.Transactions != before.Transactions+2 ||
+		after.Outputs != before.Outputs+3 ||
+		after.SerializedSize <= before.SerializedSize ||
+		after.SetHash == before.SetHash {
+
+		t.Fatalf("UtxoSetStats: got %d transactions, %d outputs, size "+
+			"%d, from %d transactions, %d outputs, size %d",
+			after.Transactions, after.Outputs, after.SerializedSize,
+			before.Transactions, before.Outputs, before.SerializedSize)
+	}
+	for i, e := range entries {
+		token := e.entry.Token()
+		got, was := after.TokenStats(token), before.TokenStats(token)
+		amount := new(big.Int).Sub(&got.Amount, &was.Amount)
+		if got.Outputs != was.Outputs+1 ||
+			amount.Int64() != int64(e.entry.Amount()) {
+
+			t.Errorf("entry #%d: got %d outputs of %v with %v more, "+
+				"want %d with %d more", i, got.Outputs, token,
+				amount, was.Outputs+1, e.entry.Amount())
+		}
+	}
+
+	mismatch := new(big.Int).Sub(after.SupplyMismatch(),
+		before.SupplyMismatch())
+	if mismatch.Int64() != 200 {
+		t.Errorf("SupplyMismatch: got %v more, want 200", mismatch)
+	}
+
+	// The walk stops when interrupted.
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if _, err := chain.UtxoSetStats(interrupt); err != errInterruptRequested {
+		t.Errorf("UtxoSetStats: got error %v when interrupted, want %v",
+			err, errInterruptRequested)
+	}
+}
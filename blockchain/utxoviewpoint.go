@@ -31,9 +31,6 @@ const (
 	// tfModified indicates that a txout has been modified since it was
 	// loaded.
 	tfModified
-
-	// tfToken encode the txout token id.
-	tfToken
 )
 
 // UtxoEntry houses details about an individual transaction output in a utxo
@@ -56,6 +53,8 @@ type UtxoEntry struct {
 	// since it was loaded.  This approach is used in order to reduce memory
 	// usage since there will be a lot of these in memory.
 	packedFlags txoFlags
+
+	token types.Token // The token carried by the output.
 }
 
 // isModified returns whether or not the output has been modified since it was
@@ -66,7 +65,7 @@ func (entry *UtxoEntry) isModified() bool {
 
 // Token returns the token of the output.
 func (entry *UtxoEntry) Token() types.Token {
-	return types.Token(entry.packedFlags & tfToken)
+	return entry.token
 }
 
 // IsCoinBase returns whether or not the output was contained in a coinbase
@@ -124,6 +123,7 @@ func (entry *UtxoEntry) Clone() *UtxoEntry {
 		pkScript:    entry.pkScript,
 		blockHeight: entry.blockHeight,
 		packedFlags: entry.packedFlags,
+		token:       entry.token,
 	}
 }
 
@@ -183,12 +183,10 @@ func (view *UtxoViewpoint) addTxOut(outpoint wire.OutPoint, txOut *wire.TxOut, i
 	entry.pkScript = txOut.PkScript
 	entry.blockHeight = blockHeight
 	entry.packedFlags = tfModified
+	entry.token = txOut.Value.Token
 	if isCoinBase {
 		entry.packedFlags |= tfCoinBase
 	}
-	if txOut.Value.Token != types.Token0 {
-		entry.packedFlags |= tfToken
-	}
 }
 
 // AddTxOut adds the specified output of the passed transaction to the view if
@@ -269,6 +267,7 @@ func (view *UtxoViewpoint) connectTransaction(tx *chainutil.Tx, blockHeight int3
 				PkScript:   entry.PkScript(),
 				Height:     entry.BlockHeight(),
 				IsCoinBase: entry.IsCoinBase(),
+				Token:      entry.Token(),
 			}
 			*stxos = append(*stxos, stxo)
 		}
@@ -389,9 +388,7 @@ func (view *UtxoViewpoint) disconnectTransactions(db database.DB, block *chainut
 					pkScript:    txOut.PkScript,
 					blockHeight: block.Height(),
 					packedFlags: packedFlags,
-				}
-				if txOut.Value.Token != types.Token0 {
-					entry.packedFlags |= tfToken
+					token:       txOut.Value.Token,
 				}
 
 				view.entries[prevOut] = entry
@@ -461,6 +458,7 @@ func (view *UtxoViewpoint) disconnectTransactions(db database.DB, block *chainut
 			entry.pkScript = stxo.PkScript
 			entry.blockHeight = stxo.Height
 			entry.packedFlags = tfModified
+			entry.token = stxo.Token
 			if stxo.IsCoinBase {
 				entry.packedFlags |= tfCoinBase
 			}
@@ -0,0 +1,79 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// TestDisconnectSpentToken ensures disconnecting a block which spends an STB
+// output restores the output with its token, as a reorganization does.
+func TestDisconnectSpentToken(t *testing.T) {
+	t.Parallel()
+
+	// An earlier transaction creates an NDR and an STB output.
+	pkScript := []byte{0x51}
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0),
+		nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 100,
+		Token: types.Token0}, pkScript))
+	prevTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 200,
+		Token: types.Token1}, pkScript))
+	view := NewUtxoViewpoint()
+	view.AddTxOuts(chainutil.NewTx(prevTx), 10)
+
+	// The block spends both outputs.
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		math.MaxUint32), nil, nil))
+	coinbase.AddTxOut(wire.NewTxOut(types.Value{Amount: 50,
+		Token: types.Token0}, pkScript))
+	spendTx := wire.NewMsgTx(wire.TxVersion)
+	prevHash := prevTx.TxHash()
+	for i := uint32(0); i < 2; i++ {
+		spendTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, i),
+			nil, nil))
+	}
+	spendTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 290,
+		Token: types.Token0}, pkScript))
+	block := chainutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase, spendTx},
+	})
+	block.SetHeight(20)
+
+	var stxos []SpentTxOut
+	if _, err := view.connectTransactions(block, &stxos); err != nil {
+		t.Fatalf("connectTransactions: unexpected error: %v", err)
+	}
+	if len(stxos) != 2 || stxos[0].Token != types.Token0 ||
+		stxos[1].Token != types.Token1 {
+		t.Fatalf("connectTransactions: got spent outputs %+v, want an NDR "+
+			"and an STB one", stxos)
+	}
+
+	if err := view.disconnectTransactions(nil, block, stxos); err != nil {
+		t.Fatalf("disconnectTransactions: unexpected error: %v", err)
+	}
+	for i, want := range []types.Token{types.Token0, types.Token1} {
+		outpoint := wire.OutPoint{Hash: prevHash, Index: uint32(i)}
+		entry := view.LookupEntry(outpoint)
+		if entry == nil || entry.IsSpent() {
+			t.Fatalf("disconnectTransactions: output %v not restored",
+				outpoint)
+		}
+		if entry.Token() != want || entry.BlockHeight() != 10 {
+			t.Errorf("disconnectTransactions: output %v restored as "+
+				"%v at height %d, want %v at height 10", outpoint,
+				entry.Token(), entry.BlockHeight(), want)
+		}
+	}
+}
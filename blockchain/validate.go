@@ -865,6 +865,52 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *chainutil.Block, view
 	return nil
 }
 
+// IsOrderBalance determines whether or not the balance of a non-coinbase
+// transaction, as returned by CheckTransactionInputs, belongs to an order.  An
+// order receives more of a token than it spends, so it has a positive balance
+// for one of the tokens, while a regular transaction only pays fees.
+func IsOrderBalance(balance *types.Balance) bool {
+	for _, value := range balance.Values() {
+		if value.Amount > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TxBalances returns the balance of each transaction of the passed block, as
+// returned by CheckTransactionInputs, given the outputs it spends in the order
+// its transactions spend them, such as the ones of its spend journal entry.
+// The balance of the coinbase only accounts for its outputs.
+func TxBalances(block *chainutil.Block, stxos []SpentTxOut) ([]types.Balance, error) {
+	transactions := block.Transactions()
+	balances := make([]types.Balance, len(transactions))
+	stxoIdx := 0
+	for i, tx := range transactions {
+		balance := &balances[i]
+		for _, txOut := range tx.MsgTx().TxOut {
+			balance.AddValue(txOut.Value)
+		}
+		if IsCoinBase(tx) {
+			continue
+		}
+
+		for range tx.MsgTx().TxIn {
+			if stxoIdx >= len(stxos) {
+				return nil, AssertError(fmt.Sprintf("missing spent "+
+					"outputs of block %s", block.Hash()))
+			}
+			stxo := &stxos[stxoIdx]
+			stxoIdx++
+
+			balance.SubValue(types.Value{Amount: stxo.Amount,
+				Token: stxo.Token})
+		}
+	}
+
+	return balances, nil
+}
+
 // CheckTransactionInputs performs a series of checks on the inputs to a
 // transaction to ensure they are valid.  An example of some of the checks
 // include verifying all inputs exist, ensuring the coinbase seasoning
@@ -885,6 +931,16 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *chainutil.Block, view
 func CheckTransactionInputs(tx *chainutil.Tx, txHeight int32, utxoView *UtxoViewpoint,
 	chainParams *chaincfg.Params) (*types.Balance, error) {
 
+	// Ensure the transaction outputs only carry the tokens of the network.
+	for txOutIndex, txOut := range tx.MsgTx().TxOut {
+		if !chainParams.HasToken(txOut.Value.Token) {
+			str := fmt.Sprintf("output %d of transaction %s carries "+
+				"unknown token %d", txOutIndex, tx.Hash(),
+				txOut.Value.Token)
+			return nil, ruleError(ErrUnknownToken, str)
+		}
+	}
+
 	// Coinbase transactions have no inputs.
 	if IsCoinBase(tx) {
 		return nil, nil
@@ -1089,6 +1145,23 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *chainutil.Block,
 	absorption := b.calcNextAbsorption()
 	accAbsorption := new(big.Int)
 
+	// Query for the Version Bits state for the partial fill deployment.
+	// Once it is active, the last transaction of the block is a partially
+	// filled order when the coinbase commits to its unfilled amount.  The
+	// scripts of the original order it was derived from are validated in
+	// its place.
+	partialFillState, err := b.deploymentState(node.parent,
+		chaincfg.DeploymentPartialFill)
+	if err != nil {
+		return err
+	}
+	var unfilled types.Amount
+	var hasPartialFill bool
+	if partialFillState == ThresholdActive {
+		unfilled, hasPartialFill = ExtractPartialFill(transactions[0])
+	}
+	var partialFillOrder *chainutil.Tx
+
 	// Perform several checks on the inputs for each transaction.  Also
 	// accumulate the total fees.  This could technically be combined with
 	// the loop above instead of running another loop over the transactions,
@@ -1097,45 +1170,30 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *chainutil.Block,
 	// against all the inputs when the signature operations are out of
 	// bounds.
 	var blockBalance types.Balance
-	for _, tx := range transactions {
+	for i, tx := range transactions {
+		if hasPartialFill && i == len(transactions)-1 {
+			var err error
+			partialFillOrder, err = checkPartialFill(tx, unfilled,
+				node.height, view, b.chainParams)
+			if err != nil {
+				return err
+			}
+		}
+
 		txBalance, err := CheckTransactionInputs(tx, node.height, view,
 			b.chainParams)
 		if err != nil {
 			return err
 		}
 
-		txBalance0 := txBalance.Amount(types.Token0)
-		txBalance1 := txBalance.Amount(types.Token1)
-
 		if IsCoinBase(tx) {
 			// coinbase tx doesnot count to blockBalance (fee)
-		} else if txBalance1 > 0 || txBalance0 > 0 {
+		} else if IsOrderBalance(txBalance) {
 			// filled order count to accAbsorption instead
-			absnSign := absorption.Sign()
-			if absorption == nil || absnSign == 0 {
-				return RuleError{
-					ErrorCode:   ErrBadAbsorption,
-					Description: "Order cannot be mined when there is no absorption.",
-				}
-			}
-			if (absnSign > 0) != (txBalance1 > 0) {
-				return RuleError{
-					ErrorCode:   ErrBadAbsorption,
-					Description: "Wrong order direction to mine.",
-				}
-			}
-			if (txBalance1 > 0) == (txBalance0 > 0) {
-				return RuleError{
-					ErrorCode:   ErrBadAbsorption,
-					Description: "Invalid order: one token must be exchanged for the other.",
-				}
-			}
-			accAbsorption.Add(accAbsorption, txBalance1.BigInt())
-			if accAbsorption.Cmp(absorption) == absnSign {
-				return RuleError{
-					ErrorCode:   ErrBadAbsorption,
-					Description: "Over absorbed.",
-				}
+			err := CheckOrderAbsorption(txBalance, absorption,
+				accAbsorption)
+			if err != nil {
+				return err
 			}
 		} else {
 			if err := blockBalance.SafeAdd(txBalance); err != nil {
@@ -1254,8 +1312,8 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *chainutil.Block,
 	// expensive ECDSA signature check scripts.  Doing this last helps
 	// prevent CPU exhaustion attacks.
 	if runScripts {
-		err := checkBlockScripts(block, view, scriptFlags, b.sigCache,
-			b.hashCache)
+		err := checkBlockScripts(block, partialFillOrder, view,
+			scriptFlags, b.sigCache, b.hashCache)
 		if err != nil {
 			return err
 		}
@@ -13,8 +13,9 @@ import (
 
 	"github.com/endurio/ndrd/chaincfg"
 	"github.com/endurio/ndrd/chaincfg/chainhash"
-	"github.com/endurio/ndrd/wire"
 	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
 )
 
 // TestSequenceLocksActive tests the SequenceLockActive function to ensure it
@@ -110,21 +111,21 @@ func TestCheckConnectBlockTemplate(t *testing.T) {
 	}
 
 	// Block 3 should fail to connect since it's already inserted.
-	err = chain.CheckConnectBlockTemplate(blocks[3])
+	err = chain.CheckConnectBlockTemplate(blocks[3], chain.chainParams)
 	if err == nil {
 		t.Fatal("CheckConnectBlockTemplate: Did not received expected error " +
 			"on block 3")
 	}
 
 	// Block 4 should connect successfully to tip of chain.
-	err = chain.CheckConnectBlockTemplate(blocks[4])
+	err = chain.CheckConnectBlockTemplate(blocks[4], chain.chainParams)
 	if err != nil {
 		t.Fatalf("CheckConnectBlockTemplate: Received unexpected error on "+
 			"block 4: %v", err)
 	}
 
 	// Block 3a should fail to connect since does not build on chain tip.
-	err = chain.CheckConnectBlockTemplate(blocks[5])
+	err = chain.CheckConnectBlockTemplate(blocks[5], chain.chainParams)
 	if err == nil {
 		t.Fatal("CheckConnectBlockTemplate: Did not received expected error " +
 			"on block 3a")
@@ -133,7 +134,8 @@ func TestCheckConnectBlockTemplate(t *testing.T) {
 	// Block 4 should connect even if proof of work is invalid.
 	invalidPowBlock := *blocks[4].MsgBlock()
 	invalidPowBlock.Header.Nonce++
-	err = chain.CheckConnectBlockTemplate(chainutil.NewBlock(&invalidPowBlock))
+	err = chain.CheckConnectBlockTemplate(chainutil.NewBlock(&invalidPowBlock),
+		chain.chainParams)
 	if err != nil {
 		t.Fatalf("CheckConnectBlockTemplate: Received unexpected error on "+
 			"block 4 with bad nonce: %v", err)
@@ -142,7 +144,8 @@ func TestCheckConnectBlockTemplate(t *testing.T) {
 	// Invalid block building on chain tip should fail to connect.
 	invalidBlock := *blocks[4].MsgBlock()
 	invalidBlock.Header.Bits--
-	err = chain.CheckConnectBlockTemplate(chainutil.NewBlock(&invalidBlock))
+	err = chain.CheckConnectBlockTemplate(chainutil.NewBlock(&invalidBlock),
+		chain.chainParams)
 	if err == nil {
 		t.Fatal("CheckConnectBlockTemplate: Did not received expected error " +
 			"on block 4 with invalid difficulty bits")
@@ -152,10 +155,9 @@ func TestCheckConnectBlockTemplate(t *testing.T) {
 // TestCheckBlockSanity tests the CheckBlockSanity function to ensure it works
 // as expected.
 func TestCheckBlockSanity(t *testing.T) {
-	powLimit := chaincfg.MainNetParams.PowLimit
 	block := chainutil.NewBlock(&Block100000)
 	timeSource := NewMedianTime()
-	err := CheckBlockSanity(block, powLimit, timeSource)
+	err := CheckBlockSanity(block, &chaincfg.MainNetParams, timeSource)
 	if err != nil {
 		t.Errorf("CheckBlockSanity: %v", err)
 	}
@@ -164,7 +166,7 @@ func TestCheckBlockSanity(t *testing.T) {
 	// second fails.
 	timestamp := block.MsgBlock().Header.Timestamp
 	block.MsgBlock().Header.Timestamp = timestamp.Add(time.Nanosecond)
-	err = CheckBlockSanity(block, powLimit, timeSource)
+	err = CheckBlockSanity(block, &chaincfg.MainNetParams, timeSource)
 	if err == nil {
 		t.Errorf("CheckBlockSanity: error is nil when it shouldn't be")
 	}
@@ -273,7 +275,7 @@ var Block100000 = wire.MsgBlock{
 			},
 			TxOut: []*wire.TxOut{
 				{
-					Value: 0x12a05f200, // 5000000000
+					Value: types.Value{Amount: 0x12a05f200}, // 5000000000
 					PkScript: []byte{
 						0x41, // OP_DATA_65
 						0x04, 0x1b, 0x0e, 0x8c, 0x25, 0x67, 0xc1, 0x25,
@@ -332,7 +334,7 @@ var Block100000 = wire.MsgBlock{
 			},
 			TxOut: []*wire.TxOut{
 				{
-					Value: 0x2123e300, // 556000000
+					Value: types.Value{Amount: 0x2123e300}, // 556000000
 					PkScript: []byte{
 						0x76, // OP_DUP
 						0xa9, // OP_HASH160
@@ -345,7 +347,7 @@ var Block100000 = wire.MsgBlock{
 					},
 				},
 				{
-					Value: 0x108e20f00, // 4444000000
+					Value: types.Value{Amount: 0x108e20f00}, // 4444000000
 					PkScript: []byte{
 						0x76, // OP_DUP
 						0xa9, // OP_HASH160
@@ -400,7 +402,7 @@ var Block100000 = wire.MsgBlock{
 			},
 			TxOut: []*wire.TxOut{
 				{
-					Value: 0xf4240, // 1000000
+					Value: types.Value{Amount: 0xf4240}, // 1000000
 					PkScript: []byte{
 						0x76, // OP_DUP
 						0xa9, // OP_HASH160
@@ -413,7 +415,7 @@ var Block100000 = wire.MsgBlock{
 					},
 				},
 				{
-					Value: 0x11d260c0, // 299000000
+					Value: types.Value{Amount: 0x11d260c0}, // 299000000
 					PkScript: []byte{
 						0x76, // OP_DUP
 						0xa9, // OP_HASH160
@@ -469,7 +471,7 @@ var Block100000 = wire.MsgBlock{
 			},
 			TxOut: []*wire.TxOut{
 				{
-					Value: 0xf4240, // 1000000
+					Value: types.Value{Amount: 0xf4240}, // 1000000
 					PkScript: []byte{
 						0x76, // OP_DUP
 						0xa9, // OP_HASH160
@@ -22,6 +22,11 @@ const (
 	epochTimeSpan = time.Hour * 24 * 7 / mvpTimeRate
 	blockPerEpoch = 1024 * 4
 	blockTime     = epochTimeSpan / blockPerEpoch
+
+	// fixedPointPriceHeight is the epoch boundary from which the blocks of
+	// the public networks carry fixed point prices.  The blocks below it
+	// were mined with floating point prices.
+	fixedPointPriceHeight = blockPerEpoch * 64
 )
 
 var (
@@ -56,6 +61,38 @@ var (
 	simNetPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 255), bigOne)
 )
 
+// These variables are the tokens of the default networks.
+var (
+	// nativeTokens are the tokens of every default network.
+	nativeTokens = []TokenInfo{
+		{types.Token0, "NDR"},
+		{types.Token1, "STB"},
+	}
+
+	// simNetTokens are the tokens of the simulation test network, which
+	// has test tokens besides the native ones.
+	simNetTokens = append(append([]TokenInfo(nil), nativeTokens...),
+		TokenInfo{types.Token(0x02), "TSTA"},
+		TokenInfo{types.Token(0x03), "TSTB"},
+	)
+)
+
+// defaultActiveAbsorptionHighRatio returns the ratio of the median price of an
+// epoch to the median price of the last absorption at or above which an active
+// absorption is triggered on every default network.  A new ratio is returned
+// on each call, so the networks never share it.
+func defaultActiveAbsorptionHighRatio() *big.Rat {
+	return big.NewRat(2, 1)
+}
+
+// defaultActiveAbsorptionLowRatio returns the ratio of the median price of an
+// epoch to the median price of the last absorption at or below which an active
+// absorption is triggered on every default network.  A new ratio is returned
+// on each call, so the networks never share it.
+func defaultActiveAbsorptionLowRatio() *big.Rat {
+	return big.NewRat(-1, 2)
+}
+
 // Checkpoint identifies a known good point in the block chain.  Using
 // checkpoints allows a few optimizations for old blocks during initial download
 // and also prevents forks from old blocks.
@@ -68,6 +105,15 @@ type Checkpoint struct {
 	Hash   *chainhash.Hash
 }
 
+// TokenInfo identifies a token the transaction outputs can carry on a network.
+type TokenInfo struct {
+	// Token is the identifier of the token in the transaction outputs.
+	Token types.Token
+
+	// Name defines a human-readable identifier for the token.
+	Name string
+}
+
 // DNSSeed identifies a DNS seed.
 type DNSSeed struct {
 	// Host defines the hostname of the seed.
@@ -112,6 +158,16 @@ const (
 	// includes the deployment of BIPS 141, 142, 144, 145, 147 and 173.
 	DeploymentSegwit
 
+	// DeploymentMedianPrice defines the rule change deployment ID for the
+	// outlier resistant price aggregation, which takes a trimmed median of
+	// the prices fed by each miner instead of the mean of all block prices.
+	DeploymentMedianPrice
+
+	// DeploymentPartialFill defines the rule change deployment ID for the
+	// partial fill of the last order of an absorption, which the coinbase
+	// commits to with a partial fill output.
+	DeploymentPartialFill
+
 	// NOTE: DefinedDeployments must always come last since it is used to
 	// determine how many defined deployments there currently are.
 
@@ -156,6 +212,11 @@ type Params struct {
 	BIP0065Height int32
 	BIP0066Height int32
 
+	// FixedPointPriceHeight is the block height from which block headers
+	// carry their price derivation in fixed point and the absorption is
+	// computed with integer arithmetic only.
+	FixedPointPriceHeight int32
+
 	// CoinbaseMaturity is the number of blocks required before newly mined
 	// coins (coinbase transactions) can be spent.
 	CoinbaseMaturity uint16
@@ -166,6 +227,18 @@ type Params struct {
 
 	BlockPerTimespan int32
 
+	// ActiveAbsorptionHighRatio and ActiveAbsorptionLowRatio are the ratios
+	// of the median price of an epoch to the median price of the last
+	// absorption at or beyond which a block within the epoch of the last
+	// absorption triggers an active absorption.  The high ratio must be
+	// greater than the low ratio.
+	ActiveAbsorptionHighRatio *big.Rat
+	ActiveAbsorptionLowRatio  *big.Rat
+
+	// Tokens are the tokens the transaction outputs can carry on the
+	// network, which always include Token0 and Token1.
+	Tokens []TokenInfo
+
 	// TargetTimespan is the desired amount of time that should elapse
 	// before the block difficulty requirement is examined to determine how
 	// it should be changed in order to maintain the desired block
@@ -259,6 +332,7 @@ var MainNetParams = Params{
 	BIP0034Height:            0, // Always active on Endurio
 	BIP0065Height:            0, // Always active on Endurio
 	BIP0066Height:            0, // Always active on Endurio
+	FixedPointPriceHeight:    fixedPointPriceHeight,
 	CoinbaseMaturity:         0,
 	SubsidyReductionInterval: 210000,
 	BlockPerTimespan:         blockPerEpoch,
@@ -269,6 +343,13 @@ var MainNetParams = Params{
 	MinDiffReductionTime:     0,
 	GenerateSupported:        false,
 
+	// Active absorption thresholds.
+	ActiveAbsorptionHighRatio: defaultActiveAbsorptionHighRatio(),
+	ActiveAbsorptionLowRatio:  defaultActiveAbsorptionLowRatio(),
+
+	// Tokens of the network.
+	Tokens: nativeTokens,
+
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
@@ -294,6 +375,16 @@ var MainNetParams = Params{
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires
 		},
+		DeploymentMedianPrice: {
+			BitNumber:  2,
+			StartTime:  1798761600, // January 1, 2027 UTC
+			ExpireTime: 1830297600, // January 1, 2028 UTC
+		},
+		DeploymentPartialFill: {
+			BitNumber:  3,
+			StartTime:  1798761600, // January 1, 2027 UTC
+			ExpireTime: 1830297600, // January 1, 2028 UTC
+		},
 	},
 
 	// Mempool parameters
@@ -344,6 +435,7 @@ var RegressionNetParams = Params{
 	BIP0034Height:            100000000, // Not active - Permit ver 1 blocks
 	BIP0065Height:            1351,      // Used by regression tests
 	BIP0066Height:            1251,      // Used by regression tests
+	FixedPointPriceHeight:    0,         // Always active on regtest
 	SubsidyReductionInterval: 150,
 	TargetTimespan:           time.Hour * 24 * 14, // 14 days
 	TargetTimePerBlock:       time.Minute * 10,    // 10 minutes
@@ -352,6 +444,13 @@ var RegressionNetParams = Params{
 	MinDiffReductionTime:     time.Minute * 20, // TargetTimePerBlock * 2
 	GenerateSupported:        true,
 
+	// Active absorption thresholds.
+	ActiveAbsorptionHighRatio: defaultActiveAbsorptionHighRatio(),
+	ActiveAbsorptionLowRatio:  defaultActiveAbsorptionLowRatio(),
+
+	// Tokens of the network.
+	Tokens: nativeTokens,
+
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
@@ -377,6 +476,16 @@ var RegressionNetParams = Params{
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires.
 		},
+		DeploymentMedianPrice: {
+			BitNumber:  2,
+			StartTime:  1,             // Available for vote from genesis
+			ExpireTime: math.MaxInt64, // Never expires
+		},
+		DeploymentPartialFill: {
+			BitNumber:  3,
+			StartTime:  1,             // Available for vote from genesis
+			ExpireTime: math.MaxInt64, // Never expires
+		},
 	},
 
 	// Mempool parameters
@@ -417,6 +526,7 @@ var TestNet3Params = Params{
 	BIP0034Height:            0, // Always active on Endurio
 	BIP0065Height:            0, // Always active on Endurio
 	BIP0066Height:            0, // Always active on Endurio
+	FixedPointPriceHeight:    fixedPointPriceHeight,
 	CoinbaseMaturity:         0,
 	SubsidyReductionInterval: 210000,
 	TargetTimespan:           time.Hour * 24 * 7,             // 7 days
@@ -426,6 +536,13 @@ var TestNet3Params = Params{
 	MinDiffReductionTime:     time.Minute * 20, // TargetTimePerBlock * 2
 	GenerateSupported:        false,
 
+	// Active absorption thresholds.
+	ActiveAbsorptionHighRatio: defaultActiveAbsorptionHighRatio(),
+	ActiveAbsorptionLowRatio:  defaultActiveAbsorptionLowRatio(),
+
+	// Tokens of the network.
+	Tokens: nativeTokens,
+
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
@@ -451,6 +568,16 @@ var TestNet3Params = Params{
 			StartTime:  0,             // May 1, 2016 UTC
 			ExpireTime: math.MaxInt64, // May 1, 2017 UTC.
 		},
+		DeploymentMedianPrice: {
+			BitNumber:  2,
+			StartTime:  1798761600, // January 1, 2027 UTC
+			ExpireTime: 1830297600, // January 1, 2028 UTC
+		},
+		DeploymentPartialFill: {
+			BitNumber:  3,
+			StartTime:  1798761600, // January 1, 2027 UTC
+			ExpireTime: 1830297600, // January 1, 2028 UTC
+		},
 	},
 
 	// Mempool parameters
@@ -497,6 +624,7 @@ var SimNetParams = Params{
 	BIP0034Height:            0, // Always active on simnet
 	BIP0065Height:            0, // Always active on simnet
 	BIP0066Height:            0, // Always active on simnet
+	FixedPointPriceHeight:    0, // Always active on simnet
 	CoinbaseMaturity:         0,
 	SubsidyReductionInterval: 210000,
 	BlockPerTimespan:         blockPerEpoch,
@@ -507,6 +635,13 @@ var SimNetParams = Params{
 	MinDiffReductionTime:     time.Minute * 20, // TargetTimePerBlock * 2
 	GenerateSupported:        true,
 
+	// Active absorption thresholds.
+	ActiveAbsorptionHighRatio: defaultActiveAbsorptionHighRatio(),
+	ActiveAbsorptionLowRatio:  defaultActiveAbsorptionLowRatio(),
+
+	// Tokens of the network.
+	Tokens: simNetTokens,
+
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
@@ -532,6 +667,16 @@ var SimNetParams = Params{
 			StartTime:  0,             // Always available for vote
 			ExpireTime: math.MaxInt64, // Never expires.
 		},
+		DeploymentMedianPrice: {
+			BitNumber:  2,
+			StartTime:  1,             // Available for vote from genesis
+			ExpireTime: math.MaxInt64, // Never expires
+		},
+		DeploymentPartialFill: {
+			BitNumber:  3,
+			StartTime:  1,             // Available for vote from genesis
+			ExpireTime: math.MaxInt64, // Never expires
+		},
 	},
 
 	// Mempool parameters
@@ -590,7 +735,8 @@ func (d DNSSeed) String() string {
 // Register registers the network parameters for a Bitcoin network.  This may
 // error with ErrDuplicateNet if the network is already registered (either
 // due to a previous Register call, or the network being one of the default
-// networks).
+// networks), or with types.ErrDuplicateToken if one of its tokens is already
+// registered with another name.
 //
 // Network parameters should be registered into this package by a main package
 // as early as possible.  Then, library packages may lookup networks or network
@@ -600,6 +746,11 @@ func Register(params *Params) error {
 	if _, ok := registeredNets[params.Net]; ok {
 		return ErrDuplicateNet
 	}
+	for _, info := range params.Tokens {
+		if err := types.RegisterToken(info.Token, info.Name); err != nil {
+			return err
+		}
+	}
 	registeredNets[params.Net] = struct{}{}
 	pubKeyHashAddrIDs[params.PubKeyHashAddrID] = struct{}{}
 	scriptHashAddrIDs[params.ScriptHashAddrID] = struct{}{}
@@ -611,6 +762,17 @@ func Register(params *Params) error {
 	return nil
 }
 
+// HasToken returns whether or not the transaction outputs can carry the passed
+// token on the network.
+func (p *Params) HasToken(token types.Token) bool {
+	for _, info := range p.Tokens {
+		if info.Token == token {
+			return true
+		}
+	}
+	return false
+}
+
 // mustRegister performs the same function as Register except it panics if there
 // is an error.  This should only be called from package init functions.
 func mustRegister(params *Params) {
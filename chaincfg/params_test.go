@@ -34,3 +34,23 @@ func TestMustRegisterPanic(t *testing.T) {
 	// Intentionally try to register duplicate params to force a panic.
 	mustRegister(&MainNetParams)
 }
+
+// TestActiveAbsorptionRatios ensures the default networks do not share their
+// active absorption ratios, so modifying those of one network leaves the
+// others untouched.
+func TestActiveAbsorptionRatios(t *testing.T) {
+	t.Parallel()
+
+	networks := []*Params{&MainNetParams, &RegressionNetParams,
+		&TestNet3Params, &SimNetParams}
+	for i, a := range networks {
+		for _, b := range networks[i+1:] {
+			if a.ActiveAbsorptionHighRatio == b.ActiveAbsorptionHighRatio ||
+				a.ActiveAbsorptionLowRatio == b.ActiveAbsorptionLowRatio {
+
+				t.Errorf("%s and %s share their active absorption "+
+					"ratios", a.Name, b.Name)
+			}
+		}
+	}
+}
@@ -47,6 +47,19 @@ func NewAddNodeCmd(addr string, subCmd AddNodeSubCmd) *AddNodeCmd {
 	}
 }
 
+// CancelOrderCmd defines the cancelorder JSON-RPC command.
+type CancelOrderCmd struct {
+	HexCancel string
+}
+
+// NewCancelOrderCmd returns a new instance which can be used to issue a
+// cancelorder JSON-RPC command.
+func NewCancelOrderCmd(hexCancel string) *CancelOrderCmd {
+	return &CancelOrderCmd{
+		HexCancel: hexCancel,
+	}
+}
+
 // TransactionInput represents the inputs to a transaction.  Specifically a
 // transaction hash and output number pair.
 type TransactionInput struct {
@@ -119,6 +132,57 @@ func NewGetAddedNodeInfoCmd(dns bool, node *string) *GetAddedNodeInfoCmd {
 	}
 }
 
+// GetAbsorptionInfoCmd defines the getabsorptioninfo JSON-RPC command.
+type GetAbsorptionInfoCmd struct {
+	Hash *string
+}
+
+// NewGetAbsorptionInfoCmd returns a new instance which can be used to issue a
+// getabsorptioninfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetAbsorptionInfoCmd(hash *string) *GetAbsorptionInfoCmd {
+	return &GetAbsorptionInfoCmd{
+		Hash: hash,
+	}
+}
+
+// GetAddressBalanceCmd defines the getaddressbalance JSON-RPC command.
+type GetAddressBalanceCmd struct {
+	Address string
+}
+
+// NewGetAddressBalanceCmd returns a new instance which can be used to issue a
+// getaddressbalance JSON-RPC command.
+func NewGetAddressBalanceCmd(address string) *GetAddressBalanceCmd {
+	return &GetAddressBalanceCmd{
+		Address: address,
+	}
+}
+
+// GetAddressUtxosCmd defines the getaddressutxos JSON-RPC command.
+type GetAddressUtxosCmd struct {
+	Address string
+	Token   *string
+	Skip    *int `jsonrpcdefault:"0"`
+	Count   *int `jsonrpcdefault:"100"`
+}
+
+// NewGetAddressUtxosCmd returns a new instance which can be used to issue a
+// getaddressutxos JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetAddressUtxosCmd(address string, token *string, skip, count *int) *GetAddressUtxosCmd {
+	return &GetAddressUtxosCmd{
+		Address: address,
+		Token:   token,
+		Skip:    skip,
+		Count:   count,
+	}
+}
+
 // GetBestBlockHashCmd defines the getbestblockhash JSON-RPC command.
 type GetBestBlockHashCmd struct{}
 
@@ -475,9 +539,12 @@ func NewGetRawMembookCmd(verbose *bool) *GetRawMembookCmd {
 	}
 }
 
-// GetOrderBookCmd defines the getmempool JSON-RPC command.
+// GetOrderBookCmd defines the getorderbook JSON-RPC command.
 type GetOrderBookCmd struct {
-	Depth *float64 `jsonrpcdefault:"0"`
+	Depth   *float64 `jsonrpcdefault:"0"`
+	Tick    *float64 `jsonrpcdefault:"0"`
+	Limit   *int     `jsonrpcdefault:"0"`
+	Verbose *bool    `jsonrpcdefault:"false"`
 }
 
 // NewGetOrderBookCmd returns a new instance which can be used to issue a
@@ -485,12 +552,24 @@ type GetOrderBookCmd struct {
 //
 // The parameters which are pointers indicate they are optional.  Passing nil
 // for optional parameters will use the default value.
-func NewGetOrderBookCmd(depth *float64) *GetOrderBookCmd {
+func NewGetOrderBookCmd(depth, tick *float64, limit *int, verbose *bool) *GetOrderBookCmd {
 	return &GetOrderBookCmd{
-		Depth: depth,
+		Depth:   depth,
+		Tick:    tick,
+		Limit:   limit,
+		Verbose: verbose,
 	}
 }
 
+// GetOrderBookSnapshotCmd defines the getorderbooksnapshot JSON-RPC command.
+type GetOrderBookSnapshotCmd struct{}
+
+// NewGetOrderBookSnapshotCmd returns a new instance which can be used to issue
+// a getorderbooksnapshot JSON-RPC command.
+func NewGetOrderBookSnapshotCmd() *GetOrderBookSnapshotCmd {
+	return &GetOrderBookSnapshotCmd{}
+}
+
 // GetRawTransactionCmd defines the getrawtransaction JSON-RPC command.
 //
 // NOTE: This field is an int versus a bool to remain compatible with Bitcoin
@@ -533,6 +612,57 @@ func NewGetRawOrderCmd(odrHash string, verbose *int) *GetRawOrderCmd {
 	}
 }
 
+// GetPriceFeedCmd defines the getpricefeed JSON-RPC command.
+type GetPriceFeedCmd struct{}
+
+// NewGetPriceFeedCmd returns a new instance which can be used to issue a
+// getpricefeed JSON-RPC command.
+func NewGetPriceFeedCmd() *GetPriceFeedCmd {
+	return &GetPriceFeedCmd{}
+}
+
+// GetPriceHistoryCmd defines the getpricehistory JSON-RPC command.  The range
+// is in block heights, or in unix timestamps when ByTime is set, and so is the
+// size of the buckets.
+type GetPriceHistoryCmd struct {
+	Start      int64
+	End        *int64
+	BucketSize *int64
+	ByTime     *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetPriceHistoryCmd returns a new instance which can be used to issue a
+// getpricehistory JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetPriceHistoryCmd(start int64, end, bucketSize *int64, byTime *bool) *GetPriceHistoryCmd {
+	return &GetPriceHistoryCmd{
+		Start:      start,
+		End:        end,
+		BucketSize: bucketSize,
+		ByTime:     byTime,
+	}
+}
+
+// GetSupplyHistoryCmd defines the getsupplyhistory JSON-RPC command.
+type GetSupplyHistoryCmd struct {
+	StartHeight int
+	Count       *int `jsonrpcdefault:"100"`
+}
+
+// NewGetSupplyHistoryCmd returns a new instance which can be used to issue a
+// getsupplyhistory JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetSupplyHistoryCmd(startHeight int, count *int) *GetSupplyHistoryCmd {
+	return &GetSupplyHistoryCmd{
+		StartHeight: startHeight,
+		Count:       count,
+	}
+}
+
 // GetTxOutCmd defines the gettxout JSON-RPC command.
 type GetTxOutCmd struct {
 	Txid           string
@@ -742,9 +872,14 @@ func NewSetGenerateCmd(generate bool, genProcLimit *int) *SetGenerateCmd {
 	}
 }
 
-// FeedPriceCmd defines the feedprice JSON-RPC command.
+// FeedPriceCmd defines the feedprice JSON-RPC command.  The price is the
+// market price of STB/USD, not a price derivation.  The timestamp and the
+// base64 encoded signature are required by the sources of signed feeds only.
 type FeedPriceCmd struct {
-	Price float64
+	Price     float64
+	Source    *string
+	Timestamp *int64
+	Signature *string
 }
 
 // NewFeedPriceCmd returns a new instance which can be used to issue a
@@ -752,9 +887,12 @@ type FeedPriceCmd struct {
 //
 // The parameters which are pointers indicate they are optional.  Passing nil
 // for optional parameters will use the default value.
-func NewFeedPriceCmd(price float64) *FeedPriceCmd {
+func NewFeedPriceCmd(price float64, source *string, timestamp *int64, signature *string) *FeedPriceCmd {
 	return &FeedPriceCmd{
-		Price: price,
+		Price:     price,
+		Source:    source,
+		Timestamp: timestamp,
+		Signature: signature,
 	}
 }
 
@@ -866,11 +1004,15 @@ func init() {
 	flags := UsageFlag(0)
 
 	MustRegisterCmd("addnode", (*AddNodeCmd)(nil), flags)
+	MustRegisterCmd("cancelorder", (*CancelOrderCmd)(nil), flags)
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
 	MustRegisterCmd("feedprice", (*FeedPriceCmd)(nil), flags)
+	MustRegisterCmd("getabsorptioninfo", (*GetAbsorptionInfoCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
+	MustRegisterCmd("getaddressbalance", (*GetAddressBalanceCmd)(nil), flags)
+	MustRegisterCmd("getaddressutxos", (*GetAddressUtxosCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblock", (*GetBlockCmd)(nil), flags)
 	MustRegisterCmd("getblockchaininfo", (*GetBlockChainInfoCmd)(nil), flags)
@@ -896,8 +1038,12 @@ func init() {
 	MustRegisterCmd("getrawmempool", (*GetRawMempoolCmd)(nil), flags)
 	MustRegisterCmd("getrawmembook", (*GetRawMembookCmd)(nil), flags)
 	MustRegisterCmd("getorderbook", (*GetOrderBookCmd)(nil), flags)
+	MustRegisterCmd("getorderbooksnapshot", (*GetOrderBookSnapshotCmd)(nil), flags)
 	MustRegisterCmd("getrawtransaction", (*GetRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("getraworder", (*GetRawOrderCmd)(nil), flags)
+	MustRegisterCmd("getpricefeed", (*GetPriceFeedCmd)(nil), flags)
+	MustRegisterCmd("getpricehistory", (*GetPriceHistoryCmd)(nil), flags)
+	MustRegisterCmd("getsupplyhistory", (*GetSupplyHistoryCmd)(nil), flags)
 	MustRegisterCmd("gettxout", (*GetTxOutCmd)(nil), flags)
 	MustRegisterCmd("gettxoutproof", (*GetTxOutProofCmd)(nil), flags)
 	MustRegisterCmd("gettxoutsetinfo", (*GetTxOutSetInfoCmd)(nil), flags)
@@ -42,6 +42,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"addnode","params":["127.0.0.1","remove"],"id":1}`,
 			unmarshalled: &chainjson.AddNodeCmd{Addr: "127.0.0.1", SubCmd: chainjson.ANRemove},
 		},
+		{
+			name: "cancelorder",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("cancelorder", "1122")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewCancelOrderCmd("1122")
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"cancelorder","params":["1122"],"id":1}`,
+			unmarshalled: &chainjson.CancelOrderCmd{HexCancel: "1122"},
+		},
 		{
 			name: "createrawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -104,6 +115,30 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
 			unmarshalled: &chainjson.DecodeScriptCmd{HexScript: "00"},
 		},
+		{
+			name: "getabsorptioninfo",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getabsorptioninfo")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetAbsorptionInfoCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getabsorptioninfo","params":[],"id":1}`,
+			unmarshalled: &chainjson.GetAbsorptionInfoCmd{Hash: nil},
+		},
+		{
+			name: "getabsorptioninfo optional",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getabsorptioninfo", "123")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetAbsorptionInfoCmd(chainjson.String("123"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getabsorptioninfo","params":["123"],"id":1}`,
+			unmarshalled: &chainjson.GetAbsorptionInfoCmd{
+				Hash: chainjson.String("123"),
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -129,6 +164,54 @@ func TestChainSvrCmds(t *testing.T) {
 				Node: chainjson.String("127.0.0.1"),
 			},
 		},
+		{
+			name: "getaddressbalance",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getaddressbalance", "1Address")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetAddressBalanceCmd("1Address")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressbalance","params":["1Address"],"id":1}`,
+			unmarshalled: &chainjson.GetAddressBalanceCmd{
+				Address: "1Address",
+			},
+		},
+		{
+			name: "getaddressutxos",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getaddressutxos", "1Address")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetAddressUtxosCmd("1Address", nil,
+					nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressutxos","params":["1Address"],"id":1}`,
+			unmarshalled: &chainjson.GetAddressUtxosCmd{
+				Address: "1Address",
+				Skip:    chainjson.Int(0),
+				Count:   chainjson.Int(100),
+			},
+		},
+		{
+			name: "getaddressutxos optional",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getaddressutxos", "1Address", "STB",
+					10, 50)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetAddressUtxosCmd("1Address",
+					chainjson.String("STB"), chainjson.Int(10),
+					chainjson.Int(50))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressutxos","params":["1Address","STB",10,50],"id":1}`,
+			unmarshalled: &chainjson.GetAddressUtxosCmd{
+				Address: "1Address",
+				Token:   chainjson.String("STB"),
+				Skip:    chainjson.Int(10),
+				Count:   chainjson.Int(50),
+			},
+		},
 		{
 			name: "getbestblockhash",
 			newCmd: func() (interface{}, error) {
@@ -463,6 +546,51 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getnetworkinfo","params":[],"id":1}`,
 			unmarshalled: &chainjson.GetNetworkInfoCmd{},
 		},
+		{
+			name: "getorderbook",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getorderbook")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetOrderBookCmd(nil, nil, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getorderbook","params":[],"id":1}`,
+			unmarshalled: &chainjson.GetOrderBookCmd{
+				Depth:   chainjson.Float64(0),
+				Tick:    chainjson.Float64(0),
+				Limit:   chainjson.Int(0),
+				Verbose: chainjson.Bool(false),
+			},
+		},
+		{
+			name: "getorderbook optional",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getorderbook", 100.0, 0.5, 10, true)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetOrderBookCmd(chainjson.Float64(100),
+					chainjson.Float64(0.5), chainjson.Int(10),
+					chainjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getorderbook","params":[100,0.5,10,true],"id":1}`,
+			unmarshalled: &chainjson.GetOrderBookCmd{
+				Depth:   chainjson.Float64(100),
+				Tick:    chainjson.Float64(0.5),
+				Limit:   chainjson.Int(10),
+				Verbose: chainjson.Bool(true),
+			},
+		},
+		{
+			name: "getorderbooksnapshot",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getorderbooksnapshot")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetOrderBookSnapshotCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getorderbooksnapshot","params":[],"id":1}`,
+			unmarshalled: &chainjson.GetOrderBookSnapshotCmd{},
+		},
 		{
 			name: "getnettotals",
 			newCmd: func() (interface{}, error) {
@@ -581,6 +709,108 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: chainjson.Int(1),
 			},
 		},
+		{
+			name: "feedprice",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("feedprice", 1.05)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewFeedPriceCmd(1.05, nil, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"feedprice","params":[1.05],"id":1}`,
+			unmarshalled: &chainjson.FeedPriceCmd{
+				Price: 1.05,
+			},
+		},
+		{
+			name: "feedprice signed",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("feedprice", 1.05, "feeder", 1546300800, "c2ln")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewFeedPriceCmd(1.05, chainjson.String("feeder"),
+					chainjson.Int64(1546300800), chainjson.String("c2ln"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"feedprice","params":[1.05,"feeder",1546300800,"c2ln"],"id":1}`,
+			unmarshalled: &chainjson.FeedPriceCmd{
+				Price:     1.05,
+				Source:    chainjson.String("feeder"),
+				Timestamp: chainjson.Int64(1546300800),
+				Signature: chainjson.String("c2ln"),
+			},
+		},
+		{
+			name: "getpricefeed",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getpricefeed")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetPriceFeedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getpricefeed","params":[],"id":1}`,
+			unmarshalled: &chainjson.GetPriceFeedCmd{},
+		},
+		{
+			name: "getpricehistory",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getpricehistory", 100)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetPriceHistoryCmd(100, nil, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getpricehistory","params":[100],"id":1}`,
+			unmarshalled: &chainjson.GetPriceHistoryCmd{
+				Start:  100,
+				ByTime: chainjson.Bool(false),
+			},
+		},
+		{
+			name: "getpricehistory optional",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getpricehistory", 1500000000,
+					1500086400, 3600, true)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetPriceHistoryCmd(1500000000,
+					chainjson.Int64(1500086400), chainjson.Int64(3600),
+					chainjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getpricehistory","params":[1500000000,1500086400,3600,true],"id":1}`,
+			unmarshalled: &chainjson.GetPriceHistoryCmd{
+				Start:      1500000000,
+				End:        chainjson.Int64(1500086400),
+				BucketSize: chainjson.Int64(3600),
+				ByTime:     chainjson.Bool(true),
+			},
+		},
+		{
+			name: "getsupplyhistory",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getsupplyhistory", 1000)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetSupplyHistoryCmd(1000, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getsupplyhistory","params":[1000],"id":1}`,
+			unmarshalled: &chainjson.GetSupplyHistoryCmd{
+				StartHeight: 1000,
+				Count:       chainjson.Int(100),
+			},
+		},
+		{
+			name: "getsupplyhistory optional",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("getsupplyhistory", 1000, 10)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewGetSupplyHistoryCmd(1000, chainjson.Int(10))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getsupplyhistory","params":[1000,10],"id":1}`,
+			unmarshalled: &chainjson.GetSupplyHistoryCmd{
+				StartHeight: 1000,
+				Count:       chainjson.Int(10),
+			},
+		},
 		{
 			name: "gettxout",
 			newCmd: func() (interface{}, error) {
@@ -7,6 +7,156 @@ package chainjson
 
 import "encoding/json"
 
+// GetAbsorptionInfoResult models the data returned from the getabsorptioninfo
+// command.  The fields describing the last absorption are only set when an
+// absorption occurred.
+type GetAbsorptionInfoResult struct {
+	Hash                 string   `json:"hash"`
+	Height               int32    `json:"height"`
+	MedianPrice          *float64 `json:"medianprice,omitempty"`
+	TotalSupply          float64  `json:"totalsupply"`
+	LastAbsorptionHash   string   `json:"lastabsorptionhash,omitempty"`
+	LastAbsorptionHeight *int32   `json:"lastabsorptionheight,omitempty"`
+	AbsorptionRate       *float64 `json:"absorptionrate,omitempty"`
+	Direction            string   `json:"direction"`
+	Absorption           float64  `json:"absorption"`
+	Absorbed             float64  `json:"absorbed"`
+	RemainingBlocks      int32    `json:"remainingblocks"`
+	NextAbsorption       float64  `json:"nextabsorption"`
+	NextPassiveHeight    int32    `json:"nextpassiveheight"`
+	ActiveLowPrice       *float64 `json:"activelowprice,omitempty"`
+	ActiveHighPrice      *float64 `json:"activehighprice,omitempty"`
+}
+
+// PriceFeedSourceResult models the data of a price feed source returned from
+// the getpricefeed command.
+type PriceFeedSourceResult struct {
+	Name   string   `json:"name"`
+	Signed bool     `json:"signed"`
+	Price  *float64 `json:"price,omitempty"`
+	Time   int64    `json:"time,omitempty"`
+	Fresh  bool     `json:"fresh"`
+}
+
+// PriceFeedRecordResult models the data of a recent feed returned from the
+// getpricefeed command.
+type PriceFeedRecordResult struct {
+	Source   string   `json:"source"`
+	Price    *float64 `json:"price,omitempty"`
+	Time     int64    `json:"time"`
+	Accepted bool     `json:"accepted"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// GetPriceFeedResult models the data returned from the getpricefeed command.
+// The prices are market prices of STB/USD, except for the price to mine which
+// is a price derivation.
+type GetPriceFeedResult struct {
+	PriceToMine *float64                `json:"pricetomine,omitempty"`
+	MedianPrice *float64                `json:"medianprice,omitempty"`
+	Reason      string                  `json:"reason"`
+	MinSources  int                     `json:"minsources"`
+	Band        float64                 `json:"band"`
+	Sources     []PriceFeedSourceResult `json:"sources"`
+	Feeds       []PriceFeedRecordResult `json:"feeds"`
+}
+
+// PriceHistoryMinerResult models the price statistics of a miner within a
+// bucket returned from the getpricehistory command.  The miner is the address
+// of the key which signed the blocks, empty for the blocks whose key cannot be
+// recovered.
+type PriceHistoryMinerResult struct {
+	Miner    string   `json:"miner"`
+	Blocks   int      `json:"blocks"`
+	NoPrices int      `json:"noprices"`
+	Mean     *float64 `json:"mean,omitempty"`
+	Median   *float64 `json:"median,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// GetPriceHistoryResult models the data of a bucket returned from the
+// getpricehistory command.  The prices are price derivations, omitted when
+// none of the blocks of the bucket carries a price.
+type GetPriceHistoryResult struct {
+	Start    int64                     `json:"start"`
+	End      int64                     `json:"end"`
+	Blocks   int                       `json:"blocks"`
+	NoPrices int                       `json:"noprices"`
+	Mean     *float64                  `json:"mean,omitempty"`
+	Median   *float64                  `json:"median,omitempty"`
+	Min      *float64                  `json:"min,omitempty"`
+	Max      *float64                  `json:"max,omitempty"`
+	Miners   []PriceHistoryMinerResult `json:"miners"`
+}
+
+// TxOutSetTokenResult models the unspent outputs of a token returned from the
+// gettxoutsetinfo command.
+type TxOutSetTokenResult struct {
+	Token  string  `json:"token"`
+	TxOuts uint64  `json:"txouts"`
+	Amount float64 `json:"amount"`
+}
+
+// GetTxOutSetInfoResult models the data returned from the gettxoutsetinfo
+// command.  SupplyMismatch is the amount of STB of the unspent outputs in
+// excess of the total supply, only when they do not match.
+type GetTxOutSetInfoResult struct {
+	Height          int32                 `json:"height"`
+	BestBlock       string                `json:"bestblock"`
+	Transactions    uint64                `json:"transactions"`
+	TxOuts          uint64                `json:"txouts"`
+	BytesSerialized uint64                `json:"bytesserialized"`
+	HashSerialized  string                `json:"hashserialized"`
+	Tokens          []TxOutSetTokenResult `json:"tokens"`
+	TotalSupply     float64               `json:"totalsupply"`
+	SupplyMismatch  *float64              `json:"supplymismatch,omitempty"`
+}
+
+// AddressTokenBalanceResult models the unspent outputs of a token paying an
+// address returned from the getaddressbalance command.
+type AddressTokenBalanceResult struct {
+	Token  string  `json:"token"`
+	TxOuts uint32  `json:"txouts"`
+	Amount float64 `json:"amount"`
+}
+
+// GetAddressBalanceResult models the data returned from the getaddressbalance
+// command, as of the block the balance index was last updated with.
+type GetAddressBalanceResult struct {
+	Address   string                      `json:"address"`
+	Height    int32                       `json:"height"`
+	BestBlock string                      `json:"bestblock"`
+	Balances  []AddressTokenBalanceResult `json:"balances"`
+}
+
+// GetAddressUtxosResult models the data of an unspent output returned from the
+// getaddressutxos command.
+type GetAddressUtxosResult struct {
+	TxID          string  `json:"txid"`
+	Vout          uint32  `json:"vout"`
+	Token         string  `json:"token"`
+	Amount        float64 `json:"amount"`
+	Height        int32   `json:"height"`
+	Confirmations int64   `json:"confirmations"`
+	Coinbase      bool    `json:"coinbase"`
+}
+
+// GetSupplyHistoryResult models the data of a block returned from the
+// getsupplyhistory command.  The order amounts are the net amounts of each
+// token received by the orders filled by the block, which are negative for the
+// token they paid.
+type GetSupplyHistoryResult struct {
+	Hash           string   `json:"hash"`
+	Height         int32    `json:"height"`
+	SupplyChange   float64  `json:"supplychange"`
+	Absorption     bool     `json:"absorption"`
+	AbsorptionRate *float64 `json:"absorptionrate,omitempty"`
+	FilledOrders   uint32   `json:"filledorders"`
+	OrderSTB       float64  `json:"orderstb"`
+	OrderNDR       float64  `json:"orderndr"`
+}
+
 // GetBlockHeaderVerboseResult models the data from the getblockheader command when
 // the verbose flag is set.  When the verbose flag is not set, getblockheader
 // returns a hex-encoded string.
@@ -198,6 +348,14 @@ type GetMempoolEntryResult struct {
 type GetMempoolInfoResult struct {
 	Size  int64 `json:"size"`
 	Bytes int64 `json:"bytes"`
+
+	// MinRelayTxFee is the minimum transaction fee in effect in coins per
+	// kilobyte, by token name.  RelayFeePrice is the price of one STB in
+	// NDR its NDR side is derived with, only when it is dynamic and was
+	// derived.
+	MinRelayTxFee   map[string]float64 `json:"minrelaytxfee"`
+	DynamicRelayFee bool               `json:"dynamicrelayfee"`
+	RelayFeePrice   float64            `json:"relayfeeprice,omitempty"`
 }
 
 // NetworksResult models the networks data from the getnetworkinfo command.
@@ -284,13 +442,54 @@ type GetRawMembookVerboseResult struct {
 	Depends []string `json:"depends"`
 }
 
-// GetOrderBookResult models the data returned from the getrawmembook
-// command when the verbose flag is set.  When the verbose flag is not set,
-// getrawmembook returns an array of order hashes.
+// OrderBookOrderResult models an order of a price level returned from the
+// getorderbook command when the verbose flag is set.
+type OrderBookOrderResult struct {
+	Hash   string  `json:"hash"`
+	Price  float64 `json:"price"`
+	Amount float64 `json:"amount"`
+	Payout float64 `json:"payout"`
+	Height int32   `json:"height"`
+	Time   int64   `json:"time"`
+}
+
+// OrderBookLevelResult models a price level of one side of the order book
+// returned from the getorderbook command.
+type OrderBookLevelResult struct {
+	Price  float64                `json:"price"`
+	Amount float64                `json:"amount"`
+	Count  int                    `json:"count"`
+	Orders []OrderBookOrderResult `json:"orders,omitempty"`
+}
+
+// GetOrderBookResult models the data returned from the getorderbook command.
+// The best prices are only set when the side they come from is not empty, and
+// the spread and mid price when both are.
 type GetOrderBookResult struct {
+	BestBid *float64               `json:"bestbid,omitempty"`
+	BestAsk *float64               `json:"bestask,omitempty"`
+	Spread  *float64               `json:"spread,omitempty"`
+	Mid     *float64               `json:"mid,omitempty"`
+	Bids    []OrderBookLevelResult `json:"bids"`
+	Asks    []OrderBookLevelResult `json:"asks"`
+}
+
+// OrderBookEntryResult models an order resting in the order book as it is
+// returned by the getorderbooksnapshot command and the orderbookdelta
+// notification.
+type OrderBookEntryResult struct {
+	Hash   string  `json:"hash"`
 	Bid    bool    `json:"bid"`
 	Price  float64 `json:"price"`
 	Amount float64 `json:"amount"`
+	Payout float64 `json:"payout"`
+}
+
+// GetOrderBookSnapshotResult models the data returned from the
+// getorderbooksnapshot command.
+type GetOrderBookSnapshotResult struct {
+	Sequence uint64                 `json:"sequence"`
+	Orders   []OrderBookEntryResult `json:"orders"`
 }
 
 // ScriptPubKeyResult models the scriptPubKey data of a tx script.  It is
@@ -74,6 +74,15 @@ func NewNotifyNewOrdersCmd(verbose *bool) *NotifyNewOrdersCmd {
 	}
 }
 
+// NotifyOrderBookCmd defines the notifyorderbook JSON-RPC command.
+type NotifyOrderBookCmd struct{}
+
+// NewNotifyOrderBookCmd returns a new instance which can be used to issue a
+// notifyorderbook JSON-RPC command.
+func NewNotifyOrderBookCmd() *NotifyOrderBookCmd {
+	return &NotifyOrderBookCmd{}
+}
+
 // SessionCmd defines the session JSON-RPC command.
 type SessionCmd struct{}
 
@@ -107,6 +116,15 @@ func NewStopNotifyNewOrdersCmd() *StopNotifyNewOrdersCmd {
 	return &StopNotifyNewOrdersCmd{}
 }
 
+// StopNotifyOrderBookCmd defines the stopnotifyorderbook JSON-RPC command.
+type StopNotifyOrderBookCmd struct{}
+
+// NewStopNotifyOrderBookCmd returns a new instance which can be used to issue
+// a stopnotifyorderbook JSON-RPC command.
+func NewStopNotifyOrderBookCmd() *StopNotifyOrderBookCmd {
+	return &StopNotifyOrderBookCmd{}
+}
+
 // NotifyReceivedCmd defines the notifyreceived JSON-RPC command.
 //
 // NOTE: Deprecated. Use LoadTxFilterCmd instead.
@@ -259,12 +277,14 @@ func init() {
 	MustRegisterCmd("notifyblocks", (*NotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("notifynewtransactions", (*NotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("notifyneworders", (*NotifyNewOrdersCmd)(nil), flags)
+	MustRegisterCmd("notifyorderbook", (*NotifyOrderBookCmd)(nil), flags)
 	MustRegisterCmd("notifyreceived", (*NotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("notifyspent", (*NotifySpentCmd)(nil), flags)
 	MustRegisterCmd("session", (*SessionCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyblocks", (*StopNotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("stopnotifynewtransactions", (*StopNotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyneworders", (*StopNotifyNewOrdersCmd)(nil), flags)
+	MustRegisterCmd("stopnotifyorderbook", (*StopNotifyOrderBookCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyspent", (*StopNotifySpentCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyreceived", (*StopNotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("rescan", (*RescanCmd)(nil), flags)
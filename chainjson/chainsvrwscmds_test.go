@@ -101,6 +101,28 @@ func TestChainSvrWsCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifynewtransactions","params":[],"id":1}`,
 			unmarshalled: &chainjson.StopNotifyNewTransactionsCmd{},
 		},
+		{
+			name: "notifyorderbook",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("notifyorderbook")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewNotifyOrderBookCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"notifyorderbook","params":[],"id":1}`,
+			unmarshalled: &chainjson.NotifyOrderBookCmd{},
+		},
+		{
+			name: "stopnotifyorderbook",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("stopnotifyorderbook")
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewStopNotifyOrderBookCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyorderbook","params":[],"id":1}`,
+			unmarshalled: &chainjson.StopNotifyOrderBookCmd{},
+		},
 		{
 			name: "notifyreceived",
 			newCmd: func() (interface{}, error) {
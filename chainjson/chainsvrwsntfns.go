@@ -91,6 +91,41 @@ const (
 	// from the chain server that inform a client that a order that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantOdrAcceptedNtfnMethod = "relevantodraccepted"
+
+	// OrderBookDeltaNtfnMethod is the method used for notifications from
+	// the chain server that an order has been added to or removed from the
+	// order book.
+	OrderBookDeltaNtfnMethod = "orderbookdelta"
+
+	// AbsorptionStartedNtfnMethod is the method used for notifications
+	// from the chain server that a block connected to the main chain has
+	// triggered an absorption.
+	AbsorptionStartedNtfnMethod = "absorptionstarted"
+
+	// AbsorptionEndedNtfnMethod is the method used for notifications from
+	// the chain server that a block connected to the main chain is the last
+	// block of an absorption.
+	AbsorptionEndedNtfnMethod = "absorptionended"
+
+	// OrderFilledNtfnMethod is the method used for notifications from the
+	// chain server that an order has been filled by a block connected to
+	// the main chain.
+	OrderFilledNtfnMethod = "orderfilled"
+
+	// AbsorptionStartRevertedNtfnMethod is the method used for
+	// notifications from the chain server that a block which triggered an
+	// absorption has been disconnected from the main chain.
+	AbsorptionStartRevertedNtfnMethod = "absorptionstartreverted"
+
+	// AbsorptionEndRevertedNtfnMethod is the method used for notifications
+	// from the chain server that a block which was the last block of an
+	// absorption has been disconnected from the main chain.
+	AbsorptionEndRevertedNtfnMethod = "absorptionendreverted"
+
+	// OrderFillRevertedNtfnMethod is the method used for notifications
+	// from the chain server that a block which filled an order has been
+	// disconnected from the main chain.
+	OrderFillRevertedNtfnMethod = "orderfillreverted"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -341,6 +376,168 @@ func NewRelevantOdrAcceptedNtfn(odrHex string) *RelevantOdrAcceptedNtfn {
 	return &RelevantOdrAcceptedNtfn{Transaction: odrHex}
 }
 
+// OrderBookDeltaNtfn defines the orderbookdelta JSON-RPC notification.
+type OrderBookDeltaNtfn struct {
+	Sequence uint64
+	Action   string
+	Order    OrderBookEntryResult
+}
+
+// NewOrderBookDeltaNtfn returns a new instance which can be used to issue an
+// orderbookdelta JSON-RPC notification.
+func NewOrderBookDeltaNtfn(sequence uint64, action string, order OrderBookEntryResult) *OrderBookDeltaNtfn {
+	return &OrderBookDeltaNtfn{
+		Sequence: sequence,
+		Action:   action,
+		Order:    order,
+	}
+}
+
+// AbsorptionStartedNtfn defines the absorptionstarted JSON-RPC notification.
+type AbsorptionStartedNtfn struct {
+	Hash       string
+	Height     int32
+	Rate       float64
+	Absorption float64
+}
+
+// NewAbsorptionStartedNtfn returns a new instance which can be used to issue
+// an absorptionstarted JSON-RPC notification.
+func NewAbsorptionStartedNtfn(hash string, height int32, rate, absorption float64) *AbsorptionStartedNtfn {
+	return &AbsorptionStartedNtfn{
+		Hash:       hash,
+		Height:     height,
+		Rate:       rate,
+		Absorption: absorption,
+	}
+}
+
+// AbsorptionEndedNtfn defines the absorptionended JSON-RPC notification.
+type AbsorptionEndedNtfn struct {
+	Hash             string
+	Height           int32
+	AbsorptionHash   string
+	AbsorptionHeight int32
+	Rate             float64
+	Absorption       float64
+	Absorbed         float64
+}
+
+// NewAbsorptionEndedNtfn returns a new instance which can be used to issue an
+// absorptionended JSON-RPC notification.
+func NewAbsorptionEndedNtfn(hash string, height int32, absorptionHash string,
+	absorptionHeight int32, rate, absorption, absorbed float64) *AbsorptionEndedNtfn {
+
+	return &AbsorptionEndedNtfn{
+		Hash:             hash,
+		Height:           height,
+		AbsorptionHash:   absorptionHash,
+		AbsorptionHeight: absorptionHeight,
+		Rate:             rate,
+		Absorption:       absorption,
+		Absorbed:         absorbed,
+	}
+}
+
+// OrderFilledNtfn defines the orderfilled JSON-RPC notification.  STB and NDR
+// are the net amounts of each token received by the order, which are negative
+// for the token it paid.  Rate is the rate of the absorption the order was
+// filled for, when any.
+type OrderFilledNtfn struct {
+	TxID   string
+	Hash   string
+	Height int32
+	STB    float64
+	NDR    float64
+	Rate   *float64
+}
+
+// NewOrderFilledNtfn returns a new instance which can be used to issue an
+// orderfilled JSON-RPC notification.
+func NewOrderFilledNtfn(txID, hash string, height int32, stb, ndr float64, rate *float64) *OrderFilledNtfn {
+	return &OrderFilledNtfn{
+		TxID:   txID,
+		Hash:   hash,
+		Height: height,
+		STB:    stb,
+		NDR:    ndr,
+		Rate:   rate,
+	}
+}
+
+// AbsorptionStartRevertedNtfn defines the absorptionstartreverted JSON-RPC
+// notification.
+type AbsorptionStartRevertedNtfn struct {
+	Hash       string
+	Height     int32
+	Rate       float64
+	Absorption float64
+}
+
+// NewAbsorptionStartRevertedNtfn returns a new instance which can be used to
+// issue an absorptionstartreverted JSON-RPC notification.
+func NewAbsorptionStartRevertedNtfn(hash string, height int32, rate, absorption float64) *AbsorptionStartRevertedNtfn {
+	return &AbsorptionStartRevertedNtfn{
+		Hash:       hash,
+		Height:     height,
+		Rate:       rate,
+		Absorption: absorption,
+	}
+}
+
+// AbsorptionEndRevertedNtfn defines the absorptionendreverted JSON-RPC
+// notification.
+type AbsorptionEndRevertedNtfn struct {
+	Hash             string
+	Height           int32
+	AbsorptionHash   string
+	AbsorptionHeight int32
+	Rate             float64
+	Absorption       float64
+	Absorbed         float64
+}
+
+// NewAbsorptionEndRevertedNtfn returns a new instance which can be used to
+// issue an absorptionendreverted JSON-RPC notification.
+func NewAbsorptionEndRevertedNtfn(hash string, height int32, absorptionHash string,
+	absorptionHeight int32, rate, absorption, absorbed float64) *AbsorptionEndRevertedNtfn {
+
+	return &AbsorptionEndRevertedNtfn{
+		Hash:             hash,
+		Height:           height,
+		AbsorptionHash:   absorptionHash,
+		AbsorptionHeight: absorptionHeight,
+		Rate:             rate,
+		Absorption:       absorption,
+		Absorbed:         absorbed,
+	}
+}
+
+// OrderFillRevertedNtfn defines the orderfillreverted JSON-RPC notification.
+// The fields are the ones of the orderfilled notification of the fill being
+// reverted.
+type OrderFillRevertedNtfn struct {
+	TxID   string
+	Hash   string
+	Height int32
+	STB    float64
+	NDR    float64
+	Rate   *float64
+}
+
+// NewOrderFillRevertedNtfn returns a new instance which can be used to issue an
+// orderfillreverted JSON-RPC notification.
+func NewOrderFillRevertedNtfn(txID, hash string, height int32, stb, ndr float64, rate *float64) *OrderFillRevertedNtfn {
+	return &OrderFillRevertedNtfn{
+		TxID:   txID,
+		Hash:   hash,
+		Height: height,
+		STB:    stb,
+		NDR:    ndr,
+		Rate:   rate,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -360,4 +557,11 @@ func init() {
 	MustRegisterCmd(OdrAcceptedNtfnMethod, (*OdrAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(OdrAcceptedVerboseNtfnMethod, (*OdrAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantOdrAcceptedNtfnMethod, (*RelevantOdrAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(OrderBookDeltaNtfnMethod, (*OrderBookDeltaNtfn)(nil), flags)
+	MustRegisterCmd(AbsorptionStartedNtfnMethod, (*AbsorptionStartedNtfn)(nil), flags)
+	MustRegisterCmd(AbsorptionEndedNtfnMethod, (*AbsorptionEndedNtfn)(nil), flags)
+	MustRegisterCmd(OrderFilledNtfnMethod, (*OrderFilledNtfn)(nil), flags)
+	MustRegisterCmd(AbsorptionStartRevertedNtfnMethod, (*AbsorptionStartRevertedNtfn)(nil), flags)
+	MustRegisterCmd(AbsorptionEndRevertedNtfnMethod, (*AbsorptionEndRevertedNtfn)(nil), flags)
+	MustRegisterCmd(OrderFillRevertedNtfnMethod, (*OrderFillRevertedNtfn)(nil), flags)
 }
@@ -226,6 +226,140 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "orderbookdelta",
+			newNtfn: func() (interface{}, error) {
+				return chainjson.NewCmd("orderbookdelta", 7, "fill", `{"hash":"123","bid":true,"price":0.5,"amount":2,"payout":1}`)
+			},
+			staticNtfn: func() interface{} {
+				order := chainjson.OrderBookEntryResult{
+					Hash:   "123",
+					Bid:    true,
+					Price:  0.5,
+					Amount: 2,
+					Payout: 1,
+				}
+				return chainjson.NewOrderBookDeltaNtfn(7, "fill", order)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"orderbookdelta","params":[7,"fill",{"hash":"123","bid":true,"price":0.5,"amount":2,"payout":1}],"id":null}`,
+			unmarshalled: &chainjson.OrderBookDeltaNtfn{
+				Sequence: 7,
+				Action:   "fill",
+				Order: chainjson.OrderBookEntryResult{
+					Hash:   "123",
+					Bid:    true,
+					Price:  0.5,
+					Amount: 2,
+					Payout: 1,
+				},
+			},
+		},
+		{
+			name: "absorptionstarted",
+			newNtfn: func() (interface{}, error) {
+				return chainjson.NewCmd("absorptionstarted", "123", 100, -0.5, 1000.0)
+			},
+			staticNtfn: func() interface{} {
+				return chainjson.NewAbsorptionStartedNtfn("123", 100, -0.5, 1000.0)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"absorptionstarted","params":["123",100,-0.5,1000],"id":null}`,
+			unmarshalled: &chainjson.AbsorptionStartedNtfn{
+				Hash:       "123",
+				Height:     100,
+				Rate:       -0.5,
+				Absorption: 1000,
+			},
+		},
+		{
+			name: "absorptionended",
+			newNtfn: func() (interface{}, error) {
+				return chainjson.NewCmd("absorptionended", "456", 148, "123", 100, -0.5, 1000.0, 990.0)
+			},
+			staticNtfn: func() interface{} {
+				return chainjson.NewAbsorptionEndedNtfn("456", 148, "123", 100, -0.5, 1000.0, 990.0)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"absorptionended","params":["456",148,"123",100,-0.5,1000,990],"id":null}`,
+			unmarshalled: &chainjson.AbsorptionEndedNtfn{
+				Hash:             "456",
+				Height:           148,
+				AbsorptionHash:   "123",
+				AbsorptionHeight: 100,
+				Rate:             -0.5,
+				Absorption:       1000,
+				Absorbed:         990,
+			},
+		},
+		{
+			name: "orderfilled",
+			newNtfn: func() (interface{}, error) {
+				return chainjson.NewCmd("orderfilled", "789", "456", 148, 30.0, -4.0, 0.5)
+			},
+			staticNtfn: func() interface{} {
+				return chainjson.NewOrderFilledNtfn("789", "456", 148, 30, -4,
+					chainjson.Float64(0.5))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"orderfilled","params":["789","456",148,30,-4,0.5],"id":null}`,
+			unmarshalled: &chainjson.OrderFilledNtfn{
+				TxID:   "789",
+				Hash:   "456",
+				Height: 148,
+				STB:    30,
+				NDR:    -4,
+				Rate:   chainjson.Float64(0.5),
+			},
+		},
+		{
+			name: "absorptionstartreverted",
+			newNtfn: func() (interface{}, error) {
+				return chainjson.NewCmd("absorptionstartreverted", "123", 100, -0.5, 1000.0)
+			},
+			staticNtfn: func() interface{} {
+				return chainjson.NewAbsorptionStartRevertedNtfn("123", 100, -0.5, 1000.0)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"absorptionstartreverted","params":["123",100,-0.5,1000],"id":null}`,
+			unmarshalled: &chainjson.AbsorptionStartRevertedNtfn{
+				Hash:       "123",
+				Height:     100,
+				Rate:       -0.5,
+				Absorption: 1000,
+			},
+		},
+		{
+			name: "absorptionendreverted",
+			newNtfn: func() (interface{}, error) {
+				return chainjson.NewCmd("absorptionendreverted", "456", 148, "123", 100, -0.5, 1000.0, 990.0)
+			},
+			staticNtfn: func() interface{} {
+				return chainjson.NewAbsorptionEndRevertedNtfn("456", 148, "123", 100, -0.5, 1000.0, 990.0)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"absorptionendreverted","params":["456",148,"123",100,-0.5,1000,990],"id":null}`,
+			unmarshalled: &chainjson.AbsorptionEndRevertedNtfn{
+				Hash:             "456",
+				Height:           148,
+				AbsorptionHash:   "123",
+				AbsorptionHeight: 100,
+				Rate:             -0.5,
+				Absorption:       1000,
+				Absorbed:         990,
+			},
+		},
+		{
+			name: "orderfillreverted",
+			newNtfn: func() (interface{}, error) {
+				return chainjson.NewCmd("orderfillreverted", "789", "456", 148, 30.0, -4.0)
+			},
+			staticNtfn: func() interface{} {
+				return chainjson.NewOrderFillRevertedNtfn("789", "456", 148, 30, -4, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"orderfillreverted","params":["789","456",148,30,-4],"id":null}`,
+			unmarshalled: &chainjson.OrderFillRevertedNtfn{
+				TxID:   "789",
+				Hash:   "456",
+				Height: 148,
+				STB:    30,
+				NDR:    -4,
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
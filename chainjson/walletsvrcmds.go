@@ -85,13 +85,20 @@ func NewEncryptWalletCmd(passphrase string) *EncryptWalletCmd {
 // EstimateFeeCmd defines the estimatefee JSON-RPC command.
 type EstimateFeeCmd struct {
 	NumBlocks int64
+	Token     *string `jsonrpcdefault:"\"NDR\""`
+	Combined  *bool   `jsonrpcdefault:"false"`
 }
 
 // NewEstimateFeeCmd returns a new instance which can be used to issue a
 // estimatefee JSON-RPC command.
-func NewEstimateFeeCmd(numBlocks int64) *EstimateFeeCmd {
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewEstimateFeeCmd(numBlocks int64, token *string, combined *bool) *EstimateFeeCmd {
 	return &EstimateFeeCmd{
 		NumBlocks: numBlocks,
+		Token:     token,
+		Combined:  combined,
 	}
 }
 
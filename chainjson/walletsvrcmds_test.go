@@ -122,11 +122,29 @@ func TestWalletSvrCmds(t *testing.T) {
 				return chainjson.NewCmd("estimatefee", 6)
 			},
 			staticCmd: func() interface{} {
-				return chainjson.NewEstimateFeeCmd(6)
+				return chainjson.NewEstimateFeeCmd(6, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"estimatefee","params":[6],"id":1}`,
 			unmarshalled: &chainjson.EstimateFeeCmd{
 				NumBlocks: 6,
+				Token:     chainjson.String("NDR"),
+				Combined:  chainjson.Bool(false),
+			},
+		},
+		{
+			name: "estimatefee optional",
+			newCmd: func() (interface{}, error) {
+				return chainjson.NewCmd("estimatefee", 6, "STB", true)
+			},
+			staticCmd: func() interface{} {
+				return chainjson.NewEstimateFeeCmd(6, chainjson.String("STB"),
+					chainjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatefee","params":[6,"STB",true],"id":1}`,
+			unmarshalled: &chainjson.EstimateFeeCmd{
+				NumBlocks: 6,
+				Token:     chainjson.String("STB"),
+				Combined:  chainjson.Bool(true),
 			},
 		},
 		{
@@ -0,0 +1,323 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/blockchain/indexers"
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/database"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+const (
+	blockDbNamePrefix = "blocks"
+
+	// supplyBatchSize is the number of supply entries loaded from the
+	// supply index at once.
+	supplyBatchSize = 2000
+)
+
+var (
+	cfg *config
+)
+
+// loadBlockDB opens the block database and returns a handle to it.
+func loadBlockDB() (database.DB, error) {
+	// The database name is based on the database type.
+	dbName := blockDbNamePrefix + "_" + cfg.DbType
+	dbPath := filepath.Join(cfg.DataDir, dbName)
+	fmt.Fprintf(os.Stderr, "Loading block database from '%s'\n", dbPath)
+	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// formatPrice returns the passed price for the output, which is empty for
+// NoPrice.
+func formatPrice(price blockchain.Price) string {
+	if price == blockchain.NoPrice {
+		return ""
+	}
+	return strconv.FormatFloat(price.Float(), 'f', -1, 64)
+}
+
+// formatSTB returns the passed amount of STB in coins for the output, which is
+// empty for a nil amount.
+func formatSTB(amount *big.Int) string {
+	if amount == nil {
+		return ""
+	}
+	f := types.Amount(amount.Int64()).ToCoin()
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// report accumulates the absorptions triggered by the replayed blocks and
+// outputs each block as a CSV line.
+type report struct {
+	w         io.Writer
+	chainMode bool
+	blocks    int
+	triggers  []int32
+	last      *blockchain.AbsorptionSimResult
+}
+
+// header outputs the CSV header line.
+func (r *report) header() {
+	line := "height,price,medianprice,rate,absorption,supply"
+	if r.chainMode {
+		line += ",chainrate,chainabsorption,chainsupply"
+	}
+	fmt.Fprintln(r.w, line)
+}
+
+// add outputs the result of a replayed block, followed by the result of the
+// same block in the chain when replaying the chain.
+func (r *report) add(result, chainResult *blockchain.AbsorptionSimResult) {
+	r.blocks++
+	r.last = result
+	if result.Rate != blockchain.NoPrice {
+		r.triggers = append(r.triggers, result.Height)
+	}
+
+	triggered := result.Rate != blockchain.NoPrice ||
+		(chainResult != nil && chainResult.Rate != blockchain.NoPrice)
+	if cfg.TriggersOnly && !triggered {
+		return
+	}
+
+	fields := []string{
+		strconv.FormatInt(int64(result.Height), 10),
+		formatPrice(result.Price),
+		formatPrice(result.MedianPrice),
+		formatPrice(result.Rate),
+		formatSTB(result.Absorption),
+		formatSTB(result.TotalSupply),
+	}
+	if chainResult != nil {
+		fields = append(fields, formatPrice(chainResult.Rate),
+			formatSTB(chainResult.Absorption),
+			formatSTB(chainResult.TotalSupply))
+	}
+	fmt.Fprintln(r.w, strings.Join(fields, ","))
+}
+
+// summary outputs a summary of the replay to stderr.
+func (r *report) summary() {
+	fmt.Fprintf(os.Stderr, "Replayed %d blocks with %d blocks per epoch, "+
+		"active ratios %s and %s\n", r.blocks,
+		cfg.simParams.BlockPerTimespan,
+		cfg.simParams.ActiveAbsorptionHighRatio.RatString(),
+		cfg.simParams.ActiveAbsorptionLowRatio.RatString())
+	fmt.Fprintf(os.Stderr, "%d absorptions triggered at heights %v\n",
+		len(r.triggers), r.triggers)
+	if r.last != nil {
+		fmt.Fprintf(os.Stderr, "Total supply after height %d: %s STB\n",
+			r.last.Height, formatSTB(r.last.TotalSupply))
+	}
+}
+
+// parseCSVBlock parses the passed CSV line into the synthetic block at the
+// passed height.  See the description of the csv option for the format.
+func parseCSVBlock(line string, height int32, params *chaincfg.Params) (*blockchain.AbsorptionSimBlock, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) > 3 {
+		return nil, fmt.Errorf("too many fields")
+	}
+
+	price := blockchain.NoPrice
+	priceField := strings.TrimSpace(fields[0])
+	if priceField != "" && !strings.EqualFold(priceField, "nan") {
+		f, err := strconv.ParseFloat(priceField, 64)
+		if err != nil {
+			return nil, err
+		}
+		price = blockchain.PriceFromFloat(f)
+		if price == blockchain.NoPrice {
+			return nil, fmt.Errorf("price %v is out of range", f)
+		}
+	}
+
+	// The synthetic blocks are spaced by the target time per block so the
+	// rule change deployments see the times they would on the network.
+	genesisTime := params.GenesisBlock.Header.Timestamp
+	block := &blockchain.AbsorptionSimBlock{
+		Header: wire.BlockHeader{
+			Version:         1,
+			Timestamp:       genesisTime.Add(time.Duration(height) * params.TargetTimePerBlock),
+			PriceDerivation: blockchain.HeaderPriceDerivation(price, height, params),
+		},
+	}
+	if len(fields) > 1 && strings.TrimSpace(fields[1]) != "" {
+		f, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return nil, err
+		}
+		amount, err := types.NewAmount(f)
+		if err != nil {
+			return nil, err
+		}
+		block.SupplyChange = amount.BigInt()
+	}
+	if len(fields) > 2 && strings.TrimSpace(fields[2]) != "" {
+		block.MinerKey = []byte(strings.TrimSpace(fields[2]))
+	}
+	return block, nil
+}
+
+// replayCSV replays the synthetic blocks of the CSV file of the configuration.
+// Empty lines and lines starting with '#' are ignored.
+func replayCSV(r *report) error {
+	file, err := os.Open(cfg.CSVFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	supply := chaincfg.PreminedSTB.Amount.BigInt()
+	if cfg.Supply != 0 {
+		amount, err := types.NewAmount(cfg.Supply)
+		if err != nil {
+			return err
+		}
+		supply = amount.BigInt()
+	}
+	sim := blockchain.NewAbsorptionSimulator(cfg.simParams, supply)
+
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		block, err := parseCSVBlock(line, sim.Height()+1, cfg.simParams)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", cfg.CSVFile, lineNum, err)
+		}
+		result, err := sim.ConnectBlock(block)
+		if err != nil {
+			return err
+		}
+		r.add(result, nil)
+	}
+	return scanner.Err()
+}
+
+// replayChain replays the blocks of the main chain of the database with the
+// simulation parameters, alongside the blocks replayed with the parameters of
+// the network, which match the absorptions of the chain.  The supply changes
+// of the blocks besides their absorptions are the differences between their
+// supply changes in the supply index and their absorptions in the chain.
+func replayChain(r *report) error {
+	db, err := loadBlockDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: activeNetParams,
+		TimeSource:  blockchain.NewMedianTime(),
+		PriceSource: blockchain.NewFeedPrice(activeNetParams.TargetTimePerBlock),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize chain: %v", err)
+	}
+	endHeight := chain.BestSnapshot().Height
+	if cfg.EndHeight > 0 && cfg.EndHeight < endHeight {
+		endHeight = cfg.EndHeight
+	}
+	fmt.Fprintf(os.Stderr, "Replaying the chain up to height %d\n",
+		endHeight)
+
+	supplyIndex := indexers.NewSupplyIndex(db, activeNetParams)
+	genesisSupply := chaincfg.PreminedSTB.Amount.BigInt()
+	chainSim := blockchain.NewAbsorptionSimulator(activeNetParams, genesisSupply)
+	sim := blockchain.NewAbsorptionSimulator(cfg.simParams, genesisSupply)
+
+	var entries []indexers.SupplyEntry
+	for height := int32(1); height <= endHeight; height++ {
+		if len(entries) == 0 {
+			entries, err = supplyIndex.EntriesByHeight(height,
+				supplyBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				return fmt.Errorf("no supply index entry for "+
+					"height %d -- run ndrd with --supplyindex "+
+					"to build the supply index", height)
+			}
+		}
+		entry := &entries[0]
+		entries = entries[1:]
+
+		header, err := chain.HeaderByHash(&entry.Hash)
+		if err != nil {
+			return err
+		}
+		chainAbsorption, err := chainSim.NextAbsorption()
+		if err != nil {
+			return err
+		}
+		supplyChange := big.NewInt(int64(entry.SupplyChange))
+		if chainAbsorption != nil {
+			supplyChange.Sub(supplyChange, chainAbsorption)
+		}
+
+		block := &blockchain.AbsorptionSimBlock{
+			Header:       header,
+			SupplyChange: supplyChange,
+		}
+		chainResult, err := chainSim.ConnectBlock(block)
+		if err != nil {
+			return err
+		}
+		result, err := sim.ConnectBlock(block)
+		if err != nil {
+			return err
+		}
+		r.add(result, chainResult)
+	}
+	return nil
+}
+
+func main() {
+	// Load configuration and parse command line.
+	tcfg, _, err := loadConfig()
+	if err != nil {
+		os.Exit(1)
+	}
+	cfg = tcfg
+
+	w := bufio.NewWriter(os.Stdout)
+	r := &report{w: w, chainMode: cfg.CSVFile == ""}
+	r.header()
+	if cfg.CSVFile != "" {
+		err = replayCSV(r)
+	} else {
+		err = replayChain(r)
+	}
+	w.Flush()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to replay the blocks:", err)
+		os.Exit(1)
+	}
+	r.summary()
+}
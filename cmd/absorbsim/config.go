@@ -0,0 +1,214 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/database"
+	_ "github.com/endurio/ndrd/database/ffldb"
+	"github.com/endurio/ndrd/wire"
+	flags "github.com/jessevdk/go-flags"
+)
+
+const (
+	defaultDbType = "ffldb"
+)
+
+var (
+	ndrdHomeDir     = chainutil.AppDataDir("ndrd", false)
+	defaultDataDir  = filepath.Join(ndrdHomeDir, "data")
+	knownDbTypes    = database.SupportedDrivers()
+	activeNetParams = &chaincfg.MainNetParams
+)
+
+// config defines the configuration options for absorbsim.
+//
+// See loadConfig for details on the configuration load process.
+type config struct {
+	DataDir          string  `short:"b" long:"datadir" description:"Location of the ndrd data directory"`
+	DbType           string  `long:"dbtype" description:"Database backend to use for the Block Chain"`
+	TestNet3         bool    `long:"testnet" description:"Use the test network"`
+	RegressionTest   bool    `long:"regtest" description:"Use the regression test network"`
+	SimNet           bool    `long:"simnet" description:"Use the simulation test network"`
+	CSVFile          string  `long:"csv" description:"Replay the synthetic blocks of a CSV file instead of the blocks of the chain database -- each line is 'price[,supplychange[,miner]]' where price is the price derivation of the block, empty or 'nan' for none, supplychange is the STB supply change of the block besides its absorption and miner identifies the miner of the block"`
+	Supply           float64 `long:"supply" description:"The total supply of STB after the genesis block of the CSV replay (default: the premined supply)"`
+	EndHeight        int32   `long:"end" description:"The height of the last block of the chain to replay (default: the best block)"`
+	BlockPerTimespan int32   `long:"blockpertimespan" description:"Replay with this number of blocks per absorption epoch (default: the one of the network)"`
+	HighRatio        string  `long:"highratio" description:"Replay with this ratio of the median price to the one of the last absorption at or above which an active absorption is triggered, such as 2 or 3/2 (default: the one of the network)"`
+	LowRatio         string  `long:"lowratio" description:"Replay with this ratio of the median price to the one of the last absorption at or below which an active absorption is triggered, such as -0.5 or -1/2 (default: the one of the network)"`
+	MinerMedian      bool    `long:"minermedian" description:"Replay with the prices aggregated per miner as if the median price deployment was active from the genesis block"`
+	TriggersOnly     bool    `long:"triggersonly" description:"Only output the blocks which trigger an absorption"`
+
+	// simParams are the chain parameters of the replay, which are the ones
+	// of the active network with the requested changes.
+	simParams *chaincfg.Params
+}
+
+// validDbType returns whether or not dbType is a supported database type.
+func validDbType(dbType string) bool {
+	for _, knownType := range knownDbTypes {
+		if dbType == knownType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// netName returns the name used when referring to a bitcoin network.  At the
+// time of writing, ndrd currently places blocks for testnet version 3 in the
+// data and log directory "testnet", which does not match the Name field of the
+// chaincfg parameters.  This function can be used to override this directory name
+// as "testnet" when the passed active network matches wire.TestNet3.
+//
+// A proper upgrade to move the data and log directories for this network to
+// "testnet3" is planned for the future, at which point this function can be
+// removed and the network parameter's name used instead.
+func netName(chainParams *chaincfg.Params) string {
+	switch chainParams.Net {
+	case wire.TestNet3:
+		return "testnet"
+	default:
+		return chainParams.Name
+	}
+}
+
+// parseRatio parses the passed ratio, either as a decimal number or as a
+// fraction.
+func parseRatio(s string) (*big.Rat, error) {
+	ratio, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid ratio %q", s)
+	}
+	return ratio, nil
+}
+
+// simulationParams returns a copy of the parameters of the active network with
+// the changes requested by the passed configuration.
+func simulationParams(cfg *config) (*chaincfg.Params, error) {
+	params := *activeNetParams
+	if cfg.BlockPerTimespan != 0 {
+		if cfg.BlockPerTimespan < 0 {
+			return nil, fmt.Errorf("the number of blocks per "+
+				"absorption epoch must be positive -- parsed [%v]",
+				cfg.BlockPerTimespan)
+		}
+		params.BlockPerTimespan = cfg.BlockPerTimespan
+	}
+	if cfg.HighRatio != "" {
+		ratio, err := parseRatio(cfg.HighRatio)
+		if err != nil {
+			return nil, err
+		}
+		params.ActiveAbsorptionHighRatio = ratio
+	}
+	if cfg.LowRatio != "" {
+		ratio, err := parseRatio(cfg.LowRatio)
+		if err != nil {
+			return nil, err
+		}
+		params.ActiveAbsorptionLowRatio = ratio
+	}
+	if params.ActiveAbsorptionHighRatio.Cmp(params.ActiveAbsorptionLowRatio) <= 0 {
+		return nil, fmt.Errorf("the high ratio %v must be greater than "+
+			"the low ratio %v", params.ActiveAbsorptionHighRatio.RatString(),
+			params.ActiveAbsorptionLowRatio.RatString())
+	}
+	if cfg.MinerMedian {
+		// A deployment which starts at zero is active from the
+		// genesis block.
+		params.Deployments[chaincfg.DeploymentMedianPrice].StartTime = 0
+	}
+	return &params, nil
+}
+
+// loadConfig initializes and parses the config using command line options.
+func loadConfig() (*config, []string, error) {
+	// Default config.
+	cfg := config{
+		DataDir: defaultDataDir,
+		DbType:  defaultDbType,
+	}
+
+	// Parse command line options.
+	parser := flags.NewParser(&cfg, flags.Default)
+	remainingArgs, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			parser.WriteHelp(os.Stderr)
+		}
+		return nil, nil, err
+	}
+
+	// Multiple networks can't be selected simultaneously.
+	funcName := "loadConfig"
+	numNets := 0
+	// Count number of network flags passed; assign active network params
+	// while we're at it
+	if cfg.TestNet3 {
+		numNets++
+		activeNetParams = &chaincfg.TestNet3Params
+	}
+	if cfg.RegressionTest {
+		numNets++
+		activeNetParams = &chaincfg.RegressionNetParams
+	}
+	if cfg.SimNet {
+		numNets++
+		activeNetParams = &chaincfg.SimNetParams
+	}
+	if numNets > 1 {
+		str := "%s: The testnet, regtest, and simnet params can't be " +
+			"used together -- choose one of the three"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		parser.WriteHelp(os.Stderr)
+		return nil, nil, err
+	}
+
+	// Validate database type.
+	if !validDbType(cfg.DbType) {
+		str := "%s: The specified database type [%v] is invalid -- " +
+			"supported types %v"
+		err := fmt.Errorf(str, funcName, cfg.DbType, knownDbTypes)
+		fmt.Fprintln(os.Stderr, err)
+		parser.WriteHelp(os.Stderr)
+		return nil, nil, err
+	}
+
+	// Append the network type to the data directory so it is "namespaced"
+	// per network.  In addition to the block database, there are other
+	// pieces of data that are saved to disk such as address manager state.
+	// All data is specific to a network, so namespacing the data directory
+	// means each individual piece of serialized data does not have to
+	// worry about changing names per network and such.
+	cfg.DataDir = filepath.Join(cfg.DataDir, netName(activeNetParams))
+
+	// The genesis supply only applies to the synthetic blocks.
+	if cfg.Supply != 0 && cfg.CSVFile == "" {
+		str := "%s: The supply option only applies to the CSV replay"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		parser.WriteHelp(os.Stderr)
+		return nil, nil, err
+	}
+
+	cfg.simParams, err = simulationParams(&cfg)
+	if err != nil {
+		err := fmt.Errorf("%s: %v", funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		parser.WriteHelp(os.Stderr)
+		return nil, nil, err
+	}
+
+	return &cfg, remainingArgs, nil
+}
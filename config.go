@@ -9,10 +9,12 @@ import (
 	"bufio"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -32,6 +34,7 @@ import (
 	_ "github.com/endurio/ndrd/database/ffldb"
 	"github.com/endurio/ndrd/mempool"
 	"github.com/endurio/ndrd/peer"
+	"github.com/endurio/ndrd/pricefeed"
 	"github.com/endurio/ndrd/types"
 	flags "github.com/jessevdk/go-flags"
 )
@@ -67,6 +70,11 @@ const (
 	sampleConfigFilename         = "sample-ndrd.conf"
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
+	defaultSupplyIndex           = false
+	defaultBalanceIndex          = false
+	defaultRelayFeeFloor         = 0.00001
+	defaultRelayFeeCeiling       = 0.01
+	defaultRelayFeeInterval      = time.Minute * 10
 )
 
 var (
@@ -147,7 +155,21 @@ type config struct {
 	NoRelayPriority      bool          `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
 	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MaxOrderAge          int32         `long:"maxorderage" description:"Max number of blocks an order is kept in the order book before it expires -- 0 to disable"`
+	MaxBookSize          int           `long:"maxbooksize" description:"Max number of orders to keep in the order book -- 0 for no limit"`
+	MinPriceImprovement  float64       `long:"minreplaceimprovement" description:"Minimum price improvement, as a fraction of the price, for an order to replace a resting order spending the same inputs"`
+	DynamicRelayFee      bool          `long:"dynamicrelayfee" description:"Scale the NDR side of minrelaytxfee with the STB/USD median price of the last absorption epoch, so it keeps the value of the STB side, for both relaying and mining"`
+	RelayFeeFloor        float64       `long:"dynamicrelayfeemin" description:"The minimum NDR side in Coin/kB of the derived minrelaytxfee"`
+	RelayFeeCeiling      float64       `long:"dynamicrelayfeemax" description:"The maximum NDR side in Coin/kB of the derived minrelaytxfee"`
+	RelayFeeInterval     time.Duration `long:"dynamicrelayfeeinterval" description:"Minimum time between two derivations of the minrelaytxfee"`
 	Generate             bool          `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
+	PriceFeedFiles       []string      `long:"pricefeedfile" description:"Add a local file to read the STB/USD price to mine from whenever it changes.  Format: '[<name>=]<path>'"`
+	PriceFeedURLs        []string      `long:"pricefeedurl" description:"Add an HTTP JSON endpoint to poll the STB/USD price to mine from, with the dot separated path of the price in the document as the URL fragment.  Format: '[<name>=]<url>[#<path>]'"`
+	PriceFeedInterval    time.Duration `long:"pricefeedinterval" description:"Interval at which the price feed files and endpoints are polled"`
+	PriceFeedMaxAge      time.Duration `long:"pricefeedmaxage" description:"Age after which a fed price is stale -- 0 for the target time per block"`
+	PriceFeedMinSources  int           `long:"pricefeedminsources" description:"Minimum number of price sources with a fresh price required to mine a price"`
+	PriceFeedBand        float64       `long:"pricefeedband" description:"Maximum relative move of a fed price from the last fresh price accepted from the same source -- 0 to disable"`
+	PriceFeeders         []string      `long:"pricefeeder" description:"Add a price source fed by RPC with feeds signed by the given public key, which replaces the source of unsigned feeds.  Format: '<name>=<hex public key>'"`
 	MiningKey            string        `long:"miningkey" description:"Add the specified payment private key to use for generated blocks -- It is required if the generate option is set"`
 	BlockMinSize         uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
@@ -164,6 +186,10 @@ type config struct {
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	SupplyIndex          bool          `long:"supplyindex" description:"Maintain a per-block index of the STB supply changes, absorptions and filled orders which makes the getsupplyhistory RPC available"`
+	DropSupplyIndex      bool          `long:"dropsupplyindex" description:"Deletes the supply index from the database on start up and then exits."`
+	BalanceIndex         bool          `long:"balanceindex" description:"Maintain an address-based index of the unspent outputs and the balance of each token which makes the getaddressbalance and getaddressutxos RPCs available"`
+	DropBalanceIndex     bool          `long:"dropbalanceindex" description:"Deletes the balance index from the database on start up and then exits."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 	lookup               func(string) ([]net.IP, error)
@@ -172,6 +198,9 @@ type config struct {
 	addCheckpoints       []chaincfg.Checkpoint
 	miningKey            *chainec.PrivateKey
 	minRelayTxPrice      types.PriceReq
+	relayFeeFloor        types.Amount
+	relayFeeCeiling      types.Amount
+	priceFeedSources     []pricefeed.SourceConfig
 	whitelists           []*net.IPNet
 	MinRelayTxPrice      types.CoinPriceReq `long:"minrelaytxfee" description:"The minimum transaction fee in Coin/kB to be considered a non-zero fee."`
 }
@@ -373,6 +402,96 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// splitPriceSource splits the passed price source option into the name of the
+// source, when it has a '<name>=' prefix, and its location.  The name must not
+// contain any of the characters '/', '\' or ':' so the '=' characters of the
+// paths and URLs are not mistaken for the one of a name.
+func splitPriceSource(option string) (string, string) {
+	i := strings.Index(option, "=")
+	if i > 0 && !strings.ContainsAny(option[:i], "/\\:") {
+		return option[:i], option[i+1:]
+	}
+	return "", option
+}
+
+// parsePriceSources parses the price feeders, files and URLs of the
+// configuration into the sources of the price feed.  The source of the unsigned
+// prices fed by RPC comes first when no price feeder is configured.  The file
+// and URL sources without a name are named after their file or host.
+func parsePriceSources(cfg *config, maxAge time.Duration) ([]pricefeed.SourceConfig, error) {
+	var sources []pricefeed.SourceConfig
+	if len(cfg.PriceFeeders) == 0 {
+		sources = append(sources, pricefeed.SourceConfig{
+			Source: pricefeed.NewRPCSource(pricefeed.RPCSourceName,
+				nil),
+			MaxAge: maxAge,
+		})
+	}
+	for _, option := range cfg.PriceFeeders {
+		name, hexKey := splitPriceSource(option)
+		if name == "" {
+			return nil, fmt.Errorf("price feeder %q has no name",
+				option)
+		}
+		serializedKey, err := hex.DecodeString(hexKey)
+		if err != nil {
+			return nil, fmt.Errorf("price feeder %q has a malformed "+
+				"public key: %v", name, err)
+		}
+		pubKey, err := chainec.ParsePubKey(serializedKey, chainec.S256())
+		if err != nil {
+			return nil, fmt.Errorf("price feeder %q has an invalid "+
+				"public key: %v", name, err)
+		}
+		sources = append(sources, pricefeed.SourceConfig{
+			Source: pricefeed.NewRPCSource(name, pubKey),
+			MaxAge: maxAge,
+		})
+	}
+	for _, option := range cfg.PriceFeedFiles {
+		name, path := splitPriceSource(option)
+		path = cleanAndExpandPath(path)
+		if name == "" {
+			name = "file:" + filepath.Base(path)
+		}
+		sources = append(sources, pricefeed.SourceConfig{
+			Source: pricefeed.NewFileSource(name, path,
+				cfg.PriceFeedInterval),
+			MaxAge: maxAge,
+		})
+	}
+	for _, option := range cfg.PriceFeedURLs {
+		name, rawURL := splitPriceSource(option)
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = "http:" + u.Host
+		}
+		source, err := pricefeed.NewHTTPSource(name, rawURL,
+			cfg.PriceFeedInterval, priceFeedDial)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, pricefeed.SourceConfig{
+			Source: source,
+			MaxAge: maxAge,
+		})
+	}
+	return sources, nil
+}
+
+// priceFeedDial connects to the endpoint of an HTTP price source with the dial
+// function of the configuration, so the requests go through the configured
+// proxy, or the onion one for .onion hosts.
+func priceFeedDial(network, addr string, timeout time.Duration) (net.Conn, error) {
+	if strings.Contains(addr, ".onion:") {
+		return cfg.oniondial(network, addr, timeout)
+	}
+	return cfg.dial(network, addr, timeout)
+}
+
 // filesExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -428,10 +547,21 @@ func loadConfig() (*config, []string, error) {
 		BlockMaxWeight:       defaultBlockMaxWeight,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MaxOrderAge:          mempool.DefaultMaxOrderAge,
+		MaxBookSize:          mempool.DefaultMaxBookSize,
+		MinPriceImprovement:  mempool.DefaultMinPriceImprovement,
+		RelayFeeFloor:        defaultRelayFeeFloor,
+		RelayFeeCeiling:      defaultRelayFeeCeiling,
+		RelayFeeInterval:     defaultRelayFeeInterval,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
 		Generate:             defaultGenerate,
+		PriceFeedInterval:    pricefeed.DefaultPollInterval,
+		PriceFeedMinSources:  pricefeed.DefaultMinSources,
+		PriceFeedBand:        pricefeed.DefaultBand,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
+		SupplyIndex:          defaultSupplyIndex,
+		BalanceIndex:         defaultBalanceIndex,
 		MinRelayTxPrice:      mempool.DefaultMinRelayTxPrice.ToCoinPriceReq(),
 	}
 
@@ -802,6 +932,73 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Limit the max order age to a sane value.
+	if cfg.MaxOrderAge < 0 {
+		str := "%s: The maxorderage option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxOrderAge)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the max order book size to a sane value.
+	if cfg.MaxBookSize < 0 {
+		str := "%s: The maxbooksize option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxBookSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the minimum price improvement of replacements to a sane value.
+	if cfg.MinPriceImprovement < 0 || cfg.MinPriceImprovement >= 1 {
+		str := "%s: The minreplaceimprovement option must be in the " +
+			"range [0, 1) -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MinPriceImprovement)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The dynamic minrelaytxfee is derived from both of its sides within
+	// sane bounds at a positive interval.
+	if cfg.DynamicRelayFee {
+		balance := cfg.minRelayTxPrice.Balance()
+		var str string
+		switch {
+		case balance.Amount(types.Token0) <= 0 ||
+			balance.Amount(types.Token1) <= 0:
+			str = "%s: The dynamicrelayfee option requires both an " +
+				"NDR and an STB side for minrelaytxfee"
+		case cfg.RelayFeeFloor <= 0 || cfg.RelayFeeCeiling < cfg.RelayFeeFloor:
+			str = "%s: The dynamicrelayfeemin and dynamicrelayfeemax " +
+				"options must be positive and ordered"
+		case cfg.RelayFeeInterval <= 0:
+			str = "%s: The dynamicrelayfeeinterval option must be " +
+				"positive"
+		}
+		if str != "" {
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+
+		cfg.relayFeeFloor, err = types.NewAmount(cfg.RelayFeeFloor)
+		if err == nil {
+			cfg.relayFeeCeiling, err = types.NewAmount(cfg.RelayFeeCeiling)
+		}
+		if err != nil {
+			str := "%s: invalid dynamicrelayfee bounds: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -868,6 +1065,51 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --supplyindex and --dropsupplyindex do not mix.
+	if cfg.SupplyIndex && cfg.DropSupplyIndex {
+		err := fmt.Errorf("%s: the --supplyindex and --dropsupplyindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --balanceindex and --dropbalanceindex do not mix.
+	if cfg.BalanceIndex && cfg.DropBalanceIndex {
+		err := fmt.Errorf("%s: the --balanceindex and --dropbalanceindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The price feed sources are polled at a positive interval.
+	if cfg.PriceFeedInterval <= 0 {
+		str := "%s: the pricefeedinterval option must be positive " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.PriceFeedInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Parse the price feed sources, whose prices are stale after the
+	// target time per block unless configured otherwise.
+	priceFeedMaxAge := cfg.PriceFeedMaxAge
+	if priceFeedMaxAge == 0 {
+		priceFeedMaxAge = activeNetParams.TargetTimePerBlock
+	}
+	cfg.priceFeedSources, err = parsePriceSources(&cfg, priceFeedMaxAge)
+	if err != nil {
+		str := "%s: Error parsing price feed sources: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	if len(cfg.MiningKey) > 0 {
 		privWif, err := chainutil.DecodeWIF(cfg.MiningKey)
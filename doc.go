@@ -101,6 +101,23 @@ Application Options:
                             high priority for relaying
       --maxorphantx=        Max number of orphan transactions to keep in memory
                             (100)
+      --maxorderage=        Max number of blocks an order is kept in the order
+                            book before it expires -- 0 to disable (4096)
+      --maxbooksize=        Max number of orders to keep in the order book -- 0
+                            for no limit (100000)
+      --minreplaceimprovement= Minimum price improvement, as a fraction of the
+                            price, for an order to replace a resting order
+                            spending the same inputs (0.001)
+      --dynamicrelayfee     Scale the NDR side of minrelaytxfee with the
+                            STB/USD median price of the last absorption epoch,
+                            so it keeps the value of the STB side, for both
+                            relaying and mining
+      --dynamicrelayfeemin= The minimum NDR side in Coin/kB of the derived
+                            minrelaytxfee (0.00001)
+      --dynamicrelayfeemax= The maximum NDR side in Coin/kB of the derived
+                            minrelaytxfee (0.01)
+      --dynamicrelayfeeinterval= Minimum time between two derivations of the
+                            minrelaytxfee (10m0s)
       --generate            Generate (mine) bitcoins using the CPU
       --miningkey=          Add the specified payment private key to use for
                             generated blocks -- It is required if the generate
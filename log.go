@@ -21,6 +21,7 @@ import (
 	"github.com/endurio/ndrd/mining/cpuminer"
 	"github.com/endurio/ndrd/netsync"
 	"github.com/endurio/ndrd/peer"
+	"github.com/endurio/ndrd/pricefeed"
 	"github.com/endurio/ndrd/txscript"
 
 	"github.com/btcsuite/btclog"
@@ -62,6 +63,7 @@ var (
 	btcdLog = backendLog.Logger("BTCD")
 	chanLog = backendLog.Logger("CHAN")
 	discLog = backendLog.Logger("DISC")
+	feedLog = backendLog.Logger("FEED")
 	indxLog = backendLog.Logger("INDX")
 	minrLog = backendLog.Logger("MINR")
 	peerLog = backendLog.Logger("PEER")
@@ -82,6 +84,7 @@ func init() {
 	mining.UseLogger(minrLog)
 	cpuminer.UseLogger(minrLog)
 	peer.UseLogger(peerLog)
+	pricefeed.UseLogger(feedLog)
 	txscript.UseLogger(scrpLog)
 	netsync.UseLogger(syncLog)
 	mempool.UseLogger(txmpLog)
@@ -96,6 +99,7 @@ var subsystemLoggers = map[string]btclog.Logger{
 	"BTCD": btcdLog,
 	"CHAN": chanLog,
 	"DISC": discLog,
+	"FEED": feedLog,
 	"INDX": indxLog,
 	"MINR": minrLog,
 	"PEER": peerLog,
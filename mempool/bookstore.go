@@ -0,0 +1,203 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
+)
+
+const (
+	// odrBookSaveVersion is the version of the serialized order book
+	// format.  It must be increased whenever the format changes.
+	odrBookSaveVersion = 1
+
+	// odrBookChecksumSize is the number of bytes of the double sha256
+	// checksum appended to the serialized order book.
+	odrBookChecksumSize = 4
+
+	// savedOrderMetaSize is the number of bytes of the metadata serialized
+	// before each order, which is the least an order can take.
+	savedOrderMetaSize = 8 + 4
+)
+
+// Save serializes all orders in the book so they can be restored later, even
+// by another node.  The orders of each side are written in their priority
+// order, so the time priority of the orders at the same price is preserved.
+//
+// The serialized format is:
+//
+//	<version><count><order 1>...<order n><checksum>
+//
+//	Field     Type      Size
+//	version   uint32    4 bytes
+//	count     uint32    4 bytes
+//	order     -         variable (added int64, height int32, serialized tx)
+//	checksum  [4]byte   first 4 bytes of the double sha256 of all above
+//
+// This function is safe for concurrent access.
+func (ob *OdrBook) Save(w io.Writer) error {
+	ob.mtx.RLock()
+	defer ob.mtx.RUnlock()
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(odrBookSaveVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(len(ob.book)))
+	var err error
+	for _, orders := range [...]*orderSide{ob.bids, ob.asks} {
+		orders.forEach(func(odrDesc *OdrDesc) bool {
+			binary.Write(&buf, binary.BigEndian, odrDesc.Added.Unix())
+			binary.Write(&buf, binary.BigEndian, odrDesc.Height)
+			err = odrDesc.MsgTx().Serialize(&buf)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	checksum := chainhash.DoubleHashB(buf.Bytes())
+	buf.Write(checksum[:odrBookChecksumSize])
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// savedOrder houses an order read back from a serialized order book along with
+// the metadata it was saved with.
+type savedOrder struct {
+	odr    *chainutil.Odr
+	added  time.Time
+	height int32
+}
+
+// deserializeOrderBook reads the orders from the passed serialized order book
+// after checking its version and checksum.
+func deserializeOrderBook(serialized []byte) ([]*savedOrder, error) {
+	if len(serialized) < 8+odrBookChecksumSize {
+		return nil, fmt.Errorf("serialized order book is too short: "+
+			"%d bytes", len(serialized))
+	}
+
+	// Check the checksum before reading anything else.
+	payload := serialized[:len(serialized)-odrBookChecksumSize]
+	checksum := chainhash.DoubleHashB(payload)
+	if !bytes.Equal(checksum[:odrBookChecksumSize],
+		serialized[len(payload):]) {
+
+		return nil, fmt.Errorf("serialized order book checksum mismatch")
+	}
+
+	r := bytes.NewReader(payload)
+
+	var version uint32
+	err := binary.Read(r, binary.BigEndian, &version)
+	if err != nil {
+		return nil, err
+	}
+	if version != odrBookSaveVersion {
+		return nil, fmt.Errorf("Incorrect version: expected %d found %d",
+			odrBookSaveVersion, version)
+	}
+
+	// The count is only trusted as far as the remaining data can hold that
+	// many orders, since it sizes the allocation below.
+	var count uint32
+	err = binary.Read(r, binary.BigEndian, &count)
+	if err != nil {
+		return nil, err
+	}
+	if maxCount := r.Len() / savedOrderMetaSize; count > uint32(maxCount) {
+		return nil, fmt.Errorf("serialized order book count %d exceeds "+
+			"the %d orders its data can hold", count, maxCount)
+	}
+	orders := make([]*savedOrder, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var added int64
+		var height int32
+		err := binary.Read(r, binary.BigEndian, &added)
+		if err != nil {
+			return nil, err
+		}
+		err = binary.Read(r, binary.BigEndian, &height)
+		if err != nil {
+			return nil, err
+		}
+		odr, err := chainutil.NewOdrFromReader(r)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, &savedOrder{
+			odr:    odr,
+			added:  time.Unix(added, 0),
+			height: height,
+		})
+	}
+
+	return orders, nil
+}
+
+// Restore reads back the orders previously serialized by Save and re-validates
+// each of them against the current chain state.  Orders which are no longer
+// valid, such as the ones whose inputs were spent while the node was down, and
+// orders which have expired are dropped.  The descriptors of the restored
+// orders are returned.
+//
+// This function is safe for concurrent access.
+func (ob *OdrBook) Restore(r io.Reader) ([]*OdrDesc, error) {
+	serialized, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := deserializeOrderBook(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	// Protect concurrent access.
+	ob.mtx.Lock()
+	defer ob.mtx.Unlock()
+
+	bestHeight := ob.cfg.BestHeight()
+	restored := make([]*OdrDesc, 0, len(orders))
+	for _, saved := range orders {
+		if maxAge := ob.cfg.Policy.MaxOrderAge; maxAge > 0 &&
+			bestHeight >= saved.height+maxAge {
+
+			log.Debugf("Dropping expired order %v", saved.odr.Hash())
+			continue
+		}
+
+		oD, _, err := ob.maybeAcceptOrder(saved.odr)
+		if err != nil {
+			log.Debugf("Dropping restored order %v: %v",
+				saved.odr.Hash(), err)
+			continue
+		}
+
+		// Keep the original arrival time and height, so the time
+		// priority and the expiry of the order survive the restart.
+		oD.Added = saved.added
+		oD.Height = saved.height
+		if maxAge := ob.cfg.Policy.MaxOrderAge; maxAge > 0 {
+			ob.removeExpiry(oD)
+			oD.Expiry = saved.height + maxAge
+			ob.addExpiry(oD)
+		}
+		restored = append(restored, oD)
+	}
+
+	log.Infof("Restored %d of %d saved %s", len(restored), len(orders),
+		pickNoun(len(orders), "order", "orders"))
+
+	return restored, nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/mining"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// TestOrderBookSerialization ensures the order book serializes to the expected
+// format and can be read back, and that corrupted data is rejected.
+func TestOrderBookSerialization(t *testing.T) {
+	t.Parallel()
+
+	ob := NewMemBook(&Config{})
+	for i := 0; i < 4; i++ {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: uint32(i)},
+			nil, nil))
+		ob.addOrder(&OdrDesc{
+			OdrDesc: mining.OdrDesc{
+				Odr:    chainutil.NewOdrFromTx(chainutil.NewTx(msgTx)),
+				Added:  time.Unix(int64(1000+i), 0),
+				Height: int32(i),
+				Bid:    i%2 == 0,
+				Amount: 100,
+				Payout: 100,
+			},
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := ob.Save(&buf); err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+	serialized := buf.Bytes()
+
+	orders, err := deserializeOrderBook(serialized)
+	if err != nil {
+		t.Fatalf("deserializeOrderBook: unexpected error: %v", err)
+	}
+	if len(orders) != len(ob.book) {
+		t.Fatalf("deserializeOrderBook: got %d orders, want %d",
+			len(orders), len(ob.book))
+	}
+	for _, saved := range orders {
+		odrDesc, ok := ob.book[*saved.odr.Hash()]
+		if !ok {
+			t.Fatalf("deserializeOrderBook: unknown order %v",
+				saved.odr.Hash())
+		}
+		if !saved.added.Equal(odrDesc.Added) ||
+			saved.height != odrDesc.Height {
+
+			t.Fatalf("deserializeOrderBook: order %v metadata "+
+				"mismatch", saved.odr.Hash())
+		}
+	}
+
+	// Flip a bit in the payload to break the checksum.
+	corrupted := append([]byte(nil), serialized...)
+	corrupted[len(corrupted)/2] ^= 0x01
+	if _, err := deserializeOrderBook(corrupted); err == nil {
+		t.Fatal("deserializeOrderBook: corrupted book was accepted")
+	}
+
+	// Truncated data must be rejected too.
+	if _, err := deserializeOrderBook(serialized[:6]); err == nil {
+		t.Fatal("deserializeOrderBook: truncated book was accepted")
+	}
+
+	// A count the data cannot hold must be rejected before anything is
+	// allocated for it, even with a valid checksum.
+	var huge bytes.Buffer
+	binary.Write(&huge, binary.BigEndian, uint32(odrBookSaveVersion))
+	binary.Write(&huge, binary.BigEndian, uint32(0xffffffff))
+	checksum := chainhash.DoubleHashB(huge.Bytes())
+	huge.Write(checksum[:odrBookChecksumSize])
+	if _, err := deserializeOrderBook(huge.Bytes()); err == nil {
+		t.Fatal("deserializeOrderBook: oversized count was accepted")
+	}
+}
+
+// TestRestoreOrderBook ensures restoring a saved order book re-validates each
+// order against the current chain state, dropping the expired orders and the
+// ones which are no longer valid while keeping the metadata of the others.
+func TestRestoreOrderBook(t *testing.T) {
+	t.Parallel()
+
+	// Every order trades 100 STB for 100 NDR, spending an anyone can spend
+	// output of its own funding transaction.
+	pkScript := []byte{0x51}
+	var funding []*wire.MsgTx
+	newOrder := func(height int32) *OdrDesc {
+		prevTx := wire.NewMsgTx(wire.TxVersion)
+		prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{
+			Index: uint32(len(funding)),
+		}, nil, nil))
+		prevTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 100,
+			Token: types.Token1}, pkScript))
+		funding = append(funding, prevTx)
+
+		prevHash := prevTx.TxHash()
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil,
+			nil))
+		msgTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 100,
+			Token: types.Token0}, pkScript))
+		return &OdrDesc{
+			OdrDesc: mining.OdrDesc{
+				Odr:    chainutil.NewOdrFromTx(chainutil.NewTx(msgTx)),
+				Added:  time.Unix(1000+int64(height), 0),
+				Height: height,
+				Bid:    true,
+				Amount: 100,
+				Payout: 100,
+			},
+		}
+	}
+
+	saved := NewMemBook(&Config{})
+	valid := saved.addOrder(newOrder(90))
+	spent := saved.addOrder(newOrder(95))
+	expired := saved.addOrder(newOrder(50))
+	var buf bytes.Buffer
+	if err := saved.Save(&buf); err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+
+	// The output spent by the second order was spent while the node was
+	// down, so only the ones of the others remain.
+	ob := NewMemBook(&Config{
+		Policy: Policy{
+			AcceptNonStd:      true,
+			MaxSigOpCostPerTx: blockchain.MaxBlockSigOpsCost / 4,
+			MaxOrderAge:       50,
+		},
+		ChainParams: &chaincfg.RegressionNetParams,
+		FetchUtxoView: func(*chainutil.Tx) (*blockchain.UtxoViewpoint, error) {
+			view := blockchain.NewUtxoViewpoint()
+			view.AddTxOuts(chainutil.NewTx(funding[0]), 1)
+			view.AddTxOuts(chainutil.NewTx(funding[2]), 1)
+			return view, nil
+		},
+		BestHeight:     func() int32 { return 100 },
+		MedianTimePast: func() time.Time { return time.Unix(2000, 0) },
+		CalcSequenceLock: func(*chainutil.Tx, *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+			return &blockchain.SequenceLock{Seconds: -1, BlockHeight: -1}, nil
+		},
+	})
+	restored, err := ob.Restore(&buf)
+	if err != nil {
+		t.Fatalf("Restore: unexpected error: %v", err)
+	}
+	if len(restored) != 1 || !restored[0].Hash().IsEqual(valid.Hash()) {
+		t.Fatalf("Restore: got %d orders, want only %v", len(restored),
+			valid.Hash())
+	}
+	if ob.HaveOrder(spent.Hash()) || ob.HaveOrder(expired.Hash()) {
+		t.Fatal("Restore: an invalid order was restored")
+	}
+	if !restored[0].Added.Equal(valid.Added) || restored[0].Height != 90 ||
+		restored[0].Expiry != 140 {
+
+		t.Fatalf("Restore: order restored with added %v, height %d and "+
+			"expiry %d", restored[0].Added, restored[0].Height,
+			restored[0].Expiry)
+	}
+
+	// The restored order expires at its original expiry.
+	if expired := ob.ExpireOrders(140); len(expired) != 1 ||
+		expired[0] != restored[0] {
+
+		t.Fatalf("ExpireOrders: got %v, want the restored order", expired)
+	}
+}
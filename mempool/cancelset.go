@@ -0,0 +1,165 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"container/list"
+
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/wire"
+)
+
+// cancelSet holds the cancellations of orders by the hash of the order they
+// withdraw, up to a limit beyond which the oldest cancellation is evicted.
+//
+// It is not safe for concurrent access, the order book lock protects it.
+type cancelSet struct {
+	cancels map[chainhash.Hash]*list.Element
+	order   *list.List // *wire.MsgCancelOdr, most recent first
+	limit   int
+}
+
+// lookup returns the cancellation of the order with the passed hash, if any.
+func (s *cancelSet) lookup(hash *chainhash.Hash) (*wire.MsgCancelOdr, bool) {
+	element, exists := s.cancels[*hash]
+	if !exists {
+		return nil, false
+	}
+	return element.Value.(*wire.MsgCancelOdr), true
+}
+
+// add adds the passed cancellation to the set, replacing any cancellation of
+// the same order, and evicts the oldest one when the limit is exceeded.
+func (s *cancelSet) add(msg *wire.MsgCancelOdr) {
+	if element, exists := s.cancels[msg.OdrHash]; exists {
+		element.Value = msg
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.cancels[msg.OdrHash] = s.order.PushFront(msg)
+	if s.order.Len() > s.limit {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.cancels, oldest.Value.(*wire.MsgCancelOdr).OdrHash)
+	}
+}
+
+// remove removes the cancellation of the order with the passed hash, if any.
+func (s *cancelSet) remove(hash *chainhash.Hash) {
+	if element, exists := s.cancels[*hash]; exists {
+		s.order.Remove(element)
+		delete(s.cancels, *hash)
+	}
+}
+
+// newCancelSet returns an empty set of cancellations holding up to the passed
+// number of them.
+func newCancelSet(limit int) *cancelSet {
+	return &cancelSet{
+		cancels: make(map[chainhash.Hash]*list.Element),
+		order:   list.New(),
+		limit:   limit,
+	}
+}
+
+// pendingCancels holds the candidate cancellations of an order which is not in
+// the book, most recent first.
+type pendingCancels struct {
+	hash    chainhash.Hash
+	cancels []*wire.MsgCancelOdr
+}
+
+// pendingCancelSet holds the cancellations of orders which are not in the book
+// by the hash of the order they withdraw.  Their signatures cannot be checked
+// until the order arrives, so several candidates are kept for each order, up
+// to a limit beyond which the oldest candidate is evicted, so a forged
+// cancellation cannot shadow the valid one.  The number of orders is limited
+// as well, beyond which the candidates of the oldest order are evicted.
+//
+// It is not safe for concurrent access, the order book lock protects it.
+type pendingCancelSet struct {
+	orders   map[chainhash.Hash]*list.Element
+	order    *list.List // *pendingCancels, most recent first
+	limit    int
+	perOrder int
+}
+
+// lookup returns the candidate cancellations of the order with the passed
+// hash, most recent first.
+func (s *pendingCancelSet) lookup(hash *chainhash.Hash) []*wire.MsgCancelOdr {
+	element, exists := s.orders[*hash]
+	if !exists {
+		return nil
+	}
+	return element.Value.(*pendingCancels).cancels
+}
+
+// add adds the passed cancellation to the candidates of the order it withdraws
+// and returns whether it is new, which it is not when the same cancellation
+// is already a candidate.
+func (s *pendingCancelSet) add(msg *wire.MsgCancelOdr) bool {
+	element, exists := s.orders[msg.OdrHash]
+	if !exists {
+		element = s.order.PushFront(&pendingCancels{hash: msg.OdrHash})
+		s.orders[msg.OdrHash] = element
+		if s.order.Len() > s.limit {
+			oldest := s.order.Back()
+			s.order.Remove(oldest)
+			delete(s.orders, oldest.Value.(*pendingCancels).hash)
+		}
+	}
+
+	pending := element.Value.(*pendingCancels)
+	for _, cancel := range pending.cancels {
+		if sameCancel(cancel, msg) {
+			return false
+		}
+	}
+	cancels := make([]*wire.MsgCancelOdr, 0, s.perOrder)
+	cancels = append(cancels, msg)
+	cancels = append(cancels, pending.cancels...)
+	if len(cancels) > s.perOrder {
+		cancels = cancels[:s.perOrder]
+	}
+	pending.cancels = cancels
+	return true
+}
+
+// remove removes the candidate cancellations of the order with the passed
+// hash, if any.
+func (s *pendingCancelSet) remove(hash *chainhash.Hash) {
+	if element, exists := s.orders[*hash]; exists {
+		s.order.Remove(element)
+		delete(s.orders, *hash)
+	}
+}
+
+// sameCancel returns whether the passed cancellations withdraw the same order
+// with the same signatures.
+func sameCancel(a, b *wire.MsgCancelOdr) bool {
+	if a.OdrHash != b.OdrHash || len(a.Signatures) != len(b.Signatures) {
+		return false
+	}
+	for i := range a.Signatures {
+		if !bytes.Equal(a.Signatures[i], b.Signatures[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// newPendingCancelSet returns an empty set of pending cancellations holding the
+// candidates of up to the passed number of orders, and up to the passed number
+// of candidates for each order.
+func newPendingCancelSet(limit, perOrder int) *pendingCancelSet {
+	return &pendingCancelSet{
+		orders:   make(map[chainhash.Hash]*list.Element),
+		order:    list.New(),
+		limit:    limit,
+		perOrder: perOrder,
+	}
+}
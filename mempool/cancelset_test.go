@@ -0,0 +1,103 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/wire"
+)
+
+// TestCancelSet ensures the set of cancellations evicts the oldest one once it
+// is full, and that adding a cancellation again makes it the most recent.
+func TestCancelSet(t *testing.T) {
+	t.Parallel()
+
+	s := newCancelSet(2)
+	msgs := make([]*wire.MsgCancelOdr, 3)
+	for i := range msgs {
+		msgs[i] = wire.NewMsgCancelOdr(&chainhash.Hash{byte(i)})
+	}
+
+	s.add(msgs[0])
+	s.add(msgs[1])
+	s.add(msgs[0])
+	s.add(msgs[2])
+	for i, want := range []bool{true, false, true} {
+		msg, exists := s.lookup(&msgs[i].OdrHash)
+		if exists != want || (exists && msg != msgs[i]) {
+			t.Errorf("lookup #%d: got %v, %v, want exists %v", i,
+				msg, exists, want)
+		}
+	}
+
+	s.remove(&msgs[0].OdrHash)
+	if _, exists := s.lookup(&msgs[0].OdrHash); exists {
+		t.Error("remove: cancellation is still in the set")
+	}
+	if len(s.cancels) != 1 || s.order.Len() != 1 {
+		t.Errorf("remove: got %d cancellations, %d in order, want 1",
+			len(s.cancels), s.order.Len())
+	}
+}
+
+// TestPendingCancelSet ensures the set of pending cancellations keeps several
+// distinct candidates for each order, evicting the oldest candidate and the
+// candidates of the oldest order once full.
+func TestPendingCancelSet(t *testing.T) {
+	t.Parallel()
+
+	newCancel := func(hash byte, sig byte) *wire.MsgCancelOdr {
+		msg := wire.NewMsgCancelOdr(&chainhash.Hash{hash})
+		msg.AddSignature([]byte{sig})
+		return msg
+	}
+
+	s := newPendingCancelSet(2, 2)
+	msgs := []*wire.MsgCancelOdr{
+		newCancel(0, 0),
+		newCancel(0, 1),
+		newCancel(0, 2),
+		newCancel(1, 0),
+	}
+	tests := []struct {
+		msg   *wire.MsgCancelOdr
+		isNew bool
+	}{
+		{msgs[0], true},
+		{newCancel(0, 0), false}, // Same signatures
+		{msgs[1], true},
+		{msgs[2], true}, // Evicts msgs[0]
+		{msgs[3], true},
+	}
+	for i, test := range tests {
+		if isNew := s.add(test.msg); isNew != test.isNew {
+			t.Errorf("add #%d: got new %v, want %v", i, isNew,
+				test.isNew)
+		}
+	}
+
+	got := s.lookup(&msgs[0].OdrHash)
+	if len(got) != 2 || got[0] != msgs[2] || got[1] != msgs[1] {
+		t.Errorf("lookup: got %v, want %v", got,
+			[]*wire.MsgCancelOdr{msgs[2], msgs[1]})
+	}
+
+	// A third order evicts the candidates of the oldest one.
+	s.add(newCancel(2, 0))
+	if got := s.lookup(&msgs[0].OdrHash); got != nil {
+		t.Errorf("lookup: got %v for an evicted order", got)
+	}
+
+	s.remove(&msgs[3].OdrHash)
+	if got := s.lookup(&msgs[3].OdrHash); got != nil {
+		t.Errorf("remove: got %v for a removed order", got)
+	}
+	if len(s.orders) != 1 || s.order.Len() != 1 {
+		t.Errorf("remove: got %d orders, %d in order, want 1",
+			len(s.orders), s.order.Len())
+	}
+}
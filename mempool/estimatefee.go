@@ -38,6 +38,10 @@ const (
 	// can be made by the txs found in a given block.
 	estimateFeeMaxReplacements = 10
 
+	// estimateFeeMaxFills is the number of most recent order fills which
+	// provide the price used to convert the fees between tokens.
+	estimateFeeMaxFills = 100
+
 	// DefaultEstimateFeeMaxRollback is the default number of rollbacks
 	// allowed by the fee estimator for orphaned blocks.
 	DefaultEstimateFeeMaxRollback = 2
@@ -93,12 +97,16 @@ func NewSatoshiPerByte(fee types.Amount, size uint32) SatoshiPerByte {
 }
 
 // observedTransaction represents an observed transaction and some
-// additional data required for the fee estimation algorithm.
+// additional data required for the fee estimation algorithm.  A transaction
+// which pays its fee in several tokens is observed once per token.
 type observedTransaction struct {
 	// A transaction hash.
 	hash chainhash.Hash
 
-	// The fee per byte of the transaction in satoshis.
+	// The token the fee was paid in.
+	token types.Token
+
+	// The fee per byte of the transaction in atoms of the token.
 	feeRate SatoshiPerByte
 
 	// The block height when it was observed.
@@ -111,6 +119,7 @@ type observedTransaction struct {
 
 func (o *observedTransaction) Serialize(w io.Writer) {
 	binary.Write(w, binary.BigEndian, o.hash)
+	binary.Write(w, binary.BigEndian, o.token)
 	binary.Write(w, binary.BigEndian, o.feeRate)
 	binary.Write(w, binary.BigEndian, o.observed)
 	binary.Write(w, binary.BigEndian, o.mined)
@@ -122,6 +131,9 @@ func deserializeObservedTransaction(r io.Reader) (*observedTransaction, error) {
 	// The first 32 bytes should be a hash.
 	binary.Read(r, binary.BigEndian, &ot.hash)
 
+	// The next byte is the token.
+	binary.Read(r, binary.BigEndian, &ot.token)
+
 	// The next 8 are SatoshiPerByte
 	binary.Read(r, binary.BigEndian, &ot.feeRate)
 
@@ -150,8 +162,25 @@ func (rb *registeredBlock) serialize(w io.Writer, txs map[*observedTransaction]u
 	}
 }
 
-// FeeEstimator manages the data necessary to create
-// fee estimations. It is safe for concurrent access.
+// tokenFees holds the transactions observed by a FeeEstimator which paid their
+// fees in a token, and the bins of those which were mined.
+type tokenFees struct {
+	observed map[chainhash.Hash]*observedTransaction
+	bin      [estimateFeeDepth][]*observedTransaction
+
+	// The cached estimates.
+	cached []SatoshiPerByte
+}
+
+// newTokenFees returns an empty set of fees paid in a token.
+func newTokenFees() *tokenFees {
+	return &tokenFees{
+		observed: make(map[chainhash.Hash]*observedTransaction),
+	}
+}
+
+// FeeEstimator manages the data necessary to create fee estimations for each
+// token the fees are paid in. It is safe for concurrent access.
 type FeeEstimator struct {
 	maxRollback uint32
 	binSize     int32
@@ -170,16 +199,16 @@ type FeeEstimator struct {
 	// The number of blocks that have been registered.
 	numBlocksRegistered uint32
 
-	mtx      sync.RWMutex
-	observed map[chainhash.Hash]*observedTransaction
-	bin      [estimateFeeDepth][]*observedTransaction
-
-	// The cached estimates.
-	cached []SatoshiPerByte
+	mtx    sync.RWMutex
+	tokens map[types.Token]*tokenFees
 
 	// Transactions that have been removed from the bins. This allows us to
 	// revert in case of an orphaned block.
 	dropped []*registeredBlock
+
+	// The most recent order fills, which provide the price used to convert
+	// the fees between tokens.
+	fills []types.Balance
 }
 
 // NewFeeEstimator creates a FeeEstimator for which at most maxRollback blocks
@@ -192,12 +221,37 @@ func NewFeeEstimator(maxRollback, minRegisteredBlocks uint32) *FeeEstimator {
 		lastKnownHeight:     mining.UnminedHeight,
 		binSize:             estimateFeeBinSize,
 		maxReplacements:     estimateFeeMaxReplacements,
-		observed:            make(map[chainhash.Hash]*observedTransaction),
+		tokens:              make(map[types.Token]*tokenFees),
 		dropped:             make([]*registeredBlock, 0, maxRollback),
 	}
 }
 
+// tokenFees returns the fees paid in the passed token, which are added to the
+// estimator when it has none.
+func (ef *FeeEstimator) tokenFees(token types.Token) *tokenFees {
+	fees, ok := ef.tokens[token]
+	if !ok {
+		fees = newTokenFees()
+		ef.tokens[token] = fees
+	}
+	return fees
+}
+
+// sortedTokens returns the tokens of the fees the estimator holds in order.
+func (ef *FeeEstimator) sortedTokens() []types.Token {
+	tokens := make([]types.Token, 0, len(ef.tokens))
+	for token := range ef.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i] < tokens[j]
+	})
+	return tokens
+}
+
 // ObserveTransaction is called when a new transaction is observed in the mempool.
+// The transaction is observed for each token it pays its fee in, while a
+// transaction without fee is observed for Token0.
 func (ef *FeeEstimator) ObserveTransaction(t *TxDesc) {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
@@ -208,28 +262,92 @@ func (ef *FeeEstimator) ObserveTransaction(t *TxDesc) {
 		return
 	}
 
+	fees := t.Fee.Balance().Values()
+	if len(fees) == 0 {
+		fees = []types.Value{{Amount: 0, Token: types.Token0}}
+	}
 	hash := *t.Tx.Hash()
-	if _, ok := ef.observed[hash]; !ok {
-		// TODO: estimate fee for all accepted tokens
-		fee := types.Amount(t.Fee.Balance().Amount(types.Token0))
-		size := uint32(GetTxVirtualSize(t.Tx))
-
-		ef.observed[hash] = &observedTransaction{
+	size := uint32(GetTxVirtualSize(t.Tx))
+	for _, fee := range fees {
+		if fee.Amount < 0 {
+			continue
+		}
+		tokenFees := ef.tokenFees(fee.Token)
+		if _, ok := tokenFees.observed[hash]; ok {
+			continue
+		}
+		tokenFees.observed[hash] = &observedTransaction{
 			hash:     hash,
-			feeRate:  NewSatoshiPerByte(fee, size),
+			token:    fee.Token,
+			feeRate:  NewSatoshiPerByte(fee.Amount, size),
 			observed: t.Height,
 			mined:    mining.UnminedHeight,
 		}
 	}
 }
 
+// ObserveOrderFill is called when an order is filled by a block connected to
+// the main chain, with the net amount of each token the order received.  The
+// amounts of the tokens exchanged by the most recent fills provide the price
+// which converts the fees between tokens.
+func (ef *FeeEstimator) ObserveOrderFill(balance *types.Balance) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	if len(ef.fills) == estimateFeeMaxFills {
+		ef.fills = append(ef.fills[1:], *balance.Clone())
+	} else {
+		ef.fills = append(ef.fills, *balance.Clone())
+	}
+}
+
+// RevertOrderFill is called when an order fill observed by ObserveOrderFill is
+// reverted by disconnecting its block from the main chain.  The most recent
+// fill with the passed balance is forgotten.
+func (ef *FeeEstimator) RevertOrderFill(balance *types.Balance) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	for i := len(ef.fills) - 1; i >= 0; i-- {
+		if ef.fills[i].Equal(balance) {
+			ef.fills = append(ef.fills[:i], ef.fills[i+1:]...)
+			return
+		}
+	}
+}
+
+// tokenPrice returns the amount of the to token exchanged for one atom of the
+// from token by the most recent order fills which exchanged both, and whether
+// or not there is any.
+func (ef *FeeEstimator) tokenPrice(from, to types.Token) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+
+	var fromAmount, toAmount float64
+	for i := range ef.fills {
+		a, b := ef.fills[i].Amount(from), ef.fills[i].Amount(to)
+		if a == 0 || b == 0 {
+			continue
+		}
+		fromAmount += math.Abs(float64(a))
+		toAmount += math.Abs(float64(b))
+	}
+	if fromAmount == 0 {
+		return 0, false
+	}
+	return toAmount / fromAmount, true
+}
+
 // RegisterBlock informs the fee estimator of a new block to take into account.
 func (ef *FeeEstimator) RegisterBlock(block *chainutil.Block) error {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
-	// The previous sorted list is invalid, so delete it.
-	ef.cached = nil
+	// The previous sorted lists are invalid, so delete them.
+	for _, fees := range ef.tokens {
+		fees.cached = nil
+	}
 
 	height := block.Height()
 	if height != ef.lastKnownHeight+1 && ef.lastKnownHeight != mining.UnminedHeight {
@@ -247,22 +365,50 @@ func (ef *FeeEstimator) RegisterBlock(block *chainutil.Block) error {
 		transactions[t] = struct{}{}
 	}
 
-	// Count the number of replacements we make per bin so that we don't
-	// replace too many.
-	var replacementCounts [estimateFeeDepth]int
-
 	// Keep track of which txs were dropped in case of an orphan block.
 	dropped := &registeredBlock{
 		hash:         *block.Hash(),
 		transactions: make([]*observedTransaction, 0, 100),
 	}
 
+	for _, fees := range ef.tokens {
+		err := ef.registerBlockFees(fees, transactions, height, dropped)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Add dropped list to history.
+	if ef.maxRollback == 0 {
+		return nil
+	}
+
+	if uint32(len(ef.dropped)) == ef.maxRollback {
+		ef.dropped = append(ef.dropped[1:], dropped)
+	} else {
+		ef.dropped = append(ef.dropped, dropped)
+	}
+
+	return nil
+}
+
+// registerBlockFees puts the transactions of a new block at the passed height
+// which paid their fees in a token into the bins of the token, and adds those
+// they replace to the passed dropped list.
+func (ef *FeeEstimator) registerBlockFees(fees *tokenFees,
+	transactions map[*chainutil.Tx]struct{}, height int32,
+	dropped *registeredBlock) error {
+
+	// Count the number of replacements we make per bin so that we don't
+	// replace too many.
+	var replacementCounts [estimateFeeDepth]int
+
 	// Go through the txs in the block.
 	for t := range transactions {
 		hash := *t.Hash()
 
 		// Have we observed this tx in the mempool?
-		o, ok := ef.observed[hash]
+		o, ok := fees.observed[hash]
 		if !ok {
 			continue
 		}
@@ -292,7 +438,7 @@ func (ef *FeeEstimator) RegisterBlock(block *chainutil.Block) error {
 
 		replacementCounts[blocksToConfirm]++
 
-		bin := ef.bin[blocksToConfirm]
+		bin := fees.bin[blocksToConfirm]
 
 		// Remove a random element and replace it with this new tx.
 		if len(bin) == int(ef.binSize) {
@@ -306,27 +452,16 @@ func (ef *FeeEstimator) RegisterBlock(block *chainutil.Block) error {
 		} else {
 			bin = append(bin, o)
 		}
-		ef.bin[blocksToConfirm] = bin
+		fees.bin[blocksToConfirm] = bin
 	}
 
 	// Go through the mempool for txs that have been in too long.
-	for hash, o := range ef.observed {
+	for hash, o := range fees.observed {
 		if o.mined == mining.UnminedHeight && height-o.observed >= estimateFeeDepth {
-			delete(ef.observed, hash)
+			delete(fees.observed, hash)
 		}
 	}
 
-	// Add dropped list to history.
-	if ef.maxRollback == 0 {
-		return nil
-	}
-
-	if uint32(len(ef.dropped)) == ef.maxRollback {
-		ef.dropped = append(ef.dropped[1:], dropped)
-	} else {
-		ef.dropped = append(ef.dropped, dropped)
-	}
-
 	return nil
 }
 
@@ -373,8 +508,10 @@ func (ef *FeeEstimator) Rollback(hash *chainhash.Hash) error {
 // rollback rolls back the effect of the last block in the stack
 // of registered blocks.
 func (ef *FeeEstimator) rollback() {
-	// The previous sorted list is invalid, so delete it.
-	ef.cached = nil
+	// The previous sorted lists are invalid, so delete them.
+	for _, fees := range ef.tokens {
+		fees.cached = nil
+	}
 
 	// pop the last list of dropped txs from the stack.
 	last := len(ef.dropped) - 1
@@ -387,17 +524,20 @@ func (ef *FeeEstimator) rollback() {
 
 	dropped := ef.dropped[last]
 
-	// where we are in each bin as we replace txs?
-	var replacementCounters [estimateFeeDepth]int
+	// where we are in each bin of each token as we replace txs?
+	replacementCounters := make(map[types.Token]*[estimateFeeDepth]int)
+	for token := range ef.tokens {
+		replacementCounters[token] = new([estimateFeeDepth]int)
+	}
 
 	// Go through the txs in the dropped block.
 	for _, o := range dropped.transactions {
 		// Which bin was this tx in?
 		blocksToConfirm := o.mined - o.observed - 1
 
-		bin := ef.bin[blocksToConfirm]
+		bin := ef.tokens[o.token].bin[blocksToConfirm]
 
-		var counter = replacementCounters[blocksToConfirm]
+		var counter = replacementCounters[o.token][blocksToConfirm]
 
 		// Continue to go through that bin where we left off.
 		for {
@@ -420,33 +560,35 @@ func (ef *FeeEstimator) rollback() {
 			counter++
 		}
 
-		replacementCounters[blocksToConfirm] = counter
+		replacementCounters[o.token][blocksToConfirm] = counter
 	}
 
 	// Continue going through bins to find other txs to remove
 	// which did not replace any other when they were entered.
-	for i, j := range replacementCounters {
-		for {
-			l := len(ef.bin[i])
-			if j >= l {
-				break
-			}
+	for token, fees := range ef.tokens {
+		for i, j := range replacementCounters[token] {
+			for {
+				l := len(fees.bin[i])
+				if j >= l {
+					break
+				}
 
-			prev := ef.bin[i][j]
+				prev := fees.bin[i][j]
 
-			if prev.mined == ef.lastKnownHeight {
-				prev.mined = mining.UnminedHeight
+				if prev.mined == ef.lastKnownHeight {
+					prev.mined = mining.UnminedHeight
 
-				newBin := append(ef.bin[i][0:j], ef.bin[i][j+1:l]...)
-				// TODO This line should prevent an unintentional memory
-				// leak but it causes a panic when it is uncommented.
-				// ef.bin[i][j] = nil
-				ef.bin[i] = newBin
+					newBin := append(fees.bin[i][0:j], fees.bin[i][j+1:l]...)
+					// TODO This line should prevent an unintentional memory
+					// leak but it causes a panic when it is uncommented.
+					// fees.bin[i][j] = nil
+					fees.bin[i] = newBin
 
-				continue
-			}
+					continue
+				}
 
-			j++
+				j++
+			}
 		}
 	}
 
@@ -508,25 +650,28 @@ func (b *estimateFeeSet) estimateFee(confirmations int) SatoshiPerByte {
 	return b.feeRate[feeIndex]
 }
 
-// newEstimateFeeSet creates a temporary data structure that
-// can be used to find all fee estimates.
-func (ef *FeeEstimator) newEstimateFeeSet() *estimateFeeSet {
+// newEstimateFeeSet creates a temporary data structure that can be used to
+// find all fee estimates in the passed token.  The fees paid in the other tokens
+// are converted to the token with the price of the recent order fills when
+// combined is set, and ignored otherwise.
+func (ef *FeeEstimator) newEstimateFeeSet(token types.Token, combined bool) *estimateFeeSet {
 	set := &estimateFeeSet{}
 
-	capacity := 0
-	for i, b := range ef.bin {
-		l := len(b)
-		set.bin[i] = uint32(l)
-		capacity += l
-	}
-
-	set.feeRate = make([]SatoshiPerByte, capacity)
+	for from, fees := range ef.tokens {
+		if from != token && !combined {
+			continue
+		}
+		price, ok := ef.tokenPrice(from, token)
+		if !ok {
+			continue
+		}
 
-	i := 0
-	for _, b := range ef.bin {
-		for _, o := range b {
-			set.feeRate[i] = o.feeRate
-			i++
+		for i, b := range fees.bin {
+			set.bin[i] += uint32(len(b))
+			for _, o := range b {
+				set.feeRate = append(set.feeRate,
+					SatoshiPerByte(float64(o.feeRate)*price))
+			}
 		}
 	}
 
@@ -535,10 +680,10 @@ func (ef *FeeEstimator) newEstimateFeeSet() *estimateFeeSet {
 	return set
 }
 
-// estimates returns the set of all fee estimates from 1 to estimateFeeDepth
-// confirmations from now.
-func (ef *FeeEstimator) estimates() []SatoshiPerByte {
-	set := ef.newEstimateFeeSet()
+// estimates returns the set of all fee estimates in the passed token from 1 to
+// estimateFeeDepth confirmations from now.
+func (ef *FeeEstimator) estimates(token types.Token, combined bool) []SatoshiPerByte {
+	set := ef.newEstimateFeeSet(token, combined)
 
 	estimates := make([]SatoshiPerByte, estimateFeeDepth)
 	for i := 0; i < estimateFeeDepth; i++ {
@@ -548,12 +693,32 @@ func (ef *FeeEstimator) estimates() []SatoshiPerByte {
 	return estimates
 }
 
-// EstimateFee estimates the fee per byte to have a tx confirmed a given
-// number of blocks from now.
-func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (BtcPerKilobyte, error) {
+// EstimateFee estimates the fee per byte to have a tx which pays its fee in the
+// passed token confirmed a given number of blocks from now.
+func (ef *FeeEstimator) EstimateFee(numBlocks uint32, token types.Token) (BtcPerKilobyte, error) {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
+	return ef.estimateFee(numBlocks, token, false)
+}
+
+// EstimateCombinedFee estimates the fee per byte in the passed token to have a
+// tx confirmed a given number of blocks from now, from the fees paid in every
+// token, which are converted to the token with the price of the recent order
+// fills.  The fees paid in tokens without such a price are ignored.
+func (ef *FeeEstimator) EstimateCombinedFee(numBlocks uint32, token types.Token) (BtcPerKilobyte, error) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	return ef.estimateFee(numBlocks, token, true)
+}
+
+// estimateFee estimates the fee per byte in the passed token to have a tx
+// confirmed a given number of blocks from now, from the fees paid in every
+// token when combined is set.  See EstimateFee and EstimateCombinedFee.
+//
+// This function MUST be called with the estimator lock held.
+func (ef *FeeEstimator) estimateFee(numBlocks uint32, token types.Token, combined bool) (BtcPerKilobyte, error) {
 	// If the number of registered blocks is below the minimum, return
 	// an error.
 	if ef.numBlocksRegistered < ef.minRegisteredBlocks {
@@ -570,19 +735,26 @@ func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (BtcPerKilobyte, error) {
 			estimateFeeBinSize)
 	}
 
+	// The combined estimates are not cached since they depend on the fees
+	// paid in every token, nor are those of a token without any fee.
+	fees, ok := ef.tokens[token]
+	if combined || !ok {
+		return ef.estimates(token, combined)[int(numBlocks)-1].ToBtcPerKb(), nil
+	}
+
 	// If there are no cached results, generate them.
-	if ef.cached == nil {
-		ef.cached = ef.estimates()
+	if fees.cached == nil {
+		fees.cached = ef.estimates(token, false)
 	}
 
-	return ef.cached[int(numBlocks)-1].ToBtcPerKb(), nil
+	return fees.cached[int(numBlocks)-1].ToBtcPerKb(), nil
 }
 
 // In case the format for the serialized version of the FeeEstimator changes,
 // we use a version number. If the version number changes, it does not make
 // sense to try to upgrade a previous version to a new version. Instead, just
 // start fee estimation over.
-const estimateFeeSaveVersion = 1
+const estimateFeeSaveVersion = 2
 
 func deserializeRegisteredBlock(r io.Reader, txs map[uint32]*observedTransaction) (*registeredBlock, error) {
 	var lenTransactions uint32
@@ -614,7 +786,10 @@ type observedTxSet []*observedTransaction
 func (q observedTxSet) Len() int { return len(q) }
 
 func (q observedTxSet) Less(i, j int) bool {
-	return strings.Compare(q[i].hash.String(), q[j].hash.String()) < 0
+	if cmp := strings.Compare(q[i].hash.String(), q[j].hash.String()); cmp != 0 {
+		return cmp < 0
+	}
+	return q[i].token < q[j].token
 }
 
 func (q observedTxSet) Swap(i, j int) {
@@ -641,31 +816,36 @@ func (ef *FeeEstimator) Save() FeeEstimatorState {
 	binary.Write(w, binary.BigEndian, &ef.numBlocksRegistered)
 
 	// Put all the observed transactions in a sorted list.
-	var txCount uint32
-	ots := make([]*observedTransaction, len(ef.observed))
-	for hash := range ef.observed {
-		ots[txCount] = ef.observed[hash]
-		txCount++
+	var ots []*observedTransaction
+	for _, fees := range ef.tokens {
+		for hash := range fees.observed {
+			ots = append(ots, fees.observed[hash])
+		}
 	}
 
 	sort.Sort(observedTxSet(ots))
 
-	txCount = 0
+	txCount := uint32(0)
 	observed := make(map[*observedTransaction]uint32)
-	binary.Write(w, binary.BigEndian, uint32(len(ef.observed)))
+	binary.Write(w, binary.BigEndian, uint32(len(ots)))
 	for _, ot := range ots {
 		ot.Serialize(w)
 		observed[ot] = txCount
 		txCount++
 	}
 
-	// Save all the right bins.
-	for _, list := range ef.bin {
+	// Save all the right bins of each token.
+	tokens := ef.sortedTokens()
+	binary.Write(w, binary.BigEndian, uint32(len(tokens)))
+	for _, token := range tokens {
+		binary.Write(w, binary.BigEndian, token)
+		for _, list := range ef.tokens[token].bin {
 
-		binary.Write(w, binary.BigEndian, uint32(len(list)))
+			binary.Write(w, binary.BigEndian, uint32(len(list)))
 
-		for _, o := range list {
-			binary.Write(w, binary.BigEndian, observed[o])
+			for _, o := range list {
+				binary.Write(w, binary.BigEndian, observed[o])
+			}
 		}
 	}
 
@@ -675,6 +855,17 @@ func (ef *FeeEstimator) Save() FeeEstimatorState {
 		registered.serialize(w, observed)
 	}
 
+	// Recent order fills.
+	binary.Write(w, binary.BigEndian, uint32(len(ef.fills)))
+	for i := range ef.fills {
+		values := ef.fills[i].Values()
+		binary.Write(w, binary.BigEndian, uint32(len(values)))
+		for _, v := range values {
+			binary.Write(w, binary.BigEndian, v.Token)
+			binary.Write(w, binary.BigEndian, v.Amount)
+		}
+	}
+
 	// Commit the tx and return.
 	return FeeEstimatorState(w.Bytes())
 }
@@ -695,7 +886,7 @@ func RestoreFeeEstimator(data FeeEstimatorState) (*FeeEstimator, error) {
 	}
 
 	ef := &FeeEstimator{
-		observed: make(map[chainhash.Hash]*observedTransaction),
+		tokens: make(map[types.Token]*tokenFees),
 	}
 
 	// Read basic parameters.
@@ -716,25 +907,32 @@ func RestoreFeeEstimator(data FeeEstimatorState) (*FeeEstimator, error) {
 			return nil, err
 		}
 		observed[i] = ot
-		ef.observed[ot.hash] = ot
-	}
-
-	// Read bins.
-	for i := 0; i < estimateFeeDepth; i++ {
-		var numTransactions uint32
-		binary.Read(r, binary.BigEndian, &numTransactions)
-		bin := make([]*observedTransaction, numTransactions)
-		for j := uint32(0); j < numTransactions; j++ {
-			var index uint32
-			binary.Read(r, binary.BigEndian, &index)
-
-			var exists bool
-			bin[j], exists = observed[index]
-			if !exists {
-				return nil, fmt.Errorf("Invalid transaction reference %d", index)
+		ef.tokenFees(ot.token).observed[ot.hash] = ot
+	}
+
+	// Read bins of each token.
+	var numTokens uint32
+	binary.Read(r, binary.BigEndian, &numTokens)
+	for t := uint32(0); t < numTokens; t++ {
+		var token types.Token
+		binary.Read(r, binary.BigEndian, &token)
+		fees := ef.tokenFees(token)
+		for i := 0; i < estimateFeeDepth; i++ {
+			var numTransactions uint32
+			binary.Read(r, binary.BigEndian, &numTransactions)
+			bin := make([]*observedTransaction, numTransactions)
+			for j := uint32(0); j < numTransactions; j++ {
+				var index uint32
+				binary.Read(r, binary.BigEndian, &index)
+
+				var exists bool
+				bin[j], exists = observed[index]
+				if !exists {
+					return nil, fmt.Errorf("Invalid transaction reference %d", index)
+				}
 			}
+			fees.bin[i] = bin
 		}
-		ef.bin[i] = bin
 	}
 
 	// Read dropped transactions.
@@ -749,5 +947,23 @@ func RestoreFeeEstimator(data FeeEstimatorState) (*FeeEstimator, error) {
 		}
 	}
 
+	// Read recent order fills.
+	var numFills uint32
+	binary.Read(r, binary.BigEndian, &numFills)
+	if numFills > estimateFeeMaxFills {
+		return nil, fmt.Errorf("Invalid number of order fills %d", numFills)
+	}
+	ef.fills = make([]types.Balance, numFills)
+	for i := uint32(0); i < numFills; i++ {
+		var numValues uint32
+		binary.Read(r, binary.BigEndian, &numValues)
+		for j := uint32(0); j < numValues; j++ {
+			var v types.Value
+			binary.Read(r, binary.BigEndian, &v.Token)
+			binary.Read(r, binary.BigEndian, &v.Amount)
+			ef.fills[i].AddValue(v)
+		}
+	}
+
 	return ef, nil
 }
@@ -14,6 +14,7 @@ import (
 	"github.com/endurio/ndrd/mining"
 	"github.com/endurio/ndrd/wire"
 	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/types"
 )
 
 // newTestFeeEstimator creates a feeEstimator with some different parameters
@@ -25,7 +26,7 @@ func newTestFeeEstimator(binSize, maxReplacements, maxRollback uint32) *FeeEstim
 		binSize:             int32(binSize),
 		minRegisteredBlocks: 0,
 		maxReplacements:     int32(maxReplacements),
-		observed:            make(map[chainhash.Hash]*observedTransaction),
+		tokens:              make(map[types.Token]*tokenFees),
 		dropped:             make([]*registeredBlock, 0, maxRollback),
 	}
 }
@@ -48,6 +49,10 @@ type estimateFeeTester struct {
 }
 
 func (eft *estimateFeeTester) testTx(fee types.Amount) *TxDesc {
+	return eft.testTokenTx(*types.NewBalance(fee, 0))
+}
+
+func (eft *estimateFeeTester) testTokenTx(fee types.Balance) *TxDesc {
 	eft.version++
 	return &TxDesc{
 		TxDesc: mining.TxDesc{
@@ -55,7 +60,7 @@ func (eft *estimateFeeTester) testTx(fee types.Amount) *TxDesc {
 				Version: eft.version,
 			}),
 			Height: eft.height,
-			Fee:    int64(fee),
+			Fee:    types.Fee(fee),
 		},
 		StartingPriority: 0,
 	}
@@ -63,7 +68,7 @@ func (eft *estimateFeeTester) testTx(fee types.Amount) *TxDesc {
 
 func expectedFeePerKilobyte(t *TxDesc) BtcPerKilobyte {
 	size := float64(t.TxDesc.Tx.MsgTx().SerializeSize())
-	fee := float64(t.TxDesc.Fee)
+	fee := float64(t.TxDesc.Fee.Balance().Amount(types.Token0))
 
 	return SatoshiPerByte(fee / size).ToBtcPerKb()
 }
@@ -104,7 +109,7 @@ func TestEstimateFee(t *testing.T) {
 	// Try with no txs and get zero for all queries.
 	expected := BtcPerKilobyte(0.0)
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+		estimated, _ := ef.EstimateFee(i, types.Token0)
 
 		if estimated != expected {
 			t.Errorf("Estimate fee error: expected %f when estimator is empty; got %f", expected, estimated)
@@ -118,7 +123,7 @@ func TestEstimateFee(t *testing.T) {
 	// Expected should still be zero because this is still in the mempool.
 	expected = BtcPerKilobyte(0.0)
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+		estimated, _ := ef.EstimateFee(i, types.Token0)
 
 		if estimated != expected {
 			t.Errorf("Estimate fee error: expected %f when estimator has one tx in mempool; got %f", expected, estimated)
@@ -130,7 +135,7 @@ func TestEstimateFee(t *testing.T) {
 	ef.minRegisteredBlocks = 1
 	expected = BtcPerKilobyte(-1.0)
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+		estimated, _ := ef.EstimateFee(i, types.Token0)
 
 		if estimated != expected {
 			t.Errorf("Estimate fee error: expected %f before any blocks have been registered; got %f", expected, estimated)
@@ -141,7 +146,7 @@ func TestEstimateFee(t *testing.T) {
 	eft.newBlock([]*wire.MsgTx{tx.Tx.MsgTx()})
 	expected = expectedFeePerKilobyte(tx)
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+		estimated, _ := ef.EstimateFee(i, types.Token0)
 
 		if estimated != expected {
 			t.Errorf("Estimate fee error: expected %f when one tx is binned; got %f", expected, estimated)
@@ -153,7 +158,7 @@ func TestEstimateFee(t *testing.T) {
 	eft.rollback()
 	expected = BtcPerKilobyte(0.0)
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+		estimated, _ := ef.EstimateFee(i, types.Token0)
 
 		if estimated != expected {
 			t.Errorf("Estimate fee error: expected %f after rolling back block; got %f", expected, estimated)
@@ -167,7 +172,7 @@ func TestEstimateFee(t *testing.T) {
 	eft.newBlock([]*wire.MsgTx{tx.Tx.MsgTx()})
 	expected = expectedFeePerKilobyte(tx)
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+		estimated, _ := ef.EstimateFee(i, types.Token0)
 
 		if estimated != expected {
 			t.Errorf("Estimate fee error: expected %f when one tx is binned; got %f", expected, estimated)
@@ -193,7 +198,7 @@ func TestEstimateFee(t *testing.T) {
 	// Now the estimated amount should depend on the value
 	// of the argument to estimate fee.
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+		estimated, _ := ef.EstimateFee(i, types.Token0)
 		if i > 2 {
 			expected = expectedFeePerKilobyte(txA)
 		} else {
@@ -215,7 +220,7 @@ func TestEstimateFee(t *testing.T) {
 	// Now the estimated amount should depend on the value
 	// of the argument to estimate fee.
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+		estimated, _ := ef.EstimateFee(i, types.Token0)
 		if i <= 2 {
 			expected = expectedFeePerKilobyte(txB)
 		} else if i <= 8 {
@@ -240,7 +245,7 @@ func TestEstimateFee(t *testing.T) {
 	// This should have no effect on the outcome because too
 	// many blocks have been mined for txC to be recorded.
 	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+		estimated, _ := ef.EstimateFee(i, types.Token0)
 		if i <= 2 {
 			expected = expectedFeePerKilobyte(txC)
 		} else if i <= 8 {
@@ -257,12 +262,105 @@ func TestEstimateFee(t *testing.T) {
 	}
 }
 
+// TestRevertOrderFill ensures a reverted order fill no longer provides the price
+// which converts the fees between tokens.
+func TestRevertOrderFill(t *testing.T) {
+	ef := newTestFeeEstimator(5, 3, 1)
+	check := func(desc string, want float64, wantOk bool) {
+		t.Helper()
+		price, ok := ef.tokenPrice(types.Token1, types.Token0)
+		if price != want || ok != wantOk {
+			t.Errorf("%s: got price %v, %v, want %v, %v", desc, price,
+				ok, want, wantOk)
+		}
+	}
+
+	ef.ObserveOrderFill(types.NewBalance(-100, 200))
+	ef.ObserveOrderFill(types.NewBalance(-300, 200))
+	check("two fills", 1, true)
+	ef.RevertOrderFill(types.NewBalance(-300, 200))
+	check("reverted fill", 0.5, true)
+	ef.RevertOrderFill(types.NewBalance(-300, 200))
+	check("fill reverted twice", 0.5, true)
+	ef.RevertOrderFill(types.NewBalance(-100, 200))
+	check("all fills reverted", 0, false)
+}
+
+// TestEstimateTokenFee tests the fee estimates of each token, and the combined
+// estimates which convert the fees between tokens with the order fill price.
+func TestEstimateTokenFee(t *testing.T) {
+	ef := newTestFeeEstimator(5, 3, 1)
+	eft := estimateFeeTester{ef: ef, t: t}
+
+	// All the test txs have the same size.
+	txA := eft.testTx(1000000)
+	txB := eft.testTokenTx(*types.NewBalance(0, 4000000))
+	size := uint32(GetTxVirtualSize(txA.Tx))
+	feeRate := func(fee types.Amount) BtcPerKilobyte {
+		return NewSatoshiPerByte(fee, size).ToBtcPerKb()
+	}
+
+	ef.ObserveTransaction(txA)
+	ef.ObserveTransaction(txB)
+	eft.newBlock([]*wire.MsgTx{txA.Tx.MsgTx(), txB.Tx.MsgTx()})
+
+	tests := []struct {
+		name     string
+		token    types.Token
+		combined bool
+		expected BtcPerKilobyte
+	}{
+		{"Token0", types.Token0, false, feeRate(1000000)},
+		{"Token1", types.Token1, false, feeRate(4000000)},
+		{"unknown token", types.Token(2), false, 0},
+		{"combined Token0 without price", types.Token0, true, feeRate(1000000)},
+		{"combined Token1 without price", types.Token1, true, feeRate(4000000)},
+	}
+	check := func() {
+		for _, test := range tests {
+			var estimated BtcPerKilobyte
+			if test.combined {
+				estimated, _ = ef.EstimateCombinedFee(1, test.token)
+			} else {
+				estimated, _ = ef.EstimateFee(1, test.token)
+			}
+			if estimated != test.expected {
+				t.Errorf("%s: expected %f; got %f", test.name,
+					test.expected, estimated)
+			}
+		}
+	}
+	check()
+
+	// An order paying 100 atoms of Token0 for 200 atoms of Token1 sets the
+	// price of Token1 to half an atom of Token0.
+	ef.ObserveOrderFill(types.NewBalance(-100, 200))
+	tests[3].name, tests[3].expected = "combined Token0", feeRate(2000000)
+	tests[4].name = "combined Token1"
+	check()
+
+	// A tx paying its fee in both tokens is observed in both.
+	txC := eft.testTokenTx(*types.NewBalance(3000000, 8000000))
+	ef.ObserveTransaction(txC)
+	eft.newBlock([]*wire.MsgTx{txC.Tx.MsgTx()})
+	for token, expected := range map[types.Token]BtcPerKilobyte{
+		types.Token0: feeRate(3000000),
+		types.Token1: feeRate(8000000),
+	} {
+		estimated, _ := ef.EstimateFee(1, token)
+		if estimated != expected {
+			t.Errorf("%v: expected %f when paying both tokens; got %f",
+				token, expected, estimated)
+		}
+	}
+}
+
 func (eft *estimateFeeTester) estimates() [estimateFeeDepth]BtcPerKilobyte {
 
 	// Generate estimates
 	var estimates [estimateFeeDepth]BtcPerKilobyte
 	for i := 0; i < estimateFeeDepth; i++ {
-		estimates[i], _ = eft.ef.EstimateFee(uint32(i + 1))
+		estimates[i], _ = eft.ef.EstimateFee(uint32(i+1), types.Token0)
 	}
 
 	// Check that all estimated fee results go in descending order.
@@ -293,7 +391,7 @@ func (eft *estimateFeeTester) round(txHistory [][]*TxDesc,
 	mempool := make(map[*observedTransaction]*TxDesc)
 	for _, h := range txHistory {
 		for _, t := range h {
-			if o, exists := eft.ef.observed[*t.Tx.Hash()]; exists && o.mined == mining.UnminedHeight {
+			if o, exists := eft.ef.tokens[types.Token0].observed[*t.Tx.Hash()]; exists && o.mined == mining.UnminedHeight {
 				mempool[o] = t
 			}
 		}
@@ -6,8 +6,11 @@
 package mempool
 
 import (
+	"bytes"
+	"container/heap"
 	"container/list"
 	"fmt"
+	"math"
 	"math/big"
 	"sync"
 	"sync/atomic"
@@ -16,6 +19,7 @@ import (
 	"github.com/endurio/ndrd/blockchain"
 	"github.com/endurio/ndrd/chaincfg"
 	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainec"
 	"github.com/endurio/ndrd/chainjson"
 	"github.com/endurio/ndrd/chainutil"
 	"github.com/endurio/ndrd/mining"
@@ -24,10 +28,116 @@ import (
 	"github.com/endurio/ndrd/wire"
 )
 
+const (
+	// DefaultMaxOrderAge is the default number of blocks an order is
+	// allowed to rest in the order book before it expires and is evicted
+	// during the next sweep.
+	DefaultMaxOrderAge = 4096
+
+	// DefaultMaxBookSize is the default maximum number of orders allowed
+	// to rest in the order book at the same time.
+	DefaultMaxBookSize = 100000
+
+	// DefaultMinPriceImprovement is the default minimum price
+	// improvement, as a fraction of the price, an order must offer over
+	// every resting order it replaces.
+	DefaultMinPriceImprovement = 0.001
+
+	// MaxReplaceableSequence is the maximum sequence number an input of an
+	// order can have for the order to signal it is replaceable, the same
+	// way transactions signal it in BIP0125.
+	MaxReplaceableSequence = wire.MaxTxInSequenceNum - 2
+
+	// maxCancelledOrders is the maximum number of cancelled orders the
+	// book remembers, to reject them when they are relayed again and to
+	// ignore replays of their cancellations.
+	maxCancelledOrders = 10000
+
+	// maxPendingCancels is the maximum number of orders not in the book
+	// whose cancellations the book remembers until the orders arrive.
+	// They are limited apart from the cancelled orders since their
+	// signatures cannot be checked yet, so they must not evict the checked
+	// ones.
+	maxPendingCancels = 1000
+
+	// maxCancelCandidates is the maximum number of distinct cancellations
+	// the book remembers for each order not in the book.  Any of them may
+	// be forged, so they are all checked when the order arrives.
+	maxCancelCandidates = 4
+)
+
+// BookDeltaAction identifies how a BookDelta changed the order book.
+type BookDeltaAction int
+
+// These constants define the ways an order book delta can change the book.
+const (
+	// BookDeltaAdd indicates the order was added to the book.
+	BookDeltaAdd BookDeltaAction = iota
+
+	// BookDeltaRemove indicates the order was removed from the book
+	// without being filled, such as when it was cancelled, replaced,
+	// double spent or expired.
+	BookDeltaRemove
+
+	// BookDeltaFill indicates the order was removed from the book because
+	// it was filled by a block connected to the main chain.
+	BookDeltaFill
+)
+
+// Map of BookDeltaAction values back to their constant names for pretty
+// printing.
+var bookDeltaActionStrings = map[BookDeltaAction]string{
+	BookDeltaAdd:    "add",
+	BookDeltaRemove: "remove",
+	BookDeltaFill:   "fill",
+}
+
+// String returns the BookDeltaAction in human-readable form.
+func (a BookDeltaAction) String() string {
+	if s, ok := bookDeltaActionStrings[a]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown BookDeltaAction (%d)", int(a))
+}
+
+// BookDelta describes a single change to the order book.  Applying the deltas
+// in the order of their sequence numbers to a snapshot of the book taken at a
+// lower sequence number reproduces the book exactly.
+type BookDelta struct {
+	// Sequence is the number of changes made to the book so far,
+	// including this one.
+	Sequence uint64
+
+	// Action is how the order changed the book.
+	Action BookDeltaAction
+
+	// Order is the order added to or removed from the book.
+	Order *OdrDesc
+}
+
 // OdrDesc is a descriptor containing an order in the mempool along with
 // additional metadata.
 type OdrDesc struct {
 	mining.OdrDesc
+
+	// Expiry is the block height at which the order expires and is
+	// evicted from the book.  Zero means the order never expires.
+	Expiry int32
+
+	// seq is the arrival sequence of the order on its side of the book.
+	// It decides the time priority among the orders of the same price.
+	seq uint64
+
+	// level and element locate the order in its side of the book, so it
+	// can be removed without searching for it.
+	level   *bookLevel
+	element *list.Element
+}
+
+// Expired returns whether or not the order is expired at the passed block
+// height.
+func (oD *OdrDesc) Expired(height int32) bool {
+	return oD.Expiry > 0 && height >= oD.Expiry
 }
 
 // Price returns the order price.
@@ -35,12 +145,28 @@ func (oD *OdrDesc) Price() float64 {
 	return float64(oD.Payout) / float64(oD.Amount)
 }
 
-// OrderBookResult returns OrderBookResult object for the order
-func (oD *OdrDesc) OrderBookResult() *chainjson.GetOrderBookResult {
-	return &chainjson.GetOrderBookResult{
+// OrderBookOrderResult returns the order as an order of a price level of the
+// order book.
+func (oD *OdrDesc) OrderBookOrderResult() chainjson.OrderBookOrderResult {
+	return chainjson.OrderBookOrderResult{
+		Hash:   oD.Hash().String(),
+		Price:  oD.Price(),
+		Amount: oD.Amount.ToCoin(),
+		Payout: oD.Payout.ToCoin(),
+		Height: oD.Height,
+		Time:   oD.Added.Unix(),
+	}
+}
+
+// OrderBookEntryResult returns the order as an entry of the order book
+// snapshots and deltas.
+func (oD *OdrDesc) OrderBookEntryResult() chainjson.OrderBookEntryResult {
+	return chainjson.OrderBookEntryResult{
+		Hash:   oD.Hash().String(),
 		Bid:    oD.Bid,
 		Price:  oD.Price(),
 		Amount: oD.Amount.ToCoin(),
+		Payout: oD.Payout.ToCoin(),
 	}
 }
 
@@ -52,15 +178,93 @@ type OdrBook struct {
 	mtx sync.RWMutex
 	cfg Config
 
-	bids      *list.List
-	asks      *list.List
-	book      map[chainhash.Hash]*list.Element
-	outpoints map[wire.OutPoint]*list.Element
+	bids      *orderSide
+	asks      *orderSide
+	book      map[chainhash.Hash]*OdrDesc
+	outpoints map[wire.OutPoint]*OdrDesc
+
+	// expiries indexes the orders which expire by their expiry height,
+	// while expiryHeights keeps those heights lowest first, so expiring
+	// orders does not scan the whole book.
+	expiries      map[int32]map[chainhash.Hash]*OdrDesc
+	expiryHeights expiryHeap
+
+	// cancelled holds the cancellations of the orders removed from the
+	// book by a valid cancellation.  pendingCancels holds the candidate
+	// cancellations of orders which are not in the book, whose signatures
+	// are checked when the orders arrive.
+	cancelled      *cancelSet
+	pendingCancels *pendingCancelSet
+
+	// sequence is the number of changes made to the book since it was
+	// created.  It increases with every delta passed to OnBookDelta.
+	sequence uint64
 }
 
 // Ensure the OdrBook type implements the mining.OdrSource interface.
 var _ mining.OdrSource = (*OdrBook)(nil)
 
+// expiryHeap is a min-heap of the block heights at which the orders of the
+// book expire.  It implements heap.Interface.
+type expiryHeap []int32
+
+// Len returns the number of heights in the heap.  It is part of the
+// heap.Interface implementation.
+func (h expiryHeap) Len() int { return len(h) }
+
+// Less returns whether the height at index i is lower than the one at index
+// j.  It is part of the heap.Interface implementation.
+func (h expiryHeap) Less(i, j int) bool { return h[i] < h[j] }
+
+// Swap swaps the heights at the passed indices.  It is part of the
+// heap.Interface implementation.
+func (h expiryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+// Push adds the passed height to the heap.  It is part of the heap.Interface
+// implementation.
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(int32)) }
+
+// Pop removes the last height of the heap.  It is part of the heap.Interface
+// implementation.
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	height := old[n-1]
+	*h = old[:n-1]
+	return height
+}
+
+// addExpiry indexes the passed order by its expiry height, if it expires.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (ob *OdrBook) addExpiry(odrDesc *OdrDesc) {
+	if odrDesc.Expiry <= 0 {
+		return
+	}
+	orders, ok := ob.expiries[odrDesc.Expiry]
+	if !ok {
+		orders = make(map[chainhash.Hash]*OdrDesc)
+		ob.expiries[odrDesc.Expiry] = orders
+		heap.Push(&ob.expiryHeights, odrDesc.Expiry)
+	}
+	orders[*odrDesc.Hash()] = odrDesc
+}
+
+// removeExpiry removes the passed order from the expiry index.  The height of
+// an emptied entry stays in the heap until it is popped.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (ob *OdrBook) removeExpiry(odrDesc *OdrDesc) {
+	orders, ok := ob.expiries[odrDesc.Expiry]
+	if !ok {
+		return
+	}
+	delete(orders, *odrDesc.Hash())
+	if len(orders) == 0 {
+		delete(ob.expiries, odrDesc.Expiry)
+	}
+}
+
 // isOrderInBook returns whether or not the passed order already
 // exists in the main book.
 //
@@ -107,27 +311,48 @@ func (ob *OdrBook) HaveOrder(hash *chainhash.Hash) bool {
 	return haveTx
 }
 
+// notifyDelta assigns the next sequence number to the passed change of the
+// book and passes it to the OnBookDelta callback, if any.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (ob *OdrBook) notifyDelta(action BookDeltaAction, odrDesc *OdrDesc) {
+	ob.sequence++
+	if ob.cfg.OnBookDelta != nil {
+		ob.cfg.OnBookDelta(&BookDelta{
+			Sequence: ob.sequence,
+			Action:   action,
+			Order:    odrDesc,
+		})
+	}
+}
+
 // removeOrder is the internal function which implements the public
 // RemoveOrder.  See the comment for RemoveOrder for more details.
 //
 // This function MUST be called with the mempool lock held (for writes).
 func (ob *OdrBook) removeOrder(order *chainutil.Odr) {
+	ob.deleteOrder(order, BookDeltaRemove)
+}
+
+// deleteOrder removes the passed order from the book, if it exists, and
+// notifies the removal as the passed action.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (ob *OdrBook) deleteOrder(order *chainutil.Odr, action BookDeltaAction) {
 	txHash := order.Hash()
 
 	// Remove the order if needed.
-	if element, exists := ob.book[*txHash]; exists {
+	if odrDesc, exists := ob.book[*txHash]; exists {
 		// Mark the referenced outpoints as unspent by the pool.
 		for _, txIn := range order.TxIn {
 			delete(ob.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(ob.book, *txHash)
-		if element.Value.(*OdrDesc).Bid {
-			ob.bids.Remove(element)
-		} else {
-			ob.asks.Remove(element)
-		}
+		ob.side(odrDesc.Bid).remove(odrDesc)
+		ob.removeExpiry(odrDesc)
 
 		atomic.StoreInt64(&ob.lastUpdated, time.Now().Unix())
+		ob.notifyDelta(action, odrDesc)
 	}
 }
 
@@ -144,6 +369,18 @@ func (ob *OdrBook) RemoveOrder(order *chainutil.Odr) {
 	ob.mtx.Unlock()
 }
 
+// FillOrder removes the passed order from the book because it was filled by a
+// block connected to the main chain.  It differs from RemoveOrder only in how
+// the removal is notified.
+//
+// This function is safe for concurrent access.
+func (ob *OdrBook) FillOrder(order *chainutil.Odr) {
+	// Protect concurrent access.
+	ob.mtx.Lock()
+	ob.deleteOrder(order, BookDeltaFill)
+	ob.mtx.Unlock()
+}
+
 // RemoveDoubleSpends removes all orders which spend outputs spent by the
 // passed order from the memory pool.  Removing those orders then
 // leads to removing all orders which rely on them, recursively.  This is
@@ -155,8 +392,7 @@ func (ob *OdrBook) RemoveDoubleSpends(tx *chainutil.Tx) {
 	// Protect concurrent access.
 	ob.mtx.Lock()
 	for _, txIn := range tx.MsgTx().TxIn {
-		if elementRedeemer, ok := ob.outpoints[txIn.PreviousOutPoint]; ok {
-			odrDesc := elementRedeemer.Value.(*OdrDesc)
+		if odrDesc, ok := ob.outpoints[txIn.PreviousOutPoint]; ok {
 			if !odrDesc.Hash().IsEqual(tx.Hash()) {
 				ob.removeOrder(odrDesc.Odr)
 			}
@@ -165,37 +401,237 @@ func (ob *OdrBook) RemoveDoubleSpends(tx *chainutil.Tx) {
 	ob.mtx.Unlock()
 }
 
-func insertOrder(orders *list.List, orderDesc *OdrDesc) *list.Element {
-	price := orderDesc.Price()
-	// ordered insert
-	e := orders.Front()
-	for ; e != nil; e = e.Next() {
-		o := e.Value.(*OdrDesc)
+// ExpireOrders removes all orders which are expired at the passed block height
+// from the book and returns their descriptors so the caller can notify others
+// about the removal.
+//
+// This function is safe for concurrent access.
+func (ob *OdrBook) ExpireOrders(height int32) []*OdrDesc {
+	// Protect concurrent access.
+	ob.mtx.Lock()
+	defer ob.mtx.Unlock()
 
-		if orderDesc.Bid {
-			// biding orders sorted from highest bidder down
-			if price > o.Price() {
-				break
-			}
-		} else {
-			// asking orders sorted from lowser asker up
-			if price < o.Price() {
-				break
-			}
+	var expired []*OdrDesc
+	for len(ob.expiryHeights) > 0 && ob.expiryHeights[0] <= height {
+		expiry := heap.Pop(&ob.expiryHeights).(int32)
+		for _, odrDesc := range ob.expiries[expiry] {
+			expired = append(expired, odrDesc)
+		}
+	}
+	for _, odrDesc := range expired {
+		ob.removeOrder(odrDesc.Odr)
+	}
+
+	if len(expired) > 0 {
+		log.Debugf("Expired %d %s (remaining: %d)", len(expired),
+			pickNoun(len(expired), "order", "orders"), len(ob.book))
+	}
+
+	return expired
+}
+
+// checkCancelSignature ensures the passed compact signature over the passed
+// hash was made with the key the passed public key script pays to.  Only
+// scripts paying to a single public key or public key hash can be cancelled.
+func checkCancelSignature(sig, hash, pkScript []byte, params *chaincfg.Params) error {
+	pubKey, wasCompressed, err := chainec.RecoverCompact(chainec.S256(),
+		sig, hash)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %v", err)
+	}
+	var serializedPK []byte
+	if wasCompressed {
+		serializedPK = pubKey.SerializeCompressed()
+	} else {
+		serializedPK = pubKey.SerializeUncompressed()
+	}
+
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, params)
+	if err != nil || len(addrs) != 1 {
+		return fmt.Errorf("script %x is not supported", pkScript)
+	}
+	switch addr := addrs[0].(type) {
+	case *chainutil.AddressPubKey:
+		if bytes.Equal(addr.ScriptAddress(), serializedPK) {
+			return nil
 		}
+	case *chainutil.AddressPubKeyHash:
+		if bytes.Equal(addr.Hash160()[:], chainutil.Hash160(serializedPK)) {
+			return nil
+		}
+	case *chainutil.AddressWitnessPubKeyHash:
+		if wasCompressed && bytes.Equal(addr.Hash160()[:],
+			chainutil.Hash160(serializedPK)) {
+
+			return nil
+		}
+	default:
+		return fmt.Errorf("script %x is not supported", pkScript)
 	}
-	if e == nil {
-		return orders.PushBack(orderDesc)
+
+	return fmt.Errorf("signature is not made by the key of script %x",
+		pkScript)
+}
+
+// checkCancel checks the passed cancel message carries one signature for each
+// input of the order, made by the key the output it spends pays to.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (ob *OdrBook) checkCancel(msg *wire.MsgCancelOdr, order *chainutil.Odr, utxoView *blockchain.UtxoViewpoint) error {
+	if len(msg.Signatures) != len(order.TxIn) {
+		str := fmt.Sprintf("cancellation of order %v has %d "+
+			"signatures for %d inputs", order.Hash(),
+			len(msg.Signatures), len(order.TxIn))
+		return txRuleError(wire.RejectInvalid, str)
 	}
-	return orders.InsertBefore(orderDesc, e)
+
+	sigHash := msg.SigHash()
+	for i, txIn := range order.TxIn {
+		entry := utxoView.LookupEntry(txIn.PreviousOutPoint)
+		if entry == nil || entry.IsSpent() {
+			str := fmt.Sprintf("output %v spent by order %v is "+
+				"unknown or spent", txIn.PreviousOutPoint,
+				order.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+		err := checkCancelSignature(msg.Signatures[i], sigHash,
+			entry.PkScript(), ob.cfg.ChainParams)
+		if err != nil {
+			str := fmt.Sprintf("cancellation of order %v has an "+
+				"invalid signature for input %d: %v",
+				order.Hash(), i, err)
+			return txRuleError(wire.RejectInvalid, str)
+		}
+	}
+
+	return nil
 }
 
-// addOrder adds the passed odr to the memory pool.  It should
-// not be called directly as it doesn't perform any validation.  This is a
-// helper for maybeAcceptOrder.
+// CancelOrder removes the order withdrawn by the passed cancel message from the
+// book and returns its descriptor.  The message must carry one signature for
+// each input of the order, made by the key the spent output pays to.
+//
+// The cancellation of an order which is not in the book cannot be checked, so
+// it is remembered among the candidates for the order until it arrives, and the
+// order is rejected then if any candidate is valid for it.  Nil is returned for
+// the descriptor in that case, and the cancellation must not be relayed since
+// it may be forged.  The returned flag reports whether the cancellation is new,
+// which it is not when the order was already cancelled or the same
+// cancellation is already remembered.
+//
+// This function is safe for concurrent access.
+func (ob *OdrBook) CancelOrder(msg *wire.MsgCancelOdr) (*OdrDesc, bool, error) {
+	// Protect concurrent access.
+	ob.mtx.Lock()
+	defer ob.mtx.Unlock()
+
+	if _, exists := ob.cancelled.lookup(&msg.OdrHash); exists {
+		return nil, false, nil
+	}
+
+	odrDesc, exists := ob.book[msg.OdrHash]
+	if !exists {
+		if !ob.pendingCancels.add(msg) {
+			return nil, false, nil
+		}
+		log.Debugf("Remembered cancellation of unknown order %v",
+			msg.OdrHash)
+		return nil, true, nil
+	}
+
+	order := odrDesc.Odr
+	utxoView, err := ob.fetchInputUtxos(order)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := ob.checkCancel(msg, order, utxoView); err != nil {
+		return nil, false, err
+	}
+
+	ob.removeOrder(order)
+	ob.cancelled.add(msg)
+	log.Debugf("Cancelled order %v (remaining: %d)", order.Hash(),
+		len(ob.book))
+
+	return odrDesc, true, nil
+}
+
+// worseOrder returns whether or not the order a has lower priority than the
+// order b.  Orders of the same side are compared by price, then by arrival
+// sequence.  An order which is not in the book yet arrives after all others.
+func worseOrder(a, b *OdrDesc) bool {
+	aPrice, bPrice := a.Price(), b.Price()
+	if aPrice != bPrice {
+		if a.Bid {
+			return aPrice < bPrice
+		}
+		return aPrice > bPrice
+	}
+	if a.level == nil || b.level == nil {
+		return a.level == nil && b.level != nil
+	}
+	return a.seq > b.seq
+}
+
+// side returns the side of the book for bids or asks.
+func (ob *OdrBook) side(bid bool) *orderSide {
+	if bid {
+		return ob.bids
+	}
+	return ob.asks
+}
+
+// lowestPriorityOrder returns the order with the lowest priority in the book,
+// which is the worst priced order of the longer side.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (ob *OdrBook) lowestPriorityOrder() *OdrDesc {
+	orders := ob.asks
+	if ob.bids.Len() > ob.asks.Len() {
+		orders = ob.bids
+	}
+	level := orders.back()
+	if level == nil {
+		return nil
+	}
+	return level.orders.Back().Value.(*OdrDesc)
+}
+
+// limitBookSize evicts the lowest priority orders until the book can fit one
+// more order.  It returns an error when the passed order itself would have
+// the lowest priority in a full book.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (ob *OdrBook) addOrder(odr *chainutil.Odr, stb, ndr int64, height int32) *OdrDesc {
+func (ob *OdrBook) limitBookSize(odrDesc *OdrDesc) error {
+	maxBookSize := ob.cfg.Policy.MaxBookSize
+	if maxBookSize <= 0 {
+		return nil
+	}
+
+	for len(ob.book) >= maxBookSize {
+		victim := ob.lowestPriorityOrder()
+		if victim == nil {
+			break
+		}
+		if victim.Bid == odrDesc.Bid && !worseOrder(victim, odrDesc) {
+			str := fmt.Sprintf("order %v has too low priority for "+
+				"the full order book", odrDesc.Hash())
+			return txRuleError(wire.RejectInsufficientFee, str)
+		}
+
+		log.Debugf("Evicting order %v from the full order book",
+			victim.Hash())
+		ob.removeOrder(victim.Odr)
+	}
+
+	return nil
+}
+
+// newOdrDesc creates the descriptor for the passed order which is accepted at
+// the passed block height.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (ob *OdrBook) newOdrDesc(odr *chainutil.Odr, stb, ndr int64, height int32) *OdrDesc {
 	odrDesc := &OdrDesc{
 		OdrDesc: mining.OdrDesc{
 			Odr:    odr,
@@ -206,20 +642,29 @@ func (ob *OdrBook) addOrder(odr *chainutil.Odr, stb, ndr int64, height int32) *O
 			Payout: types.Amount(abs(stb)),
 		},
 	}
-
-	var element *list.Element
-	if odrDesc.Bid {
-		element = insertOrder(ob.bids, odrDesc)
-	} else {
-		element = insertOrder(ob.asks, odrDesc)
+	if maxAge := ob.cfg.Policy.MaxOrderAge; maxAge > 0 {
+		odrDesc.Expiry = height + maxAge
 	}
 
-	ob.book[*odrDesc.Hash()] = element
+	return odrDesc
+}
+
+// addOrder adds the passed order descriptor to the book.  It should
+// not be called directly as it doesn't perform any validation.  This is a
+// helper for maybeAcceptOrder.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (ob *OdrBook) addOrder(odrDesc *OdrDesc) *OdrDesc {
+	ob.side(odrDesc.Bid).insert(odrDesc)
+
+	ob.book[*odrDesc.Hash()] = odrDesc
 	for _, txIn := range odrDesc.TxIn {
-		ob.outpoints[txIn.PreviousOutPoint] = element
+		ob.outpoints[txIn.PreviousOutPoint] = odrDesc
 	}
+	ob.addExpiry(odrDesc)
 
 	atomic.StoreInt64(&ob.lastUpdated, time.Now().Unix())
+	ob.notifyDelta(BookDeltaAdd, odrDesc)
 	return odrDesc
 }
 
@@ -231,11 +676,91 @@ func (ob *OdrBook) addOrder(odr *chainutil.Odr, stb, ndr int64, height int32) *O
 // This function MUST be called with the mempool lock held (for reads).
 func (ob *OdrBook) checkBookDoubleSpend(order *chainutil.Odr) error {
 	for _, txIn := range order.TxIn {
-		if element, exists := ob.outpoints[txIn.PreviousOutPoint]; exists {
+		if odrDesc, exists := ob.outpoints[txIn.PreviousOutPoint]; exists {
 			str := fmt.Sprintf("output %v already spent by order %v in the memory pool",
-				txIn.PreviousOutPoint, element.Value.(*OdrDesc).Hash())
+				txIn.PreviousOutPoint, odrDesc.Hash())
+			return txRuleError(wire.RejectDuplicate, str)
+		}
+	}
+
+	return nil
+}
+
+// signalsReplacement returns whether or not the passed order signals it is
+// replaceable, which is when the sequence number of any of its inputs is at
+// most MaxReplaceableSequence.
+func signalsReplacement(order *chainutil.Odr) bool {
+	for _, txIn := range order.TxIn {
+		if txIn.Sequence <= MaxReplaceableSequence {
+			return true
+		}
+	}
+
+	return false
+}
+
+// orderConflicts returns the orders of the book which spend any of the outputs
+// spent by the passed order.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (ob *OdrBook) orderConflicts(order *chainutil.Odr) map[chainhash.Hash]*OdrDesc {
+	conflicts := make(map[chainhash.Hash]*OdrDesc)
+	for _, txIn := range order.TxIn {
+		if odrDesc, exists := ob.outpoints[txIn.PreviousOutPoint]; exists {
+			conflicts[*odrDesc.Hash()] = odrDesc
+		}
+	}
+
+	return conflicts
+}
+
+// checkReplacement ensures the passed order can replace all of the passed
+// conflicting orders of the book.  Both the replacement and the orders it
+// replaces must signal replaceability, they must all be on the same side of
+// the book, and the replacement must improve the price of every replaced
+// order by at least the minimum price improvement of the policy.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (ob *OdrBook) checkReplacement(odrDesc *OdrDesc, conflicts map[chainhash.Hash]*OdrDesc) error {
+	if !signalsReplacement(odrDesc.Odr) {
+		str := fmt.Sprintf("order %v spends outputs of orders in the "+
+			"book without signaling replaceability", odrDesc.Hash())
+		return txRuleError(wire.RejectDuplicate, str)
+	}
+
+	improvement := ob.cfg.Policy.MinPriceImprovement
+	price := odrDesc.Price()
+	for hash, conflict := range conflicts {
+		if !signalsReplacement(conflict.Odr) {
+			str := fmt.Sprintf("order %v spends outputs of order "+
+				"%v which is not replaceable", odrDesc.Hash(), hash)
 			return txRuleError(wire.RejectDuplicate, str)
 		}
+		if conflict.Bid != odrDesc.Bid {
+			str := fmt.Sprintf("order %v is not on the same side of "+
+				"the book as order %v it replaces",
+				odrDesc.Hash(), hash)
+			return txRuleError(wire.RejectDuplicate, str)
+		}
+
+		// Bids improve by paying more, and asks by asking for less.
+		// The price must always improve, so an order can not be
+		// replaced over and over at the same price.
+		var improved bool
+		if odrDesc.Bid {
+			improved = price > conflict.Price() &&
+				price >= conflict.Price()*(1+improvement)
+		} else {
+			improved = price < conflict.Price() &&
+				price <= conflict.Price()*(1-improvement)
+		}
+		if !improved {
+			str := fmt.Sprintf("order %v with price %v does not "+
+				"improve enough on the price %v of order %v "+
+				"it replaces", odrDesc.Hash(), price,
+				conflict.Price(), hash)
+			return txRuleError(wire.RejectInsufficientFee, str)
+		}
 	}
 
 	return nil
@@ -246,10 +771,13 @@ func (ob *OdrBook) checkBookDoubleSpend(order *chainutil.Odr) error {
 // be returned, if not nil will be returned.
 func (ob *OdrBook) CheckSpend(op wire.OutPoint) *chainutil.Tx {
 	ob.mtx.RLock()
-	txR := ob.outpoints[op]
+	odrDesc := ob.outpoints[op]
 	ob.mtx.RUnlock()
 
-	return txR.Value.(*OdrDesc).Tx
+	if odrDesc == nil {
+		return nil
+	}
+	return odrDesc.Tx
 }
 
 // fetchInputUtxos loads utxo details about the input transactions referenced by
@@ -275,22 +803,43 @@ func (ob *OdrBook) fetchInputUtxos(order *chainutil.Odr) (*blockchain.UtxoViewpo
 func (ob *OdrBook) FetchOrder(txHash *chainhash.Hash) (*chainutil.Odr, error) {
 	// Protect concurrent access.
 	ob.mtx.RLock()
-	element, exists := ob.book[*txHash]
+	odrDesc, exists := ob.book[*txHash]
 	ob.mtx.RUnlock()
 
 	if exists {
-		return element.Value.(*OdrDesc).Odr, nil
+		return odrDesc.Odr, nil
 	}
 
 	return nil, fmt.Errorf("order is not in the pool")
 }
 
+// IsOrder returns whether or not the passed transaction is an order rather than
+// a regular transaction, such as a transaction of a block disconnected from the
+// main chain.  Orders are the non-coinbase transactions with a positive token
+// balance against the current chain state, the same way block validation
+// classifies them.
+//
+// This function is safe for concurrent access.
+func (ob *OdrBook) IsOrder(tx *chainutil.Tx) bool {
+	view, err := ob.cfg.FetchUtxoView(tx)
+	if err != nil {
+		return false
+	}
+	nextHeight := ob.cfg.BestHeight() + 1
+	balance, err := blockchain.CheckTransactionInputs(tx, nextHeight, view,
+		ob.cfg.ChainParams)
+	if err != nil || balance == nil {
+		return false
+	}
+	return blockchain.IsOrderBalance(balance)
+}
+
 // maybeAcceptOrder is the internal function which implements the public
 // MaybeAcceptOrder.  See the comment for MaybeAcceptOrder for
 // more details.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
+func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, []*OdrDesc, error) {
 	txHash := order.Hash()
 
 	// If a transaction has iwtness data, and segwit isn't active yet, If
@@ -299,13 +848,13 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 	if order.HasWitness() {
 		segwitActive, err := ob.cfg.IsDeploymentActive(chaincfg.DeploymentSegwit)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if !segwitActive {
 			str := fmt.Sprintf("order %v has witness data, "+
 				"but segwit isn't active yet", txHash)
-			return nil, txRuleError(wire.RejectNonstandard, str)
+			return nil, nil, txRuleError(wire.RejectNonstandard, str)
 		}
 	}
 
@@ -315,7 +864,14 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 	// weed out duplicates.
 	if ob.isOrderInBook(txHash) {
 		str := fmt.Sprintf("already have order %v", txHash)
-		return nil, txRuleError(wire.RejectDuplicate, str)
+		return nil, nil, txRuleError(wire.RejectDuplicate, str)
+	}
+
+	// Don't accept an order which was cancelled, such as when it is
+	// relayed again by a peer which does not know cancellations.
+	if _, exists := ob.cancelled.lookup(txHash); exists {
+		str := fmt.Sprintf("order %v was cancelled", txHash)
+		return nil, nil, txRuleError(wire.RejectDuplicate, str)
 	}
 
 	// Perform preliminary sanity checks on the transaction.  This makes
@@ -324,15 +880,15 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 	err := blockchain.CheckTransactionSanity(order.Tx)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, chainRuleError(cerr)
+			return nil, nil, chainRuleError(cerr)
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
 	// An order must not be a coinbase transaction.
 	if blockchain.IsCoinBase(order.Tx) {
 		str := fmt.Sprintf("order %v is a coinbase", txHash)
-		return nil, txRuleError(wire.RejectInvalid, str)
+		return nil, nil, txRuleError(wire.RejectInvalid, str)
 	}
 
 	// Get the current height of the main chain.
@@ -345,7 +901,7 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 	// forbid their acceptance.
 	if !ob.cfg.Policy.AcceptNonStd {
 		err = checkTransactionStandard(order.Tx, nextBlockHeight,
-			medianTimePast, ob.cfg.Policy.MinRelayTxPrice,
+			medianTimePast, ob.cfg.Policy.RelayTxPrice(),
 			ob.cfg.Policy.MaxTxVersion)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
@@ -357,28 +913,32 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 			}
 			str := fmt.Sprintf("order %v is not standard: %v",
 				txHash, err)
-			return nil, txRuleError(rejectCode, str)
+			return nil, nil, txRuleError(rejectCode, str)
 		}
 	}
 	// The transaction may not use any of the same outputs as other
 	// transactions already in the pool as that would ultimately result in a
-	// double spend.  This check is intended to be quick and therefore only
-	// detects double spends within the transaction pool itself.  The
-	// transaction could still be double spending coins from the main chain
-	// at this point.  There is a more in-depth check that happens later
-	// after fetching the referenced transaction inputs from the main chain
-	// which examines the actual spend data and prevents double spends.
-	err = ob.checkBookDoubleSpend(order)
-	if err != nil {
-		return nil, err
+	// double spend, unless it replaces them.  This check is intended to be
+	// quick and therefore only detects double spends within the transaction
+	// pool itself.  The transaction could still be double spending coins
+	// from the main chain at this point.  There is a more in-depth check
+	// that happens later after fetching the referenced transaction inputs
+	// from the main chain which examines the actual spend data and prevents
+	// double spends.
+	conflicts := ob.orderConflicts(order)
+	if len(conflicts) > 0 && !signalsReplacement(order) {
+		err = ob.checkBookDoubleSpend(order)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	utxoView, err := ob.fetchInputUtxos(order)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, chainRuleError(cerr)
+			return nil, nil, chainRuleError(cerr)
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Don't allow the transaction into the mempool unless its sequence
@@ -387,13 +947,13 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 	sequenceLock, err := ob.cfg.CalcSequenceLock(order.Tx, utxoView)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, chainRuleError(cerr)
+			return nil, nil, chainRuleError(cerr)
 		}
-		return nil, err
+		return nil, nil, err
 	}
 	if !blockchain.SequenceLockActive(sequenceLock, nextBlockHeight,
 		medianTimePast) {
-		return nil, txRuleError(wire.RejectNonstandard,
+		return nil, nil, txRuleError(wire.RejectNonstandard,
 			"order's sequence locks on inputs not met")
 	}
 
@@ -405,19 +965,35 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 		utxoView, ob.cfg.ChainParams)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, chainRuleError(cerr)
+			return nil, nil, chainRuleError(cerr)
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
 	if balances.Amount(types.Token1) <= 0 && balances.Amount(types.Token0) <= 0 {
 		str := fmt.Sprintf("Not an order: %v", txHash)
-		return nil, blockchain.RuleError{
+		return nil, nil, blockchain.RuleError{
 			ErrorCode:   blockchain.ErrNotAnOrder,
 			Description: str,
 		}
 	}
 
+	// The cancellations of the order may have arrived before the order
+	// itself.  They can only be checked now the inputs are known, and the
+	// order is rejected when any of them is valid.  Invalid ones are
+	// forgotten.
+	if cancels := ob.pendingCancels.lookup(txHash); cancels != nil {
+		ob.pendingCancels.remove(txHash)
+		for _, msg := range cancels {
+			if ob.checkCancel(msg, order, utxoView) != nil {
+				continue
+			}
+			ob.cancelled.add(msg)
+			str := fmt.Sprintf("order %v was cancelled", txHash)
+			return nil, nil, txRuleError(wire.RejectDuplicate, str)
+		}
+	}
+
 	// Don't allow transactions with non-standard inputs if the network
 	// parameters forbid their acceptance.
 	if !ob.cfg.Policy.AcceptNonStd {
@@ -432,7 +1008,7 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 			}
 			str := fmt.Sprintf("order %v has a non-standard "+
 				"input: %v", txHash, err)
-			return nil, txRuleError(rejectCode, str)
+			return nil, nil, txRuleError(rejectCode, str)
 		}
 	}
 
@@ -449,14 +1025,14 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 	sigOpCost, err := blockchain.GetSigOpCost(order.Tx, false, utxoView, true, true)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, chainRuleError(cerr)
+			return nil, nil, chainRuleError(cerr)
 		}
-		return nil, err
+		return nil, nil, err
 	}
 	if sigOpCost > ob.cfg.Policy.MaxSigOpCostPerTx {
 		str := fmt.Sprintf("order %v sigop cost is too high: %d > %d",
 			txHash, sigOpCost, ob.cfg.Policy.MaxSigOpCostPerTx)
-		return nil, txRuleError(wire.RejectNonstandard, str)
+		return nil, nil, txRuleError(wire.RejectNonstandard, str)
 	}
 
 	// Verify crypto signatures for each input and reject the transaction if
@@ -466,20 +1042,48 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 		ob.cfg.HashCache)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, chainRuleError(cerr)
+			return nil, nil, chainRuleError(cerr)
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Add to transaction pool.
-	oD := ob.addOrder(order,
+	oD := ob.newOdrDesc(order,
 		balances.Amount(types.Token1).Int64(),
 		balances.Amount(types.Token0).Int64(),
 		bestHeight)
 
+	// Replace the conflicting orders of the book.  Both the removal of
+	// the replaced orders and the insertion of the replacement happen with
+	// the lock held, so no other order can take their place in between.
+	// The book does not grow with a replacement, so there is no need to
+	// make room for it.
+	var replaced []*OdrDesc
+	if len(conflicts) > 0 {
+		err = ob.checkReplacement(oD, conflicts)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, conflict := range conflicts {
+			ob.removeOrder(conflict.Odr)
+			replaced = append(replaced, conflict)
+			log.Debugf("Replaced order %v with order %v",
+				conflict.Hash(), txHash)
+		}
+	} else {
+		// Make room for the order when the book is full, or reject it
+		// when it would be the first one to be evicted.
+		err = ob.limitBookSize(oD)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Add to the order book.
+	ob.addOrder(oD)
+
 	log.Debugf("Accepted order %v (book size: %v)", txHash, len(ob.book))
 
-	return oD, nil
+	return oD, replaced, nil
 }
 
 // MaybeAcceptOrder is the main workhorse for handling insertion of new
@@ -487,14 +1091,17 @@ func (ob *OdrBook) maybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 // such as rejecting duplicate orders, ensuring orders follow all
 // rules, detecting orphan orders, and insertion into the order book.
 //
+// The orders of the book replaced by the passed order, if any, are returned
+// along with the accepted order.
+//
 // This function is safe for concurrent access.
-func (ob *OdrBook) MaybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
+func (ob *OdrBook) MaybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, []*OdrDesc, error) {
 	// Protect concurrent access.
 	ob.mtx.Lock()
-	oD, err := ob.maybeAcceptOrder(order)
+	oD, replaced, err := ob.maybeAcceptOrder(order)
 	ob.mtx.Unlock()
 
-	return oD, err
+	return oD, replaced, err
 }
 
 // ProcessOrder is the main workhorse for handling insertion of new
@@ -502,13 +1109,11 @@ func (ob *OdrBook) MaybeAcceptOrder(order *chainutil.Odr) (*OdrDesc, error) {
 // such as rejecting duplicate orders, ensuring transactions follow all
 // rules, orphan order handling, and insertion into the memory pool.
 //
-// It returns a slice of orders added to the mempool.  When the
-// error is nil, the list will include the passed order itself along
-// with any additional orphan orders that were added as a result of
-// the passed one being accepted.
+// It returns the order added to the book, along with the orders of the book
+// it replaced, if any.
 //
 // This function is safe for concurrent access.
-func (ob *OdrBook) ProcessOrder(order *chainutil.Odr) (*OdrDesc, error) {
+func (ob *OdrBook) ProcessOrder(order *chainutil.Odr) (*OdrDesc, []*OdrDesc, error) {
 	log.Tracef("Processing order %v", order.Hash())
 
 	// Protect concurrent access.
@@ -516,12 +1121,12 @@ func (ob *OdrBook) ProcessOrder(order *chainutil.Odr) (*OdrDesc, error) {
 	defer ob.mtx.Unlock()
 
 	// Potentially accept the transaction to the memory pool.
-	oD, err := ob.maybeAcceptOrder(order)
+	oD, replaced, err := ob.maybeAcceptOrder(order)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return oD, nil
+	return oD, replaced, nil
 }
 
 // Count returns the nuober of orders in the main book.  It does not
@@ -562,8 +1167,8 @@ func (ob *OdrBook) OdrDescs() []*OdrDesc {
 	ob.mtx.RLock()
 	descs := make([]*OdrDesc, len(ob.book))
 	i := 0
-	for _, element := range ob.book {
-		descs[i] = element.Value.(*OdrDesc)
+	for _, odrDesc := range ob.book {
+		descs[i] = odrDesc
 		i++
 	}
 	ob.mtx.RUnlock()
@@ -572,7 +1177,9 @@ func (ob *OdrBook) OdrDescs() []*OdrDesc {
 }
 
 // MiningDescs returns a slice of mining descriptors for the orders
-// in the book, to spend as much as possible the amount of STB.
+// in the book, to spend as much as possible the amount of STB.  The first
+// order which does not fit into what is left of the amount is filled
+// partially, and comes last.
 //
 // This is part of the mining.OdrSource interface implementation and is safe for
 // concurrent access as required by the interface contract.
@@ -586,36 +1193,75 @@ func (ob *OdrBook) MiningDescs(payout *big.Int) []*mining.OdrDesc {
 		payout = new(big.Int).Abs(payout)
 	}
 
-	descs, err := getOrdersForPayout(orders, payout)
-	if err != nil {
-		log.Errorf("Unable to get orders for mining: %v", err)
-		return nil
-	}
-	result := make([]*mining.OdrDesc, len(descs))
+	descs, boundary, remain := getOrdersForPayout(orders, payout)
+	result := make([]*mining.OdrDesc, len(descs), len(descs)+1)
 	i := 0
 	for _, desc := range descs {
 		result[i] = &desc.OdrDesc
 		i++
 	}
+	if boundary != nil {
+		unfilled, ok := unfilledAmount(boundary, remain)
+		if ok {
+			// Copy the descriptor, since it's shared with the book.
+			partial := boundary.OdrDesc
+			partial.Unfilled = unfilled
+			result = append(result, &partial)
+		}
+	}
 	return result
 }
 
-// Get orders to spend as much as possible of STB amount.
+// Get orders to spend as much as possible of STB amount.  The first order
+// which does not fit is returned along with the STB amount left, so it can
+// be filled partially.
 // not thread safe
-func getOrdersForPayout(orders *list.List, payout *big.Int) ([]*OdrDesc, error) {
-	result := make([]*OdrDesc, 0, orders.Len())
+func getOrdersForPayout(orders *orderSide, payout *big.Int) ([]*OdrDesc, *OdrDesc, *big.Int) {
+	var result []*OdrDesc
+	var boundary *OdrDesc
 	remain := new(big.Int).Set(payout)
 
-	for e := orders.Front(); e != nil; e = e.Next() {
-		odrDesc := e.Value.(*OdrDesc)
-		remain.Sub(remain, big.NewInt(abs(int64(odrDesc.Payout))))
-		if remain.Sign() < 0 {
-			break
+	orders.forEach(func(odrDesc *OdrDesc) bool {
+		odrPayout := big.NewInt(abs(int64(odrDesc.Payout)))
+		if remain.Cmp(odrPayout) < 0 {
+			boundary = odrDesc
+			return false
 		}
+		remain.Sub(remain, odrPayout)
 		result = append(result, odrDesc)
+		return true
+	})
+
+	return result, boundary, remain
+}
+
+// unfilledAmount returns the amount of the token bought by the passed order to
+// leave unfilled, so the order spends or receives at most the remaining STB
+// amount.  It returns false when the order can't be filled partially with the
+// remaining amount.
+func unfilledAmount(odrDesc *OdrDesc, remain *big.Int) (types.Amount, bool) {
+	payout := big.NewInt(int64(odrDesc.Payout))
+	if remain.Sign() <= 0 || remain.Cmp(payout) >= 0 {
+		return 0, false
+	}
+
+	// Asks buy STB, so what does not fit is left unfilled.
+	if !odrDesc.Bid {
+		return types.Amount(new(big.Int).Sub(payout, remain).Int64()), true
 	}
 
-	return result, nil
+	// Bids buy NDR with STB.  The unfilled NDR returns its share of the
+	// STB as change, rounded down, which must cover what does not fit, so
+	// the unfilled amount is rounded up.
+	amount := big.NewInt(int64(odrDesc.Amount))
+	unfilled := new(big.Int).Sub(payout, remain)
+	unfilled.Mul(unfilled, amount)
+	unfilled.Add(unfilled, new(big.Int).Sub(payout, big.NewInt(1)))
+	unfilled.Div(unfilled, payout)
+	if unfilled.Cmp(amount) >= 0 {
+		return 0, false
+	}
+	return types.Amount(unfilled.Int64()), true
 }
 
 // RawMembookVerbose returns all of the entries in the mempool as a fully
@@ -629,11 +1275,10 @@ func (ob *OdrBook) RawMembookVerbose() map[string]*chainjson.GetRawMembookVerbos
 	result := make(map[string]*chainjson.GetRawMembookVerboseResult,
 		len(ob.book))
 
-	for _, element := range ob.book {
+	for _, desc := range ob.book {
 		// Calculate the current priority based on the inputs to
 		// the transaction.  Use zero if one or more of the
 		// input transactions can't be found for some reason.
-		desc := element.Value.(*OdrDesc)
 		odr := desc.Odr
 
 		mpd := &chainjson.GetRawMembookVerboseResult{
@@ -655,55 +1300,127 @@ func (ob *OdrBook) RawMembookVerbose() map[string]*chainjson.GetRawMembookVerbos
 	return result
 }
 
-// Get orders to cover as much as possible the market depth of NDR.
-// not thread safe
-func getOrdersForDepth(orders *list.List, depth float64) []*OdrDesc {
-	result := make([]*OdrDesc, 0, orders.Len())
-
-	var total float64
-
-	for e := orders.Front(); e != nil; e = e.Next() {
-		odrDesc := e.Value.(*OdrDesc)
-		result = append(result, odrDesc)
+// tickPrice returns the price the passed price is grouped at with the passed
+// price tick.  Bids are grouped down and asks up to the nearest multiple of the
+// tick, so a group never shows a better price than any of its orders.  Prices
+// are not grouped when the tick is not greater than zero.
+func tickPrice(price, tick float64, bid bool) float64 {
+	if tick <= 0 {
+		return price
+	}
+	if bid {
+		return math.Floor(price/tick) * tick
+	}
+	return math.Ceil(price/tick) * tick
+}
 
-		// limit the list by market depth param
-		if depth > 0 {
-			total += odrDesc.Amount.ToCoin()
-			if total >= depth {
-				return result
+// orderBookLevels returns the price levels of the passed side of the book from
+// the best priced one down, with the prices grouped by the passed tick.  The
+// levels stop once they cover the passed NDR depth or reach the passed limit,
+// whichever comes first, when those are greater than zero.  The orders of each
+// level are included when verbose is true.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func orderBookLevels(side *orderSide, depth, tick float64, limit int, verbose bool) []chainjson.OrderBookLevelResult {
+	result := make([]chainjson.OrderBookLevelResult, 0)
+	var total types.Amount
+	for level := side.front(); level != nil; level = level.next() {
+		price := tickPrice(level.Price, tick, side.bid)
+		last := len(result) - 1
+		if last < 0 || result[last].Price != price {
+			// Stop before starting a new level when the levels
+			// already cover the depth or reached the limit.
+			if depth > 0 && total.ToCoin() >= depth {
+				break
+			}
+			if limit > 0 && len(result) == limit {
+				break
 			}
+			result = append(result, chainjson.OrderBookLevelResult{
+				Price: price,
+			})
+			last++
+		}
+
+		total += level.Amount
+		result[last].Amount += level.Amount.ToCoin()
+		result[last].Count += level.Count
+		if !verbose {
+			continue
+		}
+		for e := level.orders.Front(); e != nil; e = e.Next() {
+			odrDesc := e.Value.(*OdrDesc)
+			result[last].Orders = append(result[last].Orders,
+				odrDesc.OrderBookOrderResult())
 		}
 	}
 
 	return result
 }
 
-// OrderBook returns all of the entries in the order book as a fully
-// populated chainjson result.
+// OrderBook returns the aggregated price levels of both sides of the order
+// book, along with the best prices, as a fully populated chainjson result.  See
+// orderBookLevels for the meaning of the parameters.
 //
 // This function is safe for concurrent access.
-func (ob *OdrBook) OrderBook(depth float64) ([]*chainjson.GetOrderBookResult, error) {
+func (ob *OdrBook) OrderBook(depth, tick float64, limit int, verbose bool) *chainjson.GetOrderBookResult {
 	ob.mtx.RLock()
 	defer ob.mtx.RUnlock()
 
-	asks := getOrdersForDepth(ob.asks, depth)
-	bids := getOrdersForDepth(ob.bids, depth)
-
-	result := make([]*chainjson.GetOrderBookResult, len(asks)+len(bids))
+	result := &chainjson.GetOrderBookResult{
+		Bids: orderBookLevels(ob.bids, depth, tick, limit, verbose),
+		Asks: orderBookLevels(ob.asks, depth, tick, limit, verbose),
+	}
 
-	var idx int
-	// asks list is reverted
-	for i := len(asks) - 1; i >= 0; i-- {
-		odrDesc := asks[i]
-		result[idx] = odrDesc.OrderBookResult()
-		idx++
+	bestBid, bestAsk := ob.bids.front(), ob.asks.front()
+	if bestBid != nil {
+		result.BestBid = &bestBid.Price
+	}
+	if bestAsk != nil {
+		result.BestAsk = &bestAsk.Price
+	}
+	if bestBid != nil && bestAsk != nil {
+		spread := bestAsk.Price - bestBid.Price
+		mid := (bestAsk.Price + bestBid.Price) / 2
+		result.Spread = &spread
+		result.Mid = &mid
 	}
-	for _, odrDesc := range bids {
-		result[idx] = odrDesc.OrderBookResult()
-		idx++
+
+	return result
+}
+
+// PriceLevels returns the aggregated price levels of the bid or ask side of
+// the book, from the best priced one down.  At most maxLevels levels are
+// returned when it is greater than zero.
+//
+// This function is safe for concurrent access.
+func (ob *OdrBook) PriceLevels(bid bool, maxLevels int) []PriceLevel {
+	ob.mtx.RLock()
+	levels := ob.side(bid).priceLevels(maxLevels)
+	ob.mtx.RUnlock()
+
+	return levels
+}
+
+// Snapshot returns all of the orders in the book, the bids then the asks from
+// the best priced ones down, along with the sequence number of the last change
+// made to the book.  Applying the deltas with higher sequence numbers to the
+// snapshot keeps it in sync with the book.
+//
+// This function is safe for concurrent access.
+func (ob *OdrBook) Snapshot() ([]*OdrDesc, uint64) {
+	ob.mtx.RLock()
+	defer ob.mtx.RUnlock()
+
+	descs := make([]*OdrDesc, 0, len(ob.book))
+	collect := func(odrDesc *OdrDesc) bool {
+		descs = append(descs, odrDesc)
+		return true
 	}
+	ob.bids.forEach(collect)
+	ob.asks.forEach(collect)
 
-	return result, nil
+	return descs, ob.sequence
 }
 
 // LastUpdated returns the last time a order was added to or removed from
@@ -719,10 +1436,14 @@ func (ob *OdrBook) LastUpdated() time.Time {
 func NewMemBook(cfg *Config) *OdrBook {
 	return &OdrBook{
 		cfg:       *cfg,
-		book:      make(map[chainhash.Hash]*list.Element),
-		bids:      list.New(),
-		asks:      list.New(),
-		outpoints: make(map[wire.OutPoint]*list.Element),
+		book:      make(map[chainhash.Hash]*OdrDesc),
+		bids:      newOrderSide(true),
+		asks:      newOrderSide(false),
+		outpoints: make(map[wire.OutPoint]*OdrDesc),
+		expiries:  make(map[int32]map[chainhash.Hash]*OdrDesc),
+
+		cancelled:      newCancelSet(maxCancelledOrders),
+		pendingCancels: newPendingCancelSet(maxPendingCancels, maxCancelCandidates),
 	}
 }
 
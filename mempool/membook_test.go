@@ -0,0 +1,669 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainec"
+	"github.com/endurio/ndrd/chainjson"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/mining"
+	"github.com/endurio/ndrd/txscript"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// TestUnfilledAmount ensures the order at the absorption boundary leaves just
+// enough of what it buys unfilled for the rest to fit the absorption.
+func TestUnfilledAmount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		bid      bool
+		amount   int64 // NDR of the order
+		payout   int64 // STB of the order
+		remain   int64 // STB left of the absorption
+		unfilled types.Amount
+		ok       bool
+	}{
+		{name: "ask", amount: 100, payout: 50, remain: 20, unfilled: 30, ok: true},
+		{name: "ask fits", amount: 100, payout: 50, remain: 50},
+		{name: "ask nothing left", amount: 100, payout: 50, remain: 0},
+		{name: "bid exact", bid: true, amount: 100, payout: 50, remain: 20, unfilled: 60, ok: true},
+		{name: "bid rounded up", bid: true, amount: 10, payout: 3, remain: 1, unfilled: 7, ok: true},
+		{name: "bid all unfilled", bid: true, amount: 2, payout: 100, remain: 1},
+	}
+
+	for _, test := range tests {
+		odrDesc := newTestOdrDesc(test.bid, test.amount, test.payout)
+		unfilled, ok := unfilledAmount(odrDesc, big.NewInt(test.remain))
+		if ok != test.ok || unfilled != test.unfilled {
+			t.Errorf("%s: got unfilled %v (ok %v), want %v (ok %v)",
+				test.name, unfilled, ok, test.unfilled, test.ok)
+			continue
+		}
+		if !ok || !test.bid {
+			continue
+		}
+
+		// The change returned for the unfilled NDR must cover the STB
+		// which does not fit the absorption.
+		change := test.payout * int64(unfilled) / test.amount
+		if test.payout-change > test.remain {
+			t.Errorf("%s: filled %d STB exceeds the %d remaining",
+				test.name, test.payout-change, test.remain)
+		}
+	}
+}
+
+// TestCancelOrder ensures an order is only removed from the book by a
+// cancellation signed by the keys of all of its inputs.
+func TestCancelOrder(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.RegressionNetParams
+	key1, pkScript1 := newTestKey(t, 1)
+	key2, pkScript2 := newTestKey(t, 2)
+
+	// The order spends one output paying to each key.
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 100}, pkScript1))
+	prevTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 100}, pkScript2))
+	prevHash := prevTx.TxHash()
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil, nil))
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 1), nil, nil))
+	order := chainutil.NewOdrFromTx(chainutil.NewTx(msgTx))
+
+	ob := NewMemBook(&Config{
+		ChainParams: params,
+		FetchUtxoView: func(*chainutil.Tx) (*blockchain.UtxoViewpoint, error) {
+			view := blockchain.NewUtxoViewpoint()
+			view.AddTxOuts(chainutil.NewTx(prevTx), 1)
+			return view, nil
+		},
+	})
+	ob.addOrder(&OdrDesc{
+		OdrDesc: mining.OdrDesc{
+			Odr:    order,
+			Amount: 100,
+			Payout: 100,
+		},
+	})
+
+	newCancel := func(keys ...*chainec.PrivateKey) *wire.MsgCancelOdr {
+		return newTestCancel(t, order.Hash(), keys...)
+	}
+
+	tests := []struct {
+		name string
+		msg  *wire.MsgCancelOdr
+	}{
+		{name: "missing signature", msg: newCancel(key1)},
+		{name: "wrong key", msg: newCancel(key1, key1)},
+		{name: "swapped signatures", msg: newCancel(key2, key1)},
+	}
+	for _, test := range tests {
+		odrDesc, _, err := ob.CancelOrder(test.msg)
+		if _, ok := err.(RuleError); !ok || odrDesc != nil {
+			t.Errorf("%s: unexpected result %v, error %v", test.name,
+				odrDesc, err)
+		}
+		if !ob.HaveOrder(order.Hash()) {
+			t.Fatalf("%s: order was removed", test.name)
+		}
+	}
+
+	odrDesc, isNew, err := ob.CancelOrder(newCancel(key1, key2))
+	if err != nil || !isNew || odrDesc == nil || odrDesc.Odr != order {
+		t.Fatalf("CancelOrder: unexpected result %v, error %v", odrDesc,
+			err)
+	}
+	spent := ob.CheckSpend(msgTx.TxIn[0].PreviousOutPoint)
+	if ob.HaveOrder(order.Hash()) || spent != nil {
+		t.Fatal("CancelOrder: order is still in the book")
+	}
+
+	// A replay of the cancellation does nothing, and is not relayed.
+	odrDesc, isNew, err = ob.CancelOrder(newCancel(key1, key2))
+	if err != nil || isNew || odrDesc != nil {
+		t.Fatalf("CancelOrder: unexpected result %v, new %v, error %v "+
+			"for a cancelled order", odrDesc, isNew, err)
+	}
+}
+
+// newTestKey returns the private key made of the passed seed byte along with
+// the pay-to-pubkey-hash script paying to it on the regression test network.
+func newTestKey(t *testing.T, seed byte) (*chainec.PrivateKey, []byte) {
+	privKey, pubKey := chainec.PrivKeyFromBytes(chainec.S256(),
+		bytes.Repeat([]byte{seed}, 32))
+	addr, err := chainutil.NewAddressPubKeyHash(chainutil.Hash160(
+		pubKey.SerializeCompressed()), &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: %v", err)
+	}
+	return privKey, pkScript
+}
+
+// newTestCancel returns the cancellation of the order with the passed hash,
+// signed by the passed keys in order.
+func newTestCancel(t *testing.T, hash *chainhash.Hash, keys ...*chainec.PrivateKey) *wire.MsgCancelOdr {
+	msg := wire.NewMsgCancelOdr(hash)
+	for _, key := range keys {
+		sig, err := chainec.SignCompact(chainec.S256(), key,
+			msg.SigHash(), true)
+		if err != nil {
+			t.Fatalf("SignCompact: %v", err)
+		}
+		msg.AddSignature(sig)
+	}
+	return msg
+}
+
+// TestCancelledOrders ensures a cancelled order is not accepted again and its
+// cancellation is not relayed again, and that the cancellations of an order
+// which is not in the book are remembered and reject the order when it
+// arrives, provided one of them is valid.
+func TestCancelledOrders(t *testing.T) {
+	t.Parallel()
+
+	// The order sells 100 STB paying to the first key for 100 NDR.
+	key1, pkScript := newTestKey(t, 1)
+	key2, _ := newTestKey(t, 2)
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 100,
+		Token: types.Token1}, pkScript))
+	prevHash := prevTx.TxHash()
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(types.Value{Amount: 100,
+		Token: types.Token0}, pkScript))
+	sigScript, err := txscript.SignatureScript(msgTx, 0, pkScript,
+		txscript.SigHashAll, key1, true)
+	if err != nil {
+		t.Fatalf("SignatureScript: %v", err)
+	}
+	msgTx.TxIn[0].SignatureScript = sigScript
+	order := chainutil.NewOdrFromTx(chainutil.NewTx(msgTx))
+
+	newBook := func() *OdrBook {
+		return NewMemBook(&Config{
+			Policy: Policy{
+				AcceptNonStd:        true,
+				MaxSigOpCostPerTx:   blockchain.MaxBlockSigOpsCost / 4,
+				MinPriceImprovement: DefaultMinPriceImprovement,
+			},
+			ChainParams: &chaincfg.RegressionNetParams,
+			FetchUtxoView: func(*chainutil.Tx) (*blockchain.UtxoViewpoint, error) {
+				view := blockchain.NewUtxoViewpoint()
+				view.AddTxOuts(chainutil.NewTx(prevTx), 1)
+				return view, nil
+			},
+			BestHeight:     func() int32 { return 10 },
+			MedianTimePast: func() time.Time { return time.Unix(2000, 0) },
+			CalcSequenceLock: func(*chainutil.Tx, *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+				return &blockchain.SequenceLock{Seconds: -1, BlockHeight: -1}, nil
+			},
+		})
+	}
+	cancel := func(ob *OdrBook, msg *wire.MsgCancelOdr, wantNew bool) {
+		t.Helper()
+		_, isNew, err := ob.CancelOrder(msg)
+		if err != nil || isNew != wantNew {
+			t.Fatalf("CancelOrder: got new %v, error %v, want new %v",
+				isNew, err, wantNew)
+		}
+	}
+	accept := func(ob *OdrBook, wantAccepted bool) {
+		t.Helper()
+		_, _, err := ob.MaybeAcceptOrder(order)
+		if wantAccepted && err != nil {
+			t.Fatalf("MaybeAcceptOrder: unexpected error: %v", err)
+		}
+		if _, ok := err.(RuleError); !wantAccepted && !ok {
+			t.Fatalf("MaybeAcceptOrder: got error %v, want a rule "+
+				"error", err)
+		}
+		if ob.HaveOrder(order.Hash()) != wantAccepted {
+			t.Fatalf("MaybeAcceptOrder: order in the book is %v, "+
+				"want %v", !wantAccepted, wantAccepted)
+		}
+	}
+
+	// A cancelled order is rejected when a peer relays it again, and the
+	// cancellation is not relayed again either.
+	ob := newBook()
+	accept(ob, true)
+	cancel(ob, newTestCancel(t, order.Hash(), key1), true)
+	accept(ob, false)
+	cancel(ob, newTestCancel(t, order.Hash(), key1), false)
+
+	// The cancellation of an unknown order is new once, and the order is
+	// rejected when it arrives.
+	ob = newBook()
+	cancel(ob, newTestCancel(t, order.Hash(), key1), true)
+	cancel(ob, newTestCancel(t, order.Hash(), key1), false)
+	accept(ob, false)
+	cancel(ob, newTestCancel(t, order.Hash(), key1), false)
+
+	// An invalid cancellation of an unknown order is forgotten when the
+	// order arrives, which can then be cancelled.
+	ob = newBook()
+	cancel(ob, newTestCancel(t, order.Hash(), key2), true)
+	accept(ob, true)
+	cancel(ob, newTestCancel(t, order.Hash(), key1), true)
+	if ob.HaveOrder(order.Hash()) {
+		t.Fatal("CancelOrder: order is still in the book")
+	}
+
+	// A forged cancellation of an unknown order arriving first does not
+	// shadow the valid one arriving later.
+	ob = newBook()
+	cancel(ob, newTestCancel(t, order.Hash(), key2), true)
+	cancel(ob, newTestCancel(t, order.Hash(), key1), true)
+	accept(ob, false)
+	cancel(ob, newTestCancel(t, order.Hash(), key1), false)
+
+}
+
+// TestCheckReplacement ensures an order only replaces the resting orders
+// spending the same outputs when all of them signal replaceability, they are
+// on the same side of the book, and the price improves enough.
+func TestCheckReplacement(t *testing.T) {
+	t.Parallel()
+
+	// newOrder returns an order descriptor for an order spending the
+	// passed output index with the passed input sequence number.
+	newOrder := func(index uint32, sequence uint32, bid bool, payout int64) *OdrDesc {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		txIn := wire.NewTxIn(&wire.OutPoint{Index: index}, nil, nil)
+		txIn.Sequence = sequence
+		msgTx.AddTxIn(txIn)
+		msgTx.AddTxOut(wire.NewTxOut(types.Value{
+			Amount: types.Amount(payout),
+		}, nil))
+		odrDesc := newTestOdrDesc(bid, 1000, payout)
+		odrDesc.Odr = chainutil.NewOdrFromTx(chainutil.NewTx(msgTx))
+		return odrDesc
+	}
+	const replaceable = MaxReplaceableSequence
+	const final = wire.MaxTxInSequenceNum
+
+	tests := []struct {
+		name     string
+		resting  *OdrDesc
+		order    *OdrDesc
+		replaced bool
+	}{
+		{
+			name:     "bid pays enough more",
+			resting:  newOrder(0, replaceable, true, 1000),
+			order:    newOrder(0, replaceable, true, 1010),
+			replaced: true,
+		},
+		{
+			name:     "ask asks for enough less",
+			resting:  newOrder(0, replaceable, false, 1000),
+			order:    newOrder(0, replaceable, false, 990),
+			replaced: true,
+		},
+		{
+			name:    "bid does not improve enough",
+			resting: newOrder(0, replaceable, true, 1000),
+			order:   newOrder(0, replaceable, true, 1009),
+		},
+		{
+			name:    "ask gets a worse price",
+			resting: newOrder(0, replaceable, false, 1000),
+			order:   newOrder(0, replaceable, false, 1100),
+		},
+		{
+			name:    "resting order is final",
+			resting: newOrder(0, final, true, 1000),
+			order:   newOrder(0, replaceable, true, 2000),
+		},
+		{
+			name:    "replacement is final",
+			resting: newOrder(0, replaceable, true, 1000),
+			order:   newOrder(0, final, true, 2000),
+		},
+		{
+			name:    "other side of the book",
+			resting: newOrder(0, replaceable, true, 1000),
+			order:   newOrder(0, replaceable, false, 500),
+		},
+	}
+
+	for _, test := range tests {
+		ob := NewMemBook(&Config{
+			Policy: Policy{MinPriceImprovement: 0.01},
+		})
+		ob.addOrder(test.resting)
+		ob.addOrder(newOrder(1, replaceable, true, 1000))
+
+		conflicts := ob.orderConflicts(test.order.Odr)
+		if len(conflicts) != 1 || conflicts[*test.resting.Hash()] == nil {
+			t.Errorf("%s: unexpected conflicts %v", test.name, conflicts)
+			continue
+		}
+		err := ob.checkReplacement(test.order, conflicts)
+		if replaced := err == nil; replaced != test.replaced {
+			t.Errorf("%s: got replaced %v (err %v), want %v",
+				test.name, replaced, err, test.replaced)
+		}
+	}
+}
+
+// newTestBookOrder returns an order descriptor of 1000 NDR for an order spending
+// the passed output index, which is usable for the order book operations.
+func newTestBookOrder(index uint32, bid bool, payout int64) *OdrDesc {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: index}, nil, nil))
+	odrDesc := newTestOdrDesc(bid, 1000, payout)
+	odrDesc.Odr = chainutil.NewOdrFromTx(chainutil.NewTx(msgTx))
+	return odrDesc
+}
+
+// TestBookDeltas ensures every change of the order book is passed to the
+// OnBookDelta callback with the next sequence number, so the deltas following
+// a snapshot reproduce the book.
+func TestBookDeltas(t *testing.T) {
+	t.Parallel()
+
+	var deltas []*BookDelta
+	ob := NewMemBook(&Config{
+		OnBookDelta: func(delta *BookDelta) {
+			deltas = append(deltas, delta)
+		},
+	})
+	orders := []*OdrDesc{
+		newTestBookOrder(0, true, 900),
+		newTestBookOrder(1, false, 1100),
+		newTestBookOrder(2, true, 950),
+	}
+	ob.addOrder(orders[0])
+	ob.addOrder(orders[1])
+	snapshot, sequence := ob.Snapshot()
+	ob.addOrder(orders[2])
+	ob.RemoveOrder(orders[0].Odr)
+	ob.FillOrder(orders[1].Odr)
+
+	// Removing an order which is not in the book changes nothing.
+	ob.FillOrder(orders[1].Odr)
+
+	want := []struct {
+		action BookDeltaAction
+		order  *OdrDesc
+	}{
+		{BookDeltaAdd, orders[0]},
+		{BookDeltaAdd, orders[1]},
+		{BookDeltaAdd, orders[2]},
+		{BookDeltaRemove, orders[0]},
+		{BookDeltaFill, orders[1]},
+	}
+	if len(deltas) != len(want) {
+		t.Fatalf("got %d deltas, want %d", len(deltas), len(want))
+	}
+	for i, delta := range deltas {
+		if delta.Sequence != uint64(i+1) || delta.Action != want[i].action ||
+			delta.Order != want[i].order {
+			t.Errorf("delta #%d: got %d %v %v, want %d %v %v", i,
+				delta.Sequence, delta.Action, delta.Order.Hash(),
+				i+1, want[i].action, want[i].order.Hash())
+		}
+	}
+	if sequence != 2 || len(snapshot) != 2 || snapshot[0] != orders[0] ||
+		snapshot[1] != orders[1] {
+		t.Fatalf("Snapshot: unexpected orders %v at sequence %d",
+			snapshot, sequence)
+	}
+
+	// Apply the deltas following the snapshot to a mirror of it.
+	mirror := make(map[*OdrDesc]struct{})
+	for _, odrDesc := range snapshot {
+		mirror[odrDesc] = struct{}{}
+	}
+	for _, delta := range deltas {
+		if delta.Sequence <= sequence {
+			continue
+		}
+		if delta.Action == BookDeltaAdd {
+			mirror[delta.Order] = struct{}{}
+		} else {
+			delete(mirror, delta.Order)
+		}
+	}
+	final, finalSequence := ob.Snapshot()
+	if finalSequence != uint64(len(deltas)) || len(final) != len(mirror) {
+		t.Fatalf("Snapshot: got %d orders at sequence %d, want %d at %d",
+			len(final), finalSequence, len(mirror), len(deltas))
+	}
+	for _, odrDesc := range final {
+		if _, ok := mirror[odrDesc]; !ok {
+			t.Errorf("order %v is missing from the mirror",
+				odrDesc.Hash())
+		}
+	}
+}
+
+// TestOrderBook ensures the order book is aggregated into price levels grouped
+// by the price tick and limited by the depth and the number of levels.
+func TestOrderBook(t *testing.T) {
+	t.Parallel()
+
+	ob := NewMemBook(&Config{})
+	addOrders := func(bid bool, prices ...float64) {
+		for _, price := range prices {
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{
+				Index: uint32(len(ob.book)),
+			}, nil, nil))
+			odrDesc := newTestOdrDesc(bid, 1e8, int64(price*1e8))
+			odrDesc.Odr = chainutil.NewOdrFromTx(chainutil.NewTx(msgTx))
+			ob.addOrder(odrDesc)
+		}
+	}
+	addOrders(true, 2, 1.75, 1.6, 1)
+	addOrders(false, 2.25, 2.5, 3.2)
+
+	type level struct {
+		price float64
+		count int
+	}
+	tests := []struct {
+		name  string
+		depth float64
+		tick  float64
+		limit int
+		bids  []level
+		asks  []level
+	}{
+		{
+			name: "all levels",
+			bids: []level{{2, 1}, {1.75, 1}, {1.6, 1}, {1, 1}},
+			asks: []level{{2.25, 1}, {2.5, 1}, {3.2, 1}},
+		},
+		{
+			name: "grouped by tick",
+			tick: 0.5,
+			bids: []level{{2, 1}, {1.5, 2}, {1, 1}},
+			asks: []level{{2.5, 2}, {3.5, 1}},
+		},
+		{
+			name:  "limited levels",
+			tick:  0.5,
+			limit: 1,
+			bids:  []level{{2, 1}},
+			asks:  []level{{2.5, 2}},
+		},
+		{
+			name:  "limited depth",
+			depth: 1.5,
+			tick:  0.5,
+			bids:  []level{{2, 1}, {1.5, 2}},
+			asks:  []level{{2.5, 2}},
+		},
+	}
+
+	checkLevels := func(name, side string, got []chainjson.OrderBookLevelResult, want []level) {
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d %s levels, want %d", name, len(got),
+				side, len(want))
+			return
+		}
+		for i, l := range got {
+			if l.Price != want[i].price || l.Count != want[i].count ||
+				l.Amount != float64(l.Count) || len(l.Orders) != l.Count {
+				t.Errorf("%s: %s level #%d is %+v, want price %v "+
+					"with %d orders", name, side, i, l,
+					want[i].price, want[i].count)
+			}
+		}
+	}
+	for _, test := range tests {
+		result := ob.OrderBook(test.depth, test.tick, test.limit, true)
+		checkLevels(test.name, "bid", result.Bids, test.bids)
+		checkLevels(test.name, "ask", result.Asks, test.asks)
+	}
+
+	// The best prices are not grouped, and the orders of the levels are
+	// only included when verbose.
+	result := ob.OrderBook(0, 0.5, 0, false)
+	if *result.BestBid != 2 || *result.BestAsk != 2.25 ||
+		*result.Spread != 0.25 || *result.Mid != 2.125 {
+		t.Errorf("unexpected best prices %v %v, spread %v, mid %v",
+			*result.BestBid, *result.BestAsk, *result.Spread,
+			*result.Mid)
+	}
+	if result.Bids[0].Orders != nil {
+		t.Errorf("orders included without verbose")
+	}
+
+	// The spread and mid price are only set when both sides have orders.
+	result = NewMemBook(&Config{}).OrderBook(0, 0, 0, false)
+	if result.BestBid != nil || result.BestAsk != nil ||
+		result.Spread != nil || result.Mid != nil {
+		t.Errorf("unexpected best prices for an empty book")
+	}
+}
+
+// TestExpireOrders ensures orders are removed from the book once the block
+// height reaches their expiry, and only then.
+func TestExpireOrders(t *testing.T) {
+	t.Parallel()
+
+	ob := NewMemBook(&Config{Policy: Policy{MaxOrderAge: 10}})
+	var orders []*OdrDesc
+	for i, height := range []int32{100, 101, 101, 105} {
+		odrDesc := newTestBookOrder(uint32(i), true, 900)
+		odrDesc.Expiry = ob.newOdrDesc(odrDesc.Odr, 0, 0, height).Expiry
+		orders = append(orders, ob.addOrder(odrDesc))
+	}
+
+	// Orders which never expire stay in the book.
+	forever := newTestBookOrder(4, false, 1100)
+	ob.addOrder(forever)
+
+	// Removing an order also removes it from the expiry index.
+	ob.RemoveOrder(orders[1].Odr)
+
+	tests := []struct {
+		height int32
+		want   []*OdrDesc
+	}{
+		{height: 109},
+		{height: 110, want: orders[:1]},
+		{height: 110},
+		{height: 114, want: orders[2:3]},
+		{height: 200, want: orders[3:]},
+	}
+	for _, test := range tests {
+		expired := ob.ExpireOrders(test.height)
+		if len(expired) != len(test.want) {
+			t.Errorf("height %d: got %d expired orders, want %d",
+				test.height, len(expired), len(test.want))
+			continue
+		}
+		for i, odrDesc := range expired {
+			if odrDesc != test.want[i] || ob.HaveOrder(odrDesc.Hash()) {
+				t.Errorf("height %d: unexpected expired order %v",
+					test.height, odrDesc.Hash())
+			}
+		}
+	}
+	if ob.Count() != 1 || !ob.HaveOrder(forever.Hash()) {
+		t.Errorf("got %d orders left, want only the one without expiry",
+			ob.Count())
+	}
+
+	// An order added at an expiry height which was already swept is
+	// still expired.
+	late := newTestBookOrder(5, true, 900)
+	late.Expiry = 110
+	ob.addOrder(late)
+	expired := ob.ExpireOrders(200)
+	if len(expired) != 1 || expired[0] != late {
+		t.Errorf("got expired orders %v, want the late order", expired)
+	}
+}
+
+// TestLimitBookSize ensures a full book evicts its lowest priority order, the
+// worst priced one of the longer side, and rejects an order which would have
+// the lowest priority itself.
+func TestLimitBookSize(t *testing.T) {
+	t.Parallel()
+
+	ob := NewMemBook(&Config{Policy: Policy{MaxBookSize: 3}})
+	worst := ob.addOrder(newTestBookOrder(0, true, 900))
+	better := ob.addOrder(newTestBookOrder(1, true, 950))
+	ask := ob.addOrder(newTestBookOrder(2, false, 1100))
+
+	// A bid worse than every bid of the longer side is rejected.
+	err := ob.limitBookSize(newTestBookOrder(3, true, 800))
+	if rerr, ok := err.(RuleError); !ok {
+		t.Fatalf("worse bid: got error %v, want a rule error", err)
+	} else if txErr, ok := rerr.Err.(TxRuleError); !ok ||
+		txErr.RejectCode != wire.RejectInsufficientFee {
+		t.Fatalf("worse bid: got error %v, want an insufficient fee "+
+			"rejection", err)
+	}
+	if ob.Count() != 3 {
+		t.Fatalf("worse bid: got %d orders, want 3", ob.Count())
+	}
+
+	// An ask evicts the worst bid, since the bids are the longer side.
+	if err := ob.limitBookSize(newTestBookOrder(3, false, 1200)); err != nil {
+		t.Fatalf("ask: unexpected error: %v", err)
+	}
+	if ob.Count() != 2 || ob.HaveOrder(worst.Hash()) ||
+		!ob.HaveOrder(better.Hash()) || !ob.HaveOrder(ask.Hash()) {
+		t.Fatalf("ask: the worst bid was not the only order evicted")
+	}
+
+	// The book is not limited without a maximum size.
+	ob = NewMemBook(&Config{})
+	for i := uint32(0); i < 3; i++ {
+		ob.addOrder(newTestBookOrder(i, true, 900))
+	}
+	if err := ob.limitBookSize(newTestBookOrder(3, true, 800)); err != nil ||
+		ob.Count() != 3 {
+		t.Fatalf("unlimited: got error %v with %d orders", err,
+			ob.Count())
+	}
+}
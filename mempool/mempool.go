@@ -95,6 +95,12 @@ type Config struct {
 	// FeeEstimatator provides a feeEstimator. If it is not nil, the mempool
 	// records all new transactions it observes into the feeEstimator.
 	FeeEstimator *FeeEstimator
+
+	// OnBookDelta defines the function invoked with every change to the
+	// order book, in the order of their sequence numbers.  It is called
+	// with the book lock held, so it must not block nor call back into the
+	// book.  This can be nil if the changes are not of interest.
+	OnBookDelta func(*BookDelta)
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -135,6 +141,33 @@ type Policy struct {
 	// MinRelayTxPrice defines the minimum transaction fee in Coin/kB to be
 	// considered a non-zero fee.
 	MinRelayTxPrice types.PriceReq
+
+	// DynamicMinRelayTxPrice, when not nil, provides the MinRelayTxPrice
+	// to use instead, which follows the price of the tokens.
+	DynamicMinRelayTxPrice *mining.DynamicPriceReq
+
+	// MaxOrderAge is the number of blocks an order is allowed to rest in
+	// the order book before it expires.  Zero disables order expiry.
+	MaxOrderAge int32
+
+	// MaxBookSize is the maximum number of orders allowed to rest in the
+	// order book.  The lowest priority orders are evicted when the limit
+	// is reached.  Zero means no limit.
+	MaxBookSize int
+
+	// MinPriceImprovement is the minimum price improvement, as a fraction
+	// of the price, an order must offer over every resting order it
+	// replaces.
+	MinPriceImprovement float64
+}
+
+// RelayTxPrice returns the minimum transaction fee in effect, either the
+// dynamic or the static one.
+func (p *Policy) RelayTxPrice() types.PriceReq {
+	if p.DynamicMinRelayTxPrice != nil {
+		return p.DynamicMinRelayTxPrice.PriceReq()
+	}
+	return p.MinRelayTxPrice
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -701,7 +734,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *chainutil.Tx, isNew, rateLimit, rej
 	// forbid their acceptance.
 	if !mp.cfg.Policy.AcceptNonStd {
 		err = checkTransactionStandard(tx, nextBlockHeight,
-			medianTimePast, mp.cfg.Policy.MinRelayTxPrice,
+			medianTimePast, mp.cfg.Policy.RelayTxPrice(),
 			mp.cfg.Policy.MaxTxVersion)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
@@ -803,7 +836,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *chainutil.Tx, isNew, rateLimit, rej
 		return nil, nil, err
 	}
 
-	if balances.Amount(types.Token1) > 0 || balances.Amount(types.Token0) > 0 {
+	if blockchain.IsOrderBalance(balances) {
 		// it's an Order, wrong function to call
 		return nil, nil, txRuleError(wire.RejectInvalid,
 			"object is an order, not a transaction")
@@ -867,7 +900,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *chainutil.Tx, isNew, rateLimit, rej
 	// high-priority transactions, don't require a fee for it.
 	serializedSize := GetTxVirtualSize(tx)
 	minFee := calcMinRequiredTxRelayFee(serializedSize,
-		mp.cfg.Policy.MinRelayTxPrice)
+		mp.cfg.Policy.RelayTxPrice())
 	if serializedSize >= (DefaultBlockPrioritySize-1000) && !txFee.Cover(minFee.Balance()) {
 		str := fmt.Sprintf("transaction %v has %d fees which is under "+
 			"the required amount of %d", txHash, txFee,
@@ -1120,6 +1153,14 @@ func (mp *TxPool) ProcessTransaction(tx *chainutil.Tx, allowOrphan, rateLimit bo
 	return nil, err
 }
 
+// RelayPolicy returns the policy of the pool, such as the minimum transaction
+// fee in effect.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RelayPolicy() *Policy {
+	return &mp.cfg.Policy
+}
+
 // Count returns the number of transactions in the main pool.  It does not
 // include the orphan pool.
 //
@@ -0,0 +1,249 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"container/list"
+	"math/rand"
+	"time"
+
+	"github.com/endurio/ndrd/types"
+)
+
+const (
+	// maxLevelHeight is the maximum number of forward links of a price
+	// level in the skiplist of an order side.  It allows for efficient
+	// lookups in sides with well over a million distinct prices.
+	maxLevelHeight = 24
+
+	// levelHeightProbability is the inverse of the probability for a price
+	// level to be linked at the next height of the skiplist.
+	levelHeightProbability = 4
+)
+
+// PriceLevel describes all of the orders of one side of the book which rest
+// at the same price.
+type PriceLevel struct {
+	// Price is the price shared by all orders of the level.
+	Price float64
+
+	// Amount is the total NDR bought or sold by the orders of the level.
+	Amount types.Amount
+
+	// Payout is the total STB spent or received by the orders of the
+	// level.
+	Payout types.Amount
+
+	// Count is the number of orders resting at the level.
+	Count int
+}
+
+// bookLevel houses the orders of one side of the book resting at the same
+// price in their time priority, along with their aggregated amounts.  It is
+// also a node of the skiplist which indexes the price levels of the side.
+type bookLevel struct {
+	PriceLevel
+
+	// orders holds the *OdrDesc of the level, earliest arrival first.
+	orders *list.List
+
+	// forward holds the links to the next price levels of the side, one
+	// for each height of the skiplist the level is linked at.
+	forward []*bookLevel
+}
+
+// next returns the price level after the level in priority order, or nil
+// when it is the worst priced level of its side.
+func (l *bookLevel) next() *bookLevel {
+	return l.forward[0]
+}
+
+// orderSide is one side of the order book.  Its price levels are indexed by a
+// skiplist sorted from the best price to the worst, so inserting and removing
+// an order only takes logarithmic time in the number of price levels.
+//
+// Orders of the same price are kept in the order of their arrival sequence,
+// which makes the time priority within a price level deterministic and
+// independent from the wall clock.
+type orderSide struct {
+	bid    bool
+	head   bookLevel
+	height int
+	levels int
+	count  int
+	seq    uint64
+	rand   *rand.Rand
+}
+
+// newOrderSide returns a new empty side of the order book.
+func newOrderSide(bid bool) *orderSide {
+	return &orderSide{
+		bid:    bid,
+		head:   bookLevel{forward: make([]*bookLevel, maxLevelHeight)},
+		height: 1,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// better returns whether or not the price a has a higher priority than the
+// price b on the side.  Bids with higher prices come first, while asks with
+// lower prices come first.
+func (s *orderSide) better(a, b float64) bool {
+	if s.bid {
+		return a > b
+	}
+	return a < b
+}
+
+// randomHeight returns the number of skiplist heights a new price level is
+// linked at.
+func (s *orderSide) randomHeight() int {
+	height := 1
+	for height < maxLevelHeight && s.rand.Intn(levelHeightProbability) == 0 {
+		height++
+	}
+	return height
+}
+
+// findLevel returns the price level with the passed price along with the last
+// level before the price at every height of the skiplist.  The returned level
+// is nil when no order of the side rests at the price.
+func (s *orderSide) findLevel(price float64, update []*bookLevel) *bookLevel {
+	x := &s.head
+	for i := s.height - 1; i >= 0; i-- {
+		for x.forward[i] != nil && s.better(x.forward[i].Price, price) {
+			x = x.forward[i]
+		}
+		if update != nil {
+			update[i] = x
+		}
+	}
+	x = x.forward[0]
+	if x != nil && x.Price == price {
+		return x
+	}
+	return nil
+}
+
+// insert adds the passed order after all orders of the side with the same or
+// a better price.  The order must not already be in the side.
+func (s *orderSide) insert(odrDesc *OdrDesc) {
+	price := odrDesc.Price()
+	var update [maxLevelHeight]*bookLevel
+	level := s.findLevel(price, update[:])
+	if level == nil {
+		height := s.randomHeight()
+		for i := s.height; i < height; i++ {
+			update[i] = &s.head
+		}
+		if height > s.height {
+			s.height = height
+		}
+
+		level = &bookLevel{
+			PriceLevel: PriceLevel{Price: price},
+			orders:     list.New(),
+			forward:    make([]*bookLevel, height),
+		}
+		for i := 0; i < height; i++ {
+			level.forward[i] = update[i].forward[i]
+			update[i].forward[i] = level
+		}
+		s.levels++
+	}
+
+	s.seq++
+	odrDesc.seq = s.seq
+	odrDesc.level = level
+	odrDesc.element = level.orders.PushBack(odrDesc)
+	level.Amount += odrDesc.Amount
+	level.Payout += odrDesc.Payout
+	level.Count++
+	s.count++
+}
+
+// remove removes the passed order from the side, along with its price level
+// when no other order rests at the same price.
+func (s *orderSide) remove(odrDesc *OdrDesc) {
+	level := odrDesc.level
+	if level == nil {
+		return
+	}
+	level.orders.Remove(odrDesc.element)
+	level.Amount -= odrDesc.Amount
+	level.Payout -= odrDesc.Payout
+	level.Count--
+	odrDesc.level = nil
+	odrDesc.element = nil
+	s.count--
+
+	if level.Count > 0 {
+		return
+	}
+
+	var update [maxLevelHeight]*bookLevel
+	s.findLevel(level.Price, update[:])
+	for i := 0; i < len(level.forward); i++ {
+		if update[i].forward[i] != level {
+			break
+		}
+		update[i].forward[i] = level.forward[i]
+	}
+	for s.height > 1 && s.head.forward[s.height-1] == nil {
+		s.height--
+	}
+	s.levels--
+}
+
+// front returns the best priced level of the side, or nil when it is empty.
+func (s *orderSide) front() *bookLevel {
+	return s.head.forward[0]
+}
+
+// back returns the worst priced level of the side, or nil when it is empty.
+func (s *orderSide) back() *bookLevel {
+	x := &s.head
+	for i := s.height - 1; i >= 0; i-- {
+		for x.forward[i] != nil {
+			x = x.forward[i]
+		}
+	}
+	if x == &s.head {
+		return nil
+	}
+	return x
+}
+
+// Len returns the number of orders in the side.
+func (s *orderSide) Len() int {
+	return s.count
+}
+
+// forEach calls the passed function with every order of the side in priority
+// order, from the best priced one down, until the function returns false.
+func (s *orderSide) forEach(f func(odrDesc *OdrDesc) bool) {
+	for level := s.front(); level != nil; level = level.next() {
+		for e := level.orders.Front(); e != nil; e = e.Next() {
+			if !f(e.Value.(*OdrDesc)) {
+				return
+			}
+		}
+	}
+}
+
+// priceLevels returns the aggregated price levels of the side from the best
+// priced one down.  At most maxLevels levels are returned when it is greater
+// than zero.
+func (s *orderSide) priceLevels(maxLevels int) []PriceLevel {
+	count := s.levels
+	if maxLevels > 0 && maxLevels < count {
+		count = maxLevels
+	}
+	result := make([]PriceLevel, 0, count)
+	for level := s.front(); level != nil && len(result) < count; level = level.next() {
+		result = append(result, level.PriceLevel)
+	}
+	return result
+}
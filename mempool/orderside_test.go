@@ -0,0 +1,270 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"container/list"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/endurio/ndrd/mining"
+	"github.com/endurio/ndrd/types"
+)
+
+// newTestOdrDesc returns an order descriptor which is only usable for the
+// order side operations.
+func newTestOdrDesc(bid bool, amount, payout int64) *OdrDesc {
+	return &OdrDesc{
+		OdrDesc: mining.OdrDesc{
+			Bid:    bid,
+			Amount: types.Amount(amount),
+			Payout: types.Amount(payout),
+		},
+	}
+}
+
+// TestOrderSide ensures the order sides keep their orders sorted by price then
+// by arrival, and aggregate them by price level.
+func TestOrderSide(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		bid    bool
+		prices []int64   // payout of the orders added with amount 1
+		remove []int     // indexes of the orders removed after adding
+		want   []int     // indexes of the remaining orders in priority
+		levels []float64 // prices of the remaining price levels
+	}{
+		{
+			name:   "bids best price first",
+			bid:    true,
+			prices: []int64{3, 5, 4, 5, 3},
+			want:   []int{1, 3, 2, 0, 4},
+			levels: []float64{5, 4, 3},
+		},
+		{
+			name:   "asks best price first",
+			bid:    false,
+			prices: []int64{3, 5, 4, 5, 3},
+			want:   []int{0, 4, 2, 1, 3},
+			levels: []float64{3, 4, 5},
+		},
+		{
+			name:   "remove keeps time priority",
+			bid:    false,
+			prices: []int64{2, 2, 2, 1},
+			remove: []int{1},
+			want:   []int{3, 0, 2},
+			levels: []float64{1, 2},
+		},
+		{
+			name:   "remove last order of a level",
+			bid:    true,
+			prices: []int64{2, 1, 3},
+			remove: []int{0},
+			want:   []int{2, 1},
+			levels: []float64{3, 1},
+		},
+		{
+			name:   "remove all",
+			bid:    true,
+			prices: []int64{1, 1},
+			remove: []int{0, 1},
+			want:   nil,
+			levels: nil,
+		},
+	}
+
+	for _, test := range tests {
+		side := newOrderSide(test.bid)
+		descs := make([]*OdrDesc, len(test.prices))
+		index := make(map[*OdrDesc]int)
+		for i, price := range test.prices {
+			descs[i] = newTestOdrDesc(test.bid, 1, price)
+			index[descs[i]] = i
+			side.insert(descs[i])
+		}
+		for _, i := range test.remove {
+			side.remove(descs[i])
+		}
+
+		var got []int
+		side.forEach(func(odrDesc *OdrDesc) bool {
+			got = append(got, index[odrDesc])
+			return true
+		})
+		if len(got) != len(test.want) || side.Len() != len(test.want) {
+			t.Errorf("%s: got orders %v (len %d), want %v", test.name,
+				got, side.Len(), test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got orders %v, want %v", test.name,
+					got, test.want)
+				break
+			}
+		}
+
+		levels := side.priceLevels(0)
+		if len(levels) != len(test.levels) {
+			t.Errorf("%s: got %d price levels, want %d", test.name,
+				len(levels), len(test.levels))
+			continue
+		}
+		for i, level := range levels {
+			if level.Price != test.levels[i] {
+				t.Errorf("%s: level %d has price %v, want %v",
+					test.name, i, level.Price, test.levels[i])
+			}
+			wantAmount := types.Amount(level.Count)
+			if level.Amount != wantAmount ||
+				level.Payout != wantAmount*types.Amount(level.Price) {
+
+				t.Errorf("%s: level %d has amount %v and payout "+
+					"%v for %d orders", test.name, i,
+					level.Amount, level.Payout, level.Count)
+			}
+		}
+	}
+}
+
+// TestOrderSideRandom ensures the order side stays sorted with many orders
+// added and removed in a random order.
+func TestOrderSideRandom(t *testing.T) {
+	t.Parallel()
+
+	r := rand.New(rand.NewSource(1))
+	side := newOrderSide(false)
+	var descs []*OdrDesc
+	for i := 0; i < 2000; i++ {
+		desc := newTestOdrDesc(false, 1, r.Int63n(100)+1)
+		side.insert(desc)
+		descs = append(descs, desc)
+
+		// Remove an existing order every third insert.
+		if i%3 == 2 {
+			j := r.Intn(len(descs))
+			side.remove(descs[j])
+			descs = append(descs[:j], descs[j+1:]...)
+		}
+	}
+
+	var prev *OdrDesc
+	count := 0
+	side.forEach(func(odrDesc *OdrDesc) bool {
+		if prev != nil && worseOrder(prev, odrDesc) {
+			t.Fatalf("order with price %v and sequence %d comes "+
+				"before order with price %v and sequence %d",
+				prev.Price(), prev.seq, odrDesc.Price(),
+				odrDesc.seq)
+		}
+		prev = odrDesc
+		count++
+		return true
+	})
+	if count != len(descs) || side.Len() != len(descs) {
+		t.Fatalf("got %d orders (len %d), want %d", count, side.Len(),
+			len(descs))
+	}
+	if back := side.back(); back == nil ||
+		back.orders.Back().Value.(*OdrDesc) != prev {
+
+		t.Fatal("back does not return the worst priced level")
+	}
+}
+
+// insertOrderList inserts the order into the sorted linked list the way the
+// order book used to, which takes linear time in the number of orders.
+func insertOrderList(orders *list.List, orderDesc *OdrDesc) *list.Element {
+	price := orderDesc.Price()
+	e := orders.Front()
+	for ; e != nil; e = e.Next() {
+		if orderDesc.Bid {
+			if price > e.Value.(*OdrDesc).Price() {
+				break
+			}
+		} else {
+			if price < e.Value.(*OdrDesc).Price() {
+				break
+			}
+		}
+	}
+	if e == nil {
+		return orders.PushBack(orderDesc)
+	}
+	return orders.InsertBefore(orderDesc, e)
+}
+
+// benchmarkOrders returns the passed number of bid descriptors with random
+// prices.
+func benchmarkOrders(count int) []*OdrDesc {
+	r := rand.New(rand.NewSource(1))
+	descs := make([]*OdrDesc, count)
+	for i := range descs {
+		descs[i] = newTestOdrDesc(true, 1000, r.Int63n(1000000)+1)
+	}
+	return descs
+}
+
+// benchmarkOrderList measures inserting and removing an order in a linked list
+// book which already holds the passed number of orders.
+func benchmarkOrderList(b *testing.B, size int) {
+	descs := benchmarkOrders(size + 1)
+
+	// Sort the initial orders up front, since filling the list one
+	// insert at a time would take quadratic time.
+	initial := append([]*OdrDesc(nil), descs[:size]...)
+	sort.Slice(initial, func(i, j int) bool {
+		return initial[i].Price() > initial[j].Price()
+	})
+	orders := list.New()
+	for _, desc := range initial {
+		orders.PushBack(desc)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		orders.Remove(insertOrderList(orders, descs[size]))
+	}
+}
+
+// benchmarkOrderSide measures inserting and removing an order in an order side
+// which already holds the passed number of orders.
+func benchmarkOrderSide(b *testing.B, size int) {
+	descs := benchmarkOrders(size + 1)
+	side := newOrderSide(true)
+	for _, desc := range descs[:size] {
+		side.insert(desc)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		side.insert(descs[size])
+		side.remove(descs[size])
+	}
+}
+
+// BenchmarkOrderList10k benchmarks the linked list book with 10k orders.
+func BenchmarkOrderList10k(b *testing.B) {
+	benchmarkOrderList(b, 10000)
+}
+
+// BenchmarkOrderList100k benchmarks the linked list book with 100k orders.
+func BenchmarkOrderList100k(b *testing.B) {
+	benchmarkOrderList(b, 100000)
+}
+
+// BenchmarkOrderSide10k benchmarks the price indexed book with 10k orders.
+func BenchmarkOrderSide10k(b *testing.B) {
+	benchmarkOrderSide(b, 10000)
+}
+
+// BenchmarkOrderSide100k benchmarks the price indexed book with 100k orders.
+func BenchmarkOrderSide100k(b *testing.B) {
+	benchmarkOrderSide(b, 100000)
+}
@@ -100,6 +100,11 @@ type OdrDesc struct {
 
 	// Payout is the total STB will be spent by the order associated with the entry.
 	Payout types.Amount
+
+	// Unfilled is the amount of the token bought by the order which is
+	// left unfilled when the order is only filled partially.  Zero means
+	// the order is filled completely.
+	Unfilled types.Amount
 }
 
 // OdrSource represents a source of orders to consider for inclusion in
@@ -115,7 +120,7 @@ type OdrSource interface {
 	// MiningDescs returns a slice of mining descriptors for all the
 	// orders in the source pool to fill the provided amount.
 	// Positive amount returns bidding orders. Negative amount returns
-	// asking order.
+	// asking order.  Only the last order may be filled partially.
 	MiningDescs(amount *big.Int) []*OdrDesc
 
 	// HaveOrder returns whether or not the passed order hash
@@ -211,7 +216,7 @@ func txPQByPriority(pq *txPriorityQueue, i, j int) bool {
 func txPQByFee(pq *txPriorityQueue, i, j int) bool {
 	// Using > here so that pop gives the highest fee item as opposed
 	// to the lowest.  Sort by fee first, then priority.
-	if pq.items[i].feePerKB == pq.items[j].feePerKB {
+	if pq.items[i].feePerKB.Balance().Equal(pq.items[j].feePerKB.Balance()) {
 		return pq.items[i].priority > pq.items[j].priority
 	}
 	return pq.items[i].feePerKB.Rate(pq.minPrice) > pq.items[j].feePerKB.Rate(pq.minPrice)
@@ -547,6 +552,22 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress chainutil.Address) (*Bl
 		queueLen += len(sourceOdrs)
 	}
 
+	// The order at the absorption boundary may only be filled partially,
+	// and is added as the last transaction of the block once partial fills
+	// have been activated.  It is left out of the block otherwise.
+	partialFillState, err := g.chain.ThresholdState(
+		chaincfg.DeploymentPartialFill)
+	if err != nil {
+		return nil, err
+	}
+	var partialOdr *OdrDesc
+	if n := len(sourceOdrs); n > 0 && sourceOdrs[n-1].Unfilled > 0 {
+		if partialFillState == blockchain.ThresholdActive {
+			partialOdr = sourceOdrs[n-1]
+		}
+		sourceOdrs = sourceOdrs[:n-1]
+	}
+
 	// Get the current source transactions and create a priority queue to
 	// hold the transactions which are ready for inclusion into a block
 	// along with some priority related and fee metadata.  Reserve the same
@@ -558,6 +579,11 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress chainutil.Address) (*Bl
 	queueLen += len(sourceTxns)
 	priorityQueue := newTxPriorityQueue(queueLen, sortedByFee)
 
+	// The fees are compared with the minimum price in effect when the
+	// template is created, which may change along with the token prices.
+	minFreePrice := g.policy.MinFreePrice()
+	priorityQueue.minPrice = minFreePrice
+
 	// Create a slice to hold the transactions to be included in the
 	// generated block with reserved space.  Also create a utxo view to
 	// house all of the input transactions so multiple lookups can be
@@ -791,13 +817,13 @@ mempoolLoop:
 		// Skip free transactions once the block is larger than the
 		// minimum block size.
 		if sortedByFee &&
-			prioItem.feePerKB.Rate(g.policy.TxMinFreePrice) < 0 &&
+			prioItem.feePerKB.Rate(minFreePrice) < 0 &&
 			blockPlusTxWeight >= g.policy.BlockMinWeight {
 
 			log.Tracef("Skipping tx %s with feePerKB %v "+
 				"< TxMinFreePrice %v and block weight %v >= "+
 				"minBlockWeight %v", tx.Hash(), prioItem.feePerKB,
-				g.policy.TxMinFreePrice, blockPlusTxWeight,
+				minFreePrice, blockPlusTxWeight,
 				g.policy.BlockMinWeight)
 			logSkippedDeps(tx, deps)
 			continue
@@ -843,33 +869,11 @@ mempoolLoop:
 			continue
 		}
 
-		balanceSTB := balances.Amount(types.Token1)
-		if balanceSTB > 0 || balances.Amount(types.Token0) > 0 {
-			absnSign := absorption.Sign()
-			if absorption == nil || absnSign == 0 {
-				return nil, blockchain.RuleError{
-					ErrorCode:   blockchain.ErrBadAbsorption,
-					Description: "Order cannot be mined when there is no absorption.",
-				}
-			}
-			if (absnSign > 0) != (balanceSTB > 0) {
-				return nil, blockchain.RuleError{
-					ErrorCode:   blockchain.ErrBadAbsorption,
-					Description: "Wrong order direction to mine.",
-				}
-			}
-			if (balanceSTB > 0) == (balances.Amount(types.Token0) > 0) {
-				return nil, blockchain.RuleError{
-					ErrorCode:   blockchain.ErrBadAbsorption,
-					Description: "Invalid order: one token must be exchanged for the other.",
-				}
-			}
-			accAbsorption.Add(accAbsorption, balanceSTB.BigInt())
-			if accAbsorption.Cmp(absorption) == absnSign {
-				return nil, blockchain.RuleError{
-					ErrorCode:   blockchain.ErrBadAbsorption,
-					Description: "Over absorbed.",
-				}
+		if blockchain.IsOrderBalance(balances) {
+			err := blockchain.CheckOrderAbsorption(balances,
+				absorption, accAbsorption)
+			if err != nil {
+				return nil, err
 			}
 		}
 
@@ -915,6 +919,44 @@ mempoolLoop:
 		}
 	}
 
+	// Fill the order at the absorption boundary partially with what is left
+	// of the absorption.  It is the last transaction of the block, and the
+	// coinbase commits to its unfilled amount.
+	if partialOdr != nil {
+		fill, sigOpCost, err := g.partialFill(partialOdr,
+			nextBlockHeight, blockUtxos, absorption, accAbsorption,
+			segwitActive)
+		if err != nil {
+			log.Debugf("Unable to fill order %v partially: %v",
+				partialOdr.Hash(), err)
+		} else {
+			commitmentOutput := &wire.TxOut{
+				Value:    types.ValueEmpty,
+				PkScript: blockchain.PartialFillScript(partialOdr.Unfilled),
+			}
+			txWeight := uint32(blockchain.GetTransactionWeight(fill) +
+				int64(commitmentOutput.SerializeSize()*
+					blockchain.WitnessScaleFactor))
+			blockPlusTxWeight := blockWeight + txWeight
+			if blockPlusTxWeight >= blockWeight &&
+				blockPlusTxWeight < g.policy.BlockMaxWeight &&
+				blockSigOpCost+sigOpCost <= blockchain.MaxBlockSigOpsCost {
+
+				coinbaseTx.MsgTx().AddTxOut(commitmentOutput)
+				spendTransaction(blockUtxos, fill, nextBlockHeight)
+				blockTxns = append(blockTxns, fill)
+				blockWeight = blockPlusTxWeight
+				blockSigOpCost += sigOpCost
+				txFees = append(txFees, types.Fee{})
+				txSigOpCosts = append(txSigOpCosts, sigOpCost)
+
+				log.Debugf("Filling order %v partially, leaving "+
+					"%v unfilled", partialOdr.Hash(),
+					partialOdr.Unfilled)
+			}
+		}
+	}
+
 	// Now that the actual transactions have been selected, update the
 	// block weight for the real transaction count and coinbase value with
 	// the total fees accordingly.
@@ -981,6 +1023,10 @@ mempoolLoop:
 		return nil, err
 	}
 
+	// Encode the price to mine for the header of the next block.
+	priceDerivation := blockchain.HeaderPriceDerivation(
+		g.priceSource.PriceToMine(), nextBlockHeight, g.chainParams)
+
 	// Create a new block ready to be solved.
 	merkles := blockchain.BuildMerkleTreeStore(blockTxns, false)
 	var msgBlock wire.MsgBlock
@@ -990,7 +1036,7 @@ mempoolLoop:
 		MerkleRoot:      *merkles[len(merkles)-1],
 		Timestamp:       ts,
 		Bits:            reqDifficulty,
-		PriceDerivation: float64(g.priceSource.PriceToMine()),
+		PriceDerivation: priceDerivation,
 	}
 	for _, tx := range blockTxns {
 		if err := msgBlock.AddTransaction(tx.MsgTx()); err != nil {
@@ -1109,6 +1155,78 @@ membookLoop:
 	}
 }
 
+// partialFill returns the transaction which fills the passed order partially
+// according to its unfilled amount, along with its signature operation cost.
+// The order must only spend outputs of the main chain which are not spent by
+// the other transactions of the block, and must fit into the absorption left.
+func (g *BlkTmplGenerator) partialFill(odrDesc *OdrDesc, nextBlockHeight int32,
+	blockUtxos *blockchain.UtxoViewpoint, absorption, accAbsorption *big.Int,
+	segwitActive bool) (*chainutil.Tx, int64, error) {
+
+	order := odrDesc.Tx
+	if order.HasWitness() {
+		return nil, 0, fmt.Errorf("orders with witness data are not " +
+			"filled partially")
+	}
+	if !blockchain.IsFinalizedTransaction(order, nextBlockHeight,
+		g.timeSource.AdjustedTime()) {
+
+		return nil, 0, fmt.Errorf("order is not finalized")
+	}
+
+	utxos, err := g.chain.FetchUtxoView(order)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, txIn := range order.MsgTx().TxIn {
+		entry := blockUtxos.LookupEntry(txIn.PreviousOutPoint)
+		if entry != nil && entry.IsSpent() {
+			return nil, 0, fmt.Errorf("output %v is spent by the "+
+				"block", txIn.PreviousOutPoint)
+		}
+	}
+
+	// The scripts of the original order are the ones validated by the
+	// consensus rules.
+	balances, err := blockchain.CheckTransactionInputs(order,
+		nextBlockHeight, utxos, g.chainParams)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = blockchain.ValidateTransactionScripts(order, utxos,
+		txscript.StandardVerifyFlags, g.sigCache, g.hashCache)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	changeScript := utxos.LookupEntry(order.MsgTx().TxIn[0].PreviousOutPoint).PkScript()
+	fillTx, err := blockchain.NewPartialFill(order.MsgTx(), balances,
+		changeScript, odrDesc.Unfilled)
+	if err != nil {
+		return nil, 0, err
+	}
+	fill := chainutil.NewTx(fillTx)
+
+	fillBalances, err := blockchain.CheckTransactionInputs(fill,
+		nextBlockHeight, utxos, g.chainParams)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = blockchain.CheckOrderAbsorption(fillBalances, absorption,
+		new(big.Int).Set(accAbsorption))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sigOpCost, err := blockchain.GetSigOpCost(fill, false, utxos, true,
+		segwitActive)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return fill, int64(sigOpCost), nil
+}
+
 // UpdateBlockTime updates the timestamp in the header of the passed block to
 // the current time while taking into account the median time of the last
 // several blocks to ensure the new time is after that time per the chain
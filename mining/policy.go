@@ -46,6 +46,19 @@ type Policy struct {
 	// required for a transaction to be treated as free for mining purposes
 	// (block template generation).
 	TxMinFreePrice types.PriceReq
+
+	// DynamicTxMinFreePrice, when not nil, provides the TxMinFreePrice to
+	// use instead, which follows the price of the tokens.
+	DynamicTxMinFreePrice *DynamicPriceReq
+}
+
+// MinFreePrice returns the minimum fee required for a transaction to be treated
+// as free in effect, either the dynamic or the static one.
+func (p *Policy) MinFreePrice() types.PriceReq {
+	if p.DynamicTxMinFreePrice != nil {
+		return p.DynamicTxMinFreePrice.PriceReq()
+	}
+	return p.TxMinFreePrice
 }
 
 // minInt is a helper function to return the minimum of two ints.  This avoids
@@ -0,0 +1,116 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/types"
+)
+
+// DynamicPriceReqConfig houses the configuration of a DynamicPriceReq.
+type DynamicPriceReqConfig struct {
+	// PriceReq is the configured price requirement, whose sides are worth
+	// the same when STB is at its peg.  Its Token1 side is kept as is, and
+	// its Token0 side is the reference the derived Token0 side is scaled
+	// from.  It is used as is until the first derivation.
+	PriceReq types.PriceReq
+
+	// MinAmount and MaxAmount bound the derived Token0 side, in atoms per
+	// kilobyte.
+	MinAmount types.Amount
+	MaxAmount types.Amount
+
+	// RefreshInterval is the minimum time between two derivations.
+	RefreshInterval time.Duration
+
+	// EpochPrice returns the median price derivation of STB/USD of the
+	// absorption epoch ending at the tip of the main chain, or NoPrice
+	// when there is none yet.
+	EpochPrice func() (blockchain.Price, error)
+}
+
+// DynamicPriceReq is a price requirement whose Token0 side is derived from
+// the median price of the last absorption epoch of the main chain, so that it
+// keeps the value of the Token1 side as STB moves away from its peg.  Since
+// the price is read from the chain, the derivation follows the reorganizations
+// and survives restarts.  It is safe for concurrent access.
+type DynamicPriceReq struct {
+	cfg DynamicPriceReqConfig
+	now func() time.Time
+
+	mtx       sync.Mutex
+	priceReq  types.PriceReq
+	rate      float64
+	refreshed time.Time
+}
+
+// NewDynamicPriceReq returns a new dynamic price requirement with the passed
+// configuration.
+func NewDynamicPriceReq(cfg *DynamicPriceReqConfig) *DynamicPriceReq {
+	return &DynamicPriceReq{
+		cfg:      *cfg,
+		now:      time.Now,
+		priceReq: cfg.PriceReq,
+	}
+}
+
+// refresh derives the Token0 side of the price requirement from the median
+// price of the last epoch, when there is one.  The configured Token0 side is
+// scaled by the value of STB relative to its peg, then bounded.
+//
+// This function MUST be called with the lock held.
+func (d *DynamicPriceReq) refresh(now time.Time) {
+	d.refreshed = now
+	price, err := d.cfg.EpochPrice()
+	if err != nil {
+		log.Warnf("Unable to derive the minimum transaction fee: %v", err)
+		return
+	}
+	if price == blockchain.NoPrice {
+		return
+	}
+
+	balance := d.cfg.PriceReq.Balance()
+	a0 := float64(balance.Amount(types.Token0)) * (1 + price.Float())
+	derived := d.cfg.MinAmount
+	switch {
+	case a0 >= float64(d.cfg.MaxAmount):
+		derived = d.cfg.MaxAmount
+	case a0 > float64(d.cfg.MinAmount):
+		derived = types.Amount(math.Round(a0))
+	}
+
+	priceReq := d.cfg.PriceReq
+	priceReq.Balance().SetAmount(types.Token0, derived)
+	d.priceReq = priceReq
+	d.rate = a0 / float64(balance.Amount(types.Token1))
+}
+
+// PriceReq returns the price requirement in effect, which is derived again
+// when the refresh interval has passed since the last derivation.
+func (d *DynamicPriceReq) PriceReq() types.PriceReq {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	now := d.now()
+	if now.Sub(d.refreshed) >= d.cfg.RefreshInterval {
+		d.refresh(now)
+	}
+	return d.priceReq
+}
+
+// Rate returns the price of one atom of Token1 in atoms of Token0 the price
+// requirement in effect was derived with, before the Token0 side is bounded,
+// and whether or not it was derived at all.
+func (d *DynamicPriceReq) Rate() (float64, bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return d.rate, d.rate != 0
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/types"
+)
+
+// TestDynamicPriceReq ensures the Token0 side of a dynamic price requirement
+// is derived with the median price of the last epoch, within its bounds, at
+// most once per refresh interval.
+func TestDynamicPriceReq(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	price := blockchain.NoPrice
+	var priceErr error
+	d := NewDynamicPriceReq(&DynamicPriceReqConfig{
+		PriceReq:        *types.NewPriceReq(1000, 500),
+		MinAmount:       100,
+		MaxAmount:       5000,
+		RefreshInterval: time.Minute,
+		EpochPrice: func() (blockchain.Price, error) {
+			return price, priceErr
+		},
+	})
+	d.now = func() time.Time { return now }
+
+	check := func(desc string, a0 types.Amount, rate float64) {
+		t.Helper()
+		priceReq := d.PriceReq()
+		if got := priceReq.Balance().Amount(types.Token0); got != a0 {
+			t.Errorf("%s: got Token0 side %v, want %v", desc, got, a0)
+		}
+		if got := priceReq.Balance().Amount(types.Token1); got != 500 {
+			t.Errorf("%s: got Token1 side %v, want 500", desc, got)
+		}
+		if got, _ := d.Rate(); got != rate {
+			t.Errorf("%s: got rate %v, want %v", desc, got, rate)
+		}
+	}
+
+	// The configured price requirement applies until the chain has an
+	// epoch price.
+	check("no price", 1000, 0)
+
+	// STB is 50% above its peg, but the price is only used after the
+	// refresh interval.
+	price = blockchain.PriceUnit / 2
+	check("before refresh", 1000, 0)
+	now = now.Add(time.Minute)
+	check("above peg", 1500, 3)
+
+	// The derived side is bounded.
+	price = 9 * blockchain.PriceUnit
+	now = now.Add(time.Minute)
+	check("max bound", 5000, 20)
+	price = -15 * blockchain.PriceUnit / 16
+	now = now.Add(time.Minute)
+	check("min bound", 100, 0.125)
+	price = -2 * blockchain.PriceUnit
+	now = now.Add(time.Minute)
+	check("negative value", 100, -2)
+
+	// The last derivation is kept when the chain has no epoch price, or
+	// fails to compute it.
+	price = blockchain.NoPrice
+	now = now.Add(time.Minute)
+	check("price gone", 100, -2)
+	price, priceErr = 0, errors.New("chain error")
+	now = now.Add(time.Minute)
+	check("chain error", 100, -2)
+	priceErr = nil
+	now = now.Add(time.Minute)
+	check("at peg", 1000, 2)
+}
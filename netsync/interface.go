@@ -30,6 +30,8 @@ type PeerNotifier interface {
 	TransactionConfirmed(tx *chainutil.Tx)
 
 	OrderFilled(odr *chainutil.Odr)
+
+	OrdersRemoved(orders []*mempool.OdrDesc)
 }
 
 // Config is a configuration struct used to initialize a new SyncManager.
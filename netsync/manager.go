@@ -15,11 +15,11 @@ import (
 	"github.com/endurio/ndrd/blockchain"
 	"github.com/endurio/ndrd/chaincfg"
 	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
 	"github.com/endurio/ndrd/database"
 	"github.com/endurio/ndrd/mempool"
 	"github.com/endurio/ndrd/mining"
 	peerpkg "github.com/endurio/ndrd/peer"
-	"github.com/endurio/ndrd/chainutil"
 	"github.com/endurio/ndrd/wire"
 )
 
@@ -44,6 +44,16 @@ const (
 	// maxRequestedOrders is the maximum number of requested orders
 	// hashes to store in memory.
 	maxRequestedOrders = wire.MaxInvPerMsg
+
+	// maxMemBookRequests is the maximum number of peers the order book is
+	// requested from once the chain is current.  The sync peer is always
+	// asked first.
+	maxMemBookRequests = 3
+
+	// memBookRequestInterval is the minimum amount of time in between two
+	// order book requests, so a burst of new peers does not result in a
+	// flood of order inventory.
+	memBookRequestInterval = time.Second * 30
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -146,6 +156,7 @@ type headerNode struct {
 // about a peer.
 type peerSyncState struct {
 	syncCandidate   bool
+	memBookAsked    bool
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedOrders map[chainhash.Hash]struct{}
@@ -178,6 +189,7 @@ type SyncManager struct {
 	requestedBlocks map[chainhash.Hash]struct{}
 	syncPeer        *peerpkg.Peer
 	peerStates      map[*peerpkg.Peer]*peerSyncState
+	lastMemBookReq  time.Time
 
 	// The following fields are used for headers-first mode.
 	headersFirstMode bool
@@ -385,6 +397,7 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 	sm.peerStates[peer] = &peerSyncState{
 		syncCandidate:   isSyncCandidate,
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
+		requestedOrders: make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
 	}
 
@@ -392,6 +405,70 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 	if isSyncCandidate && sm.syncPeer == nil {
 		sm.startSync()
 	}
+
+	// Ask the new peer for its order book when the chain is already
+	// current.
+	sm.requestMemBooks()
+}
+
+// canServeMemBook returns whether or not the peer is able to respond to an
+// order book request.  Peers only serve the order book when bloom filtering
+// is enabled, and they disconnect the ones asking otherwise.
+func canServeMemBook(peer *peerpkg.Peer) bool {
+	return peer.Services()&wire.SFNodeBloom == wire.SFNodeBloom &&
+		peer.ProtocolVersion() >= wire.BIP0035Version
+}
+
+// requestMemBooks asks up to maxMemBookRequests peers for the orders resting
+// in their order book, so the local book converges with the network instead of
+// depending on the relay of new orders only.  The sync peer is asked first.
+// Nothing is requested until the chain is current, because the orders can't be
+// validated against a stale utxo set, and requests are spaced out by
+// memBookRequestInterval.  The advertised orders are fetched by the regular
+// inventory handling.
+func (sm *SyncManager) requestMemBooks() {
+	if !sm.current() {
+		return
+	}
+	if time.Since(sm.lastMemBookReq) < memBookRequestInterval {
+		return
+	}
+
+	asked := 0
+	for _, state := range sm.peerStates {
+		if state.memBookAsked {
+			asked++
+		}
+	}
+	if asked >= maxMemBookRequests {
+		return
+	}
+
+	// Prefer the sync peer, then any other capable peer.
+	candidate := sm.syncPeer
+	if candidate != nil {
+		if state, exists := sm.peerStates[candidate]; !exists ||
+			state.memBookAsked || !canServeMemBook(candidate) {
+
+			candidate = nil
+		}
+	}
+	if candidate == nil {
+		for peer, state := range sm.peerStates {
+			if !state.memBookAsked && canServeMemBook(peer) {
+				candidate = peer
+				break
+			}
+		}
+	}
+	if candidate == nil {
+		return
+	}
+
+	log.Debugf("Requesting order book from peer %s", candidate)
+	sm.peerStates[candidate].memBookAsked = true
+	sm.lastMemBookReq = time.Now()
+	candidate.QueueMessage(wire.NewMsgMemBook(), nil)
 }
 
 // handleDonePeerMsg deals with peers that have signalled they are done.  It
@@ -416,6 +493,12 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 		delete(sm.requestedTxns, txHash)
 	}
 
+	// Remove requested orders from the global map so that they will
+	// be fetched from elsewhere next time we get an inv.
+	for odrHash := range state.requestedOrders {
+		delete(sm.requestedOrders, odrHash)
+	}
+
 	// Remove requested blocks from the global map so that they will be
 	// fetched from elsewhere next time we get an inv.
 	// TODO: we could possibly here check which peers have these blocks
@@ -535,7 +618,7 @@ func (sm *SyncManager) handleOrderMsg(omsg *orderMsg) {
 
 	// Process the transaction to include validation, insertion in the
 	// memory pool, orphan handling, etc.
-	acceptedOrder, err := sm.odrMemBook.ProcessOrder(omsg.order)
+	acceptedOrder, replaced, err := sm.odrMemBook.ProcessOrder(omsg.order)
 
 	// Remove transaction from request maps. Either the mempool/chain
 	// already knows about it and as such we shouldn't have any more
@@ -569,6 +652,11 @@ func (sm *SyncManager) handleOrderMsg(omsg *orderMsg) {
 		return
 	}
 
+	// The orders replaced by the accepted order are no longer in the book,
+	// while the replacement is relayed like any other new order.
+	if len(replaced) > 0 {
+		sm.peerNotifier.OrdersRemoved(replaced)
+	}
 	sm.peerNotifier.AnnounceNewOrders([]*mempool.OdrDesc{acceptedOrder})
 }
 
@@ -730,6 +818,10 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 		// Clear the rejected transactions.
 		sm.rejectedTxns = make(map[chainhash.Hash]struct{})
+
+		// Request the order books of the peers once the initial
+		// block download is done.
+		sm.requestMemBooks()
 	}
 
 	// Update the block height for this peer. But only send a message to
@@ -1131,6 +1223,12 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 				if _, exists := sm.rejectedOrders[iv.Hash]; exists {
 					continue
 				}
+
+				// Skip the order until the chain is current,
+				// since it can't be validated before that.
+				if !sm.current() {
+					continue
+				}
 			}
 
 			// Ignore invs block invs from non-witness enabled
@@ -1364,6 +1462,24 @@ out:
 	log.Trace("Block handler done")
 }
 
+// blockTransactions returns the transactions of the passed block the memory
+// pool and the order book are interested in.  Once partial fills are active for
+// the block, its partially filled order, if any, is replaced by the original
+// order it was derived from.  Before that, the block can't have any.
+func (sm *SyncManager) blockTransactions(block *chainutil.Block) []*chainutil.Tx {
+	active, err := sm.chain.IsDeploymentActiveAfter(
+		&block.MsgBlock().Header.PrevBlock, chaincfg.DeploymentPartialFill)
+	if err != nil {
+		log.Errorf("Unable to query the partial fill deployment of "+
+			"block %v: %v", block.Hash(), err)
+		return block.Transactions()
+	}
+	if !active {
+		return block.Transactions()
+	}
+	return blockchain.RestorePartialFills(block)
+}
+
 // handleBlockchainNotification handles notifications from blockchain.  It does
 // things such as request orphan block parents and relay accepted blocks to
 // connected peers.
@@ -1402,8 +1518,9 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 		// new transactions.  Finally, remove any transaction that is
 		// no longer an orphan. Transactions which depend on a confirmed
 		// transaction are NOT removed recursively because they are still
-		// valid.
-		for _, tx := range block.Transactions()[1:] {
+		// valid.  A partially filled order is handled as the original
+		// order it was derived from.
+		for _, tx := range sm.blockTransactions(block)[1:] {
 			txHash := tx.Hash()
 			if sm.txMemPool.HaveTransaction(txHash) {
 				sm.txMemPool.RemoveTransaction(tx, false)
@@ -1415,7 +1532,7 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 				sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
 			} else if sm.odrMemBook.HaveOrder(txHash) {
 				odr := chainutil.NewOdrFromTx(tx)
-				sm.odrMemBook.RemoveOrder(odr)
+				sm.odrMemBook.FillOrder(odr)
 				sm.txMemPool.RemoveDoubleSpends(tx)
 				sm.odrMemBook.RemoveDoubleSpends(tx)
 				sm.peerNotifier.OrderFilled(odr)
@@ -1425,6 +1542,13 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			}
 		}
 
+		// Evict the orders which have rested in the order book for too
+		// long.
+		expired := sm.odrMemBook.ExpireOrders(block.Height())
+		if len(expired) > 0 {
+			sm.peerNotifier.OrdersRemoved(expired)
+		}
+
 		// Register block with the fee estimator, if it exists.
 		if sm.feeEstimator != nil {
 			err := sm.feeEstimator.RegisterBlock(block)
@@ -1448,8 +1572,23 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 		}
 
 		// Reinsert all of the transactions (except the coinbase) into
-		// the transaction pool.
-		for _, tx := range block.Transactions()[1:] {
+		// the transaction pool, and the filled orders into the order
+		// book.  A partially filled order is returned as the original
+		// order it was derived from.
+		for _, tx := range sm.blockTransactions(block)[1:] {
+			if sm.odrMemBook.IsOrder(tx) {
+				_, replaced, err := sm.odrMemBook.MaybeAcceptOrder(
+					chainutil.NewOdrFromTx(tx))
+				if err != nil {
+					log.Debugf("Unable to return order %v to "+
+						"the order book: %v", tx.Hash(), err)
+				}
+				if len(replaced) > 0 {
+					sm.peerNotifier.OrdersRemoved(replaced)
+				}
+				continue
+			}
+
 			_, _, err := sm.txMemPool.MaybeAcceptTransaction(tx,
 				false, false)
 			if err != nil {
@@ -1464,6 +1603,34 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 		if sm.feeEstimator != nil {
 			sm.feeEstimator.Rollback(block.Hash())
 		}
+
+	// An order has been filled by a block connected to the main chain.
+	case blockchain.NTOrderFilled:
+		order, ok := notification.Data.(*blockchain.OrderFilledNtfnsData)
+		if !ok {
+			log.Warnf("Chain order filled notification is not an order.")
+			break
+		}
+
+		// The fee estimator converts the fees between tokens with the
+		// price of the filled orders.
+		if sm.feeEstimator != nil {
+			sm.feeEstimator.ObserveOrderFill(&order.Balance)
+		}
+
+	// An order fill has been reverted by disconnecting its block from the
+	// main chain.
+	case blockchain.NTOrderFillReverted:
+		order, ok := notification.Data.(*blockchain.OrderFilledNtfnsData)
+		if !ok {
+			log.Warnf("Chain order fill reverted notification is not " +
+				"an order.")
+			break
+		}
+
+		if sm.feeEstimator != nil {
+			sm.feeEstimator.RevertOrderFill(&order.Balance)
+		}
 	}
 }
 
@@ -1620,6 +1787,8 @@ func New(config *Config) (*SyncManager, error) {
 		chainParams:     config.ChainParams,
 		rejectedTxns:    make(map[chainhash.Hash]struct{}),
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
+		rejectedOrders:  make(map[chainhash.Hash]struct{}),
+		requestedOrders: make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
 		peerStates:      make(map[*peerpkg.Peer]*peerSyncState),
 		progressLogger:  newBlockProgressLogger("Processed", log),
@@ -0,0 +1,453 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
+	"github.com/endurio/ndrd/database"
+	_ "github.com/endurio/ndrd/database/ffldb"
+	"github.com/endurio/ndrd/mempool"
+	"github.com/endurio/ndrd/peer"
+	"github.com/endurio/ndrd/txscript"
+	"github.com/endurio/ndrd/types"
+	"github.com/endurio/ndrd/wire"
+)
+
+// mockPeerNotifier is a PeerNotifier which records the orders removed from the
+// order book.
+type mockPeerNotifier struct {
+	removed []*mempool.OdrDesc
+}
+
+func (n *mockPeerNotifier) AnnounceNewTransactions([]*mempool.TxDesc) {}
+
+func (n *mockPeerNotifier) AnnounceNewOrders([]*mempool.OdrDesc) {}
+
+func (n *mockPeerNotifier) UpdatePeerHeights(*chainhash.Hash, int32, *peer.Peer) {}
+
+func (n *mockPeerNotifier) RelayInventory(*wire.InvVect, interface{}) {}
+
+func (n *mockPeerNotifier) TransactionConfirmed(*chainutil.Tx) {}
+
+func (n *mockPeerNotifier) OrderFilled(*chainutil.Odr) {}
+
+func (n *mockPeerNotifier) OrdersRemoved(orders []*mempool.OdrDesc) {
+	n.removed = append(n.removed, orders...)
+}
+
+// fixedTimeSource is a median time source whose adjusted time never changes,
+// so the test chains are current regardless of the wall clock.
+type fixedTimeSource time.Time
+
+func (s fixedTimeSource) AdjustedTime() time.Time { return time.Time(s) }
+
+func (s fixedTimeSource) AddTimeSample(string, time.Time) {}
+
+func (s fixedTimeSource) Offset() time.Duration { return 0 }
+
+// testChain is a chain instance the tests extend with blocks whose coinbases
+// pay 100 NDR to an OP_TRUE script.  The blocks of the main chain are added in
+// the fast add mode, so they may fill orders without an absorption, while the
+// blocks of the side chains are fully validated when the chain reorganizes to
+// them.
+type testChain struct {
+	t       *testing.T
+	chain   *blockchain.BlockChain
+	params  *chaincfg.Params
+	version int32
+}
+
+// newTestChain returns a test chain with a short rule change window and a
+// coinbase maturity of one block, whose time is an hour after its genesis
+// block, along with a teardown function the caller must invoke when done.  When signalPartialFill is set, the blocks signal the
+// partial fill deployment so it becomes active after a few of them.
+func newTestChain(t *testing.T, signalPartialFill bool) (*testChain, func()) {
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	params.BlockPerTimespan = 1000
+	params.RuleChangeActivationThreshold = 1
+	params.MinerConfirmationWindow = 2
+
+	dbPath, err := ioutil.TempDir("", "netsynctest")
+	if err != nil {
+		t.Fatalf("TempDir: unexpected error: %v", err)
+	}
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+	timeSource := params.GenesisBlock.Header.Timestamp.Add(time.Hour)
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  fixedTimeSource(timeSource),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("Failed to create chain instance: %v", err)
+	}
+
+	version := int32(1)
+	if signalPartialFill {
+		bit := params.Deployments[chaincfg.DeploymentPartialFill].BitNumber
+		version = 0x20000000 | 1<<bit
+	}
+	return &testChain{
+		t:       t,
+		chain:   chain,
+		params:  &params,
+		version: version,
+	}, teardown
+}
+
+// addBlock creates a block extending the passed block with the passed
+// transactions and processes it.  The block is added in the fast add mode when
+// it extends the main chain.  Extra outputs, such as a partial fill commitment,
+// may be passed for the coinbase.
+func (c *testChain) addBlock(parent *chainutil.Block, coinbaseOuts []*wire.TxOut, txs ...*wire.MsgTx) *chainutil.Block {
+	height := parent.Height() + 1
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		math.MaxUint32), []byte{txscript.OP_0, byte(height)}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(types.Value{Amount: 100},
+		[]byte{txscript.OP_TRUE}))
+	for _, txOut := range coinbaseOuts {
+		coinbase.AddTxOut(txOut)
+	}
+
+	msgBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   c.version,
+			PrevBlock: *parent.Hash(),
+			Timestamp: parent.MsgBlock().Header.Timestamp.Add(time.Second),
+			Bits:      c.params.PowLimitBits,
+		},
+		Transactions: append([]*wire.MsgTx{coinbase}, txs...),
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		chainutil.NewBlock(msgBlock).Transactions(), false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	block := chainutil.NewBlock(msgBlock)
+	block.SetHeight(height)
+
+	flags := blockchain.BFNoPoWCheck
+	if parent.Hash().IsEqual(&c.chain.BestSnapshot().Hash) {
+		flags |= blockchain.BFFastAdd
+	}
+	_, isOrphan, err := c.chain.ProcessBlock(block, flags)
+	if err != nil || isOrphan {
+		c.t.Fatalf("ProcessBlock: block %d not accepted (orphan %v): %v",
+			height, isOrphan, err)
+	}
+	return block
+}
+
+// TestDisconnectedBlockOrders ensures the orders filled by a block which is
+// disconnected from the main chain by a reorganization are returned to the
+// order book, partially filled orders as the original order once partial
+// fills are active, and that the resting orders they replace are removed from
+// the peers.
+func TestDisconnectedBlockOrders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		signalPartialFill bool
+	}{
+		{name: "partial fills active", signalPartialFill: true},
+		{name: "partial fills inactive", signalPartialFill: false},
+	}
+
+	for _, test := range tests {
+		c, teardown := newTestChain(t, test.signalPartialFill)
+
+		mpCfg := mempool.Config{
+			Policy: mempool.Policy{
+				AcceptNonStd:        true,
+				MaxTxVersion:        2,
+				MaxSigOpCostPerTx:   blockchain.MaxBlockSigOpsCost / 4,
+				MinPriceImprovement: mempool.DefaultMinPriceImprovement,
+			},
+			ChainParams:   c.params,
+			FetchUtxoView: c.chain.FetchUtxoView,
+			BestHeight: func() int32 {
+				return c.chain.BestSnapshot().Height
+			},
+			MedianTimePast: func() time.Time {
+				return c.chain.BestSnapshot().MedianTime
+			},
+			CalcSequenceLock: func(tx *chainutil.Tx, view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+				return c.chain.CalcSequenceLock(tx, view, true)
+			},
+		}
+		notifier := &mockPeerNotifier{}
+		sm := &SyncManager{
+			peerNotifier: notifier,
+			chain:        c.chain,
+			txMemPool:    mempool.New(&mpCfg),
+			odrMemBook:   mempool.NewMemBook(&mpCfg),
+			chainParams:  c.params,
+		}
+		c.chain.Subscribe(sm.handleBlockchainNotification)
+
+		// Extend the chain until partial fills are active when the
+		// blocks signal them, with the first two coinbases funding the
+		// orders.
+		genesis := chainutil.NewBlock(c.params.GenesisBlock)
+		genesis.SetHeight(0)
+		tip := c.addBlock(genesis, nil)
+		funding := []*chainutil.Block{tip, c.addBlock(tip, nil)}
+		tip = funding[1]
+		for i := 0; i < 8; i++ {
+			tip = c.addBlock(tip, nil)
+		}
+		active, err := c.chain.IsDeploymentActive(
+			chaincfg.DeploymentPartialFill)
+		if err != nil {
+			t.Fatalf("%s: IsDeploymentActive: unexpected error: %v",
+				test.name, err)
+		}
+		if active != test.signalPartialFill {
+			t.Fatalf("%s: partial fills active %v, want %v", test.name,
+				active, test.signalPartialFill)
+		}
+
+		// newOrder returns an order selling the 100 NDR of the passed
+		// coinbase for the passed amount of STB.  It signals
+		// replaceability.
+		newOrder := func(funding *chainutil.Block, stb types.Amount) *wire.MsgTx {
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			prevHash := funding.Transactions()[0].Hash()
+			txIn := wire.NewTxIn(wire.NewOutPoint(prevHash, 0), nil, nil)
+			txIn.Sequence = 0
+			msgTx.AddTxIn(txIn)
+			msgTx.AddTxOut(wire.NewTxOut(types.Value{Amount: stb,
+				Token: types.Token1}, []byte{txscript.OP_TRUE}))
+			return msgTx
+		}
+
+		// A resting order sells the same NDR as the order filled next,
+		// for 11 STB, which is a worse price than the 10 STB of the
+		// filled order.
+		resting := newOrder(funding[0], 11)
+		restingDesc, _, err := sm.odrMemBook.MaybeAcceptOrder(
+			chainutil.NewOdrFromTx(chainutil.NewTx(resting)))
+		if err != nil {
+			t.Fatalf("%s: MaybeAcceptOrder: unexpected error: %v",
+				test.name, err)
+		}
+
+		// Fill an order, and another one partially, leaving 5 of its
+		// 10 STB unfilled.
+		filled := newOrder(funding[0], 10)
+		partial := newOrder(funding[1], 10)
+		partialFill, err := blockchain.NewPartialFill(partial,
+			types.NewBalance(-100, 10), []byte{txscript.OP_TRUE}, 5)
+		if err != nil {
+			t.Fatalf("%s: NewPartialFill: unexpected error: %v",
+				test.name, err)
+		}
+		forkPoint := tip
+		commitment := wire.NewTxOut(types.Value{},
+			blockchain.PartialFillScript(5))
+		c.addBlock(forkPoint, []*wire.TxOut{commitment}, filled,
+			partialFill)
+
+		// Reorganize to a longer side chain, which disconnects the
+		// block filling the orders.
+		c.addBlock(c.addBlock(forkPoint, nil), nil)
+
+		book := sm.odrMemBook
+		filledHash := filled.TxHash()
+		if !book.HaveOrder(&filledHash) {
+			t.Errorf("%s: the filled order was not returned to the "+
+				"order book", test.name)
+		}
+		if book.HaveOrder(restingDesc.Hash()) {
+			t.Errorf("%s: the replaced order is still in the order "+
+				"book", test.name)
+		}
+		if len(notifier.removed) != 1 || notifier.removed[0] != restingDesc {
+			t.Errorf("%s: got %d orders removed from the peers, want "+
+				"the replaced order", test.name, len(notifier.removed))
+		}
+
+		// The partially filled order is only restored once partial
+		// fills are active.  Before that, the block could only be valid
+		// with the partial fill as a regular order.
+		partialHash := partial.TxHash()
+		partialFillHash := partialFill.TxHash()
+		wantHash, unwantedHash := &partialHash, &partialFillHash
+		if !test.signalPartialFill {
+			wantHash, unwantedHash = unwantedHash, wantHash
+		}
+		if !book.HaveOrder(wantHash) || book.HaveOrder(unwantedHash) {
+			t.Errorf("%s: got the partial order %v and its fill %v "+
+				"in the order book, want only %v", test.name,
+				book.HaveOrder(&partialHash),
+				book.HaveOrder(&partialFillHash), wantHash)
+		}
+
+		teardown()
+	}
+}
+
+// TestRequestMemBooks ensures the order books are only requested while the
+// chain is current, at most once per request interval and from at most
+// maxMemBookRequests peers able to serve them, the sync peer first.
+func TestRequestMemBooks(t *testing.T) {
+	t.Parallel()
+
+	c, teardown := newTestChain(t, false)
+	defer teardown()
+
+	// memBookPeer describes a peer of the sync manager, which serves the
+	// order book unless it lacks bloom filtering or speaks a protocol
+	// version before the mempool message.
+	type memBookPeer struct {
+		noBloom    bool
+		oldVersion bool
+		asked      bool
+	}
+	tests := []struct {
+		name      string
+		peers     []memBookPeer
+		syncPeer  int           // index of the sync peer, -1 for none
+		syncAhead bool          // whether the sync peer has more blocks
+		lastReq   time.Duration // age of the last request, 0 for none
+		want      int           // index of the peer asked, -1 for none
+	}{
+		{
+			name:     "first request",
+			peers:    []memBookPeer{{}},
+			syncPeer: -1,
+			want:     0,
+		},
+		{
+			name:      "chain not current",
+			peers:     []memBookPeer{{}},
+			syncPeer:  0,
+			syncAhead: true,
+			want:      -1,
+		},
+		{
+			name:     "within the request interval",
+			peers:    []memBookPeer{{}},
+			syncPeer: -1,
+			lastReq:  memBookRequestInterval - time.Second,
+			want:     -1,
+		},
+		{
+			name:     "after the request interval",
+			peers:    []memBookPeer{{}},
+			syncPeer: -1,
+			lastReq:  memBookRequestInterval,
+			want:     0,
+		},
+		{
+			name:     "sync peer preferred",
+			peers:    []memBookPeer{{}, {}, {}},
+			syncPeer: 2,
+			want:     2,
+		},
+		{
+			name:     "sync peer already asked",
+			peers:    []memBookPeer{{asked: true}, {}},
+			syncPeer: 0,
+			want:     1,
+		},
+		{
+			name:     "sync peer without bloom filtering",
+			peers:    []memBookPeer{{noBloom: true}, {}},
+			syncPeer: 0,
+			want:     1,
+		},
+		{
+			name: "no peer able to serve",
+			peers: []memBookPeer{{noBloom: true}, {oldVersion: true},
+				{asked: true}},
+			syncPeer: -1,
+			want:     -1,
+		},
+		{
+			name:     "below the request limit",
+			peers:    []memBookPeer{{asked: true}, {asked: true}, {}},
+			syncPeer: -1,
+			want:     2,
+		},
+		{
+			name: "request limit reached",
+			peers: []memBookPeer{{asked: true}, {asked: true},
+				{asked: true}, {}},
+			syncPeer: -1,
+			want:     -1,
+		},
+	}
+
+	for _, test := range tests {
+		sm := &SyncManager{
+			chain:      c.chain,
+			peerStates: make(map[*peer.Peer]*peerSyncState),
+		}
+		if test.lastReq != 0 {
+			sm.lastMemBookReq = time.Now().Add(-test.lastReq)
+		}
+		lastReq := sm.lastMemBookReq
+
+		peers := make([]*peer.Peer, len(test.peers))
+		for i, p := range test.peers {
+			cfg := peer.Config{
+				Services:        wire.SFNodeBloom,
+				ProtocolVersion: wire.BIP0035Version,
+			}
+			if p.noBloom {
+				cfg.Services = 0
+			}
+			if p.oldVersion {
+				cfg.ProtocolVersion = wire.BIP0035Version - 1
+			}
+			peers[i] = peer.NewInboundPeer(&cfg)
+			sm.peerStates[peers[i]] = &peerSyncState{
+				memBookAsked: p.asked,
+			}
+		}
+		if test.syncPeer >= 0 {
+			sm.syncPeer = peers[test.syncPeer]
+			if test.syncAhead {
+				sm.syncPeer.UpdateLastBlockHeight(
+					c.chain.BestSnapshot().Height + 1)
+			}
+		}
+
+		sm.requestMemBooks()
+
+		for i, p := range test.peers {
+			asked := sm.peerStates[peers[i]].memBookAsked
+			if asked != (p.asked || i == test.want) {
+				t.Errorf("%s: peer %d asked %v, want %v", test.name,
+					i, asked, !asked)
+			}
+		}
+		if requested := sm.lastMemBookReq != lastReq; requested != (test.want >= 0) {
+			t.Errorf("%s: request time updated %v, want %v",
+				test.name, requested, !requested)
+		}
+	}
+}
@@ -181,6 +181,10 @@ func messageSummary(msg wire.Message) string {
 			msg.TxHash(), len(msg.TxIn), len(msg.TxOut),
 			formatLockTime(msg.LockTime))
 
+	case *wire.MsgCancelOdr:
+		return fmt.Sprintf("order %s, %d signatures", msg.OdrHash,
+			len(msg.Signatures))
+
 	case *wire.MsgBlock:
 		header := &msg.Header
 		return fmt.Sprintf("hash %s, ver %d, %d tx, %s", msg.BlockHash(),
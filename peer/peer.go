@@ -29,7 +29,7 @@ import (
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.FeeFilterVersion
+	MaxProtocolVersion = wire.CancelOdrVersion
 
 	// DefaultTrickleInterval is the min time between attempts to send an
 	// inv message to a peer.
@@ -128,6 +128,10 @@ type MessageListeners struct {
 	// OnOdr is invoked when a peer receives a order bitcoin message.
 	OnOdr func(p *Peer, msg *wire.MsgOdr)
 
+	// OnCancelOdr is invoked when a peer receives a cancelodr bitcoin
+	// message.
+	OnCancelOdr func(p *Peer, msg *wire.MsgCancelOdr)
+
 	// OnBlock is invoked when a peer receives a block bitcoin message.
 	OnBlock func(p *Peer, msg *wire.MsgBlock, buf []byte)
 
@@ -1450,6 +1454,11 @@ out:
 				p.cfg.Listeners.OnOdr(p, msg)
 			}
 
+		case *wire.MsgCancelOdr:
+			if p.cfg.Listeners.OnCancelOdr != nil {
+				p.cfg.Listeners.OnCancelOdr(p, msg)
+			}
+
 		case *wire.MsgBlock:
 			if p.cfg.Listeners.OnBlock != nil {
 				p.cfg.Listeners.OnBlock(p, msg, buf)
@@ -0,0 +1,25 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package pricefeed implements the feed of the STB/USD market price which miners
+include in the blocks they create.
+
+A feed aggregates the prices of several named sources: the prices pushed by the
+feedprice RPC, a local file read again whenever it changes, and HTTP endpoints
+serving a JSON document polled at an interval.  The price of each source is
+stale once it is older than the maximum age configured for the source.
+
+The price to mine is the median of the fresh prices of all the sources, minus
+1.0 to make it a price derivation.  No price is mined when less than the
+configured minimum number of sources have a fresh price, so a miner does not
+depend on a single external process feeding it on time.
+
+The sources fed by RPC may require the feeds to be signed by the private key of
+a configured public key, with SignFeed.  A price which moves more than the
+configured band from the last fresh price accepted from the same source is
+rejected.  The recent feeds are kept along with the reason of their rejection,
+and reported by Snapshot with the price to mine.
+*/
+package pricefeed
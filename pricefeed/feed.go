@@ -0,0 +1,489 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pricefeed
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+)
+
+const (
+	// RPCSourceName is the name of the source of the prices fed by the
+	// feedprice RPC.
+	RPCSourceName = "rpc"
+
+	// DefaultPollInterval is the default interval at which the polled
+	// sources fetch their price.
+	DefaultPollInterval = time.Second * 30
+
+	// DefaultMinSources is the default minimum number of sources with a
+	// fresh price required to mine a price.
+	DefaultMinSources = 1
+
+	// DefaultBand is the default maximum relative move of a price from the
+	// last fresh price accepted from the same source.
+	DefaultBand = 0.1
+
+	// DefaultHistorySize is the default number of recent feeds kept by a
+	// feed.
+	DefaultHistorySize = 100
+
+	// maxFeedClockSkew is the maximum time the timestamp of a signed feed
+	// may be ahead of the local clock.
+	maxFeedClockSkew = time.Minute
+)
+
+// Source is a named source of the market price of STB/USD.
+type Source interface {
+	// Name returns the name of the source, which is unique among the
+	// sources of a feed.
+	Name() string
+
+	// Run fetches the prices of the source and passes each of them to the
+	// feed function, along with the time it was observed, until the quit
+	// channel is closed.
+	Run(feed func(price blockchain.Price, timestamp time.Time), quit <-chan struct{})
+}
+
+// SourceConfig is the configuration of a source of a feed.
+type SourceConfig struct {
+	Source Source
+
+	// MaxAge is the age after which a price of the source is stale, and no
+	// longer takes part in the price to mine.
+	MaxAge time.Duration
+}
+
+// Config is the configuration of a feed.
+type Config struct {
+	// Sources are the sources of the feed.  The prices fed by RPC are
+	// only accepted when one of them is named RPCSourceName.
+	Sources []SourceConfig
+
+	// MinSources is the minimum number of sources with a fresh price
+	// required for the feed to provide a price to mine.
+	MinSources int
+
+	// Band is the maximum relative move of a price from the last fresh
+	// price accepted from the same source, such as 0.1 for 10%.  A price
+	// moving further is rejected.  Zero disables the check.
+	Band float64
+
+	// HistorySize is the number of recent feeds kept to be reported by
+	// Snapshot.  Zero selects DefaultHistorySize.
+	HistorySize int
+}
+
+// FeedRecord describes a price fed by a source of a feed.
+type FeedRecord struct {
+	Source    string
+	Price     blockchain.Price
+	Timestamp time.Time
+
+	// Rejected is the reason the price was rejected, or empty when it
+	// was accepted.
+	Rejected string
+}
+
+// SourceStatus describes the last price accepted from a source of a feed.
+type SourceStatus struct {
+	Name string
+
+	// Last is the last price accepted from the source, or nil when none
+	// was, and Fresh is whether it takes part in the price to mine.
+	Last  *blockchain.PriceDesc
+	Fresh bool
+
+	// Signed is whether the source only accepts signed feeds by RPC.
+	Signed bool
+}
+
+// Snapshot describes the state of a feed at a point in time, along with the
+// price it provides to mine and why.
+type Snapshot struct {
+	Sources []SourceStatus
+
+	// History is the recent feeds of the sources, oldest first.
+	History []FeedRecord
+
+	MinSources int
+	Band       float64
+
+	// MedianPrice is the median of the fresh prices of the sources, and
+	// PriceToMine is the price derivation mined from it.  Both are
+	// blockchain.NoPrice without enough fresh prices.
+	MedianPrice blockchain.Price
+	PriceToMine blockchain.Price
+
+	// Reason explains the price to mine.
+	Reason string
+}
+
+// sourceState houses a source of a feed along with the last price it fed.
+type sourceState struct {
+	SourceConfig
+	last *blockchain.PriceDesc
+}
+
+// Feed aggregates the market prices of STB/USD fed by several sources into the
+// price derivation to mine, which is the median of the fresh prices of the
+// sources minus 1.0.  No price is mined when less than the configured minimum
+// number of sources have a fresh price.
+type Feed struct {
+	started    int32
+	minSources int
+	band       float64
+	timeNow    func() time.Time
+	quit       chan struct{}
+	wg         sync.WaitGroup
+
+	mtx         sync.Mutex
+	sources     []*sourceState
+	byName      map[string]*sourceState
+	history     []FeedRecord
+	historyNext int
+}
+
+// Ensure the Feed type implements the blockchain.FeedPriceSource interface.
+var _ blockchain.FeedPriceSource = (*Feed)(nil)
+
+// record adds the passed feed to the recent feeds, replacing the oldest one
+// once the history is full.
+//
+// This function MUST be called with the feed lock held.
+func (f *Feed) record(rec FeedRecord) {
+	if len(f.history) < cap(f.history) {
+		f.history = append(f.history, rec)
+		return
+	}
+	f.history[f.historyNext] = rec
+	f.historyNext = (f.historyNext + 1) % len(f.history)
+}
+
+// isFresh returns whether the passed price is recent enough at the passed time
+// to take part in the price to mine of the passed source.
+func isFresh(state *sourceState, desc *blockchain.PriceDesc, now time.Time) bool {
+	if desc == nil {
+		return false
+	}
+	age := now.Sub(desc.Timestamp)
+	return age >= 0 && age <= state.MaxAge
+}
+
+// checkBand returns an error when the passed price moves more than the band of
+// the feed from the last fresh price accepted from the passed source.
+//
+// This function MUST be called with the feed lock held.
+func (f *Feed) checkBand(state *sourceState, price blockchain.Price, now time.Time) error {
+	if f.band == 0 || !isFresh(state, state.last, now) {
+		return nil
+	}
+	last := float64(state.last.Price)
+	if math.Abs(float64(price)-last) > f.band*last {
+		return fmt.Errorf("price %v moves more than %v%% from the last "+
+			"accepted price %v", price.Float(), f.band*100,
+			state.last.Price.Float())
+	}
+	return nil
+}
+
+// accept records the passed feed of the passed source, and makes it the last
+// price of the source unless it is rejected for an invalid price or for moving
+// out of the band of the feed.  It returns the reason of the rejection.
+//
+// This function MUST be called with the feed lock held.
+func (f *Feed) accept(state *sourceState, price blockchain.Price, timestamp time.Time) error {
+	var err error
+	if price == blockchain.NoPrice || price <= 0 {
+		err = fmt.Errorf("price %v is not positive", price.Float())
+	} else {
+		err = f.checkBand(state, price, f.timeNow())
+	}
+
+	rec := FeedRecord{
+		Source:    state.Source.Name(),
+		Price:     price,
+		Timestamp: timestamp,
+	}
+	if err != nil {
+		rec.Rejected = err.Error()
+		f.record(rec)
+		return err
+	}
+	f.record(rec)
+	state.last = &blockchain.PriceDesc{Price: price, Timestamp: timestamp}
+	return nil
+}
+
+// feed records the passed price fetched by the passed source.
+func (f *Feed) feed(state *sourceState, price blockchain.Price, timestamp time.Time) {
+	f.mtx.Lock()
+	err := f.accept(state, price, timestamp)
+	f.mtx.Unlock()
+
+	if err != nil {
+		log.Warnf("Rejected price from source %s: %v",
+			state.Source.Name(), err)
+		return
+	}
+	log.Debugf("Source %s fed price %v", state.Source.Name(), price.Float())
+}
+
+// FeedRPC records the passed price fed by RPC under the passed source name.
+// The source must be an RPC source.  The feeds of a source with a public key
+// must be signed with SignFeed for the passed unix time, which must be after
+// the one of the last price accepted from the source.  The time of the feeds of
+// the other sources is the current time, and they must not be signed.
+func (f *Feed) FeedRPC(source string, price blockchain.Price, timestamp int64, sig []byte) error {
+	state, ok := f.byName[source]
+	if !ok {
+		return fmt.Errorf("unknown price source %q", source)
+	}
+	rpc, ok := state.Source.(*rpcSource)
+	if !ok {
+		return fmt.Errorf("price source %q is not fed by RPC", source)
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	now := f.timeNow()
+	if rpc.pubKey == nil {
+		if sig != nil {
+			return fmt.Errorf("price source %q does not take signed "+
+				"feeds", source)
+		}
+		return f.accept(state, price, now)
+	}
+
+	if sig == nil {
+		return fmt.Errorf("price source %q requires signed feeds",
+			source)
+	}
+	feedTime := time.Unix(timestamp, 0)
+	if feedTime.After(now.Add(maxFeedClockSkew)) {
+		return fmt.Errorf("feed time %v is too far in the future",
+			feedTime)
+	}
+	if state.last != nil && !feedTime.After(state.last.Timestamp) {
+		return fmt.Errorf("feed time %v is not after the one of the "+
+			"last accepted feed", feedTime)
+	}
+	if !verifyFeed(rpc.pubKey, sig, source, price, timestamp) {
+		return fmt.Errorf("invalid signature for price source %q",
+			source)
+	}
+	return f.accept(state, price, feedTime)
+}
+
+// FeedPrice records the passed price fed by RPC to the source named
+// RPCSourceName.
+//
+// This is part of the blockchain.FeedPriceSource interface implementation.
+func (f *Feed) FeedPrice(price blockchain.Price) {
+	if err := f.FeedRPC(RPCSourceName, price, 0, nil); err != nil {
+		log.Warnf("Rejected price fed by RPC: %v", err)
+	}
+}
+
+// LastPrice returns the price derivation of the last price accepted from any
+// source, or nil when none has been.
+//
+// This is part of the blockchain.FeedPriceSource interface implementation.
+func (f *Feed) LastPrice() *blockchain.PriceDesc {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	var last *blockchain.PriceDesc
+	for _, state := range f.sources {
+		if state.last == nil {
+			continue
+		}
+		if last == nil || state.last.Timestamp.After(last.Timestamp) {
+			last = state.last
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	return &blockchain.PriceDesc{
+		Price:     last.Price - blockchain.PriceUnit,
+		Timestamp: last.Timestamp,
+	}
+}
+
+// medianFreshPrice returns the median of the fresh prices of the sources at the
+// passed time along with their number, or blockchain.NoPrice when less than the
+// minimum number of sources have a fresh price.
+//
+// This function MUST be called with the feed lock held.
+func (f *Feed) medianFreshPrice(now time.Time) (blockchain.Price, int) {
+	prices := make([]blockchain.Price, 0, len(f.sources))
+	for _, state := range f.sources {
+		if isFresh(state, state.last, now) {
+			prices = append(prices, state.last.Price)
+		}
+	}
+	if len(prices) < f.minSources {
+		return blockchain.NoPrice, len(prices)
+	}
+	return medianPrice(prices), len(prices)
+}
+
+// PriceToMine returns the price derivation to mine, which is the median of the
+// fresh prices of the sources minus 1.0, or blockchain.NoPrice when less than
+// the minimum number of sources have a fresh price.
+//
+// This is part of the blockchain.FeedPriceSource interface implementation.
+func (f *Feed) PriceToMine() blockchain.Price {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	median, fresh := f.medianFreshPrice(f.timeNow())
+	if median == blockchain.NoPrice {
+		log.Debugf("Not enough fresh prices to mine -- got %d, need %d",
+			fresh, f.minSources)
+		return blockchain.NoPrice
+	}
+	return median - blockchain.PriceUnit
+}
+
+// Snapshot returns the state of the feed along with the price it provides to
+// mine and why.
+func (f *Feed) Snapshot() *Snapshot {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	now := f.timeNow()
+	snapshot := Snapshot{
+		Sources:     make([]SourceStatus, 0, len(f.sources)),
+		History:     make([]FeedRecord, 0, len(f.history)),
+		MinSources:  f.minSources,
+		Band:        f.band,
+		PriceToMine: blockchain.NoPrice,
+	}
+	for _, state := range f.sources {
+		rpc, ok := state.Source.(*rpcSource)
+		snapshot.Sources = append(snapshot.Sources, SourceStatus{
+			Name:   state.Source.Name(),
+			Last:   state.last,
+			Fresh:  isFresh(state, state.last, now),
+			Signed: ok && rpc.pubKey != nil,
+		})
+	}
+	snapshot.History = append(snapshot.History, f.history[f.historyNext:]...)
+	snapshot.History = append(snapshot.History, f.history[:f.historyNext]...)
+
+	median, fresh := f.medianFreshPrice(now)
+	snapshot.MedianPrice = median
+	if median == blockchain.NoPrice {
+		snapshot.Reason = fmt.Sprintf("no price is mined with %d fresh "+
+			"prices out of the %d required", fresh, f.minSources)
+		return &snapshot
+	}
+	snapshot.PriceToMine = median - blockchain.PriceUnit
+	snapshot.Reason = fmt.Sprintf("the median of %d fresh prices minus "+
+		"1.0 is mined", fresh)
+	return &snapshot
+}
+
+// medianPrice returns the median of the passed prices, which are all positive,
+// and is the mean of the two middle ones rounded down for an even count.  The
+// passed slice is sorted in place.
+func medianPrice(prices []blockchain.Price) blockchain.Price {
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i] < prices[j]
+	})
+	mid := len(prices) / 2
+	if len(prices)%2 == 1 {
+		return prices[mid]
+	}
+	low, high := prices[mid-1], prices[mid]
+	return low + (high-low)/2
+}
+
+// Start begins fetching the prices of all the sources of the feed.
+func (f *Feed) Start() {
+	// Already started?
+	if atomic.AddInt32(&f.started, 1) != 1 {
+		return
+	}
+
+	for _, state := range f.sources {
+		state := state
+		f.wg.Add(1)
+		go func() {
+			state.Source.Run(func(price blockchain.Price, timestamp time.Time) {
+				f.feed(state, price, timestamp)
+			}, f.quit)
+			f.wg.Done()
+		}()
+	}
+}
+
+// Stop stops fetching the prices of the sources of the feed, and waits for all
+// of them to finish.
+func (f *Feed) Stop() {
+	if atomic.LoadInt32(&f.started) == 0 {
+		return
+	}
+	close(f.quit)
+	f.wg.Wait()
+}
+
+// New returns a new feed of the prices of the configured sources.  The feed
+// must be started to fetch the prices of the sources other than RPC.
+func New(cfg *Config) (*Feed, error) {
+	if cfg.MinSources < 1 {
+		return nil, fmt.Errorf("the minimum number of price sources "+
+			"must be at least 1, got %d", cfg.MinSources)
+	}
+
+	if cfg.Band < 0 {
+		return nil, fmt.Errorf("the price band must not be negative, "+
+			"got %v", cfg.Band)
+	}
+	historySize := cfg.HistorySize
+	if historySize < 0 {
+		return nil, fmt.Errorf("the price feed history size must not "+
+			"be negative, got %d", historySize)
+	}
+	if historySize == 0 {
+		historySize = DefaultHistorySize
+	}
+
+	f := Feed{
+		minSources: cfg.MinSources,
+		band:       cfg.Band,
+		history:    make([]FeedRecord, 0, historySize),
+		timeNow:    time.Now,
+		quit:       make(chan struct{}),
+		sources:    make([]*sourceState, 0, len(cfg.Sources)),
+		byName:     make(map[string]*sourceState, len(cfg.Sources)),
+	}
+	for _, sourceCfg := range cfg.Sources {
+		name := sourceCfg.Source.Name()
+		if _, ok := f.byName[name]; ok {
+			return nil, fmt.Errorf("duplicate price source name %q",
+				name)
+		}
+		state := &sourceState{SourceConfig: sourceCfg}
+		f.sources = append(f.sources, state)
+		f.byName[name] = state
+	}
+	if len(f.sources) < f.minSources {
+		return nil, fmt.Errorf("the minimum number of price sources %d "+
+			"exceeds the %d configured sources", f.minSources,
+			len(f.sources))
+	}
+
+	return &f, nil
+}
@@ -0,0 +1,358 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pricefeed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chainec"
+)
+
+// stubSource is a source whose prices are fed by the test through a channel.
+type stubSource struct {
+	name   string
+	prices chan blockchain.PriceDesc
+}
+
+func (s *stubSource) Name() string {
+	return s.name
+}
+
+func (s *stubSource) Run(feed func(blockchain.Price, time.Time), quit <-chan struct{}) {
+	for {
+		select {
+		case desc := <-s.prices:
+			feed(desc.Price, desc.Timestamp)
+		case <-quit:
+			return
+		}
+	}
+}
+
+// TestFeedPriceToMine ensures the price to mine is the median of the fresh
+// prices of the sources, and that no price is mined without a quorum.
+func TestFeedPriceToMine(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1546300800, 0)
+	price := func(f float64) blockchain.Price {
+		return blockchain.PriceFromFloat(f)
+	}
+	names := []string{"a", "b", "c"}
+	sources := make([]SourceConfig, 0, len(names)+1)
+	sources = append(sources, SourceConfig{
+		Source: NewRPCSource(RPCSourceName, nil),
+		MaxAge: time.Minute,
+	})
+	for _, name := range names {
+		sources = append(sources, SourceConfig{
+			Source: &stubSource{name: name},
+			MaxAge: time.Minute * 10,
+		})
+	}
+	feed, err := New(&Config{Sources: sources, MinSources: 2})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	feed.timeNow = func() time.Time { return now }
+	state := func(name string) *sourceState {
+		return feed.byName[name]
+	}
+
+	tests := []struct {
+		name   string
+		feed   func()
+		passed time.Duration
+		want   blockchain.Price
+	}{
+		{
+			name: "no price",
+			feed: func() {},
+			want: blockchain.NoPrice,
+		},
+		{
+			name: "single price below quorum",
+			feed: func() { feed.FeedPrice(price(1.2)) },
+			want: blockchain.NoPrice,
+		},
+		{
+			name: "even count",
+			feed: func() {
+				feed.feed(state("a"), price(1.1), now)
+			},
+			want: price(0.15),
+		},
+		{
+			name: "odd count",
+			feed: func() {
+				feed.feed(state("b"), price(0.9), now)
+			},
+			want: price(0.1),
+		},
+		{
+			name:   "stale RPC price",
+			feed:   func() {},
+			passed: time.Minute * 2,
+			want:   price(0),
+		},
+		{
+			name: "future price",
+			feed: func() {
+				feed.feed(state("c"), price(2),
+					now.Add(time.Second))
+			},
+			want: price(0),
+		},
+		{
+			name: "invalid price",
+			feed: func() {
+				feed.feed(state("a"), blockchain.NoPrice, now)
+				feed.feed(state("b"), 0, now)
+			},
+			want: price(0),
+		},
+		{
+			name:   "all stale",
+			feed:   func() {},
+			passed: time.Minute * 9,
+			want:   blockchain.NoPrice,
+		},
+	}
+
+	for _, test := range tests {
+		now = now.Add(test.passed)
+		test.feed()
+		if got := feed.PriceToMine(); got != test.want {
+			t.Fatalf("%s: unexpected price to mine -- got %v, want %v",
+				test.name, got.Float(), test.want.Float())
+		}
+	}
+
+	last := feed.LastPrice()
+	if last == nil || last.Price != price(1) {
+		t.Fatalf("LastPrice: unexpected last price %+v", last)
+	}
+}
+
+// TestFeedRun ensures a started feed records the prices of its sources until
+// it is stopped.
+func TestFeedRun(t *testing.T) {
+	t.Parallel()
+
+	source := &stubSource{
+		name:   "stub",
+		prices: make(chan blockchain.PriceDesc),
+	}
+	feed, err := New(&Config{
+		Sources:    []SourceConfig{{Source: source, MaxAge: time.Hour}},
+		MinSources: 1,
+	})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+
+	feed.Start()
+	source.prices <- blockchain.PriceDesc{
+		Price:     blockchain.PriceFromFloat(1.5),
+		Timestamp: time.Now(),
+	}
+	// The unbuffered channel is read again once the first price is fed.
+	source.prices <- blockchain.PriceDesc{
+		Price:     blockchain.PriceFromFloat(1.25),
+		Timestamp: time.Now(),
+	}
+	feed.Stop()
+
+	want := blockchain.PriceFromFloat(0.25)
+	if got := feed.PriceToMine(); got != want {
+		t.Fatalf("PriceToMine: unexpected price -- got %v, want %v",
+			got.Float(), want.Float())
+	}
+}
+
+// TestNewFeed ensures invalid configurations are rejected.
+func TestNewFeed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{
+			name: "no minimum",
+			cfg: Config{Sources: []SourceConfig{
+				{Source: NewRPCSource("a", nil)},
+			}},
+		},
+		{
+			name: "duplicate names",
+			cfg: Config{
+				Sources: []SourceConfig{
+					{Source: NewRPCSource("a", nil)},
+					{Source: NewRPCSource("a", nil)},
+				},
+				MinSources: 1,
+			},
+		},
+		{
+			name: "minimum above sources",
+			cfg: Config{
+				Sources: []SourceConfig{
+					{Source: NewRPCSource("a", nil)},
+				},
+				MinSources: 2,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := New(&test.cfg); err == nil {
+			t.Errorf("%s: New: unexpected success", test.name)
+		}
+	}
+}
+
+// TestFeedRPC ensures the prices fed by RPC are checked against the signature
+// requirements of their source and the band of the feed, and that all of them
+// are recorded in the history.
+func TestFeedRPC(t *testing.T) {
+	t.Parallel()
+
+	key, err := chainec.NewPrivateKey(chainec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+	otherKey, err := chainec.NewPrivateKey(chainec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+
+	now := time.Unix(1546300800, 0)
+	feed, err := New(&Config{
+		Sources: []SourceConfig{
+			{Source: NewRPCSource(RPCSourceName, nil), MaxAge: time.Hour},
+			{Source: NewRPCSource("signed", key.PubKey()), MaxAge: time.Hour},
+			{Source: &stubSource{name: "stub"}, MaxAge: time.Hour},
+		},
+		MinSources:  1,
+		Band:        0.1,
+		HistorySize: 4,
+	})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	feed.timeNow = func() time.Time { return now }
+
+	price := func(f float64) blockchain.Price {
+		return blockchain.PriceFromFloat(f)
+	}
+	sign := func(key *chainec.PrivateKey, source string, price blockchain.Price, timestamp int64) []byte {
+		sig, err := SignFeed(key, source, price, timestamp)
+		if err != nil {
+			t.Fatalf("SignFeed: unexpected error: %v", err)
+		}
+		return sig
+	}
+	ts := now.Unix()
+
+	tests := []struct {
+		name      string
+		source    string
+		price     blockchain.Price
+		timestamp int64
+		sig       []byte
+		accepted  bool
+		recorded  bool
+	}{
+		{"unsigned", RPCSourceName, price(1.05), 0, nil, true, true},
+		{"unsigned out of band", RPCSourceName, price(1.2), 0, nil, false, true},
+		{"unsigned in band", RPCSourceName, price(1.15), 0, nil, true, true},
+		{"unsigned with signature", RPCSourceName, price(1.1), 0,
+			sign(key, RPCSourceName, price(1.1), ts), false, false},
+		{"unknown source", "unknown", price(1), 0, nil, false, false},
+		{"not an RPC source", "stub", price(1), 0, nil, false, false},
+		{"signed without signature", "signed", price(1), ts, nil, false, false},
+		{"signed by another key", "signed", price(1), ts,
+			sign(otherKey, "signed", price(1), ts), false, false},
+		{"signed for another price", "signed", price(1), ts,
+			sign(key, "signed", price(1.01), ts), false, false},
+		{"signed in the future", "signed", price(1), ts + 120,
+			sign(key, "signed", price(1), ts+120), false, false},
+		{"signed", "signed", price(1), ts - 10,
+			sign(key, "signed", price(1), ts-10), true, true},
+		{"signed replay", "signed", price(1), ts - 10,
+			sign(key, "signed", price(1), ts-10), false, false},
+		{"signed invalid price", "signed", 0, ts,
+			sign(key, "signed", 0, ts), false, true},
+	}
+
+	recorded := 0
+	for _, test := range tests {
+		err := feed.FeedRPC(test.source, test.price, test.timestamp,
+			test.sig)
+		if (err == nil) != test.accepted {
+			t.Fatalf("%s: FeedRPC: unexpected error %v", test.name,
+				err)
+		}
+		if test.recorded {
+			recorded++
+		}
+	}
+
+	// The history keeps the last 4 recorded feeds, oldest first.
+	snapshot := feed.Snapshot()
+	if recorded != 5 || len(snapshot.History) != 4 {
+		t.Fatalf("Snapshot: unexpected history of %d feeds out of %d",
+			len(snapshot.History), recorded)
+	}
+	wantHistory := []struct {
+		price    blockchain.Price
+		rejected bool
+	}{
+		{price(1.2), true},
+		{price(1.15), false},
+		{price(1), false},
+		{0, true},
+	}
+	for i, want := range wantHistory {
+		rec := snapshot.History[i]
+		if rec.Price != want.price || (rec.Rejected != "") != want.rejected {
+			t.Fatalf("Snapshot: unexpected feed #%d %+v", i, rec)
+		}
+	}
+
+	// The signed price is accepted with its own time.
+	status := snapshot.Sources[1]
+	if !status.Signed || !status.Fresh || status.Last == nil ||
+		status.Last.Timestamp.Unix() != ts-10 {
+		t.Fatalf("Snapshot: unexpected signed source status %+v", status)
+	}
+	if snapshot.Sources[0].Signed || snapshot.Sources[2].Fresh {
+		t.Fatalf("Snapshot: unexpected source statuses %+v",
+			snapshot.Sources)
+	}
+
+	want := price(1.075)
+	if snapshot.MedianPrice != want ||
+		snapshot.PriceToMine != want-blockchain.PriceUnit ||
+		snapshot.Reason == "" {
+		t.Fatalf("Snapshot: unexpected price to mine %v, median %v",
+			snapshot.PriceToMine.Float(), snapshot.MedianPrice.Float())
+	}
+
+	// The band no longer applies once the last price is stale.
+	now = now.Add(time.Hour * 2)
+	if err := feed.FeedRPC(RPCSourceName, price(2), 0, nil); err != nil {
+		t.Fatalf("FeedRPC: unexpected error after the last price is "+
+			"stale: %v", err)
+	}
+	snapshot = feed.Snapshot()
+	if snapshot.MedianPrice != price(2) {
+		t.Fatalf("Snapshot: unexpected median %v",
+			snapshot.MedianPrice.Float())
+	}
+}
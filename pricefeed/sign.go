@@ -0,0 +1,52 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pricefeed
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainec"
+	"github.com/endurio/ndrd/wire"
+)
+
+// feedMessageMagic prefixes the messages signed by the price feeders so the
+// signatures can not be mistaken for the ones of other messages.
+const feedMessageMagic = "Endurio Signed Price Feed:\n"
+
+// feedMessageHash returns the hash signed by a price feeder to feed the passed
+// price under the passed source name at the passed unix time.  The price is in
+// units of blockchain.PriceUnit.
+func feedMessageHash(source string, price blockchain.Price, timestamp int64) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarString(&buf, 0, feedMessageMagic)
+	wire.WriteVarString(&buf, 0, source)
+	var scratch [16]byte
+	binary.LittleEndian.PutUint64(scratch[:8], uint64(price))
+	binary.LittleEndian.PutUint64(scratch[8:], uint64(timestamp))
+	buf.Write(scratch[:])
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// SignFeed returns the compact signature of a feed of the passed price under the
+// passed source name at the passed unix time, which the feedprice RPC accepts
+// for a source configured with the public key of the passed private key.
+func SignFeed(key *chainec.PrivateKey, source string, price blockchain.Price, timestamp int64) ([]byte, error) {
+	return chainec.SignCompact(chainec.S256(), key,
+		feedMessageHash(source, price, timestamp), true)
+}
+
+// verifyFeed returns whether the passed compact signature of a feed was made by
+// the private key of the passed public key.
+func verifyFeed(pubKey *chainec.PublicKey, sig []byte, source string, price blockchain.Price, timestamp int64) bool {
+	signer, _, err := chainec.RecoverCompact(chainec.S256(), sig,
+		feedMessageHash(source, price, timestamp))
+	if err != nil {
+		return false
+	}
+	return signer.IsEqual(pubKey)
+}
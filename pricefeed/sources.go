@@ -0,0 +1,304 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pricefeed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+	"github.com/endurio/ndrd/chainec"
+)
+
+// maxResponseSize is the maximum number of bytes of the document served by the
+// endpoint of an HTTP source that is read.  A price never needs more, so the
+// rest of a larger document is ignored and it fails to decode.
+const maxResponseSize = 1 << 20
+
+// DialFunc connects to the address on the named network within the passed
+// timeout, such as net.DialTimeout or the dial function of a proxy.
+type DialFunc func(network, addr string, timeout time.Duration) (net.Conn, error)
+
+// parsePrice parses the passed decimal market price, which must be positive.
+func parsePrice(s string) (blockchain.Price, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return blockchain.NoPrice, err
+	}
+	if f <= 0 || math.IsInf(f, 0) {
+		return blockchain.NoPrice, fmt.Errorf("price %v is not "+
+			"positive", f)
+	}
+	price := blockchain.PriceFromFloat(f)
+	if price == blockchain.NoPrice {
+		return blockchain.NoPrice, fmt.Errorf("price %v is out of "+
+			"range", f)
+	}
+	return price, nil
+}
+
+// rpcSource is a source whose prices are fed by RPC, so it has nothing to
+// fetch on its own.  The feeds of a source with a public key must be signed by
+// the matching private key.
+type rpcSource struct {
+	name   string
+	pubKey *chainec.PublicKey
+}
+
+// Name returns the name of the source.
+//
+// This is part of the Source interface implementation.
+func (s *rpcSource) Name() string {
+	return s.name
+}
+
+// Run waits for the quit channel to be closed, since the prices of the source
+// are fed by RPC.
+//
+// This is part of the Source interface implementation.
+func (s *rpcSource) Run(_ func(blockchain.Price, time.Time), quit <-chan struct{}) {
+	<-quit
+}
+
+// NewRPCSource returns a new source with the passed name for the prices fed by
+// RPC.  When a public key is passed, the source only accepts the feeds signed by
+// the matching private key with SignFeed.  Otherwise, it accepts the feeds of
+// any RPC client.
+func NewRPCSource(name string, pubKey *chainec.PublicKey) Source {
+	return &rpcSource{name: name, pubKey: pubKey}
+}
+
+// fileSource is a source which reads the price from a local file whenever the
+// file is modified.  The file holds the decimal price only.
+type fileSource struct {
+	name     string
+	path     string
+	interval time.Duration
+	modTime  time.Time
+}
+
+// Name returns the name of the source.
+//
+// This is part of the Source interface implementation.
+func (s *fileSource) Name() string {
+	return s.name
+}
+
+// poll reads the price from the file when it was modified since the last read,
+// and feeds it with the modification time of the file.
+func (s *fileSource) poll(feed func(blockchain.Price, time.Time)) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		log.Warnf("Unable to read price source %s: %v", s.name, err)
+		return
+	}
+	if !info.ModTime().After(s.modTime) {
+		return
+	}
+	s.modTime = info.ModTime()
+
+	contents, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		log.Warnf("Unable to read price source %s: %v", s.name, err)
+		return
+	}
+	price, err := parsePrice(string(contents))
+	if err != nil {
+		log.Warnf("Invalid price from source %s: %v", s.name, err)
+		return
+	}
+	feed(price, s.modTime)
+}
+
+// Run watches the file of the source for modifications at the configured
+// interval, and feeds the price it holds after each of them.
+//
+// This is part of the Source interface implementation.
+func (s *fileSource) Run(feed func(blockchain.Price, time.Time), quit <-chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.poll(feed)
+
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// NewFileSource returns a new source with the passed name which reads the price
+// from the file at the passed path, checking it for modifications at the passed
+// interval.
+func NewFileSource(name, path string, interval time.Duration) Source {
+	return &fileSource{
+		name:     name,
+		path:     path,
+		interval: interval,
+	}
+}
+
+// httpSource is a source which polls the price from an HTTP endpoint serving a
+// JSON document.
+type httpSource struct {
+	name     string
+	url      string
+	field    []string
+	interval time.Duration
+	client   *http.Client
+}
+
+// Name returns the name of the source.
+//
+// This is part of the Source interface implementation.
+func (s *httpSource) Name() string {
+	return s.name
+}
+
+// jsonField returns the field at the passed path of the passed decoded JSON
+// document.  Each element of the path is either the key of an object or the
+// index of an array.
+func jsonField(doc interface{}, path []string) (interface{}, error) {
+	for i, elem := range path {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			field, ok := v[elem]
+			if !ok {
+				return nil, fmt.Errorf("no field %q",
+					strings.Join(path[:i+1], "."))
+			}
+			doc = field
+
+		case []interface{}:
+			index, err := strconv.Atoi(elem)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("no element %q",
+					strings.Join(path[:i+1], "."))
+			}
+			doc = v[index]
+
+		default:
+			return nil, fmt.Errorf("%q is not an object or an array",
+				strings.Join(path[:i], "."))
+		}
+	}
+	return doc, nil
+}
+
+// fetch returns the price served by the endpoint of the source.  The price is
+// either a JSON number or a string holding a decimal number.
+func (s *httpSource) fetch() (blockchain.Price, error) {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return blockchain.NoPrice, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return blockchain.NoPrice, fmt.Errorf("unexpected status %s",
+			resp.Status)
+	}
+
+	var doc interface{}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return blockchain.NoPrice, err
+	}
+	field, err := jsonField(doc, s.field)
+	if err != nil {
+		return blockchain.NoPrice, err
+	}
+	switch v := field.(type) {
+	case json.Number:
+		return parsePrice(v.String())
+	case string:
+		return parsePrice(v)
+	}
+	return blockchain.NoPrice, fmt.Errorf("field %q is not a number",
+		strings.Join(s.field, "."))
+}
+
+// Run polls the endpoint of the source at the configured interval, and feeds
+// each price it serves with the time it was fetched.
+//
+// This is part of the Source interface implementation.
+func (s *httpSource) Run(feed func(blockchain.Price, time.Time), quit <-chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		price, err := s.fetch()
+		if err != nil {
+			log.Warnf("Unable to fetch price source %s: %v", s.name,
+				err)
+		} else {
+			feed(price, time.Now())
+		}
+
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// NewHTTPSource returns a new source with the passed name which polls the price
+// from the passed HTTP or HTTPS URL at the passed interval.  The fragment of the
+// URL, when any, is the dot separated path of the price in the JSON document
+// served, such as "data.0.price".  Otherwise, the document is the price itself.
+//
+// The connections to the endpoint are made with the passed dial function, so
+// they go through the same proxy as the rest of the node, or with
+// net.DialTimeout when it is nil.
+func NewHTTPSource(name, rawURL string, interval time.Duration, dial DialFunc) (Source, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("price source URL %q is not an HTTP or "+
+			"HTTPS URL", rawURL)
+	}
+
+	var field []string
+	if u.Fragment != "" {
+		field = strings.Split(u.Fragment, ".")
+	}
+	u.Fragment = ""
+
+	if dial == nil {
+		dial = net.DialTimeout
+	}
+	transport := &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return dial(network, addr, interval)
+		},
+		TLSHandshakeTimeout: interval,
+	}
+
+	return &httpSource{
+		name:     name,
+		url:      u.String(),
+		field:    field,
+		interval: interval,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   interval,
+		},
+	}, nil
+}
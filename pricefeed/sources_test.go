@@ -0,0 +1,199 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package pricefeed
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/endurio/ndrd/blockchain"
+)
+
+// collectFeed returns a feed function which passes the fed prices to the
+// returned channel, dropping them when it is full so a running source never
+// blocks.
+func collectFeed() (func(blockchain.Price, time.Time), chan blockchain.PriceDesc) {
+	c := make(chan blockchain.PriceDesc, 16)
+	return func(price blockchain.Price, timestamp time.Time) {
+		select {
+		case c <- blockchain.PriceDesc{Price: price, Timestamp: timestamp}:
+		default:
+		}
+	}, c
+}
+
+// TestFileSource ensures the file source feeds the price of its file whenever
+// the file is modified, and ignores invalid contents.
+func TestFileSource(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pricefeed")
+	if err != nil {
+		t.Fatalf("TempDir: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "price")
+
+	source := NewFileSource("file", path, time.Hour).(*fileSource)
+	feed, prices := collectFeed()
+
+	// A missing file feeds nothing.
+	source.poll(feed)
+	if len(prices) != 0 {
+		t.Fatal("poll: unexpected price fed for a missing file")
+	}
+
+	write := func(contents string, modTime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatalf("WriteFile: unexpected error: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes: unexpected error: %v", err)
+		}
+	}
+	modTime := time.Unix(1546300800, 0)
+	write("1.05\n", modTime)
+	source.poll(feed)
+	source.poll(feed)
+	if len(prices) != 1 {
+		t.Fatalf("poll: unexpected number of prices fed -- got %d, "+
+			"want 1", len(prices))
+	}
+	desc := <-prices
+	if desc.Price != blockchain.PriceFromFloat(1.05) ||
+		!desc.Timestamp.Equal(modTime) {
+		t.Fatalf("poll: unexpected price fed %+v", desc)
+	}
+
+	for _, contents := range []string{"abc", "-1", "0"} {
+		modTime = modTime.Add(time.Second)
+		write(contents, modTime)
+		source.poll(feed)
+		if len(prices) != 0 {
+			t.Fatalf("poll: unexpected price fed for %q", contents)
+		}
+	}
+}
+
+// TestHTTPSource ensures the HTTP source feeds the price at the configured path
+// of the JSON document served by a local endpoint.
+func TestHTTPSource(t *testing.T) {
+	t.Parallel()
+
+	body := `{"data":[{"price":"1.5"},{"price":0.98}]}`
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+		}))
+	defer server.Close()
+
+	tests := []struct {
+		fragment string
+		want     blockchain.Price
+	}{
+		{"#data.0.price", blockchain.PriceFromFloat(1.5)},
+		{"#data.1.price", blockchain.PriceFromFloat(0.98)},
+		{"#data.2.price", blockchain.NoPrice},
+		{"#data.price", blockchain.NoPrice},
+		{"#data.0.price.value", blockchain.NoPrice},
+		{"#data.0", blockchain.NoPrice},
+		{"", blockchain.NoPrice},
+	}
+	for _, test := range tests {
+		source, err := NewHTTPSource("http", server.URL+test.fragment,
+			time.Second, nil)
+		if err != nil {
+			t.Fatalf("NewHTTPSource: unexpected error: %v", err)
+		}
+		price, err := source.(*httpSource).fetch()
+		if price != test.want || (err == nil) != (test.want != blockchain.NoPrice) {
+			t.Fatalf("fetch %q: unexpected price %v, error %v",
+				test.fragment, price.Float(), err)
+		}
+	}
+
+	// The source keeps polling the endpoint until it is stopped.
+	source, err := NewHTTPSource("http", server.URL+"#data.1.price",
+		time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPSource: unexpected error: %v", err)
+	}
+	feed, prices := collectFeed()
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		source.Run(feed, quit)
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		if desc := <-prices; desc.Price != blockchain.PriceFromFloat(0.98) {
+			t.Fatalf("Run: unexpected price fed %+v", desc)
+		}
+	}
+	close(quit)
+	<-done
+
+	// Errors of the endpoint feed nothing.
+	status = http.StatusInternalServerError
+	if _, err := source.(*httpSource).fetch(); err == nil {
+		t.Fatal("fetch: unexpected success with an error status")
+	}
+
+	if _, err := NewHTTPSource("ftp", "ftp://localhost/price", time.Second, nil); err == nil {
+		t.Fatal("NewHTTPSource: unexpected success with an FTP URL")
+	}
+}
+
+// TestHTTPSourceDial ensures the HTTP source connects with the passed dial
+// function, and does not read more than the maximum size of a document.
+func TestHTTPSourceDial(t *testing.T) {
+	t.Parallel()
+
+	body := `{"price":"1.5"}`
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+	defer server.Close()
+
+	var dialed []string
+	dial := func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return net.DialTimeout(network, addr, timeout)
+	}
+	source, err := NewHTTPSource("http", server.URL+"#price", time.Second,
+		dial)
+	if err != nil {
+		t.Fatalf("NewHTTPSource: unexpected error: %v", err)
+	}
+	price, err := source.(*httpSource).fetch()
+	if err != nil || price != blockchain.PriceFromFloat(1.5) {
+		t.Fatalf("fetch: unexpected price %v, error %v", price.Float(),
+			err)
+	}
+	host := strings.TrimPrefix(server.URL, "http://")
+	if len(dialed) != 1 || dialed[0] != host {
+		t.Fatalf("fetch: unexpected addresses dialed %v, want %v",
+			dialed, host)
+	}
+
+	// A document larger than the maximum size is truncated, so it fails to
+	// decode.
+	body = `{"price":"1.5","padding":"` +
+		strings.Repeat("0", maxResponseSize) + `"}`
+	if _, err := source.(*httpSource).fetch(); err == nil {
+		t.Fatal("fetch: unexpected success with an oversized document")
+	}
+}
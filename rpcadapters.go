@@ -230,6 +230,25 @@ func (cm *rpcConnManager) RelayOrders(orders []*mempool.OdrDesc) {
 	cm.server.relayOrders(orders)
 }
 
+// CancelOrder removes the order withdrawn by the passed cancel message from the
+// order book and relays the message to all connected peers.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) CancelOrder(msg *wire.MsgCancelOdr) (*mempool.OdrDesc, bool, error) {
+	return cm.server.CancelOrder(msg, nil)
+}
+
+// OrdersRemoved stops rebroadcasting the passed orders which were removed from
+// the order book without being filled, and notifies the long poll clients
+// about their removal.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) OrdersRemoved(orders []*mempool.OdrDesc) {
+	cm.server.OrdersRemoved(orders)
+}
+
 // rpcSyncMgr provides a block manager for use with the RPC server and
 // implements the rpcserverSyncManager interface.
 type rpcSyncMgr struct {
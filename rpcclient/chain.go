@@ -13,6 +13,7 @@ import (
 
 	"github.com/endurio/ndrd/chainjson"
 	"github.com/endurio/ndrd/chaincfg/chainhash"
+	"github.com/endurio/ndrd/chainutil"
 	"github.com/endurio/ndrd/wire"
 )
 
@@ -516,6 +517,283 @@ func (c *Client) GetRawMempool() ([]*chainhash.Hash, error) {
 	return c.GetRawMempoolAsync().Receive()
 }
 
+// FutureGetOrderBookSnapshotResult is a future promise to deliver the result
+// of a GetOrderBookSnapshotAsync RPC invocation (or an applicable error).
+type FutureGetOrderBookSnapshotResult chan *response
+
+// Receive waits for the response promised by the future and returns all of
+// the orders in the order book along with the sequence number of the last
+// change made to it.
+func (r FutureGetOrderBookSnapshotResult) Receive() (*chainjson.GetOrderBookSnapshotResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a getorderbooksnapshot result object.
+	var snapshot chainjson.GetOrderBookSnapshotResult
+	err = json.Unmarshal(res, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetOrderBookSnapshotAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetOrderBookSnapshot for the blocking version and more details.
+func (c *Client) GetOrderBookSnapshotAsync() FutureGetOrderBookSnapshotResult {
+	cmd := chainjson.NewGetOrderBookSnapshotCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetOrderBookSnapshot returns all of the orders in the order book along with
+// the sequence number of the last change made to it.
+//
+// See NotifyOrderBook to keep the snapshot in sync with the order book.
+func (c *Client) GetOrderBookSnapshot() (*chainjson.GetOrderBookSnapshotResult, error) {
+	return c.GetOrderBookSnapshotAsync().Receive()
+}
+
+// FutureGetAbsorptionInfoResult is a future promise to deliver the result of a
+// GetAbsorptionInfoAsync RPC invocation (or an applicable error).
+type FutureGetAbsorptionInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// absorption state of the STB supply at the requested block.
+func (r FutureGetAbsorptionInfoResult) Receive() (*chainjson.GetAbsorptionInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a getabsorptioninfo result object.
+	var info chainjson.GetAbsorptionInfoResult
+	err = json.Unmarshal(res, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetAbsorptionInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetAbsorptionInfo for the blocking version and more details.
+func (c *Client) GetAbsorptionInfoAsync(blockHash *chainhash.Hash) FutureGetAbsorptionInfoResult {
+	var hash *string
+	if blockHash != nil {
+		hash = chainjson.String(blockHash.String())
+	}
+
+	cmd := chainjson.NewGetAbsorptionInfoCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// GetAbsorptionInfo returns the absorption state of the STB supply at the block
+// of the main chain with the given hash, or at the best block when the hash is
+// nil, along with when the next absorption can be triggered.
+func (c *Client) GetAbsorptionInfo(blockHash *chainhash.Hash) (*chainjson.GetAbsorptionInfoResult, error) {
+	return c.GetAbsorptionInfoAsync(blockHash).Receive()
+}
+
+// FutureGetPriceHistoryResult is a future promise to deliver the result of a
+// GetPriceHistoryAsync RPC invocation (or an applicable error).
+type FutureGetPriceHistoryResult chan *response
+
+// Receive waits for the response promised by the future and returns the price
+// statistics of each bucket of the requested range.
+func (r FutureGetPriceHistoryResult) Receive() ([]chainjson.GetPriceHistoryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an array of getpricehistory result objects.
+	var history []chainjson.GetPriceHistoryResult
+	err = json.Unmarshal(res, &history)
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// GetPriceHistoryAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetPriceHistory for the blocking version and more details.
+func (c *Client) GetPriceHistoryAsync(start, end, bucketSize int64, byTime bool) FutureGetPriceHistoryResult {
+	cmd := chainjson.NewGetPriceHistoryCmd(start, &end, &bucketSize, &byTime)
+	return c.sendCmd(cmd)
+}
+
+// GetPriceHistory returns the statistics of the prices carried by the headers
+// of the blocks of the main chain between start and end, inclusive, in buckets
+// of bucketSize.  The range and the bucket size are in unix time and seconds
+// when byTime is set, and in heights otherwise.
+func (c *Client) GetPriceHistory(start, end, bucketSize int64, byTime bool) ([]chainjson.GetPriceHistoryResult, error) {
+	return c.GetPriceHistoryAsync(start, end, bucketSize, byTime).Receive()
+}
+
+// FutureGetSupplyHistoryResult is a future promise to deliver the result of a
+// GetSupplyHistoryAsync RPC invocation (or an applicable error).
+type FutureGetSupplyHistoryResult chan *response
+
+// Receive waits for the response promised by the future and returns how the
+// requested blocks changed the STB supply.
+func (r FutureGetSupplyHistoryResult) Receive() ([]chainjson.GetSupplyHistoryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an array of getsupplyhistory result objects.
+	var history []chainjson.GetSupplyHistoryResult
+	err = json.Unmarshal(res, &history)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// GetSupplyHistoryAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetSupplyHistory for the blocking version and more details.
+func (c *Client) GetSupplyHistoryAsync(startHeight int32, count int) FutureGetSupplyHistoryResult {
+	cmd := chainjson.NewGetSupplyHistoryCmd(int(startHeight), &count)
+	return c.sendCmd(cmd)
+}
+
+// GetSupplyHistory returns how at most count blocks of the main chain, starting
+// at the given height, changed the STB supply.  It requires the supply index to
+// be enabled on the server.
+func (c *Client) GetSupplyHistory(startHeight int32, count int) ([]chainjson.GetSupplyHistoryResult, error) {
+	return c.GetSupplyHistoryAsync(startHeight, count).Receive()
+}
+
+// FutureGetTxOutSetInfoResult is a future promise to deliver the result of a
+// GetTxOutSetInfoAsync RPC invocation (or an applicable error).
+type FutureGetTxOutSetInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// statistics of the unspent transaction outputs.
+func (r FutureGetTxOutSetInfoResult) Receive() (*chainjson.GetTxOutSetInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a gettxoutsetinfo result object.
+	var info chainjson.GetTxOutSetInfoResult
+	err = json.Unmarshal(res, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetTxOutSetInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetTxOutSetInfo for the blocking version and more details.
+func (c *Client) GetTxOutSetInfoAsync() FutureGetTxOutSetInfoResult {
+	cmd := chainjson.NewGetTxOutSetInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetTxOutSetInfo returns the statistics of the unspent transaction outputs of
+// each token as of the best block, and whether the STB outputs match the total
+// supply.  The server walks the whole set, which may take a while.
+func (c *Client) GetTxOutSetInfo() (*chainjson.GetTxOutSetInfoResult, error) {
+	return c.GetTxOutSetInfoAsync().Receive()
+}
+
+// FutureGetAddressBalanceResult is a future promise to deliver the result of a
+// GetAddressBalanceAsync RPC invocation (or an applicable error).
+type FutureGetAddressBalanceResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// balance of each token of the requested address.
+func (r FutureGetAddressBalanceResult) Receive() (*chainjson.GetAddressBalanceResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a getaddressbalance result object.
+	var balance chainjson.GetAddressBalanceResult
+	err = json.Unmarshal(res, &balance)
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// GetAddressBalanceAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetAddressBalance for the blocking version and more details.
+func (c *Client) GetAddressBalanceAsync(address chainutil.Address) FutureGetAddressBalanceResult {
+	cmd := chainjson.NewGetAddressBalanceCmd(address.EncodeAddress())
+	return c.sendCmd(cmd)
+}
+
+// GetAddressBalance returns the number and the total amount of the unspent
+// outputs of each token paying the passed address.  It requires the balance
+// index to be enabled on the server.
+func (c *Client) GetAddressBalance(address chainutil.Address) (*chainjson.GetAddressBalanceResult, error) {
+	return c.GetAddressBalanceAsync(address).Receive()
+}
+
+// FutureGetAddressUtxosResult is a future promise to deliver the result of a
+// GetAddressUtxosAsync RPC invocation (or an applicable error).
+type FutureGetAddressUtxosResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// unspent outputs paying the requested address.
+func (r FutureGetAddressUtxosResult) Receive() ([]chainjson.GetAddressUtxosResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an array of getaddressutxos result objects.
+	var utxos []chainjson.GetAddressUtxosResult
+	err = json.Unmarshal(res, &utxos)
+	if err != nil {
+		return nil, err
+	}
+	return utxos, nil
+}
+
+// GetAddressUtxosAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetAddressUtxos for the blocking version and more details.
+func (c *Client) GetAddressUtxosAsync(address chainutil.Address, token *string, skip, count int) FutureGetAddressUtxosResult {
+	cmd := chainjson.NewGetAddressUtxosCmd(address.EncodeAddress(), token,
+		&skip, &count)
+	return c.sendCmd(cmd)
+}
+
+// GetAddressUtxos returns the unspent outputs paying the passed address, only
+// of the passed token unless it is nil.  The first skip outputs are left out,
+// and at most count outputs are returned, which the server may cap.  It
+// requires the balance index to be enabled on the server.
+func (c *Client) GetAddressUtxos(address chainutil.Address, token *string, skip, count int) ([]chainjson.GetAddressUtxosResult, error) {
+	return c.GetAddressUtxosAsync(address, token, skip, count).Receive()
+}
+
 // FutureGetRawMempoolVerboseResult is a future promise to deliver the result of
 // a GetRawMempoolVerboseAsync RPC invocation (or an applicable error).
 type FutureGetRawMempoolVerboseResult chan *response
@@ -585,14 +863,16 @@ func (r FutureEstimateFeeResult) Receive() (float64, error) {
 // returned instance.
 //
 // See EstimateFee for the blocking version and more details.
-func (c *Client) EstimateFeeAsync(numBlocks int64) FutureEstimateFeeResult {
-	cmd := chainjson.NewEstimateFeeCmd(numBlocks)
+func (c *Client) EstimateFeeAsync(numBlocks int64, token *string, combined *bool) FutureEstimateFeeResult {
+	cmd := chainjson.NewEstimateFeeCmd(numBlocks, token, combined)
 	return c.sendCmd(cmd)
 }
 
-// EstimateFee provides an estimated fee  in bitcoins per kilobyte.
-func (c *Client) EstimateFee(numBlocks int64) (float64, error) {
-	return c.EstimateFeeAsync(numBlocks).Receive()
+// EstimateFee provides an estimated fee  in bitcoins per kilobyte, paid in the
+// passed token, or NDR when it is nil.  The estimate is made from the fees paid
+// in every token when combined is set.
+func (c *Client) EstimateFee(numBlocks int64, token *string, combined *bool) (float64, error) {
+	return c.EstimateFeeAsync(numBlocks, token, combined).Receive()
 }
 
 // FutureVerifyChainResult is a future promise to deliver the result of a
@@ -250,6 +250,9 @@ func (c *Client) trackRegisteredNtfns(cmd interface{}) {
 
 		}
 
+	case *chainjson.NotifyOrderBookCmd:
+		c.ntfnState.notifyOrderBook = true
+
 	case *chainjson.NotifySpentCmd:
 		for _, op := range bcmd.OutPoints {
 			c.ntfnState.notifySpent[op] = struct{}{}
@@ -524,6 +527,14 @@ func (c *Client) reregisterNtfns() error {
 		}
 	}
 
+	// Reregister notifyorderbook if needed.
+	if stateCopy.notifyOrderBook {
+		log.Debugf("Reregistering [notifyorderbook]")
+		if err := c.NotifyOrderBook(); err != nil {
+			return err
+		}
+	}
+
 	// Reregister notifyneworders if needed.
 	if stateCopy.notifyNewOdr || stateCopy.notifyNewOdrVerbose {
 		log.Debugf("Reregistering [notifyneworders] (verbose=%v)",
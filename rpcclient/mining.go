@@ -202,6 +202,44 @@ func (c *Client) GetMiningInfo() (*chainjson.GetMiningInfoResult, error) {
 	return c.GetMiningInfoAsync().Receive()
 }
 
+// FutureGetPriceFeedResult is a future promise to deliver the result of a
+// GetPriceFeedAsync RPC invocation (or an applicable error).
+type FutureGetPriceFeedResult chan *response
+
+// Receive waits for the response promised by the future and returns the state
+// of the price feed.
+func (r FutureGetPriceFeedResult) Receive() (*chainjson.GetPriceFeedResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a getpricefeed result object.
+	var feedResult chainjson.GetPriceFeedResult
+	err = json.Unmarshal(res, &feedResult)
+	if err != nil {
+		return nil, err
+	}
+
+	return &feedResult, nil
+}
+
+// GetPriceFeedAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetPriceFeed for the blocking version and more details.
+func (c *Client) GetPriceFeedAsync() FutureGetPriceFeedResult {
+	cmd := chainjson.NewGetPriceFeedCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetPriceFeed returns the price sources of the server, their recent feeds, and
+// which price will be mined next and why.
+func (c *Client) GetPriceFeed() (*chainjson.GetPriceFeedResult, error) {
+	return c.GetPriceFeedAsync().Receive()
+}
+
 // FutureGetNetworkHashPS is a future promise to deliver the result of a
 // GetNetworkHashPSAsync RPC invocation (or an applicable error).
 type FutureGetNetworkHashPS chan *response
@@ -39,6 +39,7 @@ type notificationState struct {
 	notifyNewTxVerbose  bool
 	notifyNewOdr        bool
 	notifyNewOdrVerbose bool
+	notifyOrderBook     bool
 	notifyReceived      map[string]struct{}
 	notifySpent         map[chainjson.OutPoint]struct{}
 }
@@ -49,6 +50,7 @@ func (s *notificationState) Copy() *notificationState {
 	stateCopy.notifyBlocks = s.notifyBlocks
 	stateCopy.notifyNewTx = s.notifyNewTx
 	stateCopy.notifyNewTxVerbose = s.notifyNewTxVerbose
+	stateCopy.notifyOrderBook = s.notifyOrderBook
 	stateCopy.notifyReceived = make(map[string]struct{})
 	for addr := range s.notifyReceived {
 		stateCopy.notifyReceived[addr] = struct{}{}
@@ -183,6 +185,50 @@ type NotificationHandlers struct {
 	// made to register for the notification and the function is non-nil.
 	OnTxAcceptedVerbose func(txDetails *chainjson.TxRawResult)
 
+	// OnOrderBookDelta is invoked when an order is added to or removed from
+	// the order book.  The sequence number increases by one with every
+	// change, so a snapshot from GetOrderBookSnapshot is kept in sync by
+	// applying the deltas with higher sequence numbers.  It will only be
+	// invoked if a preceding call to NotifyOrderBook has been made to
+	// register for the notification and the function is non-nil.
+	OnOrderBookDelta func(sequence uint64, action string, order *chainjson.OrderBookEntryResult)
+
+	// OnAbsorptionStarted is invoked when a block connected to the main
+	// chain triggers an absorption.  It will only be invoked if a
+	// preceding call to NotifyBlocks has been made to register for the
+	// notification and the function is non-nil.
+	OnAbsorptionStarted func(absn *chainjson.AbsorptionStartedNtfn)
+
+	// OnAbsorptionEnded is invoked when a block connected to the main
+	// chain is the last block of an absorption.  It will only be invoked
+	// if a preceding call to NotifyBlocks has been made to register for the
+	// notification and the function is non-nil.
+	OnAbsorptionEnded func(absn *chainjson.AbsorptionEndedNtfn)
+
+	// OnOrderFilled is invoked when an order is filled by a block
+	// connected to the main chain.  It will only be invoked if a preceding
+	// call to NotifyBlocks has been made to register for the notification
+	// and the function is non-nil.
+	OnOrderFilled func(order *chainjson.OrderFilledNtfn)
+
+	// OnAbsorptionStartReverted is invoked when a block which triggered
+	// an absorption is disconnected from the main chain.  It will only be
+	// invoked if a preceding call to NotifyBlocks has been made to register
+	// for the notification and the function is non-nil.
+	OnAbsorptionStartReverted func(absn *chainjson.AbsorptionStartRevertedNtfn)
+
+	// OnAbsorptionEndReverted is invoked when a block which was the last
+	// block of an absorption is disconnected from the main chain.  It will
+	// only be invoked if a preceding call to NotifyBlocks has been made to
+	// register for the notification and the function is non-nil.
+	OnAbsorptionEndReverted func(absn *chainjson.AbsorptionEndRevertedNtfn)
+
+	// OnOrderFillReverted is invoked when a block which filled an order is
+	// disconnected from the main chain.  It will only be invoked if a
+	// preceding call to NotifyBlocks has been made to register for the
+	// notification and the function is non-nil.
+	OnOrderFillReverted func(order *chainjson.OrderFillRevertedNtfn)
+
 	// OnBtcdConnected is invoked when a wallet connects or disconnects from
 	// ndrd.
 	//
@@ -413,6 +459,126 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 
 		c.ntfnHandlers.OnTxAcceptedVerbose(rawTx)
 
+	// OnOrderBookDelta
+	case chainjson.OrderBookDeltaNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnOrderBookDelta == nil {
+			return
+		}
+
+		sequence, action, order, err := parseOrderBookDeltaNtfnParams(
+			ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid order book delta "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnOrderBookDelta(sequence, action, order)
+
+	// OnAbsorptionStarted
+	case chainjson.AbsorptionStartedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnAbsorptionStarted == nil {
+			return
+		}
+
+		absn, err := parseChainNtfn(ntfn)
+		if err != nil {
+			log.Warnf("Received invalid absorption started "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnAbsorptionStarted(absn.(*chainjson.AbsorptionStartedNtfn))
+
+	// OnAbsorptionEnded
+	case chainjson.AbsorptionEndedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnAbsorptionEnded == nil {
+			return
+		}
+
+		absn, err := parseChainNtfn(ntfn)
+		if err != nil {
+			log.Warnf("Received invalid absorption ended "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnAbsorptionEnded(absn.(*chainjson.AbsorptionEndedNtfn))
+
+	// OnOrderFilled
+	case chainjson.OrderFilledNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnOrderFilled == nil {
+			return
+		}
+
+		order, err := parseChainNtfn(ntfn)
+		if err != nil {
+			log.Warnf("Received invalid order filled notification: "+
+				"%v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnOrderFilled(order.(*chainjson.OrderFilledNtfn))
+
+	// OnAbsorptionStartReverted
+	case chainjson.AbsorptionStartRevertedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnAbsorptionStartReverted == nil {
+			return
+		}
+
+		absn, err := parseChainNtfn(ntfn)
+		if err != nil {
+			log.Warnf("Received invalid absorption start reverted "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnAbsorptionStartReverted(absn.(*chainjson.AbsorptionStartRevertedNtfn))
+
+	// OnAbsorptionEndReverted
+	case chainjson.AbsorptionEndRevertedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnAbsorptionEndReverted == nil {
+			return
+		}
+
+		absn, err := parseChainNtfn(ntfn)
+		if err != nil {
+			log.Warnf("Received invalid absorption end reverted "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnAbsorptionEndReverted(absn.(*chainjson.AbsorptionEndRevertedNtfn))
+
+	// OnOrderFillReverted
+	case chainjson.OrderFillRevertedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnOrderFillReverted == nil {
+			return
+		}
+
+		order, err := parseChainNtfn(ntfn)
+		if err != nil {
+			log.Warnf("Received invalid order fill reverted "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnOrderFillReverted(order.(*chainjson.OrderFillRevertedNtfn))
+
 	// OnBtcdConnected
 	case chainjson.BtcdConnectedNtfnMethod:
 		// Ignore the notification if the client is not interested in
@@ -779,6 +945,50 @@ func parseTxAcceptedVerboseNtfnParams(params []json.RawMessage) (*chainjson.TxRa
 	return &rawTx, nil
 }
 
+// parseOrderBookDeltaNtfnParams parses out the sequence number, the action and
+// the order from the parameters of an orderbookdelta notification.
+func parseOrderBookDeltaNtfnParams(params []json.RawMessage) (uint64, string,
+	*chainjson.OrderBookEntryResult, error) {
+
+	if len(params) != 3 {
+		return 0, "", nil, wrongNumParams(len(params))
+	}
+
+	// Unmarshal first parameter as an unsigned integer.
+	var sequence uint64
+	err := json.Unmarshal(params[0], &sequence)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	// Unmarshal second parameter as a string.
+	var action string
+	err = json.Unmarshal(params[1], &action)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	// Unmarshal third parameter as an order book entry result object.
+	var order chainjson.OrderBookEntryResult
+	err = json.Unmarshal(params[2], &order)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	return sequence, action, &order, nil
+}
+
+// parseChainNtfn parses the passed notification into the concrete type
+// registered for its method, such as *chainjson.OrderFilledNtfn for an
+// orderfilled notification.
+func parseChainNtfn(ntfn *rawNotification) (interface{}, error) {
+	return chainjson.UnmarshalCmd(&chainjson.Request{
+		Jsonrpc: "1.0",
+		Method:  ntfn.Method,
+		Params:  ntfn.Params,
+	})
+}
+
 // parseBtcdConnectedNtfnParams parses out the connection status of ndrd
 // and btcwallet from the parameters of a btcdconnected notification.
 func parseBtcdConnectedNtfnParams(params []json.RawMessage) (bool, error) {
@@ -899,7 +1109,9 @@ func (c *Client) NotifyBlocksAsync() FutureNotifyBlocksResult {
 // result in an error if the client is configured to run in HTTP POST mode.
 //
 // The notifications delivered as a result of this call will be via one of
-// OnBlockConnected or OnBlockDisconnected.
+// OnBlockConnected, OnBlockDisconnected, OnAbsorptionStarted, OnAbsorptionEnded,
+// OnOrderFilled, OnAbsorptionStartReverted, OnAbsorptionEndReverted or
+// OnOrderFillReverted.
 //
 // NOTE: This is a ndrd extension and requires a websocket connection.
 func (c *Client) NotifyBlocks() error {
@@ -1090,6 +1302,55 @@ func (c *Client) NotifyNewOrders(verbose bool) error {
 	return c.NotifyNewOrdersAsync(verbose).Receive()
 }
 
+// FutureNotifyOrderBookResult is a future promise to deliver the result of a
+// NotifyOrderBookAsync RPC invocation (or an applicable error).
+type FutureNotifyOrderBookResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the registration was not successful.
+func (r FutureNotifyOrderBookResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// NotifyOrderBookAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See NotifyOrderBook for the blocking version and more details.
+//
+// NOTE: This is a ndrd extension and requires a websocket connection.
+func (c *Client) NotifyOrderBookAsync() FutureNotifyOrderBookResult {
+	// Not supported in HTTP POST mode.
+	if c.config.HTTPPostMode {
+		return newFutureError(ErrWebsocketsRequired)
+	}
+
+	// Ignore the notification if the client is not interested in
+	// notifications.
+	if c.ntfnHandlers == nil {
+		return newNilFutureResult()
+	}
+
+	cmd := chainjson.NewNotifyOrderBookCmd()
+	return c.sendCmd(cmd)
+}
+
+// NotifyOrderBook registers the client to receive notifications of every
+// order added to or removed from the order book.  The notifications are
+// delivered to the notification handlers associated with the client.  Calling
+// this function has no effect if there are no notification handlers and will
+// result in an error if the client is configured to run in HTTP POST mode.
+//
+// The notifications delivered as a result of this call will be via
+// OnOrderBookDelta.  Calling GetOrderBookSnapshot after this function returns
+// gives the order book to apply them to.
+//
+// NOTE: This is a ndrd extension and requires a websocket connection.
+func (c *Client) NotifyOrderBook() error {
+	return c.NotifyOrderBookAsync().Receive()
+}
+
 // FutureNotifyReceivedResult is a future promise to deliver the result of a
 // NotifyReceivedAsync RPC invocation (or an applicable error).
 //
@@ -0,0 +1,74 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/endurio/ndrd/chainjson"
+)
+
+// TestRevertedChainNtfns ensures the notifications of absorptions and order
+// fills reverted by a disconnected block are delivered to their handlers.
+func TestRevertedChainNtfns(t *testing.T) {
+	t.Parallel()
+
+	var got interface{}
+	handlers := &NotificationHandlers{
+		OnAbsorptionStartReverted: func(absn *chainjson.AbsorptionStartRevertedNtfn) {
+			got = absn
+		},
+		OnAbsorptionEndReverted: func(absn *chainjson.AbsorptionEndRevertedNtfn) {
+			got = absn
+		},
+		OnOrderFillReverted: func(order *chainjson.OrderFillRevertedNtfn) {
+			got = order
+		},
+	}
+	client := &Client{ntfnHandlers: handlers}
+
+	tests := []struct {
+		name string
+		ntfn interface{}
+	}{
+		{
+			name: "absorptionstartreverted",
+			ntfn: chainjson.NewAbsorptionStartRevertedNtfn("123", 100,
+				-0.5, 1000),
+		},
+		{
+			name: "absorptionendreverted",
+			ntfn: chainjson.NewAbsorptionEndRevertedNtfn("456", 148,
+				"123", 100, -0.5, 1000, 990),
+		},
+		{
+			name: "orderfillreverted",
+			ntfn: chainjson.NewOrderFillRevertedNtfn("789", "456", 148,
+				30, -4, chainjson.Float64(0.5)),
+		},
+	}
+
+	for _, test := range tests {
+		marshalled, err := chainjson.MarshalCmd(nil, test.ntfn)
+		if err != nil {
+			t.Fatalf("%s: MarshalCmd: unexpected error: %v", test.name,
+				err)
+		}
+		var ntfn rawNotification
+		if err := json.Unmarshal(marshalled, &ntfn); err != nil {
+			t.Fatalf("%s: Unmarshal: unexpected error: %v", test.name,
+				err)
+		}
+
+		got = nil
+		client.handleNotification(&ntfn)
+		if !reflect.DeepEqual(got, test.ntfn) {
+			t.Errorf("%s: mismatched notification - got %v, want %v",
+				test.name, got, test.ntfn)
+		}
+	}
+}
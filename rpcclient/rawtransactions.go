@@ -357,6 +357,57 @@ func (c *Client) SendRawOrder(order *wire.MsgOdr, allowHighFees bool) (*chainhas
 	return c.SendRawOrderAsync(order, allowHighFees).Receive()
 }
 
+// FutureCancelOrderResult is a future promise to deliver the result of a
+// CancelOrderAsync RPC invocation (or an applicable error).
+type FutureCancelOrderResult chan *response
+
+// Receive waits for the response promised by the future and returns the hash
+// of the order removed from the order book of the server.
+func (r FutureCancelOrderResult) Receive() (*chainhash.Hash, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a string.
+	var orderHashStr string
+	err = json.Unmarshal(res, &orderHashStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return chainhash.NewHashFromStr(orderHashStr)
+}
+
+// CancelOrderAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See CancelOrder for the blocking version and more details.
+func (c *Client) CancelOrderAsync(cancel *wire.MsgCancelOdr) FutureCancelOrderResult {
+	cancelHex := ""
+	if cancel != nil {
+		// Serialize the cancellation and convert to hex string.
+		var buf bytes.Buffer
+		err := cancel.BtcEncode(&buf, wire.CancelOdrVersion,
+			wire.BaseEncoding)
+		if err != nil {
+			return newFutureError(err)
+		}
+		cancelHex = hex.EncodeToString(buf.Bytes())
+	}
+
+	cmd := chainjson.NewCancelOrderCmd(cancelHex)
+	return c.sendCmd(cmd)
+}
+
+// CancelOrder submits the encoded cancellation of an order to the server which
+// will then remove the order from its order book and relay the cancellation to
+// the network.
+func (c *Client) CancelOrder(cancel *wire.MsgCancelOdr) (*chainhash.Hash, error) {
+	return c.CancelOrderAsync(cancel).Receive()
+}
+
 // FutureSignRawTransactionResult is a future promise to deliver the result
 // of one of the SignRawTransactionAsync family of RPC invocations (or an
 // applicable error).
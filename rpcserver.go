@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"math/rand"
 	"net"
@@ -41,6 +42,7 @@ import (
 	"github.com/endurio/ndrd/mining"
 	"github.com/endurio/ndrd/mining/cpuminer"
 	"github.com/endurio/ndrd/peer"
+	"github.com/endurio/ndrd/pricefeed"
 	"github.com/endurio/ndrd/txscript"
 	"github.com/endurio/ndrd/types"
 	"github.com/endurio/ndrd/wire"
@@ -77,6 +79,23 @@ const (
 
 	// maxProtocolVersion is the max protocol version the server supports.
 	maxProtocolVersion = 70002
+
+	// maxSupplyHistoryCount is the max number of blocks returned by the
+	// getsupplyhistory RPC.
+	maxSupplyHistoryCount = 2000
+
+	// maxPriceHistoryBuckets is the max number of buckets returned by the
+	// getpricehistory RPC.
+	maxPriceHistoryBuckets = 1000
+
+	// maxPriceHistoryBlocks is the max number of blocks whose prices are
+	// gathered by the getpricehistory RPC, since the miner key of each of
+	// them is recovered from its signature.
+	maxPriceHistoryBlocks = 50000
+
+	// maxAddressUtxos is the max number of unspent outputs returned by the
+	// getaddressutxos RPC.
+	maxAddressUtxos = 1000
 )
 
 var (
@@ -130,6 +149,7 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
 	"addnode":               handleAddNode,
+	"cancelorder":           handleCancelOrder,
 	"createrawtransaction":  handleCreateRawTransaction,
 	"debuglevel":            handleDebugLevel,
 	"decoderawtransaction":  handleDecodeRawTransaction,
@@ -137,7 +157,10 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"estimatefee":           handleEstimateFee,
 	"generate":              handleGenerate,
 	"feedprice":             handleFeedPrice,
+	"getabsorptioninfo":     handleGetAbsorptionInfo,
 	"getaddednodeinfo":      handleGetAddedNodeInfo,
+	"getaddressbalance":     handleGetAddressBalance,
+	"getaddressutxos":       handleGetAddressUtxos,
 	"getbestblock":          handleGetBestBlock,
 	"getbestblockhash":      handleGetBestBlockHash,
 	"getblock":              handleGetBlock,
@@ -159,13 +182,18 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getmininginfo":         handleGetMiningInfo,
 	"getnettotals":          handleGetNetTotals,
 	"getnetworkhashps":      handleGetNetworkHashPS,
+	"getpricefeed":          handleGetPriceFeed,
+	"getpricehistory":       handleGetPriceHistory,
 	"getpeerinfo":           handleGetPeerInfo,
 	"getrawmempool":         handleGetRawMempool,
 	"getrawmembook":         handleGetRawMembook,
 	"getorderbook":          handleGetOrderBook,
+	"getorderbooksnapshot":  handleGetOrderBookSnapshot,
 	"getrawtransaction":     handleGetRawTransaction,
 	"getraworder":           handleGetRawOrder,
+	"getsupplyhistory":      handleGetSupplyHistory,
 	"gettxout":              handleGetTxOut,
+	"gettxoutsetinfo":       handleGetTxOutSetInfo,
 	"help":                  handleHelp,
 	"node":                  handleNode,
 	"ping":                  handlePing,
@@ -202,7 +230,6 @@ var rpcAskWallet = map[string]struct{}{
 	"getreceivedbyaccount":   {},
 	"getreceivedbyaddress":   {},
 	"gettransaction":         {},
-	"gettxoutsetinfo":        {},
 	"getunconfirmedbalance":  {},
 	"getwalletinfo":          {},
 	"importprivkey":          {},
@@ -259,11 +286,15 @@ var rpcLimited = map[string]struct{}{
 	"help": {},
 
 	// HTTP/S-only commands
+	"cancelorder":           {},
 	"createrawtransaction":  {},
 	"decoderawtransaction":  {},
 	"decodescript":          {},
 	"estimatefee":           {},
 	"getbestblock":          {},
+	"getabsorptioninfo":     {},
+	"getaddressbalance":     {},
+	"getaddressutxos":       {},
 	"getbestblockhash":      {},
 	"getblock":              {},
 	"getblockcount":         {},
@@ -280,8 +311,10 @@ var rpcLimited = map[string]struct{}{
 	"getrawmempool":         {},
 	"getrawmembook":         {},
 	"getorderbook":          {},
+	"getorderbooksnapshot":  {},
 	"getrawtransaction":     {},
 	"getraworder":           {},
+	"getsupplyhistory":      {},
 	"gettxout":              {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
@@ -336,6 +369,17 @@ func rpcNoTxInfoError(txHash *chainhash.Hash) *chainjson.RPCError {
 			txHash))
 }
 
+// txOutSetInfoState houses the result of the last gettxoutsetinfo invocation,
+// which is reused until the best block changes since walking the utxo set is
+// expensive.  Its lock only guards the cached result, so it is not held during
+// the walk and a slow walk does not block the invocations that find the result
+// cached or whose clients go away.
+type txOutSetInfoState struct {
+	sync.Mutex
+	hash   chainhash.Hash
+	result *chainjson.GetTxOutSetInfoResult
+}
+
 // gbtWorkState houses state that is used in between multiple RPC invocations to
 // getblocktemplate.
 type gbtWorkState struct {
@@ -522,6 +566,57 @@ func messageToHex(msg wire.Message) (string, error) {
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
+// handleCancelOrder implements the cancelorder command.
+func handleCancelOrder(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.CancelOrderCmd)
+
+	// Deserialize and send off to the order book.
+	hexStr := c.HexCancel
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedCancel, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	var msgCancel wire.MsgCancelOdr
+	err = msgCancel.BtcDecode(bytes.NewReader(serializedCancel),
+		wire.CancelOdrVersion, wire.BaseEncoding)
+	if err != nil {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCDeserialization,
+			Message: "Cancellation decode failed: " + err.Error(),
+		}
+	}
+
+	// The order is removed from the book, and the cancellation relayed to
+	// the network and notified to the long poll clients.  The cancellation
+	// of an order the book does not have yet is only remembered, since it
+	// cannot be checked until the order arrives.
+	_, isNew, err := s.cfg.ConnMgr.CancelOrder(&msgCancel)
+	if err != nil {
+		if _, ok := err.(mempool.RuleError); ok {
+			rpcsLog.Debugf("Rejected cancellation of order %v: %v",
+				msgCancel.OdrHash, err)
+		} else {
+			rpcsLog.Errorf("Failed to cancel order %v: %v",
+				msgCancel.OdrHash, err)
+		}
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCDeserialization,
+			Message: "Cancellation rejected: " + err.Error(),
+		}
+	}
+	if !isNew {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCVerify,
+			Message: "Order was already cancelled",
+		}
+	}
+
+	return msgCancel.OdrHash.String(), nil
+}
+
 // handleCreateRawTransaction handles createrawtransaction commands.
 func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.CreateRawTransactionCmd)
@@ -914,7 +1009,29 @@ func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		return -1.0, errors.New("Parameter NumBlocks must be positive")
 	}
 
-	feeRate, err := s.cfg.FeeEstimator.EstimateFee(uint32(c.NumBlocks))
+	// The optional parameters are nil when they are passed as null rather
+	// than omitted, so fall back to their defaults.
+	tokenName := "NDR"
+	if c.Token != nil {
+		tokenName = *c.Token
+	}
+	token, ok := types.TokenByName(tokenName)
+	if !ok || !s.cfg.ChainParams.HasToken(token) {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCInvalidParameter,
+			Message: "Unknown token: " + tokenName,
+		}
+	}
+
+	var feeRate mempool.BtcPerKilobyte
+	var err error
+	if c.Combined != nil && *c.Combined {
+		feeRate, err = s.cfg.FeeEstimator.EstimateCombinedFee(
+			uint32(c.NumBlocks), token)
+	} else {
+		feeRate, err = s.cfg.FeeEstimator.EstimateFee(uint32(c.NumBlocks),
+			token)
+	}
 
 	if err != nil {
 		return -1.0, err
@@ -977,6 +1094,85 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return reply, nil
 }
 
+// priceResult returns the passed price for a JSON-RPC result, which is nil when
+// there is no price.
+func priceResult(price blockchain.Price) *float64 {
+	if price == blockchain.NoPrice {
+		return nil
+	}
+	f := price.Float()
+	return &f
+}
+
+// stbToCoin returns the passed amount of STB in coins, which is zero for a nil
+// amount.
+func stbToCoin(amount *big.Int) float64 {
+	if amount == nil {
+		return 0
+	}
+	return types.Amount(amount.Int64()).ToCoin()
+}
+
+// handleGetAbsorptionInfo implements the getabsorptioninfo command.
+func handleGetAbsorptionInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.GetAbsorptionInfoCmd)
+
+	// Default to the tip of the main chain when no block is given.
+	var hash *chainhash.Hash
+	if c.Hash != nil {
+		var err error
+		hash, err = chainhash.NewHashFromStr(*c.Hash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.Hash)
+		}
+		if !s.cfg.Chain.MainChainHasBlock(hash) {
+			return nil, &chainjson.RPCError{
+				Code:    chainjson.ErrRPCBlockNotFound,
+				Message: "Block not found in the main chain",
+			}
+		}
+	}
+
+	info, err := s.cfg.Chain.AbsorptionInfo(hash)
+	if err != nil {
+		context := "Failed to obtain absorption info"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	result := &chainjson.GetAbsorptionInfoResult{
+		Hash:              info.Hash.String(),
+		Height:            info.Height,
+		MedianPrice:       priceResult(info.MedianPrice),
+		TotalSupply:       stbToCoin(info.TotalSupply),
+		Direction:         "none",
+		NextPassiveHeight: info.NextPassiveHeight,
+	}
+	if info.LastAbsorption == nil {
+		return result, nil
+	}
+
+	lastAbsorptionHeight := info.LastAbsorptionHeight
+	result.LastAbsorptionHash = info.LastAbsorption.String()
+	result.LastAbsorptionHeight = &lastAbsorptionHeight
+	result.AbsorptionRate = priceResult(info.AbsorptionRate)
+	result.Absorption = stbToCoin(info.Absorption)
+	result.Absorbed = stbToCoin(info.Absorbed)
+	result.RemainingBlocks = info.RemainingBlocks
+	result.NextAbsorption = stbToCoin(info.NextAbsorption)
+	result.ActiveLowPrice = priceResult(info.ActiveLowPrice)
+	result.ActiveHighPrice = priceResult(info.ActiveHighPrice)
+	if info.RemainingBlocks > 0 {
+		switch info.Absorption.Sign() {
+		case 1:
+			result.Direction = "expansion"
+		case -1:
+			result.Direction = "contraction"
+		}
+	}
+
+	return result, nil
+}
+
 // handleGetAddedNodeInfo handles getaddednodeinfo commands.
 func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.GetAddedNodeInfoCmd)
@@ -1067,6 +1263,125 @@ func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return results, nil
 }
 
+// balanceIndexAddress returns the balance index and the address decoded from
+// the passed string, or an error when the index is not enabled or the address
+// is invalid.
+func balanceIndexAddress(s *rpcServer, address string) (*indexers.BalanceIndex, chainutil.Address, error) {
+	// Respond with an error if the balance index is not enabled.
+	balanceIndex := s.cfg.BalanceIndex
+	if balanceIndex == nil {
+		return nil, nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCMisc,
+			Message: "Balance index must be enabled (--balanceindex)",
+		}
+	}
+
+	addr, err := chainutil.DecodeAddress(address, s.cfg.ChainParams)
+	if err != nil {
+		return nil, nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + err.Error(),
+		}
+	}
+	return balanceIndex, addr, nil
+}
+
+// handleGetAddressBalance implements the getaddressbalance command.
+func handleGetAddressBalance(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.GetAddressBalanceCmd)
+	balanceIndex, addr, err := balanceIndexAddress(s, c.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := balanceIndex.AddressBalance(addr)
+	if err != nil {
+		context := "Failed to load address balance"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	balances := make([]chainjson.AddressTokenBalanceResult, 0,
+		len(balance.Tokens))
+	for i := range balance.Tokens {
+		tokenBalance := &balance.Tokens[i]
+		balances = append(balances, chainjson.AddressTokenBalanceResult{
+			Token:  tokenBalance.Token.String(),
+			TxOuts: tokenBalance.Outputs,
+			Amount: tokenBalance.Amount.ToCoin(),
+		})
+	}
+	return &chainjson.GetAddressBalanceResult{
+		Address:   addr.EncodeAddress(),
+		Height:    balance.Height,
+		BestBlock: balance.Hash.String(),
+		Balances:  balances,
+	}, nil
+}
+
+// handleGetAddressUtxos implements the getaddressutxos command.
+func handleGetAddressUtxos(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.GetAddressUtxosCmd)
+	balanceIndex, addr, err := balanceIndexAddress(s, c.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only return the outputs of the requested token, if any, within the
+	// requested page.
+	token := types.TokenInvalid
+	if c.Token != nil {
+		var ok bool
+		token, ok = types.TokenByName(*c.Token)
+		if !ok || !s.cfg.ChainParams.HasToken(token) {
+			return nil, &chainjson.RPCError{
+				Code:    chainjson.ErrRPCInvalidParameter,
+				Message: "Unknown token: " + *c.Token,
+			}
+		}
+	}
+
+	numRequested := 100
+	if c.Count != nil {
+		numRequested = *c.Count
+		if numRequested < 0 {
+			numRequested = 1
+		}
+	}
+	if numRequested > maxAddressUtxos {
+		numRequested = maxAddressUtxos
+	}
+	var numToSkip int
+	if c.Skip != nil {
+		numToSkip = *c.Skip
+		if numToSkip < 0 {
+			numToSkip = 0
+		}
+	}
+
+	utxos, _, err := balanceIndex.AddressUtxos(addr, token,
+		uint32(numToSkip), uint32(numRequested))
+	if err != nil {
+		context := "Failed to load address unspent outputs"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	results := make([]chainjson.GetAddressUtxosResult, 0, len(utxos))
+	for i := range utxos {
+		utxo := &utxos[i]
+		results = append(results, chainjson.GetAddressUtxosResult{
+			TxID:          utxo.OutPoint.Hash.String(),
+			Vout:          utxo.OutPoint.Index,
+			Token:         utxo.Value.Token.String(),
+			Amount:        utxo.Value.Amount.ToCoin(),
+			Height:        utxo.Height,
+			Confirmations: int64(best.Height - utxo.Height + 1),
+			Coinbase:      utxo.IsCoinBase,
+		})
+	}
+	return results, nil
+}
+
 // handleGetBestBlock implements the getbestblock command.
 func handleGetBestBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// All other "get block" commands give either the height, the
@@ -1297,6 +1612,12 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		case chaincfg.DeploymentSegwit:
 			forkName = "segwit"
 
+		case chaincfg.DeploymentMedianPrice:
+			forkName = "medianprice"
+
+		case chaincfg.DeploymentPartialFill:
+			forkName = "partialfill"
+
 		default:
 			return nil, &chainjson.RPCError{
 				Code: chainjson.ErrRPCInternal.Code,
@@ -2396,9 +2717,25 @@ func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		numBytes += int64(txD.Tx.MsgTx().SerializeSize())
 	}
 
+	// Report the minimum transaction fee in effect, which changes along
+	// with the price of the tokens when it is dynamic.
+	policy := s.cfg.TxMemPool.RelayPolicy()
+	relayTxPrice := policy.RelayTxPrice()
+	minRelayTxFee := make(map[string]float64)
+	for _, v := range relayTxPrice.Balance().Values() {
+		minRelayTxFee[v.Token.String()] = v.Amount.ToCoin()
+	}
+
 	ret := &chainjson.GetMempoolInfoResult{
-		Size:  int64(len(mempoolTxns)),
-		Bytes: numBytes,
+		Size:            int64(len(mempoolTxns)),
+		Bytes:           numBytes,
+		MinRelayTxFee:   minRelayTxFee,
+		DynamicRelayFee: policy.DynamicMinRelayTxPrice != nil,
+	}
+	if policy.DynamicMinRelayTxPrice != nil {
+		if rate, ok := policy.DynamicMinRelayTxPrice.Rate(); ok {
+			ret.RelayFeePrice = rate
+		}
 	}
 
 	return ret, nil
@@ -2624,17 +2961,46 @@ func handleGetRawMembook(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return hashStrings, nil
 }
 
-// handleGetOrderBook implements the getrawOrderBook command.
+// handleGetOrderBook implements the getorderbook command.
 func handleGetOrderBook(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.GetOrderBookCmd)
 	mb := s.cfg.OdrMemBook
-	var depth float64
+	var depth, tick float64
+	var limit int
 
 	if c.Depth != nil && *c.Depth > 0.0 {
 		depth = *c.Depth
 	}
+	if c.Tick != nil {
+		tick = *c.Tick
+	}
+	if c.Limit != nil {
+		limit = *c.Limit
+	}
+	if tick < 0 || limit < 0 {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCInvalidParameter,
+			Message: "tick and limit must not be negative",
+		}
+	}
+	verbose := c.Verbose != nil && *c.Verbose
 
-	return mb.OrderBook(depth)
+	return mb.OrderBook(depth, tick, limit, verbose), nil
+}
+
+// handleGetOrderBookSnapshot implements the getorderbooksnapshot command.
+func handleGetOrderBookSnapshot(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	descs, sequence := s.cfg.OdrMemBook.Snapshot()
+
+	orders := make([]chainjson.OrderBookEntryResult, 0, len(descs))
+	for _, odrDesc := range descs {
+		orders = append(orders, odrDesc.OrderBookEntryResult())
+	}
+
+	return &chainjson.GetOrderBookSnapshotResult{
+		Sequence: sequence,
+		Orders:   orders,
+	}, nil
 }
 
 // handleGetRawTransaction implements the getrawtransaction command.
@@ -2828,6 +3194,63 @@ func handleGetRawOrder(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return *rawOdrn, nil
 }
 
+// handleGetSupplyHistory implements the getsupplyhistory command.
+func handleGetSupplyHistory(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Respond with an error if the supply index is not enabled.
+	supplyIndex := s.cfg.SupplyIndex
+	if supplyIndex == nil {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCMisc,
+			Message: "Supply index must be enabled (--supplyindex)",
+		}
+	}
+
+	c := cmd.(*chainjson.GetSupplyHistoryCmd)
+	if c.StartHeight < 0 {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCOutOfRange,
+			Message: "Block height out of range",
+		}
+	}
+
+	// Limit the number of blocks to the max.
+	count := 100
+	if c.Count != nil {
+		count = *c.Count
+	}
+	if count <= 0 {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCInvalidParameter,
+			Message: "Count must be positive",
+		}
+	}
+	if count > maxSupplyHistoryCount {
+		count = maxSupplyHistoryCount
+	}
+
+	entries, err := supplyIndex.EntriesByHeight(int32(c.StartHeight), count)
+	if err != nil {
+		context := "Failed to load supply history"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	results := make([]chainjson.GetSupplyHistoryResult, 0, len(entries))
+	for i := range entries {
+		entry := &entries[i]
+		results = append(results, chainjson.GetSupplyHistoryResult{
+			Hash:           entry.Hash.String(),
+			Height:         entry.Height,
+			SupplyChange:   entry.SupplyChange.ToCoin(),
+			Absorption:     entry.Absorption(),
+			AbsorptionRate: priceResult(entry.AbsorptionRate),
+			FilledOrders:   entry.FilledOrders,
+			OrderSTB:       entry.OrderSTB.ToCoin(),
+			OrderNDR:       entry.OrderNDR.ToCoin(),
+		})
+	}
+	return results, nil
+}
+
 // handleGetTxOut handles gettxout commands.
 func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.GetTxOutCmd)
@@ -2934,6 +3357,69 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return txOutReply, nil
 }
 
+// bigToCoin converts the passed amount of atoms, which may exceed the range of
+// an Amount, to coins.
+func bigToCoin(amount *big.Int) float64 {
+	coins, _ := new(big.Rat).SetFrac(amount, big.NewInt(types.AtomPerCoin)).Float64()
+	return coins
+}
+
+// handleGetTxOutSetInfo implements the gettxoutsetinfo command.
+func handleGetTxOutSetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Walking the utxo set may take a while, so the result is reused until
+	// the best block changes, and the walk stops when the client goes away.
+	state := &s.txOutSetInfo
+	state.Lock()
+	result, hash := state.result, state.hash
+	state.Unlock()
+	if result != nil && hash == s.cfg.Chain.BestSnapshot().Hash {
+		return result, nil
+	}
+
+	stats, err := s.cfg.Chain.UtxoSetStats(closeChan)
+	if err != nil {
+		context := "Failed to walk the utxo set"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	tokens := make([]chainjson.TxOutSetTokenResult, 0, len(stats.Tokens))
+	for i := range stats.Tokens {
+		tokenStats := &stats.Tokens[i]
+		tokens = append(tokens, chainjson.TxOutSetTokenResult{
+			Token:  tokenStats.Token.String(),
+			TxOuts: tokenStats.Outputs,
+			Amount: bigToCoin(&tokenStats.Amount),
+		})
+	}
+
+	ret := &chainjson.GetTxOutSetInfoResult{
+		Height:          stats.Height,
+		BestBlock:       stats.Hash.String(),
+		Transactions:    stats.Transactions,
+		TxOuts:          stats.Outputs,
+		BytesSerialized: stats.SerializedSize,
+		HashSerialized:  stats.SetHash.String(),
+		Tokens:          tokens,
+		TotalSupply:     bigToCoin(&stats.TotalSupply),
+	}
+
+	// The STB of the unspent outputs should always add up to the total
+	// supply, so a mismatch is worth the attention of the operator.
+	if mismatch := stats.SupplyMismatch(); mismatch.Sign() != 0 {
+		rpcsLog.Warnf("The unspent outputs as of block %v (height %d) "+
+			"hold %v atoms of STB more than the total supply %v",
+			stats.Hash, stats.Height, mismatch, &stats.TotalSupply)
+		coins := bigToCoin(mismatch)
+		ret.SupplyMismatch = &coins
+	}
+
+	state.Lock()
+	state.hash = stats.Hash
+	state.result = ret
+	state.Unlock()
+	return ret, nil
+}
+
 // handleHelp implements the help command.
 func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.HelpCmd)
@@ -3573,7 +4059,7 @@ func handleSendRawOrder(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 
 	// Use 0 for the tag to represent local node.
 	order := chainutil.NewOdr(msgOrder)
-	acceptedOrder, err := s.cfg.OdrMemBook.ProcessOrder(order)
+	acceptedOrder, replaced, err := s.cfg.OdrMemBook.ProcessOrder(order)
 	if err != nil {
 		// When the error is a rule error, it means the order was
 		// simply rejected as opposed to something actually going wrong,
@@ -3601,6 +4087,11 @@ func handleSendRawOrder(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 		return nil, internalRPCError(errStr, "")
 	}
 
+	// The orders replaced by the accepted order are no longer in the book.
+	if len(replaced) > 0 {
+		s.cfg.ConnMgr.OrdersRemoved(replaced)
+	}
+
 	acceptedOrders := []*mempool.OdrDesc{acceptedOrder}
 
 	// Generate and relay inventory vectors for all newly accepted
@@ -3659,19 +4150,195 @@ func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 func handleFeedPrice(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*chainjson.FeedPriceCmd)
 
-	price := c.Price
+	source := pricefeed.RPCSourceName
+	if c.Source != nil {
+		source = *c.Source
+	}
+	var timestamp int64
+	if c.Timestamp != nil {
+		timestamp = *c.Timestamp
+	}
+	var sig []byte
+	if c.Signature != nil {
+		var err error
+		sig, err = base64.StdEncoding.DecodeString(*c.Signature)
+		if err != nil {
+			return nil, &chainjson.RPCError{
+				Code:    chainjson.ErrRPCParse.Code,
+				Message: "Malformed base64 encoding: " + err.Error(),
+			}
+		}
+	}
 
-	if price <= 0 {
+	price := blockchain.PriceFromFloat(c.Price)
+	err := s.cfg.PriceFeed.FeedRPC(source, price, timestamp, sig)
+	if err != nil {
 		return nil, &chainjson.RPCError{
-			Code:    chainjson.ErrRPCInvalidRequest.Code,
-			Message: "Price must be possitive",
+			Code:    chainjson.ErrRPCInvalidParameter,
+			Message: "Price rejected: " + err.Error(),
 		}
 	}
-
-	s.cfg.PriceSource.FeedPrice(blockchain.Price(price))
 	return nil, nil
 }
 
+// handleGetPriceFeed implements the getpricefeed command.
+func handleGetPriceFeed(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	snapshot := s.cfg.PriceFeed.Snapshot()
+
+	result := &chainjson.GetPriceFeedResult{
+		PriceToMine: priceResult(snapshot.PriceToMine),
+		MedianPrice: priceResult(snapshot.MedianPrice),
+		Reason:      snapshot.Reason,
+		MinSources:  snapshot.MinSources,
+		Band:        snapshot.Band,
+		Sources:     make([]chainjson.PriceFeedSourceResult, 0, len(snapshot.Sources)),
+		Feeds:       make([]chainjson.PriceFeedRecordResult, 0, len(snapshot.History)),
+	}
+	for _, source := range snapshot.Sources {
+		sourceResult := chainjson.PriceFeedSourceResult{
+			Name:   source.Name,
+			Signed: source.Signed,
+			Fresh:  source.Fresh,
+		}
+		if source.Last != nil {
+			sourceResult.Price = priceResult(source.Last.Price)
+			sourceResult.Time = source.Last.Timestamp.Unix()
+		}
+		result.Sources = append(result.Sources, sourceResult)
+	}
+	for _, rec := range snapshot.History {
+		result.Feeds = append(result.Feeds, chainjson.PriceFeedRecordResult{
+			Source:   rec.Source,
+			Price:    priceResult(rec.Price),
+			Time:     rec.Timestamp.Unix(),
+			Accepted: rec.Rejected == "",
+			Reason:   rec.Rejected,
+		})
+	}
+	return result, nil
+}
+
+// priceStatsResult returns the passed price statistics as price derivations
+// for the getpricehistory results.
+func priceStatsResult(stats *blockchain.PriceStats) (mean, median, min, max *float64) {
+	return priceResult(stats.Mean), priceResult(stats.Median),
+		priceResult(stats.Min), priceResult(stats.Max)
+}
+
+// handleGetPriceHistory implements the getpricehistory command.
+func handleGetPriceHistory(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*chainjson.GetPriceHistoryCmd)
+	params := s.cfg.ChainParams
+	byTime := c.ByTime != nil && *c.ByTime
+
+	// The range ends at the best block or at the current time by default,
+	// and is bucketed per absorption epoch.
+	end := int64(s.cfg.Chain.BestSnapshot().Height)
+	bucketSize := int64(params.BlockPerTimespan)
+	if byTime {
+		end = time.Now().Unix()
+		bucketSize = int64(params.TargetTimespan / time.Second)
+	}
+	if c.End != nil {
+		end = *c.End
+	}
+	if c.BucketSize != nil {
+		bucketSize = *c.BucketSize
+	}
+
+	if bucketSize <= 0 {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCInvalidParameter,
+			Message: "Bucket size must be positive",
+		}
+	}
+	if c.Start < 0 || c.Start > end {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCInvalidParameter,
+			Message: "Start must not be negative nor past the end",
+		}
+	}
+	if !byTime && end > math.MaxInt32 {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCOutOfRange,
+			Message: "Block height out of range",
+		}
+	}
+	if byTime && end > math.MaxUint32 {
+		return nil, &chainjson.RPCError{
+			Code:    chainjson.ErrRPCOutOfRange,
+			Message: "Timestamp out of range",
+		}
+	}
+
+	// A bucket never spans more than the range, so the bucket size in
+	// seconds does not overflow once converted to a duration.
+	if bucketSize > end-c.Start+1 {
+		bucketSize = end - c.Start + 1
+	}
+	if (end-c.Start)/bucketSize >= maxPriceHistoryBuckets {
+		return nil, &chainjson.RPCError{
+			Code: chainjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("The range spans more than %d "+
+				"buckets", maxPriceHistoryBuckets),
+		}
+	}
+
+	var buckets []blockchain.PriceBucket
+	var err error
+	if byTime {
+		buckets, err = s.cfg.Chain.PriceHistoryByTime(time.Unix(c.Start, 0),
+			time.Unix(end, 0), time.Duration(bucketSize)*time.Second,
+			maxPriceHistoryBlocks)
+	} else {
+		buckets, err = s.cfg.Chain.PriceHistoryByHeight(int32(c.Start),
+			int32(end), int32(bucketSize), maxPriceHistoryBlocks)
+	}
+	if err != nil {
+		return nil, &chainjson.RPCError{
+			Code: chainjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("The range holds more than %d "+
+				"blocks", maxPriceHistoryBlocks),
+		}
+	}
+
+	results := make([]chainjson.GetPriceHistoryResult, 0, len(buckets))
+	for i := range buckets {
+		bucket := &buckets[i]
+		result := chainjson.GetPriceHistoryResult{
+			Start:    bucket.Start,
+			End:      bucket.End,
+			Blocks:   bucket.Blocks,
+			NoPrices: bucket.NoPrices,
+			Miners:   make([]chainjson.PriceHistoryMinerResult, 0, len(bucket.Miners)),
+		}
+		result.Mean, result.Median, result.Min, result.Max =
+			priceStatsResult(&bucket.PriceStats)
+
+		for j := range bucket.Miners {
+			miner := &bucket.Miners[j]
+			minerResult := chainjson.PriceHistoryMinerResult{
+				Blocks:   miner.Blocks,
+				NoPrices: miner.NoPrices,
+			}
+			if miner.MinerKey != nil {
+				addr, err := chainutil.NewAddressPubKeyHash(
+					miner.MinerKey, params)
+				if err != nil {
+					context := "Failed to encode miner address"
+					return nil, internalRPCError(err.Error(), context)
+				}
+				minerResult.Miner = addr.EncodeAddress()
+			}
+			minerResult.Mean, minerResult.Median, minerResult.Min,
+				minerResult.Max = priceStatsResult(&miner.PriceStats)
+			result.Miners = append(result.Miners, minerResult)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // handleStop implements the stop command.
 func handleStop(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	select {
@@ -3879,6 +4546,7 @@ type rpcServer struct {
 	wg                     sync.WaitGroup
 	gbtWorkState           *gbtWorkState
 	helpCacher             *helpCacher
+	txOutSetInfo           txOutSetInfoState
 	requestProcessShutdown chan struct{}
 	quit                   chan int
 }
@@ -3995,6 +4663,24 @@ func (s *rpcServer) NotifyNewOrders(orders []*mempool.OdrDesc) {
 	}
 }
 
+// NotifyBookDelta passes the passed change of the order book to the
+// notification manager for the websocket clients following the book.
+func (s *rpcServer) NotifyBookDelta(delta *mempool.BookDelta) {
+	s.ntfnMgr.NotifyBookDelta(delta)
+}
+
+// NotifyOrdersRemoved notifies getblocktemplate long poll clients that the
+// passed orders were removed from the order book.
+func (s *rpcServer) NotifyOrdersRemoved(orders []*mempool.OdrDesc) {
+	if len(orders) == 0 {
+		return
+	}
+
+	// Potentially notify any getblocktemplate long poll clients about
+	// stale block templates due to the removed orders.
+	s.gbtWorkState.NotifyMembookOdr(s.cfg.OdrMemBook.LastUpdated())
+}
+
 // limitConnections responds with a 503 service unavailable and returns true if
 // adding another client would exceed the maximum allow RPC clients.
 //
@@ -4475,6 +5161,18 @@ type rpcserverConnManager interface {
 	// RelayOrders generates and relays inventory vectors for all of
 	// the passed orders to all connected peers.
 	RelayOrders(orders []*mempool.OdrDesc)
+
+	// CancelOrder removes the order withdrawn by the passed cancel
+	// message from the order book and relays the message to all connected
+	// peers.  The cancellation of an order which is not in the book is
+	// remembered and relayed, and nil is returned for the order.  The
+	// returned flag reports whether the cancellation was new.
+	CancelOrder(msg *wire.MsgCancelOdr) (*mempool.OdrDesc, bool, error)
+
+	// OrdersRemoved stops rebroadcasting the passed orders which were
+	// removed from the order book without being filled, and notifies the
+	// long poll clients about their removal.
+	OrdersRemoved(orders []*mempool.OdrDesc)
 }
 
 // rpcserverSyncManager represents a sync manager for use with the RPC server.
@@ -4528,7 +5226,7 @@ type rpcserverConfig struct {
 	// These fields allow the RPC server to interface with the local block
 	// chain data and state.
 	TimeSource  blockchain.MedianTimeSource
-	PriceSource blockchain.FeedPriceSource
+	PriceFeed   *pricefeed.Feed
 	Chain       *blockchain.BlockChain
 	ChainParams *chaincfg.Params
 	DB          database.DB
@@ -4548,9 +5246,11 @@ type rpcserverConfig struct {
 
 	// These fields define any optional indexes the RPC server can make use
 	// of to provide additional data when queried.
-	TxIndex   *indexers.TxIndex
-	AddrIndex *indexers.AddrIndex
-	CfIndex   *indexers.CfIndex
+	TxIndex      *indexers.TxIndex
+	AddrIndex    *indexers.AddrIndex
+	CfIndex      *indexers.CfIndex
+	SupplyIndex  *indexers.SupplyIndex
+	BalanceIndex *indexers.BalanceIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
@@ -4562,7 +5262,7 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 	rpc := rpcServer{
 		cfg:                    *config,
 		statusLines:            make(map[int]string),
-		gbtWorkState:           newGbtWorkState(config.TimeSource, config.PriceSource),
+		gbtWorkState:           newGbtWorkState(config.TimeSource, config.PriceFeed),
 		helpCacher:             newHelpCacher(),
 		requestProcessShutdown: make(chan struct{}),
 		quit:                   make(chan int),
@@ -4618,6 +5318,52 @@ func (s *rpcServer) handleBlockchainNotification(notification *blockchain.Notifi
 
 		// Notify registered websocket clients.
 		s.ntfnMgr.NotifyBlockDisconnected(block)
+
+	case blockchain.NTAbsorptionStarted, blockchain.NTAbsorptionEnded:
+		absn, ok := notification.Data.(*blockchain.AbsorptionNtfnsData)
+		if !ok {
+			rpcsLog.Warnf("Chain absorption notification is not an " +
+				"absorption.")
+			break
+		}
+
+		// Notify registered websocket clients.
+		started := notification.Type == blockchain.NTAbsorptionStarted
+		s.ntfnMgr.NotifyAbsorption(started, absn)
+
+	case blockchain.NTOrderFilled:
+		order, ok := notification.Data.(*blockchain.OrderFilledNtfnsData)
+		if !ok {
+			rpcsLog.Warnf("Chain order filled notification is not an " +
+				"order.")
+			break
+		}
+
+		// Notify registered websocket clients.
+		s.ntfnMgr.NotifyOrderFilled(order)
+
+	case blockchain.NTAbsorptionStartReverted, blockchain.NTAbsorptionEndReverted:
+		absn, ok := notification.Data.(*blockchain.AbsorptionNtfnsData)
+		if !ok {
+			rpcsLog.Warnf("Chain absorption reverted notification is " +
+				"not an absorption.")
+			break
+		}
+
+		// Notify registered websocket clients.
+		started := notification.Type == blockchain.NTAbsorptionStartReverted
+		s.ntfnMgr.NotifyAbsorptionReverted(started, absn)
+
+	case blockchain.NTOrderFillReverted:
+		order, ok := notification.Data.(*blockchain.OrderFilledNtfnsData)
+		if !ok {
+			rpcsLog.Warnf("Chain order fill reverted notification is " +
+				"not an order.")
+			break
+		}
+
+		// Notify registered websocket clients.
+		s.ntfnMgr.NotifyOrderFillReverted(order)
 	}
 }
 
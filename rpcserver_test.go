@@ -0,0 +1,62 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/endurio/ndrd/chaincfg"
+	"github.com/endurio/ndrd/chainjson"
+	"github.com/endurio/ndrd/mempool"
+)
+
+// TestHandleEstimateFeeNullParams ensures the optional parameters of the
+// estimatefee command passed as null fall back to their defaults rather than
+// crashing the handler.
+func TestHandleEstimateFeeNullParams(t *testing.T) {
+	s := &rpcServer{
+		cfg: rpcserverConfig{
+			ChainParams:  &chaincfg.RegressionNetParams,
+			FeeEstimator: mempool.NewFeeEstimator(1, 0),
+		},
+	}
+
+	// estimateFee parses and handles an estimatefee request with the
+	// passed parameters.
+	estimateFee := func(params string) (interface{}, error) {
+		t.Helper()
+		var raw []json.RawMessage
+		if err := json.Unmarshal([]byte(params), &raw); err != nil {
+			t.Fatalf("Unmarshal %s: unexpected error: %v", params, err)
+		}
+		cmd, err := chainjson.UnmarshalCmd(&chainjson.Request{
+			Jsonrpc: "1.0",
+			Method:  "estimatefee",
+			Params:  raw,
+		})
+		if err != nil {
+			t.Fatalf("UnmarshalCmd %s: unexpected error: %v", params,
+				err)
+		}
+		return handleEstimateFee(s, cmd, nil)
+	}
+
+	want, wantErr := estimateFee(`[1]`)
+	tests := []string{
+		`[1,null]`,
+		`[1,null,null]`,
+		`[1,"NDR",null]`,
+		`[1,null,false]`,
+	}
+	for _, params := range tests {
+		got, err := estimateFee(params)
+		if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(err, wantErr) {
+			t.Errorf("estimatefee %s: got %v, %v, want %v, %v", params,
+				got, err, want, wantErr)
+		}
+	}
+}
@@ -35,6 +35,11 @@ var helpDescsEnUS = map[string]string{
 	"addnode-addr":      "IP address and port of the peer to operate on",
 	"addnode-subcmd":    "'add' to add a persistent peer, 'remove' to remove a persistent peer, or 'onetry' to try a single connection to a peer",
 
+	// CancelOrderCmd help.
+	"cancelorder--synopsis": "Submits the serialized, hex-encoded cancellation of an order to the local peer, which removes the order from its order book and relays the cancellation to the network. The cancellation of an order the peer does not have yet is not relayed, but it is remembered and rejects the order when it arrives.",
+	"cancelorder-hexcancel": "Serialized, hex-encoded cancellation holding the order hash and one compact signature for each input of the order",
+	"cancelorder--result0":  "The hash of the cancelled order",
+
 	// NodeCmd help.
 	"node--synopsis":     "Attempts to add or remove a peer.",
 	"node-subcmd":        "'disconnect' to remove all matching non-persistent peers, 'remove' to remove a persistent peer, or 'connect' to connect to a peer",
@@ -122,6 +127,10 @@ var helpDescsEnUS = map[string]string{
 		"blocks have been generated.",
 	"estimatefee-numblocks": "The maximum number of blocks which can be " +
 		"generated before the transaction is mined.",
+	"estimatefee-token": "The token the fee is paid in",
+	"estimatefee-combined": "Estimate from the fees paid in every token, " +
+		"converted to the token with the price of the recent order fills, " +
+		"instead of the fees paid in the token only",
 	"estimatefee--result0": "Estimated fee per kilobyte in satoshis for a block to " +
 		"be mined in the next NumBlocks blocks.",
 
@@ -132,8 +141,85 @@ var helpDescsEnUS = map[string]string{
 	"generate--result0":  "The hashes, in order, of blocks generated by the call",
 
 	// FeedPriceCmd help
-	"feedprice--synopsis": "Feed the market price of STB/USD to the mining node.",
-	"feedprice-price":     "Current market price of STB/USD",
+	"feedprice--synopsis": "Feed the market price of STB/USD to a price source of the mining node.  The price is rejected when it moves more than the configured band from the last fresh price accepted from the source.",
+	"feedprice-price":     "Current market price of STB/USD, which is not a price derivation",
+	"feedprice-source":    "The name of the price source to feed",
+	"feedprice-timestamp": "The unix time of the price, required by the sources of signed feeds",
+	"feedprice-signature": "The base64 encoded compact signature of the source, price and timestamp, required by the sources of signed feeds",
+
+	// GetPriceFeedCmd help.
+	"getpricefeed--synopsis": "Returns the price sources of the mining node, their recent feeds, and which price will be mined next and why.",
+
+	// PriceFeedSourceResult help.
+	"pricefeedsourceresult-name":   "The name of the source",
+	"pricefeedsourceresult-signed": "Whether or not the source only accepts signed feeds",
+	"pricefeedsourceresult-price":  "The last market price accepted from the source, omitted when none was",
+	"pricefeedsourceresult-time":   "The unix time of the last accepted price, omitted when none was",
+	"pricefeedsourceresult-fresh":  "Whether or not the last accepted price takes part in the price to mine",
+
+	// PriceFeedRecordResult help.
+	"pricefeedrecordresult-source":   "The name of the source",
+	"pricefeedrecordresult-price":    "The fed market price, omitted when invalid",
+	"pricefeedrecordresult-time":     "The unix time of the fed price",
+	"pricefeedrecordresult-accepted": "Whether or not the price was accepted",
+	"pricefeedrecordresult-reason":   "The reason the price was rejected, omitted when it was accepted",
+
+	// GetPriceFeedResult help.
+	"getpricefeedresult-pricetomine": "The price derivation which will be mined next, omitted when none will be",
+	"getpricefeedresult-medianprice": "The median of the fresh market prices, omitted without enough of them",
+	"getpricefeedresult-reason":      "Why the price to mine is mined or omitted",
+	"getpricefeedresult-minsources":  "The minimum number of sources with a fresh price required to mine a price",
+	"getpricefeedresult-band":        "The maximum relative move of a price from the last fresh price accepted from the same source, zero when disabled",
+	"getpricefeedresult-sources":     "The price sources",
+	"getpricefeedresult-feeds":       "The recent feeds of the sources, oldest first",
+
+	// GetPriceHistoryCmd help.
+	"getpricehistory--synopsis":  "Returns statistics of the price derivations carried by the headers of the blocks of the main chain, in buckets of a range of heights or of timestamps.  The range holds up to 50000 blocks.  Blocks without a price count as no-price blocks.",
+	"getpricehistory-start":      "The first height, or unix time when bytime is set, of the range",
+	"getpricehistory-end":        "The last height, or unix time when bytime is set, of the range (default: the best block or the current time)",
+	"getpricehistory-bucketsize": "The number of heights, or seconds when bytime is set, spanned by each bucket, up to 1000 buckets (default: an absorption epoch)",
+	"getpricehistory-bytime":     "Whether the range and the bucket size are in unix time and seconds instead of heights",
+
+	// PriceHistoryMinerResult help.
+	"pricehistoryminerresult-miner":    "The address of the key which signed the blocks, empty for the blocks whose key cannot be recovered",
+	"pricehistoryminerresult-blocks":   "The number of blocks signed by the miner",
+	"pricehistoryminerresult-noprices": "The number of blocks signed by the miner without a price",
+	"pricehistoryminerresult-mean":     "The mean price of the miner, omitted when none of its blocks carries a price",
+	"pricehistoryminerresult-median":   "The median price of the miner, omitted when none of its blocks carries a price",
+	"pricehistoryminerresult-min":      "The lowest price of the miner, omitted when none of its blocks carries a price",
+	"pricehistoryminerresult-max":      "The highest price of the miner, omitted when none of its blocks carries a price",
+
+	// GetPriceHistoryResult help.
+	"getpricehistoryresult-start":    "The first height, or unix time, of the bucket",
+	"getpricehistoryresult-end":      "The last height, or unix time, of the bucket",
+	"getpricehistoryresult-blocks":   "The number of blocks in the bucket",
+	"getpricehistoryresult-noprices": "The number of blocks in the bucket without a price",
+	"getpricehistoryresult-mean":     "The mean price of the bucket, omitted when none of its blocks carries a price",
+	"getpricehistoryresult-median":   "The median price of the bucket, omitted when none of its blocks carries a price",
+	"getpricehistoryresult-min":      "The lowest price of the bucket, omitted when none of its blocks carries a price",
+	"getpricehistoryresult-max":      "The highest price of the bucket, omitted when none of its blocks carries a price",
+	"getpricehistoryresult-miners":   "The statistics of the bucket per miner, by decreasing number of blocks",
+
+	// GetAbsorptionInfoCmd help.
+	"getabsorptioninfo--synopsis": "Returns the absorption state of the STB supply at a block of the main chain, and when the next absorption can be triggered.",
+	"getabsorptioninfo-hash":      "The hash of the block (default: the best block)",
+
+	// GetAbsorptionInfoResult help.
+	"getabsorptioninforesult-hash":                 "The hash of the block",
+	"getabsorptioninforesult-height":               "The height of the block",
+	"getabsorptioninforesult-medianprice":          "The median price of the epoch ending at the block, omitted when the blocks do not provide enough prices",
+	"getabsorptioninforesult-totalsupply":          "The total supply of STB after the block",
+	"getabsorptioninforesult-lastabsorptionhash":   "The hash of the last absorption block, omitted when no absorption occurred",
+	"getabsorptioninforesult-lastabsorptionheight": "The height of the last absorption block, omitted when no absorption occurred",
+	"getabsorptioninforesult-absorptionrate":       "The median price of the last absorption",
+	"getabsorptioninforesult-direction":            "The direction of the STB supply change of the ongoing absorption (expansion/contraction/none)",
+	"getabsorptioninforesult-absorption":           "The total amount of STB of the last absorption, negative when the supply contracts",
+	"getabsorptioninforesult-absorbed":             "The amount of STB already absorbed since the last absorption",
+	"getabsorptioninforesult-remainingblocks":      "The number of blocks left to absorb the rest of the last absorption",
+	"getabsorptioninforesult-nextabsorption":       "The amount of STB the next block must absorb",
+	"getabsorptioninforesult-nextpassiveheight":    "The first height of a block which can trigger a passive absorption, given enough prices",
+	"getabsorptioninforesult-activelowprice":       "The median price at or below which the next block triggers an active absorption, omitted when it cannot trigger one",
+	"getabsorptioninforesult-activehighprice":      "The median price at or above which the next block triggers an active absorption, omitted when it cannot trigger one",
 
 	// GetAddedNodeInfoResultAddr help.
 	"getaddednodeinforesultaddr-address":   "The ip address for this DNS entry",
@@ -152,6 +238,37 @@ var helpDescsEnUS = map[string]string{
 	"getaddednodeinfo--condition1": "dns=true",
 	"getaddednodeinfo--result0":    "List of added peers",
 
+	// GetAddressBalanceCmd help.
+	"getaddressbalance--synopsis": "Returns the number and the total amount of the unspent outputs of each token paying an address.  Requires the balance index (--balanceindex).",
+	"getaddressbalance-address":   "The address to query",
+
+	// GetAddressBalanceResult help.
+	"getaddressbalanceresult-address":   "The queried address",
+	"getaddressbalanceresult-height":    "The height of the block the balance index was last updated with",
+	"getaddressbalanceresult-bestblock": "The hash of the block the balance index was last updated with",
+	"getaddressbalanceresult-balances":  "The balance of each token with unspent outputs paying the address, by increasing token",
+
+	// AddressTokenBalanceResult help.
+	"addresstokenbalanceresult-token":  "The name of the token",
+	"addresstokenbalanceresult-txouts": "The number of unspent outputs of the token",
+	"addresstokenbalanceresult-amount": "The total amount of the unspent outputs of the token",
+
+	// GetAddressUtxosCmd help.
+	"getaddressutxos--synopsis": "Returns the unspent outputs paying an address, ordered by outpoint, a page of up to 1000 outputs at a time.  Requires the balance index (--balanceindex).",
+	"getaddressutxos-address":   "The address to query",
+	"getaddressutxos-token":     "Only return the outputs of this token (default: all tokens)",
+	"getaddressutxos-skip":      "The number of leading outputs to leave out of the response",
+	"getaddressutxos-count":     "The maximum number of outputs to return, up to 1000",
+
+	// GetAddressUtxosResult help.
+	"getaddressutxosresult-txid":          "The hash of the transaction of the output",
+	"getaddressutxosresult-vout":          "The index of the output in the transaction",
+	"getaddressutxosresult-token":         "The name of the token of the output",
+	"getaddressutxosresult-amount":        "The amount of the output",
+	"getaddressutxosresult-height":        "The height of the block containing the transaction",
+	"getaddressutxosresult-confirmations": "The number of confirmations of the transaction",
+	"getaddressutxosresult-coinbase":      "Whether or not the transaction is a coinbase",
+
 	// GetBestBlockResult help.
 	"getbestblockresult-hash":   "Hex-encoded bytes of the best block hash",
 	"getbestblockresult-height": "Height of the best block",
@@ -412,8 +529,14 @@ var helpDescsEnUS = map[string]string{
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
 	// GetMempoolInfoResult help.
-	"getmempoolinforesult-bytes": "Size in bytes of the mempool",
-	"getmempoolinforesult-size":  "Number of transactions in the mempool",
+	"getmempoolinforesult-bytes":                "Size in bytes of the mempool",
+	"getmempoolinforesult-size":                 "Number of transactions in the mempool",
+	"getmempoolinforesult-minrelaytxfee":        "The minimum transaction fee in effect",
+	"getmempoolinforesult-minrelaytxfee--key":   "token",
+	"getmempoolinforesult-minrelaytxfee--value": "n.nnn",
+	"getmempoolinforesult-minrelaytxfee--desc":  "The minimum fee in coins per kilobyte paid in the token",
+	"getmempoolinforesult-dynamicrelayfee":      "Whether or not the NDR side of the minimum transaction fee is derived from the epoch price of the main chain",
+	"getmempoolinforesult-relayfeeprice":        "The price of one STB in NDR the NDR side of the minimum transaction fee was derived with (only when derived)",
 
 	// GetMiningInfoResult help.
 	"getmininginforesult-blocks":             "Height of the latest best block",
@@ -506,10 +629,49 @@ var helpDescsEnUS = map[string]string{
 	"getrawmembook--condition1": "verbose=true",
 	"getrawmembook--result0":    "Array of order hashes",
 
-	// GetRawMempoolCmd help.
-	"getorderbook--synopsis": "Returns information about all of the transactions currently in the memory pool.",
-	"getorderbook-depth":     "Market depth of the orders from both side",
-	"getorderbook--result0":  "Array of orders",
+	// GetOrderBookCmd help.
+	"getorderbook--synopsis": "Returns the price levels of both sides of the order book, from the best priced ones down, along with the best prices.",
+	"getorderbook-depth":     "The NDR depth covered by the levels of each side, all of them when zero",
+	"getorderbook-tick":      "The price tick to group the levels by, bids down and asks up, no grouping when zero",
+	"getorderbook-limit":     "The maximum number of levels of each side, all of them when zero",
+	"getorderbook-verbose":   "Include the orders of each level",
+
+	// GetOrderBookResult help.
+	"getorderbookresult-bestbid": "The best bid price, if there are bids",
+	"getorderbookresult-bestask": "The best ask price, if there are asks",
+	"getorderbookresult-spread":  "The best ask price less the best bid price, if there are both",
+	"getorderbookresult-mid":     "The mean of the best bid and ask prices, if there are both",
+	"getorderbookresult-bids":    "The price levels of the bids",
+	"getorderbookresult-asks":    "The price levels of the asks",
+
+	// OrderBookLevelResult help.
+	"orderbooklevelresult-price":  "The price of the level in STB per NDR",
+	"orderbooklevelresult-amount": "The total NDR of the orders of the level",
+	"orderbooklevelresult-count":  "The number of orders of the level",
+	"orderbooklevelresult-orders": "The orders of the level in time priority (only when verbose is true)",
+
+	// OrderBookOrderResult help.
+	"orderbookorderresult-hash":   "The hash of the order",
+	"orderbookorderresult-price":  "The price of the order in STB per NDR",
+	"orderbookorderresult-amount": "The amount of NDR of the order",
+	"orderbookorderresult-payout": "The amount of STB of the order",
+	"orderbookorderresult-height": "The block height when the order was added to the book",
+	"orderbookorderresult-time":   "Local time the order was added to the book in seconds since 1 Jan 1970 GMT",
+
+	// GetOrderBookSnapshotCmd help.
+	"getorderbooksnapshot--synopsis": "Returns all of the orders in the order book along with the sequence number of the last change made to it.\n" +
+		"Applying the orderbookdelta notifications with higher sequence numbers keeps the snapshot in sync with the order book.",
+
+	// GetOrderBookSnapshotResult help.
+	"getorderbooksnapshotresult-sequence": "The sequence number of the last change made to the order book",
+	"getorderbooksnapshotresult-orders":   "The orders in the order book, the bids then the asks from the best priced ones down",
+
+	// OrderBookEntryResult help.
+	"orderbookentryresult-hash":   "The hash of the order",
+	"orderbookentryresult-bid":    "Whether the order buys NDR",
+	"orderbookentryresult-price":  "The price of the order in STB per NDR",
+	"orderbookentryresult-amount": "The amount of NDR of the order",
+	"orderbookentryresult-payout": "The amount of STB of the order",
 
 	// GetRawTransactionCmd help.
 	"getrawtransaction--synopsis":   "Returns information about a transaction given its hash.",
@@ -527,6 +689,21 @@ var helpDescsEnUS = map[string]string{
 	"getraworder--condition1": "verbose=true",
 	"getraworder--result0":    "Hex-encoded bytes of the serialized order",
 
+	// GetSupplyHistoryCmd help.
+	"getsupplyhistory--synopsis":   "Returns how the blocks of the main chain changed the STB supply, starting at the given height.  Requires the supply index (--supplyindex).",
+	"getsupplyhistory-startheight": "The height of the first block",
+	"getsupplyhistory-count":       "The maximum number of blocks to return, up to 2000",
+
+	// GetSupplyHistoryResult help.
+	"getsupplyhistoryresult-hash":           "The hash of the block",
+	"getsupplyhistoryresult-height":         "The height of the block",
+	"getsupplyhistoryresult-supplychange":   "The amount of STB created by the block, negative when it destroyed STB",
+	"getsupplyhistoryresult-absorption":     "Whether or not the block triggered an absorption",
+	"getsupplyhistoryresult-absorptionrate": "The absorption rate triggered by the block, omitted when it did not trigger one",
+	"getsupplyhistoryresult-filledorders":   "The number of orders filled by the block",
+	"getsupplyhistoryresult-orderstb":       "The net amount of STB received by the filled orders, negative when they paid STB",
+	"getsupplyhistoryresult-orderndr":       "The net amount of NDR received by the filled orders, negative when they paid NDR, fees included",
+
 	// GetTxOutResult help.
 	"gettxoutresult-bestblock":     "The block hash that contains the transaction output",
 	"gettxoutresult-confirmations": "The number of confirmations",
@@ -541,6 +718,25 @@ var helpDescsEnUS = map[string]string{
 	"gettxout-vout":           "The index of the output",
 	"gettxout-includemempool": "Include the mempool when true",
 
+	// GetTxOutSetInfoCmd help.
+	"gettxoutsetinfo--synopsis": "Returns statistics of the unspent transaction outputs of each token, walking the whole set as of the best block stored.  This may take a while for large sets, so the result is reused until the best block changes.",
+
+	// GetTxOutSetInfoResult help.
+	"gettxoutsetinforesult-height":          "The height of the block the set reflects",
+	"gettxoutsetinforesult-bestblock":       "The hash of the block the set reflects",
+	"gettxoutsetinforesult-transactions":    "The number of transactions with unspent outputs",
+	"gettxoutsetinforesult-txouts":          "The number of unspent outputs",
+	"gettxoutsetinforesult-bytesserialized": "The size of the set as it is stored",
+	"gettxoutsetinforesult-hashserialized":  "The hash of the set as it is stored",
+	"gettxoutsetinforesult-tokens":          "The unspent outputs of each token with any, by increasing token",
+	"gettxoutsetinforesult-totalsupply":     "The total supply of STB in the chain as of the block",
+	"gettxoutsetinforesult-supplymismatch":  "The amount of STB of the unspent outputs in excess of the total supply, negative when short of it, omitted when they match",
+
+	// TxOutSetTokenResult help.
+	"txoutsettokenresult-token":  "The name of the token",
+	"txoutsettokenresult-txouts": "The number of unspent outputs of the token",
+	"txoutsettokenresult-amount": "The total amount of the unspent outputs of the token",
+
 	// HelpCmd help.
 	"help--synopsis":   "Returns a list of all commands or help for a specified command.",
 	"help-command":     "The command to retrieve help for",
@@ -628,7 +824,7 @@ var helpDescsEnUS = map[string]string{
 	"sessionresult-sessionid": "The unique session ID for a client's websocket connection.",
 
 	// NotifyBlocksCmd help.
-	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain.",
+	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain, and for the absorptions started and ended and the orders filled by the connected blocks.",
 
 	// StopNotifyBlocksCmd help.
 	"stopnotifyblocks--synopsis": "Cancel registered notifications for whenever a block is connected or disconnected from the main (best) chain.",
@@ -647,6 +843,13 @@ var helpDescsEnUS = map[string]string{
 	// StopNotifyNewOrdersCmd help.
 	"stopnotifyneworders--synopsis": "Stop sending either a odraccepted or a odracceptedverbose notification when a new order is accepted into the membook.",
 
+	// NotifyOrderBookCmd help.
+	"notifyorderbook--synopsis": "Send an orderbookdelta notification with an increasing sequence number for every order added to or removed from the order book.\n" +
+		"Call getorderbooksnapshot after this command returns to get the order book to apply the notifications to.",
+
+	// StopNotifyOrderBookCmd help.
+	"stopnotifyorderbook--synopsis": "Stop sending orderbookdelta notifications.",
+
 	// NotifyReceivedCmd help.
 	"notifyreceived--synopsis": "Send a recvtx notification when a transaction added to mempool or appears in a newly-attached block contains a txout pkScript sending to any of the passed addresses.\n" +
 		"Matching outpoints are automatically registered for redeemingtx notifications.",
@@ -717,6 +920,7 @@ var helpDescsEnUS = map[string]string{
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
 	"addnode":               nil,
+	"cancelorder":           {(*string)(nil)},
 	"createrawtransaction":  {(*string)(nil)},
 	"debuglevel":            {(*string)(nil), (*string)(nil)},
 	"decoderawtransaction":  {(*chainjson.TxRawDecodeResult)(nil)},
@@ -724,7 +928,10 @@ var rpcResultTypes = map[string][]interface{}{
 	"estimatefee":           {(*float64)(nil)},
 	"generate":              {(*[]string)(nil)},
 	"feedprice":             nil,
+	"getabsorptioninfo":     {(*chainjson.GetAbsorptionInfoResult)(nil)},
 	"getaddednodeinfo":      {(*[]string)(nil), (*[]chainjson.GetAddedNodeInfoResult)(nil)},
+	"getaddressbalance":     {(*chainjson.GetAddressBalanceResult)(nil)},
+	"getaddressutxos":       {(*[]chainjson.GetAddressUtxosResult)(nil)},
 	"getbestblock":          {(*chainjson.GetBestBlockResult)(nil)},
 	"getbestblockhash":      {(*string)(nil)},
 	"getblock":              {(*string)(nil), (*chainjson.GetBlockVerboseResult)(nil)},
@@ -749,9 +956,14 @@ var rpcResultTypes = map[string][]interface{}{
 	"getpeerinfo":           {(*[]chainjson.GetPeerInfoResult)(nil)},
 	"getrawmempool":         {(*[]string)(nil), (*chainjson.GetRawMempoolVerboseResult)(nil)},
 	"getrawmembook":         {(*[]string)(nil), (*chainjson.GetRawMembookVerboseResult)(nil)},
-	"getorderbook":          {(*[]string)(nil), (*chainjson.GetOrderBookResult)(nil)},
+	"getorderbook":          {(*chainjson.GetOrderBookResult)(nil)},
+	"getorderbooksnapshot":  {(*chainjson.GetOrderBookSnapshotResult)(nil)},
 	"getrawtransaction":     {(*string)(nil), (*chainjson.TxRawResult)(nil)},
+	"getpricefeed":          {(*chainjson.GetPriceFeedResult)(nil)},
+	"getpricehistory":       {(*[]chainjson.GetPriceHistoryResult)(nil)},
+	"getsupplyhistory":      {(*[]chainjson.GetSupplyHistoryResult)(nil)},
 	"gettxout":              {(*chainjson.GetTxOutResult)(nil)},
+	"gettxoutsetinfo":       {(*chainjson.GetTxOutSetInfoResult)(nil)},
 	"node":                  nil,
 	"help":                  {(*string)(nil), (*string)(nil)},
 	"ping":                  nil,
@@ -775,6 +987,8 @@ var rpcResultTypes = map[string][]interface{}{
 	"stopnotifynewtransactions": nil,
 	"notifyneworders":           nil,
 	"stopnotifyneworders":       nil,
+	"notifyorderbook":           nil,
+	"stopnotifyorderbook":       nil,
 	"notifyreceived":            nil,
 	"stopnotifyreceived":        nil,
 	"notifyspent":               nil,
@@ -29,6 +29,7 @@ import (
 	"github.com/endurio/ndrd/chainjson"
 	"github.com/endurio/ndrd/chainutil"
 	"github.com/endurio/ndrd/database"
+	"github.com/endurio/ndrd/mempool"
 	"github.com/endurio/ndrd/txscript"
 	"github.com/endurio/ndrd/types"
 	"github.com/endurio/ndrd/wire"
@@ -70,12 +71,14 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 	"notifyblocks":              handleNotifyBlocks,
 	"notifynewtransactions":     handleNotifyNewTransactions,
 	"notifyneworders":           handleNotifyNewOrders,
+	"notifyorderbook":           handleNotifyOrderBook,
 	"notifyreceived":            handleNotifyReceived,
 	"notifyspent":               handleNotifySpent,
 	"session":                   handleSession,
 	"stopnotifyblocks":          handleStopNotifyBlocks,
 	"stopnotifynewtransactions": handleStopNotifyNewTransactions,
 	"stopnotifyneworders":       handleStopNotifyNewOrders,
+	"stopnotifyorderbook":       handleStopNotifyOrderBook,
 	"stopnotifyspent":           handleStopNotifySpent,
 	"stopnotifyreceived":        handleStopNotifyReceived,
 	"rescan":                    handleRescan,
@@ -270,6 +273,87 @@ func (m *wsNotificationManager) NotifyMembookOdr(odr *chainutil.Odr, isNew bool)
 	}
 }
 
+// NotifyBookDelta passes a change of the order book to the notification manager
+// for the websocket clients following the book.  The changes are queued in the
+// order of their sequence numbers since the order book calls this with its
+// lock held.
+func (m *wsNotificationManager) NotifyBookDelta(delta *mempool.BookDelta) {
+	// As NotifyBookDelta will be called by the order book and the RPC
+	// server may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun shutting
+	// down.
+	select {
+	case m.queueNotification <- (*notificationBookDelta)(delta):
+	case <-m.quit:
+	}
+}
+
+// NotifyAbsorption passes an absorption started or ended by a block connected
+// to the best chain to the notification manager for block notification
+// processing.
+func (m *wsNotificationManager) NotifyAbsorption(started bool, absn *blockchain.AbsorptionNtfnsData) {
+	n := &notificationAbsorption{
+		started: started,
+		absn:    absn,
+	}
+
+	// As NotifyAbsorption will be called by the block manager and the
+	// RPC server may no longer be running, use a select statement to
+	// unblock enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
+// NotifyAbsorptionReverted passes an absorption started or ended by a block
+// disconnected from the best chain to the notification manager for block
+// notification processing.
+func (m *wsNotificationManager) NotifyAbsorptionReverted(started bool, absn *blockchain.AbsorptionNtfnsData) {
+	n := &notificationAbsorption{
+		started:  started,
+		reverted: true,
+		absn:     absn,
+	}
+
+	// As NotifyAbsorptionReverted will be called by the block manager
+	// and the RPC server may no longer be running, use a select statement
+	// to unblock enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
+// NotifyOrderFilled passes an order filled by a block connected to the best
+// chain to the notification manager for block notification processing.
+func (m *wsNotificationManager) NotifyOrderFilled(order *blockchain.OrderFilledNtfnsData) {
+	// As NotifyOrderFilled will be called by the block manager and the
+	// RPC server may no longer be running, use a select statement to
+	// unblock enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- (*notificationOrderFilled)(order):
+	case <-m.quit:
+	}
+}
+
+// NotifyOrderFillReverted passes an order filled by a block disconnected from
+// the best chain to the notification manager for block notification
+// processing.
+func (m *wsNotificationManager) NotifyOrderFillReverted(order *blockchain.OrderFilledNtfnsData) {
+	// As NotifyOrderFillReverted will be called by the block manager and
+	// the RPC server may no longer be running, use a select statement to
+	// unblock enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- (*notificationOrderFillReverted)(order):
+	case <-m.quit:
+	}
+}
+
 // wsClientFilter tracks relevant addresses for each websocket client for
 // the `rescanblocks` extension. It is modified by the `loadtxfilter` command.
 //
@@ -479,6 +563,14 @@ type notificationOdrAcceptedByMempool struct {
 	isNew bool
 	odr   *chainutil.Odr
 }
+type notificationBookDelta mempool.BookDelta
+type notificationAbsorption struct {
+	started  bool
+	reverted bool
+	absn     *blockchain.AbsorptionNtfnsData
+}
+type notificationOrderFilled blockchain.OrderFilledNtfnsData
+type notificationOrderFillReverted blockchain.OrderFilledNtfnsData
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -489,6 +581,8 @@ type notificationRegisterNewMempoolTxs wsClient
 type notificationUnregisterNewMempoolTxs wsClient
 type notificationRegisterNewMembookOdrs wsClient
 type notificationUnregisterNewMembookOdrs wsClient
+type notificationRegisterOrderBook wsClient
+type notificationUnregisterOrderBook wsClient
 type notificationRegisterSpent struct {
 	wsc *wsClient
 	ops []*wire.OutPoint
@@ -522,6 +616,7 @@ func (m *wsNotificationManager) notificationHandler() {
 	blockNotifications := make(map[chan struct{}]*wsClient)
 	txNotifications := make(map[chan struct{}]*wsClient)
 	odrNotifications := make(map[chan struct{}]*wsClient)
+	bookNotifications := make(map[chan struct{}]*wsClient)
 	watchedOutPoints := make(map[wire.OutPoint]map[chan struct{}]*wsClient)
 	watchedAddrs := make(map[string]map[chan struct{}]*wsClient)
 
@@ -563,6 +658,24 @@ out:
 						block)
 				}
 
+			case *notificationAbsorption:
+				if len(blockNotifications) != 0 {
+					m.notifyAbsorption(blockNotifications,
+						n.started, n.reverted, n.absn)
+				}
+
+			case *notificationOrderFilled:
+				if len(blockNotifications) != 0 {
+					m.notifyOrderFilled(blockNotifications,
+						(*blockchain.OrderFilledNtfnsData)(n), false)
+				}
+
+			case *notificationOrderFillReverted:
+				if len(blockNotifications) != 0 {
+					m.notifyOrderFilled(blockNotifications,
+						(*blockchain.OrderFilledNtfnsData)(n), true)
+				}
+
 			case *notificationTxAcceptedByMempool:
 				if n.isNew && len(txNotifications) != 0 {
 					m.notifyForNewTx(txNotifications, n.tx)
@@ -577,6 +690,12 @@ out:
 				m.notifyForOdr(watchedOutPoints, watchedAddrs, n.odr, nil)
 				m.notifyRelevantOdrAccepted(n.odr, clients)
 
+			case *notificationBookDelta:
+				if len(bookNotifications) != 0 {
+					m.notifyBookDelta(bookNotifications,
+						(*mempool.BookDelta)(n))
+				}
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -595,6 +714,7 @@ out:
 				// the client itself.
 				delete(blockNotifications, wsc.quit)
 				delete(txNotifications, wsc.quit)
+				delete(bookNotifications, wsc.quit)
 				for k := range wsc.spentRequests {
 					op := k
 					m.removeSpentRequest(watchedOutPoints, wsc, &op)
@@ -624,6 +744,14 @@ out:
 				wsc := (*wsClient)(n)
 				delete(txNotifications, wsc.quit)
 
+			case *notificationRegisterOrderBook:
+				wsc := (*wsClient)(n)
+				bookNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterOrderBook:
+				wsc := (*wsClient)(n)
+				delete(bookNotifications, wsc.quit)
+
 			default:
 				rpcsLog.Warn("Unhandled notification type")
 			}
@@ -845,6 +973,73 @@ func (*wsNotificationManager) notifyFilteredBlockDisconnected(clients map[chan s
 	}
 }
 
+// notifyAbsorption notifies websocket clients that have registered for block
+// updates when a block connected to the main chain starts or ends an
+// absorption, or when such a block is disconnected from it and the absorption
+// start or end is reverted.
+func (*wsNotificationManager) notifyAbsorption(clients map[chan struct{}]*wsClient,
+	started, reverted bool, absn *blockchain.AbsorptionNtfnsData) {
+
+	block := absn.Block
+	hash, height := block.Hash().String(), block.Height()
+	rate, absorption := absn.Rate.Float(), stbToCoin(absn.Absorption)
+	absnHash, absorbed := absn.AbsorptionHash.String(), stbToCoin(absn.Absorbed)
+	var ntfn interface{}
+	switch {
+	case started && !reverted:
+		ntfn = chainjson.NewAbsorptionStartedNtfn(hash, height, rate,
+			absorption)
+	case started:
+		ntfn = chainjson.NewAbsorptionStartRevertedNtfn(hash, height,
+			rate, absorption)
+	case !reverted:
+		ntfn = chainjson.NewAbsorptionEndedNtfn(hash, height, absnHash,
+			absn.AbsorptionHeight, rate, absorption, absorbed)
+	default:
+		ntfn = chainjson.NewAbsorptionEndRevertedNtfn(hash, height,
+			absnHash, absn.AbsorptionHeight, rate, absorption,
+			absorbed)
+	}
+	marshalledJSON, err := chainjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal absorption notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
+// notifyOrderFilled notifies websocket clients that have registered for block
+// updates when an order is filled by a block connected to the main chain, or
+// when such a block is disconnected from it and the fill is reverted.
+func (*wsNotificationManager) notifyOrderFilled(clients map[chan struct{}]*wsClient,
+	order *blockchain.OrderFilledNtfnsData, reverted bool) {
+
+	txID := order.Order.Hash().String()
+	hash, height := order.Block.Hash().String(), order.Block.Height()
+	stb := order.Balance.Amount(types.Token1).ToCoin()
+	ndr := order.Balance.Amount(types.Token0).ToCoin()
+	var ntfn interface{}
+	if reverted {
+		ntfn = chainjson.NewOrderFillRevertedNtfn(txID, hash, height,
+			stb, ndr, priceResult(order.Rate))
+	} else {
+		ntfn = chainjson.NewOrderFilledNtfn(txID, hash, height, stb,
+			ndr, priceResult(order.Rate))
+	}
+	marshalledJSON, err := chainjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal order filled notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterNewMempoolTxsUpdates requests notifications to the passed websocket
 // client when new transactions are added to the memory pool.
 func (m *wsNotificationManager) RegisterNewMempoolTxsUpdates(wsc *wsClient) {
@@ -869,6 +1064,34 @@ func (m *wsNotificationManager) UnregisterNewMembookOdrsUpdates(wsc *wsClient) {
 	m.queueNotification <- (*notificationUnregisterNewMembookOdrs)(wsc)
 }
 
+// RegisterOrderBookUpdates requests notifications to the passed websocket
+// client of every change made to the order book.
+func (m *wsNotificationManager) RegisterOrderBookUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterOrderBook)(wsc)
+}
+
+// UnregisterOrderBookUpdates removes notifications to the passed websocket
+// client of the changes made to the order book.
+func (m *wsNotificationManager) UnregisterOrderBookUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterOrderBook)(wsc)
+}
+
+// notifyBookDelta notifies websocket clients that have registered for order
+// book updates of the passed change of the book.
+func (m *wsNotificationManager) notifyBookDelta(clients map[chan struct{}]*wsClient, delta *mempool.BookDelta) {
+	ntfn := chainjson.NewOrderBookDeltaNtfn(delta.Sequence,
+		delta.Action.String(), delta.Order.OrderBookEntryResult())
+	marshalledJSON, err := chainjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal order book notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // notifyForNewTx notifies websocket clients that have registered for updates
 // when a new transaction is added to the memory pool.
 func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClient, tx *chainutil.Tx) {
@@ -2042,6 +2265,22 @@ func handleStopNotifyNewOrders(wsc *wsClient, icmd interface{}) (interface{}, er
 	return nil, nil
 }
 
+// handleNotifyOrderBook implements the notifyorderbook command extension for
+// websocket connections.  The client receives every change made to the order
+// book after the command returns, so a getorderbooksnapshot issued after it
+// can be kept in sync by applying the deltas with higher sequence numbers.
+func handleNotifyOrderBook(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.RegisterOrderBookUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyOrderBook implements the stopnotifyorderbook command
+// extension for websocket connections.
+func handleStopNotifyOrderBook(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterOrderBookUpdates(wsc)
+	return nil, nil
+}
+
 // handleNotifyReceived implements the notifyreceived command extension for
 // websocket connections.
 func handleNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, error) {
@@ -15,6 +15,8 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
@@ -37,6 +39,7 @@ import (
 	"github.com/endurio/ndrd/mining/cpuminer"
 	"github.com/endurio/ndrd/netsync"
 	"github.com/endurio/ndrd/peer"
+	"github.com/endurio/ndrd/pricefeed"
 	"github.com/endurio/ndrd/txscript"
 	"github.com/endurio/ndrd/types"
 	"github.com/endurio/ndrd/wire"
@@ -59,6 +62,14 @@ const (
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
+
+	// orderBookFilename is the name of the file in the data directory the
+	// order book is saved to, so it survives node restarts.
+	orderBookFilename = "orderbook.dat"
+
+	// saveOrderBookInterval is the interval used to save the order book
+	// to disk, in case the node is not shut down gracefully.
+	saveOrderBookInterval = time.Minute * 10
 )
 
 var (
@@ -231,16 +242,18 @@ type server struct {
 	nat                  NAT
 	db                   database.DB
 	timeSource           blockchain.MedianTimeSource
-	priceSource          blockchain.FeedPriceSource
+	priceFeed            *pricefeed.Feed
 	services             wire.ServiceFlag
 
 	// The following fields are used for optional indexes.  They will be nil
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
 	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
-	cfIndex   *indexers.CfIndex
+	txIndex      *indexers.TxIndex
+	addrIndex    *indexers.AddrIndex
+	cfIndex      *indexers.CfIndex
+	supplyIndex  *indexers.SupplyIndex
+	balanceIndex *indexers.BalanceIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
@@ -670,6 +683,27 @@ func (sp *serverPeer) OnOdr(_ *peer.Peer, msg *wire.MsgOdr) {
 	<-sp.odrProcessed
 }
 
+// OnCancelOdr is invoked when a peer receives a cancelodr bitcoin message.
+// The cancelled order is removed from the order book and the message is
+// relayed to the other peers.  Peers sending cancellations with invalid
+// signatures are penalized.
+func (sp *serverPeer) OnCancelOdr(_ *peer.Peer, msg *wire.MsgCancelOdr) {
+	if cfg.BlocksOnly {
+		peerLog.Tracef("Ignoring cancellation of order %v from %v - "+
+			"blocksonly enabled", msg.OdrHash, sp)
+		return
+	}
+
+	_, _, err := sp.server.CancelOrder(msg, sp)
+	if err != nil {
+		peerLog.Debugf("Rejected cancellation of order %v from %v: %v",
+			msg.OdrHash, sp, err)
+		if _, ok := err.(mempool.RuleError); ok {
+			sp.addBanScore(10, 0, "cancelodr")
+		}
+	}
+}
+
 // OnBlock is invoked when a peer receives a block bitcoin message.  It
 // blocks until the bitcoin block has been fully processed.
 func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
@@ -1547,6 +1581,56 @@ func (s *server) OrderFilled(order *chainutil.Odr) {
 	s.RemoveRebroadcastInventory(iv)
 }
 
+// notifyBookDelta is invoked by the order book for every change made to it and
+// passes the change on to the websocket clients following the book.
+func (s *server) notifyBookDelta(delta *mempool.BookDelta) {
+	if s.rpcServer != nil {
+		s.rpcServer.NotifyBookDelta(delta)
+	}
+}
+
+// OrdersRemoved is invoked when orders are removed from the order book
+// without being filled, such as when they expire.  The orders no longer need
+// rebroadcasting and the getblocktemplate long poll clients are notified.
+func (s *server) OrdersRemoved(orders []*mempool.OdrDesc) {
+	// Rebroadcasting is only necessary when the RPC server is active.
+	if s.rpcServer == nil {
+		return
+	}
+
+	for _, oD := range orders {
+		iv := wire.NewInvVect(wire.InvTypeOdr, oD.Hash())
+		s.RemoveRebroadcastInventory(iv)
+	}
+	s.rpcServer.NotifyOrdersRemoved(orders)
+}
+
+// CancelOrder removes the order withdrawn by the passed cancel message from the
+// order book and relays the message to all connected peers except the peer it
+// came from, if any.  The cancellation of an order which is not in the book is
+// only remembered by the order book, and not relayed since it cannot be checked
+// yet.  Nil is returned for the order in that case.  The returned flag reports
+// whether the cancellation was new.
+func (s *server) CancelOrder(msg *wire.MsgCancelOdr, source *serverPeer) (*mempool.OdrDesc, bool, error) {
+	odrDesc, isNew, err := s.odrMemBook.CancelOrder(msg)
+	if err != nil || !isNew {
+		return nil, false, err
+	}
+
+	if odrDesc == nil {
+		return nil, true, nil
+	}
+
+	s.OrdersRemoved([]*mempool.OdrDesc{odrDesc})
+	if source != nil {
+		s.BroadcastMessage(msg, source)
+	} else {
+		s.BroadcastMessage(msg)
+	}
+
+	return odrDesc, true, nil
+}
+
 // pushTxMsg sends a tx message for the provided transaction hash to the
 // connected peer.  An error is returned if the transaction hash is not known.
 func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
@@ -1983,6 +2067,13 @@ func (s *server) handleBroadcastMsg(state *peerState, bmsg *broadcastMsg) {
 			}
 		}
 
+		// Peers which predate cancel order messages are unable to
+		// decode them.
+		_, isCancel := bmsg.message.(*wire.MsgCancelOdr)
+		if isCancel && sp.ProtocolVersion() < wire.CancelOdrVersion {
+			return
+		}
+
 		sp.QueueMessage(bmsg.message, nil)
 	})
 }
@@ -2165,6 +2256,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnTx:           sp.OnTx,
 			OnMemBook:      sp.OnMemBook,
 			OnOdr:          sp.OnOdr,
+			OnCancelOdr:    sp.OnCancelOdr,
 			OnBlock:        sp.OnBlock,
 			OnInv:          sp.OnInv,
 			OnHeaders:      sp.OnHeaders,
@@ -2487,6 +2579,69 @@ cleanup:
 	s.wg.Done()
 }
 
+// saveOrderBook writes the order book to its file in the data directory.  The
+// book is written to a temporary file first, so an interrupted write never
+// leaves a corrupt file behind.
+func (s *server) saveOrderBook() {
+	filePath := filepath.Join(cfg.DataDir, orderBookFilename)
+	tmpPath := filePath + ".tmp"
+	w, err := os.Create(tmpPath)
+	if err != nil {
+		srvrLog.Errorf("Error opening file %s: %v", tmpPath, err)
+		return
+	}
+	err = s.odrMemBook.Save(w)
+	w.Close()
+	if err != nil {
+		srvrLog.Errorf("Failed to save order book to %s: %v", tmpPath, err)
+		return
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		srvrLog.Errorf("Failed to rename %s: %v", tmpPath, err)
+	}
+}
+
+// loadOrderBook restores the order book saved in the data directory, if any.
+// Every saved order is re-validated, so the ones whose inputs were spent while
+// the node was down are dropped.
+func (s *server) loadOrderBook() {
+	filePath := filepath.Join(cfg.DataDir, orderBookFilename)
+	r, err := os.Open(filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			srvrLog.Errorf("Error opening file %s: %v", filePath, err)
+		}
+		return
+	}
+	defer r.Close()
+
+	if _, err := s.odrMemBook.Restore(r); err != nil {
+		srvrLog.Errorf("Failed to restore order book from %s: %v",
+			filePath, err)
+	}
+}
+
+// orderBookHandler periodically saves the order book to disk and saves it one
+// last time when the server is shutting down.  It must be run as a goroutine.
+func (s *server) orderBookHandler() {
+	ticker := time.NewTicker(saveOrderBookInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			s.saveOrderBook()
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.saveOrderBook()
+	s.wg.Done()
+}
+
 // Start begins accepting connections from peers.
 func (s *server) Start() {
 	// Already started?
@@ -2504,6 +2659,11 @@ func (s *server) Start() {
 	s.wg.Add(1)
 	go s.peerHandler()
 
+	// Start the order book handler which periodically saves the order book
+	// to disk.
+	s.wg.Add(1)
+	go s.orderBookHandler()
+
 	if s.nat != nil {
 		s.wg.Add(1)
 		go s.upnpUpdateThread()
@@ -2519,6 +2679,9 @@ func (s *server) Start() {
 		s.rpcServer.Start()
 	}
 
+	// Start fetching the prices of the price feed sources.
+	s.priceFeed.Start()
+
 	// Start the CPU miner if generation is enabled.
 	if cfg.Generate {
 		s.cpuMiner.Start()
@@ -2539,6 +2702,9 @@ func (s *server) Stop() error {
 	// Stop the CPU miner if needed
 	s.cpuMiner.Stop()
 
+	// Stop fetching the prices of the price feed sources.
+	s.priceFeed.Stop()
+
 	// Shutdown the RPC server if it's not disabled.
 	if !cfg.DisableRPC {
 		s.rpcServer.Stop()
@@ -2776,6 +2942,15 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		}
 	}
 
+	priceFeed, err := pricefeed.New(&pricefeed.Config{
+		Sources:    cfg.priceFeedSources,
+		MinSources: cfg.PriceFeedMinSources,
+		Band:       cfg.PriceFeedBand,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	s := server{
 		chainParams:          chainParams,
 		addrManager:          amgr,
@@ -2791,7 +2966,7 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		nat:                  nat,
 		db:                   db,
 		timeSource:           blockchain.NewMedianTime(),
-		priceSource:          blockchain.NewFeedPrice(chainParams.TargetTimePerBlock),
+		priceFeed:            priceFeed,
 		services:             services,
 		sigCache:             txscript.NewSigCache(cfg.SigCacheMaxSize),
 		hashCache:            txscript.NewHashCache(cfg.SigCacheMaxSize),
@@ -2829,6 +3004,16 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		s.cfIndex = indexers.NewCfIndex(db, chainParams)
 		indexes = append(indexes, s.cfIndex)
 	}
+	if cfg.SupplyIndex {
+		indxLog.Info("Supply index is enabled")
+		s.supplyIndex = indexers.NewSupplyIndex(db, chainParams)
+		indexes = append(indexes, s.supplyIndex)
+	}
+	if cfg.BalanceIndex {
+		indxLog.Info("Balance index is enabled")
+		s.balanceIndex = indexers.NewBalanceIndex(db, chainParams)
+		indexes = append(indexes, s.balanceIndex)
+	}
 
 	// Create an index manager if any of the optional indexes are enabled.
 	var indexManager blockchain.IndexManager
@@ -2843,7 +3028,6 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	}
 
 	// Create a new block chain instance with the appropriate configuration.
-	var err error
 	s.chain, err = blockchain.New(&blockchain.Config{
 		DB:           s.db,
 		Interrupt:    interrupt,
@@ -2888,16 +3072,33 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			mempool.DefaultEstimateFeeMinRegisteredBlocks)
 	}
 
+	// The minimum transaction fee to relay and mine follows the epoch
+	// price of the main chain when it is dynamic.
+	var relayTxPrice *mining.DynamicPriceReq
+	if cfg.DynamicRelayFee {
+		relayTxPrice = mining.NewDynamicPriceReq(&mining.DynamicPriceReqConfig{
+			PriceReq:        cfg.minRelayTxPrice,
+			MinAmount:       cfg.relayFeeFloor,
+			MaxAmount:       cfg.relayFeeCeiling,
+			RefreshInterval: cfg.RelayFeeInterval,
+			EpochPrice:      s.chain.EpochPrice,
+		})
+	}
+
 	txC := mempool.Config{
 		Policy: mempool.Policy{
-			DisableRelayPriority: cfg.NoRelayPriority,
-			AcceptNonStd:         cfg.RelayNonStd,
-			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
-			MaxOrphanTxs:         cfg.MaxOrphanTxs,
-			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
-			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
-			MinRelayTxPrice:      cfg.minRelayTxFee,
-			MaxTxVersion:         2,
+			DisableRelayPriority:   cfg.NoRelayPriority,
+			AcceptNonStd:           cfg.RelayNonStd,
+			FreeTxRelayLimit:       cfg.FreeTxRelayLimit,
+			MaxOrphanTxs:           cfg.MaxOrphanTxs,
+			MaxOrphanTxSize:        defaultMaxOrphanTxSize,
+			MaxSigOpCostPerTx:      blockchain.MaxBlockSigOpsCost / 4,
+			MinRelayTxPrice:        cfg.minRelayTxPrice,
+			DynamicMinRelayTxPrice: relayTxPrice,
+			MaxTxVersion:           2,
+			MaxOrderAge:            cfg.MaxOrderAge,
+			MaxBookSize:            cfg.MaxBookSize,
+			MinPriceImprovement:    cfg.MinPriceImprovement,
 		},
 		ChainParams:    chainParams,
 		FetchUtxoView:  s.chain.FetchUtxoView,
@@ -2911,9 +3112,11 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		HashCache:          s.hashCache,
 		AddrIndex:          s.addrIndex,
 		FeeEstimator:       s.feeEstimator,
+		OnBookDelta:        s.notifyBookDelta,
 	}
 	s.txMemPool = mempool.New(&txC)
 	s.odrMemBook = mempool.NewMemBook(&txC)
+	s.loadOrderBook()
 
 	s.syncManager, err = netsync.New(&netsync.Config{
 		PeerNotifier:       &s,
@@ -2935,16 +3138,17 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	// NOTE: The CPU miner relies on the mempool, so the mempool has to be
 	// created before calling the function to create the CPU miner.
 	policy := mining.Policy{
-		BlockMinWeight:    cfg.BlockMinWeight,
-		BlockMaxWeight:    cfg.BlockMaxWeight,
-		BlockMinSize:      cfg.BlockMinSize,
-		BlockMaxSize:      cfg.BlockMaxSize,
-		BlockPrioritySize: cfg.BlockPrioritySize,
-		TxMinFreePrice:    cfg.minRelayTxFee,
+		BlockMinWeight:        cfg.BlockMinWeight,
+		BlockMaxWeight:        cfg.BlockMaxWeight,
+		BlockMinSize:          cfg.BlockMinSize,
+		BlockMaxSize:          cfg.BlockMaxSize,
+		BlockPrioritySize:     cfg.BlockPrioritySize,
+		TxMinFreePrice:        cfg.minRelayTxPrice,
+		DynamicTxMinFreePrice: relayTxPrice,
 	}
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy,
 		s.chainParams, s.odrMemBook, s.txMemPool, s.chain, s.timeSource,
-		s.priceSource, s.sigCache, s.hashCache)
+		s.priceFeed, s.sigCache, s.hashCache)
 	s.cpuMiner = cpuminer.New(&cpuminer.Config{
 		ChainParams:            chainParams,
 		BlockTemplateGenerator: blockTemplateGenerator,
@@ -3055,7 +3259,7 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			ConnMgr:      &rpcConnManager{&s},
 			SyncMgr:      &rpcSyncMgr{&s, s.syncManager},
 			TimeSource:   s.timeSource,
-			PriceSource:  s.priceSource,
+			PriceFeed:    s.priceFeed,
 			Chain:        s.chain,
 			ChainParams:  chainParams,
 			DB:           db,
@@ -3066,6 +3270,8 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			TxIndex:      s.txIndex,
 			AddrIndex:    s.addrIndex,
 			CfIndex:      s.cfIndex,
+			SupplyIndex:  s.supplyIndex,
+			BalanceIndex: s.balanceIndex,
 			FeeEstimator: s.feeEstimator,
 		})
 		if err != nil {
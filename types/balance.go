@@ -7,59 +7,127 @@ package types
 import (
 	"fmt"
 	"math/big"
+	"sort"
+	"strings"
 )
 
 // Balance contains all token amounts carried by an tx output.
-// Designed as map of Token => Amount, but currently be a struct of 2 fields for optimization.
+// Designed as map of Token => Amount, but the amounts of Token0 and Token1 are
+// fields for optimization, while the non-zero amounts of the other tokens are
+// kept in a slice sorted by token.  The slice is never modified in place but
+// replaced, so copies of a balance do not share their amounts.
 type Balance struct {
 	a0, a1 Amount
+	more   []Value
 }
 
 var (
 	BalanceEmpty = Balance{}
-	BalanceDummy = Balance{-1, -1}
-	BalanceMax   = Balance{MaxAtom, MaxAtom}
+	BalanceDummy = Balance{a0: -1, a1: -1}
+	BalanceMax   = Balance{a0: MaxAtom, a1: MaxAtom}
 )
 
 func NewBalance(a0, a1 Amount) *Balance {
-	return &Balance{a0, a1}
+	return &Balance{a0: a0, a1: a1}
 }
 
+// Map returns the amounts of the balance indexed by token, up to the greatest
+// token with a non-zero amount, and at least Token1.
 func (b Balance) Map() []Amount {
-	return []Amount{b.a0, b.a1}
+	size := int(Token1) + 1
+	if len(b.more) > 0 {
+		size = int(b.more[len(b.more)-1].Token) + 1
+	}
+	amounts := make([]Amount, size)
+	amounts[Token0] = b.a0
+	amounts[Token1] = b.a1
+	for _, v := range b.more {
+		amounts[v.Token] = v.Amount
+	}
+	return amounts
+}
+
+// moreIndex returns the index of the passed token in the amounts of the other
+// tokens, and whether or not it is there.
+func (b *Balance) moreIndex(token Token) (int, bool) {
+	i := sort.Search(len(b.more), func(i int) bool {
+		return b.more[i].Token >= token
+	})
+	return i, i < len(b.more) && b.more[i].Token == token
 }
 
 func (b Balance) Amount(token Token) Amount {
-	if token == Token0 {
+	switch token {
+	case Token0:
 		return b.a0
+	case Token1:
+		return b.a1
 	}
-	return b.a1
+	if i, ok := b.moreIndex(token); ok {
+		return b.more[i].Amount
+	}
+	return 0
 }
 
 func (b *Balance) SetAmount(token Token, amount Amount) {
-	if token == Token0 {
+	switch token {
+	case Token0:
 		b.a0 = amount
-	} else {
+		return
+	case Token1:
 		b.a1 = amount
+		return
+	}
+
+	// Replace the amounts of the other tokens, without the zero amounts.
+	i, ok := b.moreIndex(token)
+	more := make([]Value, 0, len(b.more)+1)
+	more = append(more, b.more[:i]...)
+	if amount != 0 {
+		more = append(more, Value{amount, token})
+	}
+	if ok {
+		i++
 	}
+	more = append(more, b.more[i:]...)
+	if len(more) == 0 {
+		more = nil
+	}
+	b.more = more
 }
 
-func (b *Balance) Value(token Token) Value {
-	if token == Token0 {
-		return Value{b.a0, Token0}
+// mapMore replaces the amounts of the other tokens with the results of the
+// passed function.
+func (b *Balance) mapMore(f func(Amount) Amount) {
+	if len(b.more) == 0 {
+		return
+	}
+	more := make([]Value, 0, len(b.more))
+	for _, v := range b.more {
+		if amount := f(v.Amount); amount != 0 {
+			more = append(more, Value{amount, v.Token})
+		}
 	}
-	return Value{b.a1, Token1}
+	if len(more) == 0 {
+		more = nil
+	}
+	b.more = more
+}
+
+func (b *Balance) Value(token Token) Value {
+	return Value{b.Amount(token), token}
 }
 
+// Values returns the non-zero values of the balance, ordered by token.
 func (b *Balance) Values() []Value {
-	values := make([]Value, 2)
+	values := make([]Value, 0, 2+len(b.more))
 	if b.a0 != 0 {
 		values = append(values, Value{b.a0, Token0})
 	}
 	if b.a1 != 0 {
 		values = append(values, Value{b.a1, Token1})
 	}
-	return values
+	return append(values, b.more...)
 }
 
 func (b *Balance) Fee() *Fee {
@@ -71,11 +139,18 @@ func (b *Balance) Price() *Price {
 }
 
 func (b *Balance) String() string {
-	return fmt.Sprintf("(%v,%v)", b.a0, b.a1)
+	if len(b.more) == 0 {
+		return fmt.Sprintf("(%v,%v)", b.a0, b.a1)
+	}
+	amounts := make([]string, 0, len(b.more))
+	for _, v := range b.more {
+		amounts = append(amounts, fmt.Sprintf("%v:%v", v.Token, v.Amount))
+	}
+	return fmt.Sprintf("(%v,%v,%s)", b.a0, b.a1, strings.Join(amounts, ","))
 }
 
 func (b *Balance) Clone() *Balance {
-	return &Balance{b.a0, b.a1}
+	return &Balance{b.a0, b.a1, b.more}
 }
 
 func (b *Balance) AddValue(v Value) *Balance {
@@ -85,7 +160,7 @@ func (b *Balance) AddValue(v Value) *Balance {
 	case Token1:
 		b.a1 += v.Amount
 	default:
-		panic(fmt.Sprintf("Unknown Token: %v", v.Token))
+		b.SetAmount(v.Token, b.Amount(v.Token)+v.Amount)
 	}
 	return b
 }
@@ -97,7 +172,7 @@ func (b *Balance) SubValue(v Value) *Balance {
 	case Token1:
 		b.a1 -= v.Amount
 	default:
-		panic(fmt.Sprintf("Unknown Token: %v", v.Token))
+		b.SetAmount(v.Token, b.Amount(v.Token)-v.Amount)
 	}
 	return b
 }
@@ -105,67 +180,83 @@ func (b *Balance) SubValue(v Value) *Balance {
 func (b *Balance) Add(c *Balance) *Balance {
 	b.a0 += c.a0
 	b.a1 += c.a1
+	for _, v := range c.more {
+		b.AddValue(v)
+	}
 	return b
 }
 
 func (b *Balance) Sub(c *Balance) *Balance {
 	b.a0 -= c.a0
 	b.a1 -= c.a1
+	for _, v := range c.more {
+		b.SubValue(v)
+	}
 	return b
 }
 
 func (b *Balance) Neg() *Balance {
 	b.a0 = -b.a0
 	b.a1 = -b.a1
+	b.mapMore(func(amount Amount) Amount { return -amount })
 	return b
 }
 
 func (b *Balance) Mul(a Amount) *Balance {
 	b.a0 *= a
 	b.a1 *= a
+	b.mapMore(func(amount Amount) Amount { return amount * a })
 	return b
 }
 
 func (b *Balance) Div(a Amount) *Balance {
 	b.a0 /= a
 	b.a1 /= a
+	b.mapMore(func(amount Amount) Amount { return amount / a })
 	return b
 }
 
+// rangeCheck returns 0 for an amount in its valid range, -1 for an amount lower
+// than the minimum, and 1 for an amount higher than the maximum.
+func rangeCheck(amount Amount) int {
+	if amount < 0 {
+		return -1
+	}
+	if amount > MaxAtom {
+		return 1
+	}
+	return 0
+}
+
 // RangeCheck checks whether the value is in it's valid range.
 // Returns 0 for a valid range, negative for lower than minimum,
 // and positive value for higher than maximum.
+// The amounts of the tokens other than Token0 and Token1 are only checked when
+// those are in range.
 func (b *Balance) RangeCheck() int {
-	var check int
-	if b.a0 < 0 {
-		check = -1
-	} else if b.a0 > MaxAtom {
-		check = 1
-	}
-	if b.a1 < 0 {
-		check += -2
-	} else if b.a1 > MaxAtom {
-		check += 2
+	check := rangeCheck(b.a0) + 2*rangeCheck(b.a1)
+	for _, v := range b.more {
+		if check != 0 {
+			break
+		}
+		check = 4 * rangeCheck(v.Amount)
 	}
 	return check
 }
 
+// addOverflows returns whether or not the addition of the passed amounts
+// overflows.
+func addOverflows(a, b Amount) bool {
+	result := a + b
+	return (b > 0 && result < a) || (b < 0 && result > a)
+}
+
 // SafeAdd perform Add with overflows check.
 func (b *Balance) SafeAdd(c *Balance) error {
-	if c.a0 != 0 {
-		result := b.a0 + c.a0
-		if (c.a0 > 0 && result < b.a0) ||
-			(c.a0 < 0 && result > b.a0) {
-			return fmt.Errorf("balances addition overflows		token: %v, a: %v, b: %v",
-				Token0, b.a0, c.a0)
-		}
-	}
-	if c.a1 != 0 {
-		result := b.a1 + c.a1
-		if (c.a1 > 0 && result < b.a1) ||
-			(c.a1 < 0 && result > b.a1) {
+	for _, v := range c.Values() {
+		if a := b.Amount(v.Token); addOverflows(a, v.Amount) {
 			return fmt.Errorf("balances addition overflows		token: %v, a: %v, b: %v",
-				Token1, b.a1, c.a1)
+				v.Token, a, v.Amount)
 		}
 	}
 	b.Add(c)
@@ -174,44 +265,119 @@ func (b *Balance) SafeAdd(c *Balance) error {
 
 // Cover returns b >= c
 func (b *Balance) Cover(c *Balance) bool {
-	return b.a0 >= c.a0 && b.a1 >= c.a1
+	if b.a0 < c.a0 || b.a1 < c.a1 {
+		return false
+	}
+	for _, v := range c.more {
+		if b.Amount(v.Token) < v.Amount {
+			return false
+		}
+	}
+	for _, v := range b.more {
+		if v.Amount < c.Amount(v.Token) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns b == c
+func (b *Balance) Equal(c *Balance) bool {
+	if b.a0 != c.a0 || b.a1 != c.a1 || len(b.more) != len(c.more) {
+		return false
+	}
+	for i, v := range b.more {
+		if c.more[i] != v {
+			return false
+		}
+	}
+	return true
 }
 
 func (b *Balance) Empty() bool {
-	return b.a0 == 0 && b.a1 == 0
+	return b.a0 == 0 && b.a1 == 0 && len(b.more) == 0
 }
 
 func (b Balance) Big() *BalanceBig {
 	var bb BalanceBig
-	bb.a0.SetUint64(uint64(b.a0))
-	bb.a1.SetUint64(uint64(b.a1))
+	bb.a0.SetInt64(int64(b.a0))
+	bb.a1.SetInt64(int64(b.a1))
+	for _, v := range b.more {
+		bb.amount(v.Token).SetInt64(int64(v.Amount))
+	}
 	return &bb
 }
 
 // BalanceBig is balance of big.Int
 type BalanceBig struct {
 	a0, a1 big.Int
+	more   map[Token]*big.Int
 }
 
 var (
 	BalanceBigEmtpy = BalanceBig{}
 )
 
+// amount returns the amount of the passed token, which is added to the
+// balance when it is not there.
+func (b *BalanceBig) amount(token Token) *big.Int {
+	switch token {
+	case Token0:
+		return &b.a0
+	case Token1:
+		return &b.a1
+	}
+	if b.more == nil {
+		b.more = make(map[Token]*big.Int)
+	}
+	amount, ok := b.more[token]
+	if !ok {
+		amount = new(big.Int)
+		b.more[token] = amount
+	}
+	return amount
+}
+
+// Amount returns a copy of the amount of the passed token.
+func (b *BalanceBig) Amount(token Token) *big.Int {
+	switch token {
+	case Token0:
+		return new(big.Int).Set(&b.a0)
+	case Token1:
+		return new(big.Int).Set(&b.a1)
+	}
+	if amount, ok := b.more[token]; ok {
+		return new(big.Int).Set(amount)
+	}
+	return new(big.Int)
+}
+
 func (b *BalanceBig) Clone() *BalanceBig {
 	var bb BalanceBig
 	bb.a0.Set(&b.a0)
 	bb.a1.Set(&b.a1)
+	for token, amount := range b.more {
+		bb.amount(token).Set(amount)
+	}
 	return &bb
 }
 
 func (b *BalanceBig) Add(bb *BalanceBig) *BalanceBig {
 	b.a0.Add(&b.a0, &bb.a0)
 	b.a1.Add(&b.a1, &bb.a1)
+	for token, amount := range bb.more {
+		a := b.amount(token)
+		a.Add(a, amount)
+	}
 	return b
 }
 
 func (b *BalanceBig) Sub(bb *BalanceBig) *BalanceBig {
 	b.a0.Sub(&b.a0, &bb.a0)
 	b.a1.Sub(&b.a1, &bb.a1)
+	for token, amount := range bb.more {
+		a := b.amount(token)
+		a.Sub(a, amount)
+	}
 	return b
 }
@@ -0,0 +1,132 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestBalanceTokens ensures the balances handle the tokens other than Token0
+// and Token1 the way they handle those.
+func TestBalanceTokens(t *testing.T) {
+	token2, token3 := Token(2), Token(3)
+
+	b := NewBalance(10, 20)
+	b.AddValue(Value{30, token3})
+	b.AddValue(Value{40, token2})
+	b.SubValue(Value{5, token2})
+	wantValues := []Value{{10, Token0}, {20, Token1}, {35, token2},
+		{30, token3}}
+	if values := b.Values(); !reflect.DeepEqual(values, wantValues) {
+		t.Fatalf("Values: got %v, want %v", values, wantValues)
+	}
+	wantMap := []Amount{10, 20, 35, 30}
+	if amounts := b.Map(); !reflect.DeepEqual(amounts, wantMap) {
+		t.Fatalf("Map: got %v, want %v", amounts, wantMap)
+	}
+
+	// A copy of the balance does not change with it.
+	c := *b
+	b.SetAmount(token3, 0)
+	b.Mul(2)
+	if b.Amount(token2) != 70 || b.Amount(token3) != 0 ||
+		c.Amount(token2) != 35 || c.Amount(token3) != 30 {
+
+		t.Fatalf("SetAmount: got balances %v and copy %v", b, &c)
+	}
+
+	// Zero amounts are dropped, so the balances are equal and empty
+	// regardless of the tokens they once carried.
+	b.Sub(NewBalance(20, 40)).SubValue(Value{70, token2})
+	if !b.Empty() || !b.Equal(&BalanceEmpty) {
+		t.Fatalf("Empty: got balance %v, want an empty one", b)
+	}
+
+	if !c.Cover(NewBalance(10, 20)) || c.Clone().Neg().Cover(&BalanceEmpty) {
+		t.Fatalf("Cover: got unexpected coverage of %v", &c)
+	}
+	negative := NewBalance(10, 20).SubValue(Value{1, token3})
+	if c.Cover(negative.Clone().AddValue(Value{32, token3})) ||
+		!c.Cover(negative) || negative.Cover(&BalanceEmpty) {
+
+		t.Fatalf("Cover: got unexpected coverage of %v", negative)
+	}
+
+	if check := negative.RangeCheck(); check >= 0 {
+		t.Fatalf("RangeCheck: got %d for %v, want negative", check,
+			negative)
+	}
+	max := NewBalance(0, 0).AddValue(Value{MaxAtom + 1, token2})
+	if check := max.RangeCheck(); check <= 0 {
+		t.Fatalf("RangeCheck: got %d for %v, want positive", check, max)
+	}
+
+	overflow := NewBalance(0, 0).AddValue(Value{1<<63 - 1, token2})
+	if err := overflow.SafeAdd(&c); err == nil {
+		t.Fatalf("SafeAdd: got no error adding %v to %v", &c, overflow)
+	}
+	if err := c.SafeAdd(&c); err != nil || c.Amount(token3) != 60 {
+		t.Fatalf("SafeAdd: got %v, %v", &c, err)
+	}
+}
+
+// TestPriceRateTokens ensures the price rate accounts for the price of every
+// token the price requirement accepts.
+func TestPriceRateTokens(t *testing.T) {
+	token2 := Token(2)
+
+	req := NewPriceReq(100, 0)
+	req.Balance().SetAmount(token2, 50)
+	price := NewBalance(50, 1000)
+	price.SetAmount(token2, 25)
+	if rate := price.Price().Rate(*req); rate != 1 {
+		t.Fatalf("Rate: got %v, want 1", rate)
+	}
+
+	coins := req.ToCoinPriceReq()
+	if back := coins.ToPriceReq(); !back.Balance().Equal(req.Balance()) {
+		t.Fatalf("ToPriceReq: got %v, want %v", back.Balance(),
+			req.Balance())
+	}
+}
+
+// TestRegisterToken ensures the tokens are registered with unique names.
+func TestRegisterToken(t *testing.T) {
+	token := Token(0x7f)
+	if token.IsRegistered() || token.String() != "UnknownToken" {
+		t.Fatalf("token %d is unexpectedly registered", token)
+	}
+	if err := RegisterToken(token, "TEST"); err != nil {
+		t.Fatalf("RegisterToken: unexpected error: %v", err)
+	}
+	if err := RegisterToken(token, "TEST"); err != nil {
+		t.Fatalf("RegisterToken: unexpected error registering again: %v",
+			err)
+	}
+	if found, ok := TokenByName("TEST"); !ok || found != token ||
+		token.String() != "TEST" {
+
+		t.Fatalf("TokenByName: got %v, %v, want %v", found, ok, token)
+	}
+
+	tests := []struct {
+		token Token
+		name  string
+		err   error
+	}{
+		{token, "OTHER", ErrDuplicateToken},
+		{Token(0x7e), "TEST", ErrDuplicateToken},
+		{Token1, "USD", ErrDuplicateToken},
+		{TokenInvalid, "INVALID", ErrInvalidToken},
+		{Token(0x7e), "", ErrInvalidToken},
+	}
+	for i, test := range tests {
+		if err := RegisterToken(test.token, test.name); err != test.err {
+			t.Errorf("RegisterToken #%d: got error %v, want %v", i,
+				err, test.err)
+		}
+	}
+}
@@ -10,7 +10,7 @@ type Fee Balance
 
 var (
 	FeeEmpty = Fee{}
-	FeeDummy = Fee{-1, -1}
+	FeeDummy = Fee(BalanceDummy)
 )
 
 func (f *Fee) Balance() *Balance {
@@ -29,6 +29,10 @@ func (f *Fee) Add(g *Fee) *Fee {
 // Price.a(i) = Tx.Fee.a(i) / Tx.SizeInKB
 type Price Balance
 
+func (p *Price) Balance() *Balance {
+	return (*Balance)(p)
+}
+
 // PriceReq is the miner-configured price rate accepted for each tokens.
 // The fundametal different between PriceReq and Price/Fee/Balance is that PriceReq's
 // amounts are not accumulated. The price is required to be PriceReq.a0 of Token0, OR
@@ -41,7 +45,7 @@ type Price Balance
 type PriceReq Price
 
 func NewPriceReq(a0, a1 Amount) *PriceReq {
-	return &PriceReq{a0, a1}
+	return &PriceReq{a0: a0, a1: a1}
 }
 
 func (p *PriceReq) Balance() *Balance {
@@ -58,6 +62,12 @@ func (p Price) Rate(r PriceReq) (rate float64) {
 	if r.a1 > 0 {
 		rate += float64(p.a1) / float64(r.a1)
 	}
+	for _, v := range r.more {
+		if v.Amount > 0 {
+			amount := (*Balance)(&p).Amount(v.Token)
+			rate += float64(amount) / float64(v.Amount)
+		}
+	}
 	return rate
 }
 
@@ -65,17 +75,28 @@ func (b PriceReq) ToCoinPriceReq() CoinPriceReq {
 	var bc CoinPriceReq
 	bc.a0 = b.a0.ToCoin()
 	bc.a1 = b.a1.ToCoin()
+	for _, v := range b.more {
+		if bc.more == nil {
+			bc.more = make(map[Token]float64, len(b.more))
+		}
+		bc.more[v.Token] = v.Amount.ToCoin()
+	}
 	return bc
 }
 
 // CoinPriceReq is balance of float64
 type CoinPriceReq struct {
 	a0, a1 float64
+	more   map[Token]float64
 }
 
 func (bc CoinPriceReq) ToPriceReq() PriceReq {
 	var b PriceReq
 	b.a0, _ = NewAmount(bc.a0)
 	b.a1, _ = NewAmount(bc.a1)
+	for token, coin := range bc.more {
+		amount, _ := NewAmount(coin)
+		b.Balance().SetAmount(token, amount)
+	}
 	return b
 }
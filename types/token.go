@@ -4,6 +4,10 @@
 
 package types
 
+import (
+	"errors"
+)
+
 type Token uint8
 
 const (
@@ -13,13 +17,64 @@ const (
 	TokenInvalid = Token(0xFF)
 )
 
+var (
+	// ErrDuplicateToken describes an error where a token could not be
+	// registered due to the token or its name being already registered
+	// with another name or token.
+	ErrDuplicateToken = errors.New("duplicate token")
+
+	// ErrInvalidToken describes an error where TokenInvalid or a token
+	// without a name is registered.
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// tokenNames and tokensByName are the registered tokens and their names.  The
+// native tokens are always registered.
+var (
+	tokenNames   = map[Token]string{Token0: "NDR", Token1: "STB"}
+	tokensByName = map[string]Token{"NDR": Token0, "STB": Token1}
+)
+
+// RegisterToken registers the name of a token.  This may error with
+// ErrDuplicateToken if the token or the name is already registered with
+// another name or token, while registering the same token with the same name
+// again has no effect.
+//
+// Tokens are registered along with the network parameters which carry them, so
+// they should be registered as early as possible, and this function is NOT
+// safe for concurrent access with the lookups of the tokens.
+func RegisterToken(token Token, name string) error {
+	if token == TokenInvalid || name == "" {
+		return ErrInvalidToken
+	}
+	registered, ok := tokenNames[token]
+	if ok && registered == name {
+		return nil
+	}
+	if _, nameTaken := tokensByName[name]; ok || nameTaken {
+		return ErrDuplicateToken
+	}
+	tokenNames[token] = name
+	tokensByName[name] = token
+	return nil
+}
+
+// IsRegistered returns whether or not the token is registered on any network.
+func (t Token) IsRegistered() bool {
+	_, ok := tokenNames[t]
+	return ok
+}
+
+// TokenByName returns the registered token with the passed name, and whether
+// or not there is one.
+func TokenByName(name string) (Token, bool) {
+	token, ok := tokensByName[name]
+	return token, ok
+}
+
 func (t Token) String() string {
-	switch t {
-	case Token0:
-		return "NDR"
-	case Token1:
-		return "STB"
-	default:
-		return "UnknownToken"
+	if name, ok := tokenNames[t]; ok {
+		return name
 	}
+	return "UnknownToken"
 }
@@ -8,6 +8,7 @@ package wire
 import (
 	"bytes"
 	"io"
+	"math"
 	"time"
 
 	"github.com/endurio/ndrd/chainec"
@@ -21,6 +22,16 @@ import (
 // PrevBlock and MerkleRoot hashes.
 var MaxBlockHeaderPayload = 16 + 8 + (chainhash.HashSize * 2) + chainec.CompactSignatureSize
 
+const (
+	// PriceDerivationUnit is the fixed-point unit of the price derivation
+	// of a block header, which is carried in parts per billion.
+	PriceDerivationUnit = 1000000000
+
+	// NoPriceDerivation is the price derivation of a block header which
+	// does not provide a price.
+	NoPriceDerivation = math.MinInt64
+)
+
 // BlockHeader defines information about a block and is used in the bitcoin
 // block (MsgBlock) and headers (MsgHeaders) messages.
 type BlockHeader struct {
@@ -43,10 +54,14 @@ type BlockHeader struct {
 	// Nonce used to generate the block.
 	Nonce uint32
 
-	// Price derivation of STB/USD from 1.0.
-	// For market price of STB/USD is 1.0 + x, PriceDerivation = x is fed.
-	// math.NaN() is fed for no value provided.
-	PriceDerivation float64
+	// Price derivation of STB/USD from 1.0 in units of
+	// PriceDerivationUnit.  For market price of STB/USD is 1.0 + x,
+	// PriceDerivation = x * PriceDerivationUnit is fed.
+	// NoPriceDerivation is fed for no value provided.
+	//
+	// NOTE: Blocks below the FixedPointPriceHeight of their chain carry
+	// the bits of a float64 price derivation instead.
+	PriceDerivation int64
 
 	// Miner's signature for all data above in compact format.
 	// PK recovered from this must be the same with coinbase address,
@@ -136,7 +151,7 @@ func (h *BlockHeader) Serialize(w io.Writer) error {
 // block hash, merkle root hash, difficulty bits, and nonce used to generate the
 // block with defaults for the remaining fields.
 func NewBlockHeader(version int32, prevHash, merkleRootHash *chainhash.Hash,
-	bits uint32, nonce uint32, priceDerivation float64, signature *chainec.CompactSignature) *BlockHeader {
+	bits uint32, nonce uint32, priceDerivation int64, signature *chainec.CompactSignature) *BlockHeader {
 
 	// Limit the timestamp to one second precision since the protocol
 	// doesn't support better.
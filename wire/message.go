@@ -40,6 +40,7 @@ const (
 	CmdBlock        = "block"
 	CmdTx           = "tx"
 	CmdOdr          = "odr"
+	CmdCancelOdr    = "cancelodr"
 	CmdGetHeaders   = "getheaders"
 	CmdHeaders      = "headers"
 	CmdPing         = "ping"
@@ -129,6 +130,9 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdOdr:
 		msg = &MsgOdr{}
 
+	case CmdCancelOdr:
+		msg = &MsgCancelOdr{}
+
 	case CmdPing:
 		msg = &MsgPing{}
 
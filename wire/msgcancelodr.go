@@ -0,0 +1,165 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+)
+
+const (
+	// CancelOdrSignatureSize is the size of a compact signature of a
+	// cancel order message.
+	CancelOdrSignatureSize = 65
+
+	// cancelOdrMagic is prepended to the order hash before it is hashed
+	// and signed, so a cancel signature can never be mistaken for the
+	// signature of a transaction or of a signed message.
+	cancelOdrMagic = "Endurio Cancel Order:\n"
+)
+
+// MaxCancelOdrSignatures is the maximum number of signatures allowed in a
+// cancel order message, one for each input of the cancelled order.
+const MaxCancelOdrSignatures = (MaxMessagePayload - chainhash.HashSize -
+	MaxVarIntPayload) / (CancelOdrSignatureSize + 1)
+
+// MsgCancelOdr implements the Message interface and represents a cancelodr
+// message.  It is used to withdraw an order from the order books of the
+// network without spending its inputs on-chain.
+//
+// The message proves control of the inputs of the order with one compact
+// signature for each of them, in the order of the inputs, over the hash
+// returned by SigHash.
+//
+// This message was not added until protocol version CancelOdrVersion.
+type MsgCancelOdr struct {
+	OdrHash    chainhash.Hash
+	Signatures [][]byte
+}
+
+// AddSignature adds the compact signature of the next input of the order.
+func (msg *MsgCancelOdr) AddSignature(sig []byte) error {
+	if len(msg.Signatures)+1 > MaxCancelOdrSignatures {
+		str := fmt.Sprintf("too many signatures in message [max %v]",
+			MaxCancelOdrSignatures)
+		return messageError("MsgCancelOdr.AddSignature", str)
+	}
+
+	msg.Signatures = append(msg.Signatures, sig)
+	return nil
+}
+
+// SigHash returns the hash the inputs of the order are signed over to cancel
+// it.
+func (msg *MsgCancelOdr) SigHash() []byte {
+	var buf bytes.Buffer
+	WriteVarString(&buf, 0, cancelOdrMagic)
+	buf.Write(msg.OdrHash[:])
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCancelOdr) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < CancelOdrVersion {
+		str := fmt.Sprintf("cancelodr message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCancelOdr.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.OdrHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max signatures per message.
+	if count > MaxCancelOdrSignatures {
+		str := fmt.Sprintf("too many signatures for message "+
+			"[count %v, max %v]", count, MaxCancelOdrSignatures)
+		return messageError("MsgCancelOdr.BtcDecode", str)
+	}
+
+	msg.Signatures = make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		sig, err := ReadVarBytes(r, pver, CancelOdrSignatureSize,
+			"cancel order signature")
+		if err != nil {
+			return err
+		}
+		msg.Signatures = append(msg.Signatures, sig)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCancelOdr) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < CancelOdrVersion {
+		str := fmt.Sprintf("cancelodr message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCancelOdr.BtcEncode", str)
+	}
+
+	// Limit to max signatures per message.
+	count := len(msg.Signatures)
+	if count > MaxCancelOdrSignatures {
+		str := fmt.Sprintf("too many signatures for message "+
+			"[count %v, max %v]", count, MaxCancelOdrSignatures)
+		return messageError("MsgCancelOdr.BtcEncode", str)
+	}
+
+	err := writeElement(w, &msg.OdrHash)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+
+	for _, sig := range msg.Signatures {
+		if len(sig) > CancelOdrSignatureSize {
+			str := fmt.Sprintf("signature is too large [size %v, "+
+				"max %v]", len(sig), CancelOdrSignatureSize)
+			return messageError("MsgCancelOdr.BtcEncode", str)
+		}
+		err = WriteVarBytes(w, pver, sig)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCancelOdr) Command() string {
+	return CmdCancelOdr
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCancelOdr) MaxPayloadLength(pver uint32) uint32 {
+	return MaxMessagePayload
+}
+
+// NewMsgCancelOdr returns a new cancelodr message that conforms to the
+// Message interface for the passed order hash.  See MsgCancelOdr for details.
+func NewMsgCancelOdr(odrHash *chainhash.Hash) *MsgCancelOdr {
+	return &MsgCancelOdr{
+		OdrHash: *odrHash,
+	}
+}
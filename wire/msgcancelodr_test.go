@@ -0,0 +1,141 @@
+// Copyright (c) 2018-2019 The Endurio developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/endurio/ndrd/chaincfg/chainhash"
+)
+
+// cancelOdrHash and otherOdrHash are order hashes used by the cancel order
+// message tests.
+var (
+	cancelOdrHash = chainhash.DoubleHashH([]byte("order"))
+	otherOdrHash  = chainhash.DoubleHashH([]byte("other order"))
+)
+
+// TestCancelOdr tests the MsgCancelOdr API against the latest protocol version.
+func TestCancelOdr(t *testing.T) {
+	pver := ProtocolVersion
+
+	msg := NewMsgCancelOdr(&cancelOdrHash)
+	if msg.OdrHash != cancelOdrHash {
+		t.Errorf("NewMsgCancelOdr: wrong order hash - got %v, want %v",
+			msg.OdrHash, cancelOdrHash)
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "cancelodr"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgCancelOdr: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure the signature hash commits to the order hash.
+	sigHash := msg.SigHash()
+	other := NewMsgCancelOdr(&otherOdrHash)
+	if bytes.Equal(sigHash, other.SigHash()) {
+		t.Error("SigHash: same hash for different orders")
+	}
+
+	for i := 0; i < 2; i++ {
+		sig := bytes.Repeat([]byte{byte(i + 1)}, CancelOdrSignatureSize)
+		if err := msg.AddSignature(sig); err != nil {
+			t.Fatalf("AddSignature: %v", err)
+		}
+	}
+
+	// Test encode with latest protocol version.
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, pver, BaseEncoding)
+	if err != nil {
+		t.Fatalf("encode of MsgCancelOdr failed %v err <%v>", msg, err)
+	}
+	wantLen := 32 + 1 + 2*(1+CancelOdrSignatureSize)
+	if buf.Len() != wantLen {
+		t.Errorf("encode of MsgCancelOdr: got %d bytes, want %d",
+			buf.Len(), wantLen)
+	}
+
+	// Test decode with latest protocol version.
+	var readmsg MsgCancelOdr
+	err = readmsg.BtcDecode(&buf, pver, BaseEncoding)
+	if err != nil {
+		t.Fatalf("decode of MsgCancelOdr failed [%v] err <%v>", buf, err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Errorf("BtcDecode: got %v, want %v", spew.Sdump(&readmsg),
+			spew.Sdump(msg))
+	}
+
+	// Signatures larger than a compact signature must be rejected.
+	msg.Signatures[0] = append(msg.Signatures[0], 0)
+	buf.Reset()
+	if err := msg.BtcEncode(&buf, pver, BaseEncoding); err == nil {
+		t.Error("BtcEncode: oversized signature was accepted")
+	}
+}
+
+// TestCancelOdrWireErrors performs negative tests against wire encode and
+// decode of MsgCancelOdr to confirm error paths work correctly.
+func TestCancelOdrWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	pverNoCancelOdr := CancelOdrVersion - 1
+	wireErr := &MessageError{}
+
+	baseCancelOdr := NewMsgCancelOdr(&cancelOdrHash)
+	baseCancelOdr.AddSignature([]byte{0x01, 0x02})
+	baseCancelOdrEncoded := append(cancelOdrHash.CloneBytes(),
+		0x01, // Varint for number of signatures
+		0x02, // Varint for signature length
+		0x01, 0x02,
+	)
+
+	tests := []struct {
+		in       *MsgCancelOdr // Value to encode
+		buf      []byte        // Wire encoding
+		pver     uint32        // Protocol version for wire encoding
+		max      int           // Max size of fixed buffer to induce errors
+		writeErr error         // Expected write error
+		readErr  error         // Expected read error
+	}{
+		// Latest protocol version with intentional read/write errors.
+		// Force error in order hash.
+		{baseCancelOdr, baseCancelOdrEncoded, pver, 0, io.ErrShortWrite, io.ErrUnexpectedEOF},
+		// Force error in signature count.
+		{baseCancelOdr, baseCancelOdrEncoded, pver, 32, io.ErrShortWrite, io.ErrUnexpectedEOF},
+		// Force error in signature.
+		{baseCancelOdr, baseCancelOdrEncoded, pver, 33, io.ErrShortWrite, io.ErrUnexpectedEOF},
+		// Force error due to unsupported protocol version.
+		{baseCancelOdr, baseCancelOdrEncoded, pverNoCancelOdr, 4, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.BtcEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// Decode from wire format.
+		var msg MsgCancelOdr
+		r := newFixedReader(test.max, test.buf)
+		err = msg.BtcDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+	}
+}
@@ -65,8 +65,8 @@ const (
 	maxTxInPerMessage = (MaxMessagePayload / minTxInPayload) + 1
 
 	// MinTxOutPayload is the minimum payload size for a transaction output.
-	// Value 8 bytes + Varint for PkScript length 1 byte.
-	MinTxOutPayload = 9
+	// Value 8 bytes + Token 1 byte + Varint for PkScript length 1 byte.
+	MinTxOutPayload = 10
 
 	// maxTxOutPerMessage is the maximum number of transactions outputs that
 	// a transaction which fits into a message could possibly have.
@@ -268,9 +268,9 @@ type TxOut struct {
 // SerializeSize returns the number of bytes it would take to serialize the
 // the transaction output.
 func (t *TxOut) SerializeSize() int {
-	// Value 8 bytes + serialized varint size for the length of PkScript +
-	// PkScript bytes.
-	return 8 + VarIntSerializeSize(uint64(len(t.PkScript))) + len(t.PkScript)
+	// Value 8 bytes + Token 1 byte + serialized varint size for the length
+	// of PkScript + PkScript bytes.
+	return 9 + VarIntSerializeSize(uint64(len(t.PkScript))) + len(t.PkScript)
 }
 
 // NewTxOut returns a new bitcoin transaction output with the provided
@@ -892,9 +892,9 @@ func (msg *MsgTx) PkScriptLocs() []int {
 	for i, txOut := range msg.TxOut {
 		// The offset of the script in the transaction output is:
 		//
-		// Value 8 bytes + serialized varint size for the length of
-		// PkScript.
-		n += 8 + VarIntSerializeSize(uint64(len(txOut.PkScript)))
+		// Value 8 bytes + Token 1 byte + serialized varint size for the
+		// length of PkScript.
+		n += 9 + VarIntSerializeSize(uint64(len(txOut.PkScript)))
 		pkScriptLocs[i] = n
 		n += len(txOut.PkScript)
 	}
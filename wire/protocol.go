@@ -14,7 +14,7 @@ import (
 // XXX pedro: we will probably need to bump this.
 const (
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 70013
+	ProtocolVersion uint32 = 70014
 
 	// MultipleAddressVersion is the protocol version which added multiple
 	// addresses per message (pver >= MultipleAddressVersion).
@@ -52,6 +52,10 @@ const (
 	// FeeFilterVersion is the protocol version which added a new
 	// feefilter message.
 	FeeFilterVersion uint32 = 70013
+
+	// CancelOdrVersion is the protocol version which added a new
+	// cancelodr message.
+	CancelOdrVersion uint32 = 70014
 )
 
 // ServiceFlag identifies services supported by a bitcoin peer.